@@ -30,7 +30,10 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
+	"github.com/aws/amazon-ecs-agent/agent/health"
 	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/recorder"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	utilatomic "github.com/aws/amazon-ecs-agent/agent/utils/atomic"
@@ -60,6 +63,10 @@ const payloadMessageBufferSize = 10
 // the last sequence number successfully handled.
 var SequenceNumber = utilatomic.NewIncreasingInt64(1)
 
+// ConnectionStatus tracks the state of the connection to ACS for health
+// reporting.
+var ConnectionStatus = health.NewConnectionTracker()
+
 // StartSessionArguments is a struct representing all the things this handler
 // needs... This is really a hack to get by-name instead of positional
 // arguments since there are too many for positional to be wieldy
@@ -71,6 +78,8 @@ type StartSessionArguments struct {
 	ECSClient            api.ECSClient
 	StateManager         statemanager.StateManager
 	AcceptInvalidCert    bool
+	// Recorder, if set, records the messages received from and sent to ACS.
+	Recorder *recorder.Recorder
 }
 
 // StartSession creates a session with ACS and handles requests using the passed
@@ -107,7 +116,7 @@ func StartSession(ctx context.Context, args StartSessionArguments) error {
 			url := AcsWsUrl(acsEndpoint, cfg.Cluster, args.ContainerInstanceArn, args.TaskEngine)
 
 			clearStrChannel(ackBuffer)
-			client := acsclient.New(url, cfg.AWSRegion, args.CredentialProvider, args.AcceptInvalidCert)
+			client := recorder.NewACSClientServer(acsclient.New(url, cfg.AWSRegion, args.CredentialProvider, args.AcceptInvalidCert), args.Recorder)
 			defer client.Close()
 			// Clear the ackbuffer whenever we get a new client because acks of
 			// messageids don't have any value across sessions
@@ -134,6 +143,9 @@ func StartSession(ctx context.Context, args StartSessionArguments) error {
 				log.Error("Error connecting to ACS: " + err.Error())
 				return err
 			}
+			ConnectionStatus.Connected()
+			metrics.BackendConnections.Inc("acs")
+			defer ConnectionStatus.Disconnected()
 			ttime.AfterFunc(utils.AddJitter(heartbeatTimeout, heartbeatJitter), func() {
 				// If we do not have an error connecting and remain connected for at
 				// least 5 or so minutes, reset the backoff. This prevents disconnect
@@ -179,6 +191,7 @@ func StartSession(ctx context.Context, args StartSessionArguments) error {
 func anyMessageHandler(timer ttime.Timer) func(interface{}) {
 	return func(interface{}) {
 		log.Debug("ACS activity occured")
+		ConnectionStatus.MessageReceived()
 		timer.Reset(utils.AddJitter(heartbeatTimeout, heartbeatJitter))
 	}
 }
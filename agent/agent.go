@@ -16,6 +16,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	mathrand "math/rand"
 	"os"
 	"runtime"
@@ -28,11 +29,15 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
 	"github.com/aws/amazon-ecs-agent/agent/handlers"
+	"github.com/aws/amazon-ecs-agent/agent/health"
 	"github.com/aws/amazon-ecs-agent/agent/httpclient"
 	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/recorder"
 	"github.com/aws/amazon-ecs-agent/agent/sighandlers"
 	"github.com/aws/amazon-ecs-agent/agent/sighandlers/exitcodes"
+	"github.com/aws/amazon-ecs-agent/agent/standalone"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager"
+	"github.com/aws/amazon-ecs-agent/agent/stats"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/handler"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	utilatomic "github.com/aws/amazon-ecs-agent/agent/utils/atomic"
@@ -43,6 +48,17 @@ import (
 	"golang.org/x/net/context"
 )
 
+const (
+	// backendConnectionMaxIdle is how long the ACS or TCS connection may go
+	// without a message before it is reported as unhealthy. It is the longest
+	// either session handler waits for a heartbeat before reconnecting.
+	backendConnectionMaxIdle = 8 * time.Minute
+
+	// maxPendingStateChanges is the number of queued, unsubmitted state
+	// changes above which the agent is reported as unhealthy.
+	maxPendingStateChanges = 100
+)
+
 func init() {
 	runtime.GOMAXPROCS(1)
 	mathrand.Seed(time.Now().UnixNano())
@@ -61,6 +77,8 @@ func _main() int {
 	acceptInsecureCert := flagset.Bool("k", false, "Disable SSL certificate verification. We do not recommend setting this option.")
 	licenseFlag := flagset.Bool("license", false, "Print the LICENSE and NOTICE files and exit")
 	blackholeEc2Metadata := flagset.Bool("blackhole-ec2-metadata", false, "Blackhole the EC2 Metadata requests. Setting this option can cause the ECS Agent to fail to work properly.  We do not recommend setting this option")
+	printConfig := flagset.Bool("print-config", false, "Print the effective config with the source of every value, with secrets redacted, and exit")
+	checkConfig := flagset.Bool("check-config", false, "Check that every config value can be used, as in strict mode, and exit")
 	err := flagset.Parse(os.Args[1:])
 	if err != nil {
 		return exitcodes.ExitTerminal
@@ -88,7 +106,20 @@ func _main() int {
 		log.Warn("SSL certificate verification disabled. This is not recommended.")
 	}
 	log.Info("Loading configuration")
-	cfg, err := config.NewConfig(ec2MetadataClient)
+	var cfg *config.Config
+	if *checkConfig {
+		cfg, err = config.NewStrictConfig(ec2MetadataClient)
+	} else {
+		cfg, err = config.NewConfig(ec2MetadataClient)
+	}
+	if *printConfig || *checkConfig {
+		return reportConfig(cfg, err, *printConfig)
+	}
+	// The log file and level can be set in env files too
+	logger.SetLogfile(os.Getenv(logger.LOGFILE_ENV_VAR))
+	if *logLevel == "" {
+		logger.SetLevel(os.Getenv(logger.LOGLEVEL_ENV_VAR))
+	}
 	// Load cfg before doing 'versionFlag' so that it has the DOCKER_HOST
 	// variable loaded if needed
 	if *versionFlag {
@@ -106,11 +137,30 @@ func _main() int {
 		return exitcodes.ExitError
 	}
 	log.Debug("Loaded config: " + cfg.String())
+	// What reads reloadable settings while the agent runs, other than the
+	// task engine, reads them from cfgHolder
+	cfgHolder := config.NewHolder(cfg)
+	loadedCfg := *cfg
+	reloader := &sighandlers.ConfigReloader{
+		Config: cfgHolder,
+		Loaded: &loadedCfg,
+		Load: func() (*config.Config, error) {
+			return config.NewConfig(ec2MetadataClient)
+		},
+		LogLevel: *logLevel,
+	}
 
 	var currentEc2InstanceID, containerInstanceArn string
 	var taskEngine engine.TaskEngine
 
 	if cfg.Checkpoint {
+		dataDirLock, err := statemanager.LockDataDir(cfg.DataDir)
+		if err != nil {
+			log.Criticalf("Error locking the data dir: %v", err)
+			return exitcodes.ExitTerminal
+		}
+		defer dataDirLock.Unlock()
+
 		log.Info("Checkpointing is enabled. Attempting to load state")
 		var previousCluster, previousEc2InstanceID, previousContainerInstanceArn string
 		previousTaskEngine := engine.NewTaskEngine(cfg, *acceptInsecureCert)
@@ -123,6 +173,10 @@ func _main() int {
 		}
 
 		err = previousState.Load()
+		if closer, ok := previousState.(io.Closer); ok {
+			// The state manager saving from here on opens the database again
+			closer.Close()
+		}
 		if err != nil {
 			log.Criticalf("Error loading previously saved state: %v", err)
 			return exitcodes.ExitTerminal
@@ -170,7 +224,22 @@ func _main() int {
 		return exitcodes.ExitTerminal
 	}
 
+	interactionRecorder := newRecorder(cfg)
+	taskEngine.SetRecorder(interactionRecorder)
+
+	// Agent introspection api. It is started before registration so that the
+	// health and readiness endpoints can be polled while the agent comes up;
+	// registration publishes the container instance arn to it once known.
+	publishedContainerInstanceArn := utilatomic.NewString(containerInstanceArn)
+	healthChecker := newHealthChecker(cfg, taskEngine, stateManager, publishedContainerInstanceArn)
+	go handlers.ServeHttp(publishedContainerInstanceArn, taskEngine, cfgHolder, healthChecker, stats.NewDockerStatsEngine(cfg))
+
+	if cfg.StandaloneTaskDir != "" {
+		return runStandalone(ctx, cfg, taskEngine, stateManager, reloader)
+	}
+
 	capabilities := taskEngine.Capabilities()
+	hostAttributes := taskEngine.HostAttributes()
 
 	// We instantiate our own credentialProvider for use in acs/tcs. This tries
 	// to mimic roughly the way it's instantiated by the SDK for a default
@@ -180,11 +249,11 @@ func _main() int {
 	if preflightCreds, err := credentialProvider.Get(); err != nil || preflightCreds.AccessKeyID == "" {
 		log.Warnf("Error getting valid credentials (AKID %v): %v", preflightCreds.AccessKeyID, err)
 	}
-	client := api.NewECSClient(credentialProvider, cfg, httpclient.New(api.RoundtripTimeout, *acceptInsecureCert), ec2MetadataClient)
+	client := api.NewECSClient(credentialProvider, cfgHolder, httpclient.New(api.RoundtripTimeout, *acceptInsecureCert), ec2MetadataClient)
 
 	if containerInstanceArn == "" {
 		log.Info("Registering Instance with ECS")
-		containerInstanceArn, err = client.RegisterContainerInstance("", capabilities)
+		containerInstanceArn, err = client.RegisterContainerInstance("", capabilities, hostAttributes)
 		if err != nil {
 			log.Errorf("Error registering: %v", err)
 			if retriable, ok := err.(utils.Retriable); ok && !retriable.Retry() {
@@ -193,11 +262,12 @@ func _main() int {
 			return exitcodes.ExitError
 		}
 		log.Infof("Registration completed successfully. I am running as '%v' in cluster '%v'", containerInstanceArn, cfg.Cluster)
+		publishedContainerInstanceArn.Set(containerInstanceArn)
 		// Save our shiny new containerInstanceArn
 		stateManager.Save()
 	} else {
 		log.Infof("Restored from checkpoint file. I am running as '%v' in cluster '%v'", containerInstanceArn, cfg.Cluster)
-		_, err = client.RegisterContainerInstance(containerInstanceArn, capabilities)
+		_, err = client.RegisterContainerInstance(containerInstanceArn, capabilities, hostAttributes)
 		if err != nil {
 			log.Errorf("Error re-registering: %v", err)
 			if awserr, ok := err.(awserr.Error); ok && api.IsInstanceTypeChangedError(awserr) {
@@ -211,14 +281,17 @@ func _main() int {
 	// Begin listening to the docker daemon and saving changes
 	taskEngine.SetSaver(stateManager)
 	taskEngine.MustInit()
+	statsEngine := startStatsEngine(cfg, taskEngine, containerInstanceArn)
 
 	go sighandlers.StartTerminationHandler(stateManager, taskEngine)
+	reloader.TaskEngine = taskEngine
+	reloader.Register = func(capabilities []string) error {
+		_, err := client.RegisterContainerInstance(containerInstanceArn, capabilities, hostAttributes)
+		return err
+	}
+	sighandlers.StartReloadHandler(reloader)
 
-	// Agent introspection api
-	go handlers.ServeHttp(&containerInstanceArn, taskEngine, cfg)
-
-	// Start sending events to the backend
-	go eventhandler.HandleEngineEvents(taskEngine, client, stateManager)
+	startEventHandler(cfg, taskEngine, client, stateManager, containerInstanceArn)
 
 	telemetrySessionParams := tcshandler.TelemetrySessionParams{
 		ContainerInstanceArn: containerInstanceArn,
@@ -226,11 +299,12 @@ func _main() int {
 		Cfg:                  cfg,
 		AcceptInvalidCert:    *acceptInsecureCert,
 		EcsClient:            client,
-		TaskEngine:           taskEngine,
 	}
 
 	// Start metrics session in a go routine
-	go tcshandler.StartMetricsSession(telemetrySessionParams)
+	if statsEngine != nil {
+		go tcshandler.StartMetricsSession(telemetrySessionParams, statsEngine)
+	}
 
 	log.Info("Beginning Polling for updates")
 	err = acshandler.StartSession(ctx, acshandler.StartSessionArguments{
@@ -241,6 +315,7 @@ func _main() int {
 		ECSClient:            client,
 		StateManager:         stateManager,
 		TaskEngine:           taskEngine,
+		Recorder:             interactionRecorder,
 	})
 	if err != nil {
 		log.Criticalf("Unretriable error starting communicating with ACS: %v", err)
@@ -250,11 +325,128 @@ func _main() int {
 	return exitcodes.ExitError
 }
 
+// reportConfig prints the config for the print-config flag, and any error
+// loading it, returning the exit code for the print-config and check-config
+// flags.
+func reportConfig(cfg *config.Config, err error, print bool) int {
+	// Warnings about the config are logged to stdout too
+	log.Flush()
+	if print {
+		config.PrintSettings(os.Stdout, config.Describe(cfg))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitcodes.ExitError
+	}
+	if !print {
+		fmt.Println("The config is valid")
+	}
+	return exitcodes.ExitSuccess
+}
+
+// runStandalone runs the tasks described by the files in the configured
+// directory, without registering a container instance or connecting to ACS
+// or TCS. State changes are recorded locally.
+func runStandalone(ctx context.Context, cfg *config.Config, taskEngine engine.TaskEngine, stateManager statemanager.StateManager, reloader *sighandlers.ConfigReloader) int {
+	log.Infof("Running in standalone mode with tasks from '%v'", cfg.StandaloneTaskDir)
+	client, err := standalone.NewClient(cfg.Cluster, cfg.StandaloneEventsFile)
+	if err != nil {
+		log.Criticalf("Error opening the standalone events file: %v", err)
+		return exitcodes.ExitTerminal
+	}
+
+	taskEngine.SetSaver(stateManager)
+	taskEngine.MustInit()
+	startStatsEngine(cfg, taskEngine, "")
+
+	go sighandlers.StartTerminationHandler(stateManager, taskEngine)
+	reloader.TaskEngine = taskEngine
+	sighandlers.StartReloadHandler(reloader)
+
+	startEventHandler(cfg, taskEngine, client, stateManager, "")
+
+	standalone.NewTaskWatcher(cfg.StandaloneTaskDir, taskEngine).Watch(ctx)
+	return exitcodes.ExitSuccess
+}
+
+// startStatsEngine starts collecting container stats, which are served by the
+// introspection api, written to any stats sinks and checked against alert
+// rules whether or not they're published to TCS. It returns nil if the stats
+// engine couldn't be initialized.
+func startStatsEngine(cfg *config.Config, taskEngine engine.TaskEngine, containerInstanceArn string) *stats.DockerStatsEngine {
+	statsEngine := stats.NewDockerStatsEngine(cfg)
+	if err := statsEngine.MustInit(taskEngine, cfg.Cluster, containerInstanceArn); err != nil {
+		log.Warnf("Error initializing the stats engine; container stats won't be collected: %v", err)
+		return nil
+	}
+	return statsEngine
+}
+
+// startEventHandler starts submitting the state changes of the task engine
+// using the given client. When checkpointing, changes are journaled in the
+// data dir until they're submitted. They're also delivered to any configured
+// webhooks.
+func startEventHandler(cfg *config.Config, taskEngine engine.TaskEngine, client api.ECSClient, stateManager statemanager.StateManager, containerInstanceArn string) {
+	var eventJournal *eventhandler.Journal
+	if cfg.Checkpoint {
+		var err error
+		eventJournal, err = eventhandler.OpenJournal(cfg.DataDir)
+		if err != nil {
+			log.Errorf("Error opening the state change journal; pending state changes will be lost if the agent restarts: %v", err)
+		}
+	}
+	webhooks := eventhandler.NewWebhookSink(cfg.StateChangeWebhookURLs, cfg.StateChangeWebhookSecret, cfg.Cluster, containerInstanceArn)
+	go eventhandler.HandleEngineEvents(taskEngine, client, stateManager, eventJournal, webhooks)
+}
+
+// newRecorder starts a journal of the agent's interactions with ACS and docker
+// if a record dir is configured.
+func newRecorder(cfg *config.Config) *recorder.Recorder {
+	if cfg.RecordDir == "" {
+		return nil
+	}
+	interactionRecorder, err := recorder.New(cfg.RecordDir)
+	if err != nil {
+		log.Errorf("Error starting a journal in the record dir; interactions won't be recorded: %v", err)
+		return nil
+	}
+	return interactionRecorder
+}
+
+// newHealthChecker registers the checks backing the health and readiness
+// endpoints. Liveness checks cover what the agent needs to keep working; the
+// readiness-only checks cover what it needs before it can be given tasks.
+func newHealthChecker(cfg *config.Config, taskEngine engine.TaskEngine, stateManager statemanager.StateManager, containerInstanceArn *utilatomic.String) *health.Checker {
+	checker := health.NewChecker()
+	checker.AddLivenessCheck("Docker", health.DockerCheck(taskEngine))
+	checker.AddLivenessCheck("StateSave", health.StateSaveCheck(stateManager))
+	checker.AddLivenessCheck("EventBacklog", health.BacklogCheck(eventhandler.PendingEvents, maxPendingStateChanges))
+
+	if cfg.StandaloneTaskDir != "" {
+		checker.AddReadinessCheck("Registration", health.DisabledCheck("standalone mode"))
+		checker.AddReadinessCheck("ACS", health.DisabledCheck("standalone mode"))
+		checker.AddReadinessCheck("TCS", health.DisabledCheck("standalone mode"))
+		return checker
+	}
+	checker.AddReadinessCheck("Registration", health.RegistrationCheck(containerInstanceArn))
+	checker.AddReadinessCheck("ACS", health.ConnectionCheck(acshandler.ConnectionStatus, backendConnectionMaxIdle))
+	if cfg.DisableMetrics {
+		checker.AddReadinessCheck("TCS", health.DisabledCheck("metrics are disabled"))
+	} else {
+		checker.AddReadinessCheck("TCS", health.ConnectionCheck(tcshandler.ConnectionStatus, backendConnectionMaxIdle))
+	}
+	return checker
+}
+
 func initializeStateManager(cfg *config.Config, taskEngine engine.TaskEngine, cluster, containerInstanceArn, savedInstanceID *string, sequenceNumber *utilatomic.IncreasingInt64) (statemanager.StateManager, error) {
 	if !cfg.Checkpoint {
 		return statemanager.NewNoopStateManager(), nil
 	}
-	stateManager, err := statemanager.NewStateManager(cfg,
+	newStateManager := statemanager.NewStateManager
+	if cfg.StateStore == config.StateStoreBoltDB {
+		newStateManager = statemanager.NewBoltStateManager
+	}
+	stateManager, err := newStateManager(cfg,
 		statemanager.AddSaveable("TaskEngine", taskEngine),
 		statemanager.AddSaveable("ContainerInstanceArn", containerInstanceArn),
 		statemanager.AddSaveable("Cluster", cluster),
@@ -14,9 +14,11 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"runtime"
+	"sort"
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/ecs_client/model/ecs"
@@ -43,8 +45,10 @@ type ECSClient interface {
 	// the default cluster if necessary, and returns the registered
 	// ContainerInstanceARN if successful. Supplying a non-empty container
 	// instance ARN allows a container instance to update its registered
-	// resources.
-	RegisterContainerInstance(existingContainerInstanceArn string, attributes []string) (string, error)
+	// resources. The capabilities are registered as attributes without
+	// values, along with the given attributes, the custom ones from the
+	// config and the instance type.
+	RegisterContainerInstance(existingContainerInstanceArn string, capabilities []string, attributes map[string]string) (string, error)
 	// SubmitTaskStateChange sends a state change and returns an error
 	// indicating if it was submitted
 	SubmitTaskStateChange(change TaskStateChange) error
@@ -76,10 +80,21 @@ type ECSSubmitStateSDK interface {
 // ApiECSClient implements ECSClient
 type ApiECSClient struct {
 	credentialProvider      *credentials.Credentials
-	config                  *config.Config
+	config                  *config.Holder
 	standardClient          ECSSDK
 	submitStateChangeClient ECSSubmitStateSDK
-	ec2metadata             ec2.EC2MetadataClient
+	// submitStateChangeRetrier retries the calls of submitStateChangeClient
+	// when it's the SDK's client.
+	submitStateChangeRetrier *oneDayRetrier
+	ec2metadata              ec2.EC2MetadataClient
+}
+
+// ThrottleReporter is implemented by ECS clients which retry throttled state
+// change submissions on their own, and can report them as they happen.
+type ThrottleReporter interface {
+	// OnSubmitThrottled sets a function called with the error of each
+	// throttled state change submission which is retried.
+	OnSubmitThrottled(throttled func(error))
 }
 
 // SetSDK overrides the SDK to the given one. This is useful for injecting a
@@ -94,30 +109,48 @@ func (client *ApiECSClient) SetSubmitStateChangeSDK(sdk ECSSubmitStateSDK) {
 	client.submitStateChangeClient = sdk
 }
 
+// OnSubmitThrottled implements ThrottleReporter
+func (client *ApiECSClient) OnSubmitThrottled(throttled func(error)) {
+	if client.submitStateChangeRetrier == nil {
+		return
+	}
+	client.submitStateChangeRetrier.onThrottled(throttled)
+}
+
 const (
 	ECS_SERVICE = "ecs"
 
 	EcsMaxReasonLength = 255
 
 	RoundtripTimeout = 5 * time.Second
+
+	// InstanceTypeAttribute is the name of the attribute container instances
+	// are registered with for their EC2 instance type.
+	InstanceTypeAttribute = "ecs.instance-type"
 )
 
-func NewECSClient(credentialProvider *credentials.Credentials, config *config.Config, httpClient *http.Client, ec2MetadataClient ec2.EC2MetadataClient) ECSClient {
+// NewECSClient returns a client of the ECS API. The reserved ports and
+// instance attributes it registers with are read from the current config of
+// cfgHolder, so that a reloaded config is used to re-register.
+func NewECSClient(credentialProvider *credentials.Credentials, cfgHolder *config.Holder, httpClient *http.Client, ec2MetadataClient ec2.EC2MetadataClient) ECSClient {
+	cfg := cfgHolder.Get()
 	var ecsConfig aws.Config
 	ecsConfig.Credentials = credentialProvider
-	ecsConfig.Region = &config.AWSRegion
+	ecsConfig.Region = &cfg.AWSRegion
 	ecsConfig.HTTPClient = httpClient
-	if config.APIEndpoint != "" {
-		ecsConfig.Endpoint = &config.APIEndpoint
+	if cfg.APIEndpoint != "" {
+		ecsConfig.Endpoint = &cfg.APIEndpoint
 	}
 	standardClient := ecs.New(session.New(&ecsConfig))
-	submitStateChangeClient := newSubmitStateChangeClient(&ecsConfig)
+	submitStateChangeRetrier := &oneDayRetrier{}
+	submitStateChangeClient := newSubmitStateChangeClient(&ecsConfig, submitStateChangeRetrier)
 	return &ApiECSClient{
-		credentialProvider:      credentialProvider,
-		config:                  config,
-		standardClient:          standardClient,
-		submitStateChangeClient: submitStateChangeClient,
-		ec2metadata:             ec2MetadataClient,
+		credentialProvider:       credentialProvider,
+		config:                   cfgHolder,
+		standardClient:           standardClient,
+		submitStateChangeClient:  submitStateChangeClient,
+		submitStateChangeRetrier: submitStateChangeRetrier,
+		ec2metadata:              ec2MetadataClient,
 	}
 }
 
@@ -144,18 +177,20 @@ func (client *ApiECSClient) CreateCluster(clusterName string) (string, error) {
 	return *resp.Cluster.ClusterName, nil
 }
 
-func (client *ApiECSClient) RegisterContainerInstance(containerInstanceArn string, attributes []string) (string, error) {
-	clusterRef := client.config.Cluster
+func (client *ApiECSClient) RegisterContainerInstance(containerInstanceArn string, capabilities []string, attributes map[string]string) (string, error) {
+	clusterRef := client.config.Get().Cluster
 	// If our clusterRef is empty, we should try to create the default
 	if clusterRef == "" {
 		clusterRef = config.DEFAULT_CLUSTER_NAME
 		defer func() {
-			// Update the config value to reflect the cluster we end up in
-			client.config.Cluster = clusterRef
+			// Update the config value to reflect the cluster we end up in.
+			// This only happens on the first registration, before the config
+			// can be reloaded.
+			client.config.Get().Cluster = clusterRef
 		}()
 		// Attempt to register without checking existence of the cluster so we don't require
 		// excess permissions in the case where the cluster already exists and is active
-		containerInstanceArn, err := client.registerContainerInstance(clusterRef, containerInstanceArn, attributes)
+		containerInstanceArn, err := client.registerContainerInstance(clusterRef, containerInstanceArn, capabilities, attributes)
 		if err == nil {
 			return containerInstanceArn, nil
 		}
@@ -166,18 +201,19 @@ func (client *ApiECSClient) RegisterContainerInstance(containerInstanceArn strin
 			return "", err
 		}
 	}
-	return client.registerContainerInstance(clusterRef, containerInstanceArn, attributes)
+	return client.registerContainerInstance(clusterRef, containerInstanceArn, capabilities, attributes)
 }
 
-func (client *ApiECSClient) registerContainerInstance(clusterRef string, containerInstanceArn string, attributes []string) (string, error) {
+func (client *ApiECSClient) registerContainerInstance(clusterRef string, containerInstanceArn string, capabilities []string, attributes map[string]string) (string, error) {
+	cfg := client.config.Get()
 	registerRequest := ecs.RegisterContainerInstanceInput{Cluster: &clusterRef}
 	if containerInstanceArn != "" {
 		registerRequest.ContainerInstanceArn = &containerInstanceArn
 	}
 
-	for _, attribute := range attributes {
+	for _, capability := range capabilities {
 		registerRequest.Attributes = append(registerRequest.Attributes, &ecs.Attribute{
-			Name: aws.String(attribute),
+			Name: aws.String(capability),
 		})
 	}
 
@@ -190,6 +226,7 @@ func (client *ApiECSClient) registerContainerInstance(clusterRef string, contain
 	}
 	strIid := string(instanceIdentityDoc)
 	registerRequest.InstanceIdentityDocument = &strIid
+	registerRequest.Attributes = append(registerRequest.Attributes, valuedAttributes(instanceIdentityDoc, attributes, cfg.InstanceAttributes)...)
 
 	instanceIdentitySignature := []byte{}
 	if iidRetrieved {
@@ -206,7 +243,7 @@ func (client *ApiECSClient) registerContainerInstance(clusterRef string, contain
 	integerStr := "INTEGER"
 
 	cpu, mem := getCpuAndMemory()
-	mem = mem - int64(client.config.ReservedMemory)
+	mem = mem - int64(cfg.ReservedMemory)
 
 	cpuResource := ecs.Resource{
 		Name:         utils.Strptr("CPU"),
@@ -221,12 +258,12 @@ func (client *ApiECSClient) registerContainerInstance(clusterRef string, contain
 	portResource := ecs.Resource{
 		Name:           utils.Strptr("PORTS"),
 		Type:           utils.Strptr("STRINGSET"),
-		StringSetValue: utils.Uint16SliceToStringSlice(client.config.ReservedPorts),
+		StringSetValue: utils.Uint16SliceToStringSlice(cfg.ReservedPorts),
 	}
 	udpPortResource := ecs.Resource{
 		Name:           utils.Strptr("PORTS_UDP"),
 		Type:           utils.Strptr("STRINGSET"),
-		StringSetValue: utils.Uint16SliceToStringSlice(client.config.ReservedPortsUDP),
+		StringSetValue: utils.Uint16SliceToStringSlice(cfg.ReservedPortsUDP),
 	}
 
 	resources := []*ecs.Resource{&cpuResource, &memResource, &portResource, &udpPortResource}
@@ -241,6 +278,38 @@ func (client *ApiECSClient) registerContainerInstance(clusterRef string, contain
 	return *resp.ContainerInstance.ContainerInstanceArn, nil
 }
 
+// valuedAttributes returns the attributes with values to register: the given
+// ones, the custom ones from the config and the instance type from the
+// instance identity document. They're validated where they come from.
+func valuedAttributes(instanceIdentityDoc []byte, attributes map[string]string, instanceAttributes map[string]string) []*ecs.Attribute {
+	values := make(map[string]string)
+	for name, value := range attributes {
+		values[name] = value
+	}
+	for name, value := range instanceAttributes {
+		values[name] = value
+	}
+	var iid ec2.InstanceIdentityDocument
+	if err := json.Unmarshal(instanceIdentityDoc, &iid); err == nil && iid.InstanceType != "" {
+		values[InstanceTypeAttribute] = iid.InstanceType
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var valued []*ecs.Attribute
+	for _, name := range names {
+		attribute := &ecs.Attribute{Name: aws.String(name)}
+		if values[name] != "" {
+			attribute.Value = aws.String(values[name])
+		}
+		valued = append(valued, attribute)
+	}
+	return valued
+}
+
 func (client *ApiECSClient) SubmitTaskStateChange(change TaskStateChange) error {
 	if change.Status == TaskStatusNone {
 		log.Warn("SubmitTaskStateChange called with an invalid change", "change", change)
@@ -255,7 +324,7 @@ func (client *ApiECSClient) SubmitTaskStateChange(change TaskStateChange) error
 
 	status := change.Status.String()
 	_, err := client.submitStateChangeClient.SubmitTaskStateChange(&ecs.SubmitTaskStateChangeInput{
-		Cluster: &client.config.Cluster,
+		Cluster: &client.config.Get().Cluster,
 		Task:    &change.TaskArn,
 		Status:  &status,
 		Reason:  &change.Reason,
@@ -269,7 +338,7 @@ func (client *ApiECSClient) SubmitTaskStateChange(change TaskStateChange) error
 
 func (client *ApiECSClient) SubmitContainerStateChange(change ContainerStateChange) error {
 	req := ecs.SubmitContainerStateChangeInput{
-		Cluster:       &client.config.Cluster,
+		Cluster:       &client.config.Get().Cluster,
 		Task:          &change.TaskArn,
 		ContainerName: &change.ContainerName,
 	}
@@ -320,7 +389,7 @@ func (client *ApiECSClient) SubmitContainerStateChange(change ContainerStateChan
 func (client *ApiECSClient) DiscoverPollEndpoint(containerInstanceArn string) (string, error) {
 	resp, err := client.standardClient.DiscoverPollEndpoint(&ecs.DiscoverPollEndpointInput{
 		ContainerInstance: &containerInstanceArn,
-		Cluster:           &client.config.Cluster,
+		Cluster:           &client.config.Get().Cluster,
 	})
 	if err != nil {
 		return "", err
@@ -332,7 +401,7 @@ func (client *ApiECSClient) DiscoverPollEndpoint(containerInstanceArn string) (s
 func (client *ApiECSClient) DiscoverTelemetryEndpoint(containerInstanceArn string) (string, error) {
 	resp, err := client.standardClient.DiscoverPollEndpoint(&ecs.DiscoverPollEndpointInput{
 		ContainerInstance: &containerInstanceArn,
-		Cluster:           &client.config.Cluster,
+		Cluster:           &client.config.Get().Cluster,
 	})
 	if err != nil {
 		return "", err
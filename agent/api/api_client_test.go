@@ -24,7 +24,7 @@ import (
 const configuredCluster = "mycluster"
 
 func NewMockClient(ctrl *gomock.Controller, ec2Metadata ec2.EC2MetadataClient) (api.ECSClient, *mock_api.MockECSSDK, *mock_api.MockECSSubmitStateSDK) {
-	client := api.NewECSClient(credentials.AnonymousCredentials, &config.Config{Cluster: configuredCluster, AWSRegion: "us-east-1"}, http.DefaultClient, ec2Metadata)
+	client := api.NewECSClient(credentials.AnonymousCredentials, config.NewHolder(&config.Config{Cluster: configuredCluster, AWSRegion: "us-east-1"}), http.DefaultClient, ec2Metadata)
 	mockSDK := mock_api.NewMockECSSDK(ctrl)
 	mockSubmitStateSDK := mock_api.NewMockECSSubmitStateSDK(ctrl)
 	client.(*api.ApiECSClient).SetSDK(mockSDK)
@@ -261,7 +261,7 @@ func TestRegisterContainerInstance(t *testing.T) {
 
 	}).Return(&ecs.RegisterContainerInstanceOutput{ContainerInstance: &ecs.ContainerInstance{ContainerInstanceArn: aws.String("registerArn")}}, nil)
 
-	arn, err := client.RegisterContainerInstance("arn:test", capabilities)
+	arn, err := client.RegisterContainerInstance("arn:test", capabilities, nil)
 	if err != nil {
 		t.Errorf("Should not be an error: %v", err)
 	}
@@ -270,6 +270,41 @@ func TestRegisterContainerInstance(t *testing.T) {
 	}
 }
 
+func TestRegisterContainerInstanceAttributes(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockEC2Metadata := mock_ec2.NewMockEC2MetadataClient(mockCtrl)
+	client := api.NewECSClient(credentials.AnonymousCredentials, config.NewHolder(&config.Config{
+		Cluster:            configuredCluster,
+		AWSRegion:          "us-east-1",
+		InstanceAttributes: map[string]string{"rack": "r12", "ssd": ""},
+	}), http.DefaultClient, mockEC2Metadata)
+	mc := mock_api.NewMockECSSDK(mockCtrl)
+	client.(*api.ApiECSClient).SetSDK(mc)
+
+	mockEC2Metadata.EXPECT().ReadResource(ec2.INSTANCE_IDENTITY_DOCUMENT_RESOURCE).Return([]byte(`{"instanceType":"m4.large"}`), nil)
+	mockEC2Metadata.EXPECT().ReadResource(ec2.INSTANCE_IDENTITY_DOCUMENT_SIGNATURE_RESOURCE).Return([]byte("signature"), nil)
+	mc.EXPECT().RegisterContainerInstance(gomock.Any()).Do(func(req *ecs.RegisterContainerInstanceInput) {
+		expected := []*ecs.Attribute{
+			{Name: aws.String("capability1")},
+			{Name: aws.String("ecs.cpu-model"), Value: aws.String("Xeon")},
+			{Name: aws.String("ecs.instance-type"), Value: aws.String("m4.large")},
+			{Name: aws.String("rack"), Value: aws.String("r12")},
+			{Name: aws.String("ssd")},
+		}
+		if !reflect.DeepEqual(req.Attributes, expected) {
+			t.Errorf("Expected attributes %v, got %v", expected, req.Attributes)
+		}
+	}).Return(&ecs.RegisterContainerInstanceOutput{ContainerInstance: &ecs.ContainerInstance{ContainerInstanceArn: aws.String("registerArn")}}, nil)
+
+	_, err := client.RegisterContainerInstance("", []string{"capability1"}, map[string]string{
+		"ecs.cpu-model": "Xeon",
+	})
+	if err != nil {
+		t.Errorf("Should not be an error: %v", err)
+	}
+}
+
 func findResource(resources []*ecs.Resource, name string) (*ecs.Resource, bool) {
 	for _, resource := range resources {
 		if name == *resource.Name {
@@ -284,7 +319,7 @@ func TestRegisterBlankCluster(t *testing.T) {
 	defer mockCtrl.Finish()
 	mockEC2Metadata := mock_ec2.NewMockEC2MetadataClient(mockCtrl)
 	// Test the special 'empty cluster' behavior of creating 'default'
-	client := api.NewECSClient(credentials.AnonymousCredentials, &config.Config{Cluster: "", AWSRegion: "us-east-1"}, http.DefaultClient, mockEC2Metadata)
+	client := api.NewECSClient(credentials.AnonymousCredentials, config.NewHolder(&config.Config{Cluster: "", AWSRegion: "us-east-1"}), http.DefaultClient, mockEC2Metadata)
 	mc := mock_api.NewMockECSSDK(mockCtrl)
 	client.(*api.ApiECSClient).SetSDK(mc)
 
@@ -309,7 +344,7 @@ func TestRegisterBlankCluster(t *testing.T) {
 		}).Return(&ecs.RegisterContainerInstanceOutput{ContainerInstance: &ecs.ContainerInstance{ContainerInstanceArn: aws.String("registerArn")}}, nil),
 	)
 
-	arn, err := client.RegisterContainerInstance("", nil)
+	arn, err := client.RegisterContainerInstance("", nil, nil)
 	if err != nil {
 		t.Errorf("Should not be an error: %v", err)
 	}
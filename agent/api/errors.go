@@ -25,6 +25,23 @@ func IsInstanceTypeChangedError(err awserr.Error) bool {
 	return strings.Contains(err.Message(), INSTANCE_TYPE_CHANGED_ERROR_MESSAGE)
 }
 
+// throttlingErrorCodes are the codes of errors returned by the ECS API when
+// it throttles requests.
+var throttlingErrorCodes = map[string]bool{
+	"Throttling":               true,
+	"ThrottlingException":      true,
+	"RequestLimitExceeded":     true,
+	"RequestThrottled":         true,
+	"TooManyRequestsException": true,
+}
+
+// IsThrottlingError returns whether err was returned by the ECS API because
+// it throttled the request.
+func IsThrottlingError(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && throttlingErrorCodes[awsErr.Code()]
+}
+
 type badVolumeError struct {
 	msg string
 }
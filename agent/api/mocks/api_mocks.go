@@ -162,15 +162,15 @@ func (_mr *_MockECSClientRecorder) DiscoverTelemetryEndpoint(arg0 interface{}) *
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "DiscoverTelemetryEndpoint", arg0)
 }
 
-func (_m *MockECSClient) RegisterContainerInstance(_param0 string, _param1 []string) (string, error) {
-	ret := _m.ctrl.Call(_m, "RegisterContainerInstance", _param0, _param1)
+func (_m *MockECSClient) RegisterContainerInstance(_param0 string, _param1 []string, _param2 map[string]string) (string, error) {
+	ret := _m.ctrl.Call(_m, "RegisterContainerInstance", _param0, _param1, _param2)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockECSClientRecorder) RegisterContainerInstance(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "RegisterContainerInstance", arg0, arg1)
+func (_mr *_MockECSClientRecorder) RegisterContainerInstance(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RegisterContainerInstance", arg0, arg1, arg2)
 }
 
 func (_m *MockECSClient) SubmitContainerStateChange(_param0 api.ContainerStateChange) error {
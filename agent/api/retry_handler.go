@@ -16,6 +16,7 @@ package api
 import (
 	"math"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/ecs_client/model/ecs"
@@ -47,10 +48,11 @@ const (
 
 // newSubmitStateChangeClient returns a client intended to be used for
 // Submit*StateChange APIs which has the behavior of retrying the call on
-// retriable errors for an extended period of time (roughly 24 hours).
-func newSubmitStateChangeClient(awsConfig *aws.Config) *ecs.ECS {
+// retriable errors for an extended period of time (roughly 24 hours), using
+// the given retrier.
+func newSubmitStateChangeClient(awsConfig *aws.Config, retrier *oneDayRetrier) *ecs.ECS {
 	sscConfig := awsConfig.Copy()
-	sscConfig.Retryer = &oneDayRetrier{}
+	sscConfig.Retryer = retrier
 	client := ecs.New(session.New(sscConfig))
 	return client
 }
@@ -61,6 +63,19 @@ func newSubmitStateChangeClient(awsConfig *aws.Config) *ecs.ECS {
 // Conforms to the request.Retryer interface https://github.com/aws/aws-sdk-go/blob/v1.0.0/aws/request/retryer.go#L13
 type oneDayRetrier struct {
 	client.DefaultRetryer
+
+	lock sync.RWMutex
+	// throttled, if set, is called with the error of each throttled attempt
+	// which is retried.
+	throttled func(error)
+}
+
+// onThrottled sets the function called with the error of each throttled
+// attempt which is retried.
+func (retrier *oneDayRetrier) onThrottled(throttled func(error)) {
+	retrier.lock.Lock()
+	defer retrier.lock.Unlock()
+	retrier.throttled = throttled
 }
 
 // MaxRetries returns the number of retries needed to retry for roughly a day
@@ -74,7 +89,17 @@ func (retrier *oneDayRetrier) MaxRetries() int {
 // backoff between 30ms and 1 minute.
 // See the const comments for math on how this gets us to around 24 hours
 // total.
+// The SDK only calls it for attempts it retries, so throttled attempts are
+// reported from here; they never reach the caller otherwise.
 func (retrier *oneDayRetrier) RetryRules(r *request.Request) time.Duration {
+	if IsThrottlingError(r.Error) {
+		retrier.lock.RLock()
+		throttled := retrier.throttled
+		retrier.lock.RUnlock()
+		if throttled != nil {
+			throttled(r.Error)
+		}
+	}
 	// This logic is the same as the default retrier, but duplicated here such
 	// that upstream changes do not invalidate the math done above.
 	if r.RetryCount <= submitStateChangeInitialRetries {
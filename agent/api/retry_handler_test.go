@@ -25,7 +25,7 @@ import (
 )
 
 func TestOneDayRetrier(t *testing.T) {
-	stateChangeClient := newSubmitStateChangeClient(defaults.Config())
+	stateChangeClient := newSubmitStateChangeClient(defaults.Config(), &oneDayRetrier{})
 
 	request, _ := stateChangeClient.SubmitContainerStateChangeRequest(&ecs.SubmitContainerStateChangeInput{})
 
@@ -0,0 +1,56 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// maxInstanceAttributes is the most custom attributes ECS allows on a
+// container instance.
+const maxInstanceAttributes = 10
+
+var (
+	attributeNamePattern  = regexp.MustCompile(`^[a-zA-Z0-9_./\\-]{1,128}$`)
+	attributeValuePattern = regexp.MustCompile(`^[a-zA-Z0-9_.@/\\: -]{0,128}$`)
+)
+
+// reservedAttributePrefixes are the prefixes of the attributes the agent
+// registers itself, which custom attributes can't use.
+var reservedAttributePrefixes = []string{"ecs.", "com.amazonaws.ecs."}
+
+// ValidateAttribute returns an error if the name or value of a container
+// instance attribute break the rules ECS checks them against.
+func ValidateAttribute(name, value string) error {
+	if !attributeNamePattern.MatchString(name) {
+		return errors.New("names must be 1 to 128 letters, numbers, hyphens, underscores, periods or slashes")
+	}
+	if !attributeValuePattern.MatchString(value) || strings.TrimSpace(value) != value {
+		return errors.New("values must be up to 128 letters, numbers, hyphens, underscores, periods, at signs, slashes, colons or spaces, and can't start or end with a space")
+	}
+	return nil
+}
+
+// validateInstanceAttribute returns an error if a custom attribute can't be
+// registered.
+func validateInstanceAttribute(name, value string) error {
+	for _, prefix := range reservedAttributePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return errors.New("names starting with " + prefix + " are reserved for the agent")
+		}
+	}
+	return ValidateAttribute(name, value)
+}
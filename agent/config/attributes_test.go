@@ -0,0 +1,76 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+)
+
+func TestValidateAttribute(t *testing.T) {
+	for _, attribute := range []struct {
+		name, value string
+		valid       bool
+	}{
+		{"rack", "r12", true},
+		{"ssd", "", true},
+		{"team/owner", `Team A@example.com:\ops`, true},
+		{"", "r12", false},
+		{"rack id", "r12", false},
+		{strings.Repeat("a", 129), "r12", false},
+		{"rack", "r(12)", false},
+		{"rack", " r12", false},
+		{"rack", strings.Repeat("a", 129), false},
+	} {
+		err := ValidateAttribute(attribute.name, attribute.value)
+		if (err == nil) != attribute.valid {
+			t.Errorf("Expected %q=%q to be valid: %v, got %v", attribute.name, attribute.value, attribute.valid, err)
+		}
+	}
+}
+
+func TestInstanceAttributes(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	os.Setenv("AWS_DEFAULT_REGION", "us-west-2")
+	os.Setenv("ECS_INSTANCE_ATTRIBUTES", `{"rack":"r12","ssd":"true","ecs.instance-type":"m4.large","bad name":"x"}`)
+
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.InstanceAttributes, map[string]string{"rack": "r12", "ssd": "true"}) {
+		t.Errorf("Expected the invalid attributes to be dropped, got %v", cfg.InstanceAttributes)
+	}
+	_, err = NewStrictConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err == nil || !strings.Contains(err.Error(), `"ecs.instance-type"`) || !strings.Contains(err.Error(), `"bad name"`) {
+		t.Errorf("Expected the invalid attributes to be an error in strict mode, got %v", err)
+	}
+
+	os.Setenv("ECS_INSTANCE_ATTRIBUTES", `{"a1":"","a2":"","a3":"","a4":"","a5":"","a6":"","a7":"","a8":"","a9":"","a10":"","a11":""}`)
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil || len(cfg.InstanceAttributes) != 0 {
+		t.Errorf("Expected too many attributes to be ignored, got %v, %v", cfg.InstanceAttributes, err)
+	}
+
+	os.Setenv("ECS_INSTANCE_ATTRIBUTES", `["rack"]`)
+	_, err = NewStrictConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err == nil || !strings.Contains(err.Error(), "expected a JSON object") {
+		t.Errorf("Expected attributes which aren't an object to be an error, got %v", err)
+	}
+}
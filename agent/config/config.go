@@ -14,14 +14,10 @@
 package config
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"os"
+	"net/url"
 	"reflect"
-	"strconv"
 	"strings"
 	"time"
 
@@ -51,6 +47,34 @@ const (
 	// minimumTaskCleanupWaitDuration specifies the minimum duration to wait before cleaning up
 	// a task's container. This is used to enforce sane values for the config.TaskCleanupWaitDuration field.
 	minimumTaskCleanupWaitDuration = 1 * time.Minute
+
+	// DefaultStatsSinkInterval specifies the default interval at which container stats are written to
+	// the configured stats sinks.
+	DefaultStatsSinkInterval = 10 * time.Second
+
+	// minimumStatsSinkInterval specifies the minimum interval at which container stats may be written
+	// to the configured stats sinks. Stats are collected twice a second, so writing more often is pointless.
+	minimumStatsSinkInterval = 1 * time.Second
+
+	// DefaultTelemetryBufferRetention specifies the default duration for which undelivered metrics are
+	// kept to be sent to the telemetry endpoint again.
+	DefaultTelemetryBufferRetention = 5 * time.Minute
+
+	// StatsCollectorCgroup reads container stats from the host's cgroup
+	// filesystem. It's the default stats collector.
+	StatsCollectorCgroup = "cgroup"
+
+	// StatsCollectorDocker reads container stats from the stats endpoint of
+	// the Docker remote API.
+	StatsCollectorDocker = "docker"
+
+	// StateStoreJSON checkpoints state to a JSON file which is rewritten on
+	// each save. It's the default state store.
+	StateStoreJSON = "json"
+
+	// StateStoreBoltDB checkpoints state to a bolt database, saving only the
+	// tasks and containers which changed.
+	StateStoreBoltDB = "boltdb"
 )
 
 // Merge merges two config files, preferring the ones on the left. Any nil or
@@ -62,6 +86,9 @@ func (lhs *Config) Merge(rhs Config) *Config {
 
 	for i := 0; i < left.NumField(); i++ {
 		leftField := left.Field(i)
+		if !leftField.CanSet() {
+			continue
+		}
 		if utils.ZeroOrNil(leftField.Interface()) {
 			leftField.Set(reflect.ValueOf(right.Field(i).Interface()))
 		}
@@ -70,18 +97,6 @@ func (lhs *Config) Merge(rhs Config) *Config {
 	return lhs //make it chainable
 }
 
-// complete returns true if all fields of the config are populated / nonzero
-func (cfg *Config) complete() bool {
-	cfgElem := reflect.ValueOf(cfg).Elem()
-
-	for i := 0; i < cfgElem.NumField(); i++ {
-		if utils.ZeroOrNil(cfgElem.Field(i).Interface()) {
-			return false
-		}
-	}
-	return true
-}
-
 // checkMissingAndDeprecated checks all zero-valued fields for tags of the form
 // missing:STRING and acts based on that string. Current options are: fatal,
 // warn. Fatal will result in an error being returned, warn will result in a
@@ -93,6 +108,9 @@ func (cfg *Config) checkMissingAndDepreciated() error {
 	fatalFields := []string{}
 	for i := 0; i < cfgElem.NumField(); i++ {
 		cfgField := cfgElem.Field(i)
+		if !cfgField.CanInterface() {
+			continue
+		}
 		if utils.ZeroOrNil(cfgField.Interface()) {
 			missingTag := cfgStructField.Field(i).Tag.Get("missing")
 			if len(missingTag) == 0 {
@@ -102,6 +120,10 @@ func (cfg *Config) checkMissingAndDepreciated() error {
 			case "warn":
 				log.Warn("Configuration key not set", "key", cfgStructField.Field(i).Name)
 			case "fatal":
+				if cfg.StandaloneTaskDir != "" {
+					// Nothing is needed to reach the ECS backend in standalone mode
+					continue
+				}
 				log.Crit("Configuration key not set", "key", cfgStructField.Field(i).Name)
 				fatalFields = append(fatalFields, cfgStructField.Field(i).Name)
 			default:
@@ -149,214 +171,169 @@ func (cfg *Config) trimWhitespace() {
 
 func DefaultConfig() Config {
 	return Config{
-		DockerEndpoint:          "unix:///var/run/docker.sock",
-		ReservedPorts:           []uint16{SSH_PORT, DOCKER_RESERVED_PORT, DOCKER_RESERVED_SSL_PORT, AGENT_INTROSPECTION_PORT},
-		ReservedPortsUDP:        []uint16{},
-		DataDir:                 "/data/",
-		DisableMetrics:          false,
-		DockerGraphPath:         "/var/lib/docker",
-		ReservedMemory:          0,
-		AvailableLoggingDrivers: []dockerclient.LoggingDriver{dockerclient.JsonFileDriver},
-		TaskCleanupWaitDuration: DefaultTaskCleanupWaitDuration,
+		DockerEndpoint:           "unix:///var/run/docker.sock",
+		ReservedPorts:            []uint16{SSH_PORT, DOCKER_RESERVED_PORT, DOCKER_RESERVED_SSL_PORT, AGENT_INTROSPECTION_PORT},
+		ReservedPortsUDP:         []uint16{},
+		DataDir:                  "/data/",
+		StateStore:               StateStoreJSON,
+		DisableMetrics:           false,
+		EngineAuthData:           NewSensitiveRawMessage(nil),
+		DockerGraphPath:          "/var/lib/docker",
+		HostProcPath:             "/proc",
+		StatsCollector:           StatsCollectorCgroup,
+		ReservedMemory:           0,
+		AvailableLoggingDrivers:  []dockerclient.LoggingDriver{dockerclient.JsonFileDriver},
+		TaskCleanupWaitDuration:  DefaultTaskCleanupWaitDuration,
+		StatsSinkInterval:        DefaultStatsSinkInterval,
+		TelemetryBufferRetention: DefaultTelemetryBufferRetention,
 	}
 }
 
-func fileConfig() Config {
-	config_file := utils.DefaultIfBlank(os.Getenv("ECS_AGENT_CONFIG_FILE_PATH"), "/etc/ecs_container_agent/config.json")
+// NewConfig returns a config struct created by merging environment variables,
+// env files, a config file, and EC2 Metadata info, in that order of
+// precedence, over the defaults. The source each field was set from is recorded for Describe.
+// Values which can't be parsed or are out of range are warned about and then
+// ignored or overridden, unless StrictConfig is set.
+// The 'config' struct it returns can be used, even if an error is returned. An
+// error is returned, however, if the config is incomplete in some way that is
+// considered fatal.
+func NewConfig(ec2client ec2.EC2MetadataClient) (*Config, error) {
+	return loadConfig(ec2client, false)
+}
 
-	file, err := os.Open(config_file)
-	if err != nil {
-		return Config{}
+// NewStrictConfig returns the config as NewConfig does, with an error for any
+// value which can't be parsed or is out of range whether or not StrictConfig
+// is set.
+func NewStrictConfig(ec2client ec2.EC2MetadataClient) (*Config, error) {
+	return loadConfig(ec2client, true)
+}
+
+func loadConfig(ec2client ec2.EC2MetadataClient, strict bool) (*Config, error) {
+	var problems problems
+	config := &Config{sources: make(map[string]string)}
+	// Environment overrides all else
+	config.mergeSource(readEnvironment(&problems))
+	for _, source := range readEnvFiles(&problems) {
+		config.mergeSource(source)
 	}
-	data, err := ioutil.ReadAll(file)
-	if err != nil {
-		log.Error("Unable to read config file", "err", err)
-		return Config{}
+	config.mergeSource(readFile(&problems))
+	if config.sources["AWSRegion"] == "" {
+		// Get it from metadata only if we need to (network io)
+		config.mergeSource(ec2MetadataConfig(ec2client))
 	}
-	if strings.TrimSpace(string(data)) == "" {
-		// empty file, not an error
-		return Config{}
+	if config.sources["Checkpoint"] == "" && config.sources["DataDir"] != "" {
+		// if we have a directory to checkpoint to, from any source but the
+		// defaults which are merged below, default it to be on. If it's not
+		// set, checkpointing is off for backwards compatibility
+		config.Checkpoint = true
+		config.sources["Checkpoint"] = SourceDefault
 	}
+	config.mergeSource(defaultSource())
 
-	config := Config{}
-	err = json.Unmarshal(data, &config)
+	config.checkValues(&problems)
+
+	err := config.validate()
 	if err != nil {
-		log.Error("Error reading config json data", "err", err)
+		return config, err
 	}
-
-	// Handle any deprecated keys correctly here
-	if utils.ZeroOrNil(config.Cluster) && !utils.ZeroOrNil(config.ClusterArn) {
-		config.Cluster = config.ClusterArn
+	if (strict || config.StrictConfig) && len(problems) > 0 {
+		return config, errors.New("Invalid config: " + strings.Join(problems, "; "))
 	}
-	return config
+	return config, nil
 }
 
-// environmentConfig reads the given configs from the environment and attempts
-// to convert them to the given type
-func environmentConfig() Config {
-	endpoint := os.Getenv("ECS_BACKEND_HOST")
-
-	clusterRef := os.Getenv("ECS_CLUSTER")
-	awsRegion := os.Getenv("AWS_DEFAULT_REGION")
-
-	dockerEndpoint := os.Getenv("DOCKER_HOST")
-	engineAuthType := os.Getenv("ECS_ENGINE_AUTH_TYPE")
-	engineAuthData := os.Getenv("ECS_ENGINE_AUTH_DATA")
-
-	var checkpoint bool
-	dataDir := os.Getenv("ECS_DATADIR")
-	if dataDir != "" {
-		// if we have a directory to checkpoint to, default it to be on
-		checkpoint = utils.ParseBool(os.Getenv("ECS_CHECKPOINT"), true)
-	} else {
-		// if the directory is not set, default to checkpointing off for
-		// backwards compatibility
-		checkpoint = utils.ParseBool(os.Getenv("ECS_CHECKPOINT"), false)
-	}
+// mergeSource sets the fields set by source which no source merged before it
+// has set, and records that they came from it.
+func (config *Config) mergeSource(source *configSource) {
+	cfgElem := reflect.ValueOf(config).Elem()
+	sourceElem := reflect.ValueOf(&source.config).Elem()
+	cfgStructField := cfgElem.Type()
 
-	// Format: json array, e.g. [1,2,3]
-	reservedPortEnv := os.Getenv("ECS_RESERVED_PORTS")
-	portDecoder := json.NewDecoder(strings.NewReader(reservedPortEnv))
-	var reservedPorts []uint16
-	err := portDecoder.Decode(&reservedPorts)
-	// EOF means the string was blank as opposed to UnexepctedEof which means an
-	// invalid parse
-	// Blank is not a warning; we have sane defaults
-	if err != io.EOF && err != nil {
-		log.Warn("Invalid format for \"ECS_RESERVED_PORTS\" environment variable; expected a JSON array like [1,2,3].", "err", err)
+	for i := 0; i < cfgElem.NumField(); i++ {
+		name := cfgStructField.Field(i).Name
+		if !cfgElem.Field(i).CanSet() || !source.set[name] || config.sources[name] != "" {
+			continue
+		}
+		cfgElem.Field(i).Set(sourceElem.Field(i))
+		config.sources[name] = source.name
 	}
+}
 
-	reservedPortUDPEnv := os.Getenv("ECS_RESERVED_PORTS_UDP")
-	portDecoderUDP := json.NewDecoder(strings.NewReader(reservedPortUDPEnv))
-	var reservedPortsUDP []uint16
-	err = portDecoderUDP.Decode(&reservedPortsUDP)
-	// EOF means the string was blank as opposed to UnexepctedEof which means an
-	// invalid parse
-	// Blank is not a warning; we have sane defaults
-	if err != io.EOF && err != nil {
-		log.Warn("Invalid format for \"ECS_RESERVED_PORTS_UDP\" environment variable; expected a JSON array like [1,2,3].", "err", err)
+// checkValues overrides values which are out of range with their defaults,
+// and drops entries of lists which can't be used.
+func (config *Config) checkValues(problems *problems) {
+	if config.TaskCleanupWaitDuration < minimumTaskCleanupWaitDuration {
+		problems.add("Invalid value %v for task cleanup duration, below the minimum of %v; will be overridden to %v", config.TaskCleanupWaitDuration, minimumTaskCleanupWaitDuration, DefaultTaskCleanupWaitDuration)
+		config.override("TaskCleanupWaitDuration")
 	}
 
-	updateDownloadDir := os.Getenv("ECS_UPDATE_DOWNLOAD_DIR")
-	updatesEnabled := utils.ParseBool(os.Getenv("ECS_UPDATES_ENABLED"), false)
-
-	disableMetrics := utils.ParseBool(os.Getenv("ECS_DISABLE_METRICS"), false)
-	dockerGraphPath := os.Getenv("ECS_DOCKER_GRAPHPATH")
-
-	reservedMemory := parseEnvVariableUint16("ECS_RESERVED_MEMORY")
-
-	taskCleanupWaitDuration := parseEnvVariableDuration("ECS_ENGINE_TASK_CLEANUP_WAIT_DURATION")
-	availableLoggingDriversEnv := os.Getenv("ECS_AVAILABLE_LOGGING_DRIVERS")
-	loggingDriverDecoder := json.NewDecoder(strings.NewReader(availableLoggingDriversEnv))
-	var availableLoggingDrivers []dockerclient.LoggingDriver
-	err = loggingDriverDecoder.Decode(&availableLoggingDrivers)
-	// EOF means the string was blank as opposed to UnexepctedEof which means an
-	// invalid parse
-	// Blank is not a warning; we have sane defaults
-	if err != io.EOF && err != nil {
-		log.Warn("Invalid format for \"ECS_AVAILABLE_LOGGING_DRIVERS\" environment variable; expected a JSON array like [\"json-file\",\"syslog\"].", "err", err)
+	if config.StatsSinkInterval < minimumStatsSinkInterval {
+		problems.add("Invalid value %v for stats sink interval, below the minimum of %v; will be overridden to %v", config.StatsSinkInterval, minimumStatsSinkInterval, DefaultStatsSinkInterval)
+		config.override("StatsSinkInterval")
 	}
 
-	privilegedDisabled := utils.ParseBool(os.Getenv("ECS_DISABLE_PRIVILEGED"), false)
-	seLinuxCapable := utils.ParseBool(os.Getenv("ECS_SELINUX_CAPABLE"), false)
-	appArmorCapable := utils.ParseBool(os.Getenv("ECS_APPARMOR_CAPABLE"), false)
+	if config.TelemetryBufferRetention < 0 {
+		problems.add("Invalid value %v for telemetry buffer retention; will be overridden to %v", config.TelemetryBufferRetention, DefaultTelemetryBufferRetention)
+		config.override("TelemetryBufferRetention")
+	}
 
-	return Config{
-		Cluster:                 clusterRef,
-		APIEndpoint:             endpoint,
-		AWSRegion:               awsRegion,
-		DockerEndpoint:          dockerEndpoint,
-		ReservedPorts:           reservedPorts,
-		ReservedPortsUDP:        reservedPortsUDP,
-		DataDir:                 dataDir,
-		Checkpoint:              checkpoint,
-		EngineAuthType:          engineAuthType,
-		EngineAuthData:          NewSensitiveRawMessage([]byte(engineAuthData)),
-		UpdatesEnabled:          updatesEnabled,
-		UpdateDownloadDir:       updateDownloadDir,
-		DisableMetrics:          disableMetrics,
-		DockerGraphPath:         dockerGraphPath,
-		ReservedMemory:          reservedMemory,
-		AvailableLoggingDrivers: availableLoggingDrivers,
-		PrivilegedDisabled:      privilegedDisabled,
-		SELinuxCapable:          seLinuxCapable,
-		AppArmorCapable:         appArmorCapable,
-		TaskCleanupWaitDuration: taskCleanupWaitDuration,
+	if config.StatsCollector != StatsCollectorCgroup && config.StatsCollector != StatsCollectorDocker {
+		problems.add("Invalid value %q for stats collector; will be overridden to %v", config.StatsCollector, StatsCollectorCgroup)
+		config.override("StatsCollector")
 	}
-}
 
-func parseEnvVariableUint16(envVar string) uint16 {
-	envVal := os.Getenv(envVar)
-	var var16 uint16
-	if envVal != "" {
-		var64, err := strconv.ParseUint(envVal, 10, 16)
-		if err != nil {
-			log.Warn("Invalid format for \""+envVar+"\" environment variable; expected unsigned integer.", "err", err)
-		} else {
-			var16 = uint16(var64)
-		}
+	if config.StateStore != StateStoreJSON && config.StateStore != StateStoreBoltDB {
+		problems.add("Invalid value %q for state store; will be overridden to %v", config.StateStore, StateStoreJSON)
+		config.override("StateStore")
 	}
-	return var16
-}
 
-func parseEnvVariableDuration(envVar string) time.Duration {
-	var duration time.Duration
-	envVal := os.Getenv(envVar)
-	if envVal == "" {
-		log.Debug("Environment variable empty: " + envVar)
-	} else {
-		var err error
-		duration, err = time.ParseDuration(envVal)
-		if err != nil {
-			log.Warn("Could not parse duration value: "+envVal+" for Environment Variable "+envVar+" : ", err)
+	// Rules which can't be evaluated are dropped
+	validRules := config.StatsAlertRules[:0]
+	for _, rule := range config.StatsAlertRules {
+		_, durationErr := rule.Duration()
+		if rule.Name == "" || rule.Metric == "" || durationErr != nil {
+			problems.add("Invalid stats alert rule %+v, will be ignored", rule)
+			continue
 		}
+		validRules = append(validRules, rule)
 	}
-	return duration
-}
-
-func ec2MetadataConfig(ec2client ec2.EC2MetadataClient) Config {
-	iid, err := ec2client.InstanceIdentityDocument()
-	if err != nil {
-		log.Crit("Unable to communicate with EC2 Metadata service to infer region: " + err.Error())
-		return Config{}
+	config.StatsAlertRules = validRules
+
+	// Webhooks which can't be posted to are dropped
+	validWebhooks := config.StateChangeWebhookURLs[:0]
+	for _, webhook := range config.StateChangeWebhookURLs {
+		webhookURL, parseErr := url.Parse(strings.TrimSpace(webhook))
+		if parseErr != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+			problems.add("Invalid state change webhook url %q, will be ignored", webhook)
+			continue
+		}
+		validWebhooks = append(validWebhooks, webhookURL.String())
 	}
-	return Config{AWSRegion: iid.Region}
-}
+	config.StateChangeWebhookURLs = validWebhooks
 
-// NewConfig returns a config struct created by merging environment variables,
-// a config file, and EC2 Metadata info.
-// The 'config' struct it returns can be used, even if an error is returned. An
-// error is returned, however, if the config is incomplete in some way that is
-// considered fatal.
-func NewConfig(ec2client ec2.EC2MetadataClient) (config *Config, err error) {
-	ctmp := environmentConfig() //Environment overrides all else
-	config = &ctmp
-	defer func() {
-		config.trimWhitespace()
-		err = config.validate()
-		config.Merge(DefaultConfig())
-	}()
-
-	if config.complete() {
-		// No need to do file / network IO
-		return config, nil
+	// Attributes ECS would refuse are dropped
+	if len(config.InstanceAttributes) > maxInstanceAttributes {
+		problems.add("Too many instance attributes, %d, above the maximum of %d; all will be ignored", len(config.InstanceAttributes), maxInstanceAttributes)
+		config.override("InstanceAttributes")
 	}
-
-	config.Merge(fileConfig())
-
-	if config.AWSRegion == "" {
-		// Get it from metadata only if we need to (network io)
-		config.Merge(ec2MetadataConfig(ec2client))
+	validAttributes := make(map[string]string)
+	for name, value := range config.InstanceAttributes {
+		if err := validateInstanceAttribute(name, value); err != nil {
+			problems.add("Invalid instance attribute %q, will be ignored: %v", name, err)
+			continue
+		}
+		validAttributes[name] = value
 	}
-
-	// If a value has been set for taskCleanupWaitDuration and the value is less than the minimum allowed cleanup duration,
-	// print a warning and override it
-	if config.TaskCleanupWaitDuration < minimumTaskCleanupWaitDuration {
-		log.Warn("Invalid value for task cleanup duration, will be overridden to "+DefaultTaskCleanupWaitDuration.String(), "parsed value", config.TaskCleanupWaitDuration, "minimum threshold", minimumTaskCleanupWaitDuration)
-		config.TaskCleanupWaitDuration = DefaultTaskCleanupWaitDuration
+	if len(config.InstanceAttributes) != 0 {
+		config.InstanceAttributes = validAttributes
 	}
+}
 
-	return config, err
+// override sets a field to its default value.
+func (config *Config) override(name string) {
+	defaults := DefaultConfig()
+	reflect.ValueOf(config).Elem().FieldByName(name).Set(reflect.ValueOf(defaults).FieldByName(name))
+	config.sources[name] = SourceDefault
 }
 
 // validate performs validation over members of the Config struct
@@ -15,8 +15,10 @@ package config
 
 import (
 	"errors"
+	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -57,6 +59,20 @@ func TestBrokenEC2Metadata(t *testing.T) {
 	}
 }
 
+func TestStandaloneWithoutRegion(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("ECS_STANDALONE_TASK_DIR", "/etc/ecs/tasks")
+	defer os.Unsetenv("ECS_STANDALONE_TASK_DIR")
+
+	config, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatalf("Expected no error in standalone mode without a region, got: %v", err)
+	}
+	if config.StandaloneTaskDir != "/etc/ecs/tasks" {
+		t.Errorf("Wrong standalone task dir: %v", config.StandaloneTaskDir)
+	}
+}
+
 func TestBrokenEC2MetadataEndpoint(t *testing.T) {
 	os.Clearenv()
 	ctrl := gomock.NewController(t)
@@ -86,8 +102,9 @@ func TestEnvironmentConfig(t *testing.T) {
 	os.Setenv("ECS_APPARMOR_CAPABLE", "true")
 	os.Setenv("ECS_DISABLE_PRIVILEGED", "true")
 	os.Setenv("ECS_ENGINE_TASK_CLEANUP_WAIT_DURATION", "90s")
+	os.Setenv("ECS_RECORD_DIR", "/var/lib/ecs/record")
 
-	conf := environmentConfig()
+	conf := readEnvironment(new(problems)).config
 	if conf.Cluster != "myCluster" {
 		t.Error("Wrong value for cluster ", conf.Cluster)
 	}
@@ -115,6 +132,9 @@ func TestEnvironmentConfig(t *testing.T) {
 	if conf.TaskCleanupWaitDuration != (90 * time.Second) {
 		t.Error("Wrong value for TaskCleanupWaitDuration")
 	}
+	if conf.RecordDir != "/var/lib/ecs/record" {
+		t.Error("Wrong value for RecordDir", conf.RecordDir)
+	}
 }
 
 func TestTrimWhitespace(t *testing.T) {
@@ -154,6 +174,151 @@ func TestConfigBoolean(t *testing.T) {
 	}
 }
 
+func TestConfigStatsSinks(t *testing.T) {
+	os.Setenv("ECS_STATSD_ENDPOINT", "localhost:8125")
+	os.Setenv("ECS_STATS_SINK_INTERVAL", "30s")
+	defer os.Unsetenv("ECS_STATSD_ENDPOINT")
+	defer os.Unsetenv("ECS_STATS_SINK_INTERVAL")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.StatsDEndpoint != "localhost:8125" {
+		t.Errorf("Wrong statsd endpoint: %v", cfg.StatsDEndpoint)
+	}
+	if cfg.StatsSinkInterval != 30*time.Second {
+		t.Errorf("Wrong stats sink interval: %v", cfg.StatsSinkInterval)
+	}
+}
+
+func TestInvalidStatsSinkInterval(t *testing.T) {
+	os.Setenv("ECS_STATS_SINK_INTERVAL", "10ms")
+	defer os.Unsetenv("ECS_STATS_SINK_INTERVAL")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.StatsSinkInterval != DefaultStatsSinkInterval {
+		t.Errorf("Expected stats sink interval to be overridden, got: %v", cfg.StatsSinkInterval)
+	}
+}
+
+func TestStatsCollector(t *testing.T) {
+	os.Setenv("ECS_STATS_COLLECTOR", "docker")
+	defer os.Unsetenv("ECS_STATS_COLLECTOR")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.StatsCollector != StatsCollectorDocker {
+		t.Errorf("Wrong stats collector: %v", cfg.StatsCollector)
+	}
+
+	os.Setenv("ECS_STATS_COLLECTOR", "libcontainer")
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.StatsCollector != StatsCollectorCgroup {
+		t.Errorf("Expected stats collector to be overridden, got: %v", cfg.StatsCollector)
+	}
+}
+
+func TestStateStore(t *testing.T) {
+	os.Setenv("ECS_STATE_STORE", "boltdb")
+	defer os.Unsetenv("ECS_STATE_STORE")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.StateStore != StateStoreBoltDB {
+		t.Errorf("Wrong state store: %v", cfg.StateStore)
+	}
+
+	os.Setenv("ECS_STATE_STORE", "leveldb")
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.StateStore != StateStoreJSON {
+		t.Errorf("Expected state store to be overridden, got: %v", cfg.StateStore)
+	}
+}
+
+func TestTelemetryBufferRetention(t *testing.T) {
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TelemetryBufferRetention != DefaultTelemetryBufferRetention {
+		t.Errorf("Expected the default telemetry buffer retention, got: %v", cfg.TelemetryBufferRetention)
+	}
+
+	os.Setenv("ECS_TELEMETRY_BUFFER_RETENTION", "10m")
+	defer os.Unsetenv("ECS_TELEMETRY_BUFFER_RETENTION")
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TelemetryBufferRetention != 10*time.Minute {
+		t.Errorf("Wrong telemetry buffer retention: %v", cfg.TelemetryBufferRetention)
+	}
+}
+
+func TestStatsAlertRules(t *testing.T) {
+	os.Setenv("ECS_STATS_ALERT_RULES", `[{"name":"memory","metric":"memoryUtilizationPerc","threshold":90,"for":"2m"},{"name":"cpu","metric":"cpuUsagePerc","threshold":95,"for":"soon"}]`)
+	defer os.Unsetenv("ECS_STATS_ALERT_RULES")
+	os.Setenv("ECS_STATS_ALERT_WEBHOOK_URL", "http://localhost:9000/alerts")
+	defer os.Unsetenv("ECS_STATS_ALERT_WEBHOOK_URL")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The rule with an invalid duration is dropped
+	expected := []StatsAlertRule{{Name: "memory", Metric: "memoryUtilizationPerc", Threshold: 90, For: "2m"}}
+	if !reflect.DeepEqual(cfg.StatsAlertRules, expected) {
+		t.Errorf("Expected alert rules %+v, got %+v", expected, cfg.StatsAlertRules)
+	}
+	duration, err := cfg.StatsAlertRules[0].Duration()
+	if err != nil || duration != 2*time.Minute {
+		t.Errorf("Expected a duration of 2m, got %v: %v", duration, err)
+	}
+	if cfg.StatsAlertWebhookURL != "http://localhost:9000/alerts" {
+		t.Errorf("Wrong stats alert webhook url: %v", cfg.StatsAlertWebhookURL)
+	}
+}
+
+func TestStateChangeWebhooks(t *testing.T) {
+	os.Setenv("ECS_STATE_CHANGE_WEBHOOK_URLS", `["http://localhost:9000/events", "localhost:9001", " https://discovery.local/ecs "]`)
+	defer os.Unsetenv("ECS_STATE_CHANGE_WEBHOOK_URLS")
+	os.Setenv("ECS_STATE_CHANGE_WEBHOOK_SECRET", "hunter2")
+	defer os.Unsetenv("ECS_STATE_CHANGE_WEBHOOK_SECRET")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The url without a scheme is dropped
+	expected := []string{"http://localhost:9000/events", "https://discovery.local/ecs"}
+	if !reflect.DeepEqual(cfg.StateChangeWebhookURLs, expected) {
+		t.Errorf("Expected webhook urls %v, got %v", expected, cfg.StateChangeWebhookURLs)
+	}
+	if cfg.StateChangeWebhookSecret != "hunter2" {
+		t.Errorf("Wrong state change webhook secret: %v", cfg.StateChangeWebhookSecret)
+	}
+}
+
+func TestConfigPrometheusMetrics(t *testing.T) {
+	os.Setenv("ECS_ENABLE_PROMETHEUS_METRICS", "true")
+	defer os.Unsetenv("ECS_ENABLE_PROMETHEUS_METRICS")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.PrometheusMetricsEnabled {
+		t.Error("PrometheusMetricsEnabled not set to true")
+	}
+}
+
 func TestConfigDefault(t *testing.T) {
 	os.Unsetenv("ECS_DISABLE_METRICS")
 	os.Unsetenv("ECS_RESERVED_PORTS")
@@ -171,15 +336,27 @@ func TestConfigDefault(t *testing.T) {
 	if cfg.DataDir != "/data/" {
 		t.Error("Default datadir set incorrectly")
 	}
+	if cfg.StateStore != StateStoreJSON {
+		t.Errorf("Default state store set incorrectly: %v", cfg.StateStore)
+	}
 	if cfg.DisableMetrics {
 		t.Errorf("Default disablemetrics set incorrectly: %v", cfg.DisableMetrics)
 	}
+	if cfg.PrometheusMetricsEnabled {
+		t.Errorf("Default prometheus metrics set incorrectly: %v", cfg.PrometheusMetricsEnabled)
+	}
 	if len(cfg.ReservedPorts) != 4 {
 		t.Error("Default resered ports set incorrectly")
 	}
 	if cfg.DockerGraphPath != "/var/lib/docker" {
 		t.Error("Default docker graph path set incorrectly")
 	}
+	if cfg.HostProcPath != "/proc" {
+		t.Error("Default host proc path set incorrectly")
+	}
+	if cfg.StatsCollector != StatsCollectorCgroup {
+		t.Errorf("Default stats collector set incorrectly: %v", cfg.StatsCollector)
+	}
 	if cfg.ReservedMemory != 0 {
 		t.Errorf("Default reserved memory set incorrectly: %v", cfg.ReservedMemory)
 	}
@@ -192,14 +369,22 @@ func TestConfigDefault(t *testing.T) {
 	if cfg.TaskCleanupWaitDuration != 3*time.Hour {
 		t.Errorf("Defualt task cleanup wait duration set incorrectly: %v", cfg.TaskCleanupWaitDuration)
 	}
+	if cfg.EngineAuthData == nil || len(cfg.EngineAuthData.Contents()) != 0 {
+		t.Errorf("Default engine auth data set incorrectly: %v", cfg.EngineAuthData)
+	}
 }
 
 func TestBadLoggingDriverSerialization(t *testing.T) {
 	os.Setenv("ECS_AVAILABLE_LOGGING_DRIVERS", "[\"malformed]")
+	defer os.Unsetenv("ECS_AVAILABLE_LOGGING_DRIVERS")
 
-	conf := environmentConfig()
-	if len(conf.AvailableLoggingDrivers) != 0 {
-		t.Error("Wrong value for AvailableLoggingDrivers", conf.AvailableLoggingDrivers)
+	var problems problems
+	env := readEnvironment(&problems)
+	if len(env.config.AvailableLoggingDrivers) != 0 || env.set["AvailableLoggingDrivers"] {
+		t.Error("Wrong value for AvailableLoggingDrivers", env.config.AvailableLoggingDrivers)
+	}
+	if len(problems) != 1 {
+		t.Errorf("Expected the malformed value to be reported, got %v", problems)
 	}
 }
 
@@ -214,35 +399,42 @@ func TestInvalidLoggingDriver(t *testing.T) {
 	}
 }
 
-func TestInvalidFormatParseEnvVariableUint16(t *testing.T) {
-	os.Setenv("FOO", "foo")
-	var16 := parseEnvVariableUint16("FOO")
-	if var16 != 0 {
-		t.Error("Expected 0 from parseEnvVariableUint16 for invalid Uint16 format")
+func TestInvalidFormatParseEnvironmentValue(t *testing.T) {
+	var conf Config
+	cfgElem := reflect.ValueOf(&conf).Elem()
+	for field, value := range map[string]string{
+		"ReservedMemory":          "foo",
+		"TaskCleanupWaitDuration": "foo",
+		"Checkpoint":              "maybe",
+		"ReservedPorts":           "22",
+	} {
+		err := parseEnvironmentValue(cfgElem.FieldByName(field), value)
+		if err == nil {
+			t.Errorf("Expected an error parsing %q for %s", value, field)
+		}
+	}
+	if !reflect.DeepEqual(conf, Config{}) {
+		t.Errorf("Expected invalid values to be ignored, got %+v", conf)
 	}
 }
 
-func TestValidFormatParseEnvVariableUint16(t *testing.T) {
-	os.Setenv("FOO", "1")
-	var16 := parseEnvVariableUint16("FOO")
-	if var16 != 1 {
-		t.Errorf("Unexpected value parsed in parseEnvVariableUint16. Expected %d, got %d", 1, var16)
-	}
-}
-
-func TestInvalidFormatParseEnvVariableDuration(t *testing.T) {
-	os.Setenv("FOO", "foo")
-	duration := parseEnvVariableDuration("FOO")
-	if duration != 0 {
-		t.Error("Expected 0 from parseEnvVariableDuration for invalid format")
-	}
-}
-
-func TestValidFormatParseEnvVariableDuration(t *testing.T) {
-	os.Setenv("FOO", "1s")
-	duration := parseEnvVariableDuration("FOO")
-	if duration != 1*time.Second {
-		t.Errorf("Unexpected value parsed in parseEnvVariableDuration. Expected %v, got %v", 1*time.Second, duration)
+func TestValidFormatParseEnvironmentValue(t *testing.T) {
+	var conf Config
+	cfgElem := reflect.ValueOf(&conf).Elem()
+	for field, value := range map[string]string{
+		"ReservedMemory":          "1",
+		"TaskCleanupWaitDuration": "1s",
+		"Checkpoint":              "true",
+		"ReservedPorts":           "[22]",
+	} {
+		err := parseEnvironmentValue(cfgElem.FieldByName(field), value)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q for %s: %v", value, field, err)
+		}
+	}
+	expected := Config{ReservedMemory: 1, TaskCleanupWaitDuration: time.Second, Checkpoint: true, ReservedPorts: []uint16{22}}
+	if !reflect.DeepEqual(conf, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, conf)
 	}
 }
 
@@ -301,3 +493,160 @@ func TestReservedMemory(t *testing.T) {
 		t.Errorf("Wrong value for ReservedMemory. Expected %d, got %d", 1, cfg.ReservedMemory)
 	}
 }
+
+func TestDescribe(t *testing.T) {
+	os.Clearenv()
+	file, err := ioutil.TempFile("", "ecs_config_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{"Cluster": "fileCluster", "ReservedMemory": 128}`)
+	file.Close()
+	os.Setenv("ECS_AGENT_CONFIG_FILE_PATH", file.Name())
+	os.Setenv("AWS_DEFAULT_REGION", "us-west-2")
+	os.Setenv("ECS_RESERVED_MEMORY", "64")
+	os.Setenv("ECS_ENGINE_AUTH_DATA", `{"registry": {"password": "secret"}}`)
+	defer os.Clearenv()
+
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := make(map[string]Setting)
+	for _, setting := range Describe(cfg) {
+		settings[setting.Name] = setting
+	}
+	expected := map[string]Setting{
+		"Cluster":                 {"Cluster", "fileCluster", SourceFile},
+		"AWSRegion":               {"AWSRegion", "us-west-2", SourceEnvironment},
+		"ReservedMemory":          {"ReservedMemory", "64", SourceEnvironment},
+		"EngineAuthData":          {"EngineAuthData", redactedValue, SourceEnvironment},
+		"DockerEndpoint":          {"DockerEndpoint", "unix:///var/run/docker.sock", SourceDefault},
+		"TaskCleanupWaitDuration": {"TaskCleanupWaitDuration", "3h0m0s", SourceDefault},
+		"ReservedPorts":           {"ReservedPorts", "[22,2375,2376,51678]", SourceDefault},
+	}
+	for name, setting := range expected {
+		if settings[name] != setting {
+			t.Errorf("Expected %v, got %v", setting, settings[name])
+		}
+	}
+	// Every field but the unexported sources is described
+	if len(settings) != reflect.TypeOf(Config{}).NumField()-1 {
+		t.Errorf("Expected every field to be described, got %d", len(settings))
+	}
+}
+
+func writeConfigFile(t *testing.T, contents string) func() {
+	file, err := ioutil.TempFile("", "ecs_config_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(contents)
+	file.Close()
+	os.Setenv("ECS_AGENT_CONFIG_FILE_PATH", file.Name())
+	return func() { os.Remove(file.Name()) }
+}
+
+func TestZeroValuesOverrideFile(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	defer writeConfigFile(t, `{"DisableMetrics": true, "ReservedPorts": [22], "Checkpoint": true, "AWSRegion": "us-west-2"}`)()
+	os.Setenv("ECS_DISABLE_METRICS", "false")
+	os.Setenv("ECS_RESERVED_PORTS", "[]")
+
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DisableMetrics {
+		t.Error("Expected DisableMetrics=false in the environment to override the file")
+	}
+	if len(cfg.ReservedPorts) != 0 {
+		t.Errorf("Expected no reserved ports, got %v", cfg.ReservedPorts)
+	}
+	if !cfg.Checkpoint {
+		t.Error("Expected Checkpoint to be read from the file")
+	}
+	for name, source := range map[string]string{"DisableMetrics": SourceEnvironment, "ReservedPorts": SourceEnvironment, "Checkpoint": SourceFile} {
+		if cfg.sources[name] != source {
+			t.Errorf("Expected %s to come from the %s, got %q", name, source, cfg.sources[name])
+		}
+	}
+}
+
+func TestConfigFileProblems(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	defer writeConfigFile(t, `{"cluster": "fileCluster", "ReservedMemory": "lots", "Clustr": "typo", "AWSRegion": "us-west-2"}`)()
+
+	var problems problems
+	file := readFile(&problems)
+	if file.config.Cluster != "fileCluster" || !file.set["Cluster"] {
+		t.Errorf("Expected keys to be matched to fields regardless of case, got %q", file.config.Cluster)
+	}
+	if file.set["ReservedMemory"] {
+		t.Error("Expected the invalid reserved memory not to be set")
+	}
+	if len(problems) != 2 {
+		t.Errorf("Expected the invalid value and the unknown key to be reported, got %v", problems)
+	}
+
+	_, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Errorf("Expected the problems to be warnings, got %v", err)
+	}
+	_, err = NewStrictConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err == nil || !strings.Contains(err.Error(), "Clustr") {
+		t.Errorf("Expected the problems to be an error in strict mode, got %v", err)
+	}
+}
+
+func TestStrictConfig(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	os.Setenv("AWS_DEFAULT_REGION", "us-west-2")
+	os.Setenv("ECS_STRICT_CONFIG", "true")
+
+	_, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatalf("Expected a valid config, got %v", err)
+	}
+
+	for env, value := range map[string]string{
+		"ECS_RESERVED_MEMORY":                   "-1",
+		"ECS_CHECKPOINT":                        "maybe",
+		"ECS_STATE_STORE":                       "leveldb",
+		"ECS_ENGINE_TASK_CLEANUP_WAIT_DURATION": "1s",
+		"ECS_STATE_CHANGE_WEBHOOK_URLS":         `["localhost:9001"]`,
+	} {
+		os.Setenv(env, value)
+		cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+		if err == nil || !strings.Contains(err.Error(), "Invalid") {
+			t.Errorf("Expected an error for %s=%s in strict mode, got %v", env, value, err)
+		}
+		if cfg == nil {
+			t.Errorf("Expected the config to be returned along with the error for %s", env)
+		}
+		os.Unsetenv(env)
+	}
+}
+
+func TestOverriddenValueSource(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	os.Setenv("AWS_DEFAULT_REGION", "us-west-2")
+	os.Setenv("ECS_STATS_COLLECTOR", "libcontainer")
+	os.Setenv("ECS_STATS_SINK_INTERVAL", "0s")
+
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.StatsCollector != StatsCollectorCgroup || cfg.sources["StatsCollector"] != SourceDefault {
+		t.Errorf("Expected the stats collector to be overridden with its default, got %q from %q", cfg.StatsCollector, cfg.sources["StatsCollector"])
+	}
+	if cfg.StatsSinkInterval != DefaultStatsSinkInterval || cfg.sources["StatsSinkInterval"] != SourceDefault {
+		t.Errorf("Expected the stats sink interval to be overridden with its default, got %v from %q", cfg.StatsSinkInterval, cfg.sources["StatsSinkInterval"])
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/utils"
+)
+
+// Sources a configuration value can come from, in order of precedence. Values
+// read from env files have the path of the file as their source, and come
+// between the environment and the config file.
+const (
+	SourceEnvironment = "environment"
+	SourceFile        = "file"
+	SourceEC2Metadata = "ec2 metadata"
+	SourceDefault     = "default"
+)
+
+// redactedValue replaces the value of fields with the `sensitive` tag.
+const redactedValue = "[redacted]"
+
+// Setting is a field of the config with the source its value came from.
+type Setting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// Describe lists every field of cfg with its value and the source it was set
+// from, as recorded by NewConfig; the source is empty for configs which weren't
+// loaded by it. The values of fields with the `sensitive` tag are redacted.
+func Describe(cfg *Config) []Setting {
+	cfgElem := reflect.ValueOf(cfg).Elem()
+	cfgStructField := cfgElem.Type()
+
+	settings := make([]Setting, 0, cfgElem.NumField())
+	for i := 0; i < cfgElem.NumField(); i++ {
+		field := cfgStructField.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		value := cfgElem.Field(i).Interface()
+
+		setting := Setting{Name: field.Name, Source: cfg.sources[field.Name]}
+		if field.Tag.Get("sensitive") != "" && !unset(value) {
+			setting.Value = redactedValue
+		} else {
+			setting.Value = formatValue(value)
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
+
+// PrintSettings writes settings as a table.
+func PrintSettings(w io.Writer, settings []Setting) error {
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tSOURCE\tVALUE")
+	for _, setting := range settings {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", setting.Name, setting.Source, setting.Value)
+	}
+	return table.Flush()
+}
+
+// unset returns true if a field has its zero value. Auth data without any
+// contents is unset too.
+func unset(value interface{}) bool {
+	if data, ok := value.(*SensitiveRawMessage); ok && data != nil {
+		return len(data.Contents()) == 0
+	}
+	return utils.ZeroOrNil(value)
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Duration:
+		return v.String()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -17,8 +17,8 @@ and setting sane defaults.
 
 Configuration Sources
 
-Configuration data is loaded from two sources currently: the environment and
-a json config file.
+Configuration data is loaded from three sources currently: the environment,
+env files, and a json config file.
 
 Environment Variables:
 
@@ -26,10 +26,31 @@ The environment variables from which configuration values are loaded are
 documented in the README file which can be found at
 https://github.com/aws/amazon-ecs-agent#environment-variables.
 
+Env files:
+
+The env file at ECS_AGENT_ENV_FILE_PATH, /etc/ecs/ecs.config by default, and
+the drop-in files ending in .conf in the directory of the same name with a .d
+suffix, are read in the VARIABLE=VALUE format of docker's --env-file. Drop-in
+files are read in lexical order, and override the files before them.
+
 Config file:
 
 The config file will be loaded from the path stored in the environment key
 ECS_AGENT_CONFIG_FILE_PATH. It must be a JSON file of the format described
 by the "Config" struct below.
+
+Precedence:
+
+The environment overrides env files, which override the config file, which
+overrides EC2 metadata and the defaults. A value counts as set by a source whenever the source has it,
+even if it's the zero value, and the source of every value is recorded.
+Values which can't be parsed or are out of range are warnings, or errors in
+strict mode.
+
+Reloading:
+
+The fields with the "reload" tag can change while the agent is running. When
+the config is reloaded, Changes lists what differs and ApplyReloadable
+applies those fields; the others take effect on restart.
 */
 package config
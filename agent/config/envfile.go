@@ -0,0 +1,214 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/utils"
+)
+
+const (
+	// defaultEnvFilePath is the env file read unless ECS_AGENT_ENV_FILE_PATH
+	// is set. It's the file ecs-init passes to the agent with --env-file.
+	defaultEnvFilePath = "/etc/ecs/ecs.config"
+
+	// dropInDirSuffix is appended to the path of the env file for the
+	// directory of drop-in env files.
+	dropInDirSuffix = ".d"
+
+	// dropInFileSuffix is the suffix of the drop-in env files which are read.
+	// Other files in the directory, like editor backups, are ignored.
+	dropInFileSuffix = ".conf"
+)
+
+// otherVariables are variables read from the environment outside of the
+// config, which env files may set too.
+var otherVariables = map[string]bool{
+	logger.LOGLEVEL_ENV_VAR:      true,
+	logger.LOGFILE_ENV_VAR:       true,
+	"ECS_AGENT_CONFIG_FILE_PATH": true,
+	"ECS_AGENT_ENV_FILE_PATH":    true,
+}
+
+// exported is the variables set in the environment from env files, with the
+// values they were set to.
+var exported = struct {
+	sync.Mutex
+	variables map[string]string
+}{variables: make(map[string]string)}
+
+// readEnvFiles reads the env file and then its drop-in files, in lexical
+// order. Each is a source, and later ones take precedence, so the sources
+// are returned in reverse order. Variables exported from env files read
+// before which are no longer in any are unset, so a reload forgets them.
+func readEnvFiles(problems *problems) []*configSource {
+	path := utils.DefaultIfBlank(os.Getenv("ECS_AGENT_ENV_FILE_PATH"), defaultEnvFilePath)
+	paths := []string{path}
+
+	dropInDir := path + dropInDirSuffix
+	files, err := ioutil.ReadDir(dropInDir)
+	if err != nil && !os.IsNotExist(err) {
+		problems.add("Unable to read env file directory %s: %v", dropInDir, err)
+	}
+	var dropIns []string
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") || !strings.HasSuffix(file.Name(), dropInFileSuffix) {
+			continue
+		}
+		dropIns = append(dropIns, filepath.Join(dropInDir, file.Name()))
+	}
+	sort.Strings(dropIns)
+	paths = append(paths, dropIns...)
+
+	var sources []*configSource
+	set := make(map[string]bool)
+	for i := len(paths) - 1; i >= 0; i-- {
+		source, variables := readEnvFile(paths[i], problems)
+		if source == nil {
+			continue
+		}
+		sources = append(sources, source)
+		for name, value := range variables {
+			if !set[name] {
+				exportVariable(name, value)
+				set[name] = true
+			}
+		}
+	}
+	unexportVariables(set)
+	return sources
+}
+
+// readEnvFile reads an env file in the format of docker's --env-file: a
+// VARIABLE=VALUE on each line, with the value taken as is. Blank lines and
+// lines starting with # are ignored. Every variable is parsed as it is from
+// the environment, and the source of its value is the path of the file. The
+// variables are returned too, to be set in the environment as --env-file
+// would, for the parts of the agent which read them from there.
+func readEnvFile(path string, problems *problems) (*configSource, map[string]string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			problems.add("Unable to read env file %s: %v", path, err)
+		}
+		return nil, nil
+	}
+
+	variables := make(map[string]string)
+	lines := make(map[string]int)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(strings.TrimLeft(line, " \t"), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		name := parts[0]
+		if name == "" || strings.ContainsAny(name, " \t") {
+			problems.add("Invalid line in env file %s line %d; expected VARIABLE=VALUE", path, i+1)
+			continue
+		}
+		if len(parts) == 1 {
+			// docker passes a variable without a value through from the
+			// environment, which is read already
+			continue
+		}
+		if strings.HasPrefix(name, "ECS_") && !isConfigVariable(name) && !otherVariables[name] {
+			problems.add("Unknown variable %q in env file %s line %d", name, path, i+1)
+			continue
+		}
+		variables[name] = parts[1]
+		lines[name] = i + 1
+	}
+
+	source := newConfigSource(path)
+	lookup := func(name string) string {
+		return variables[name]
+	}
+	describe := func(name string) string {
+		return strconv.Quote(name) + " in env file " + path + " line " + strconv.Itoa(lines[name])
+	}
+	readVariables(source, lookup, describe, problems)
+	return source, variables
+}
+
+// isConfigVariable returns true if a field of the config is read from the
+// environment variable name.
+func isConfigVariable(name string) bool {
+	cfgStructField := reflect.TypeOf(Config{})
+	for i := 0; i < cfgStructField.NumField(); i++ {
+		if cfgStructField.Field(i).Tag.Get("env") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// exportVariable sets a variable read from an env file in the environment,
+// unless it was set there otherwise. Variables exported before are updated.
+func exportVariable(name, value string) {
+	exported.Lock()
+	defer exported.Unlock()
+	current, ok := lookupEnv(name)
+	if ok && current != exported.variables[name] {
+		return
+	}
+	os.Setenv(name, value)
+	exported.variables[name] = value
+}
+
+// unexportVariables unsets the variables exported before which aren't in
+// keep, unless they were set in the environment otherwise since.
+func unexportVariables(keep map[string]bool) {
+	exported.Lock()
+	defer exported.Unlock()
+	for name, value := range exported.variables {
+		if keep[name] {
+			continue
+		}
+		if current, ok := lookupEnv(name); ok && current == value {
+			os.Unsetenv(name)
+		}
+		delete(exported.variables, name)
+	}
+}
+
+// lookupEnv returns the value of a variable in the environment and whether
+// it's set at all, which os.Getenv doesn't tell apart from it being empty.
+func lookupEnv(name string) (string, bool) {
+	prefix := name + "="
+	for _, variable := range os.Environ() {
+		if strings.HasPrefix(variable, prefix) {
+			return variable[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+// exportedFromEnvFile returns true if a variable in the environment was set
+// there from an env file.
+func exportedFromEnvFile(name string) bool {
+	exported.Lock()
+	defer exported.Unlock()
+	value, ok := exported.variables[name]
+	return ok && os.Getenv(name) == value
+}
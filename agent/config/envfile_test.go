@@ -0,0 +1,171 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+)
+
+// writeEnvFiles writes an env file and its drop-in files to a temporary
+// directory, and points ECS_AGENT_ENV_FILE_PATH at it.
+func writeEnvFiles(t *testing.T, envFile string, dropIns map[string]string) func() {
+	dir, err := ioutil.TempDir("", "ecs_config_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "ecs.config")
+	ioutil.WriteFile(path, []byte(envFile), 0644)
+	os.Mkdir(path+dropInDirSuffix, 0755)
+	for name, contents := range dropIns {
+		ioutil.WriteFile(filepath.Join(path+dropInDirSuffix, name), []byte(contents), 0644)
+	}
+	os.Setenv("ECS_AGENT_ENV_FILE_PATH", path)
+	return func() {
+		os.RemoveAll(dir)
+		exported.Lock()
+		exported.variables = make(map[string]string)
+		exported.Unlock()
+	}
+}
+
+func TestEnvFiles(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	defer writeEnvFiles(t, "# The cluster\nECS_CLUSTER=base\n\n  ECS_RESERVED_MEMORY=64\r\nAWS_DEFAULT_REGION=us-west-2\nECS_DISABLE_METRICS=true\n", map[string]string{
+		"10-cluster.conf": "ECS_CLUSTER=dropin\nECS_RESERVED_PORTS=[22, 80]\n",
+		"20-memory.conf":  "ECS_RESERVED_MEMORY=128\nECS_CLUSTER=last\n",
+		"30-ignored.bak":  "ECS_RESERVED_MEMORY=1\n",
+	})()
+	os.Setenv("ECS_DISABLE_METRICS", "false")
+
+	cfg, err := NewStrictConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropInDir := filepath.Join(filepath.Dir(os.Getenv("ECS_AGENT_ENV_FILE_PATH")), "ecs.config.d")
+	expected := map[string]Setting{
+		"Cluster":        {"Cluster", "last", filepath.Join(dropInDir, "20-memory.conf")},
+		"ReservedMemory": {"ReservedMemory", "128", filepath.Join(dropInDir, "20-memory.conf")},
+		"ReservedPorts":  {"ReservedPorts", "[22,80]", filepath.Join(dropInDir, "10-cluster.conf")},
+		"AWSRegion":      {"AWSRegion", "us-west-2", os.Getenv("ECS_AGENT_ENV_FILE_PATH")},
+		"DisableMetrics": {"DisableMetrics", "false", SourceEnvironment},
+	}
+	for _, setting := range Describe(cfg) {
+		if expectedSetting, ok := expected[setting.Name]; ok && setting != expectedSetting {
+			t.Errorf("Expected %v, got %v", expectedSetting, setting)
+		}
+	}
+
+	// Variables are set in the environment as --env-file would, without
+	// overriding it, and are still read from the files after that
+	if os.Getenv("ECS_CLUSTER") != "last" || os.Getenv("ECS_DISABLE_METRICS") != "false" {
+		t.Errorf("Expected the env files to be exported to the environment, got cluster %q", os.Getenv("ECS_CLUSTER"))
+	}
+	cfg, err = NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.sources["Cluster"] == SourceEnvironment {
+		t.Error("Expected the cluster to be read from the env files again")
+	}
+}
+
+func TestEnvFileDataDirEnablesCheckpoint(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	defer writeEnvFiles(t, "AWS_DEFAULT_REGION=us-west-2\nECS_DATADIR=/var/lib/ecs/data\n", nil)()
+
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Checkpoint || cfg.sources["DataDir"] != os.Getenv("ECS_AGENT_ENV_FILE_PATH") {
+		t.Errorf("Expected a data dir from an env file to turn checkpointing on, got %v with the data dir from %v", cfg.Checkpoint, cfg.sources["DataDir"])
+	}
+}
+
+func TestEnvFileProblems(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	defer writeEnvFiles(t, "AWS_DEFAULT_REGION=us-west-2\nECS_CHECKPOINT=maybe\n", map[string]string{
+		"10-typos.conf": "ECS_CLUSTR=typo\nnot a variable\n",
+	})()
+
+	_, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Errorf("Expected the problems to be warnings, got %v", err)
+	}
+	_, err = NewStrictConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err == nil {
+		t.Fatal("Expected the problems to be an error in strict mode")
+	}
+	for _, problem := range []string{
+		`"ECS_CHECKPOINT" in env file ` + os.Getenv("ECS_AGENT_ENV_FILE_PATH") + " line 2",
+		`"ECS_CLUSTR" in env file ` + filepath.Join(os.Getenv("ECS_AGENT_ENV_FILE_PATH")+dropInDirSuffix, "10-typos.conf") + " line 1",
+		"10-typos.conf line 2",
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("Expected %q to be reported, got %v", problem, err)
+		}
+	}
+}
+
+func TestEnvFileVariableRemoved(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	defer writeEnvFiles(t, "AWS_DEFAULT_REGION=us-west-2\nECS_LOGLEVEL=debug\nECS_CLUSTER=removed\n", nil)()
+	os.Setenv("ECS_RESERVED_MEMORY", "64")
+
+	NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if os.Getenv("ECS_LOGLEVEL") != "debug" {
+		t.Fatalf("Expected the log level to be exported, got %q", os.Getenv("ECS_LOGLEVEL"))
+	}
+
+	// As when the file is edited before a reload
+	ioutil.WriteFile(os.Getenv("ECS_AGENT_ENV_FILE_PATH"), []byte("AWS_DEFAULT_REGION=us-west-2\nECS_RESERVED_MEMORY=128\n"), 0644)
+	os.Setenv("ECS_CLUSTER", "set elsewhere")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lookupEnv("ECS_LOGLEVEL"); ok {
+		t.Errorf("Expected the log level removed from the env file to be unset, got %q", os.Getenv("ECS_LOGLEVEL"))
+	}
+	if cfg.Cluster != "set elsewhere" || cfg.ReservedMemory != 64 {
+		t.Errorf("Expected variables set in the environment otherwise to be kept, got %q and %v", cfg.Cluster, cfg.ReservedMemory)
+	}
+}
+
+func TestLookupEnv(t *testing.T) {
+	os.Setenv("ECS_TEST_LOOKUP_EMPTY", "")
+	defer os.Unsetenv("ECS_TEST_LOOKUP_EMPTY")
+	os.Setenv("ECS_TEST_LOOKUP_EMPTY_SUFFIX", "value")
+	defer os.Unsetenv("ECS_TEST_LOOKUP_EMPTY_SUFFIX")
+
+	if value, ok := lookupEnv("ECS_TEST_LOOKUP_EMPTY"); !ok || value != "" {
+		t.Errorf("Expected an empty variable to be set, got %q, %v", value, ok)
+	}
+	if value, ok := lookupEnv("ECS_TEST_LOOKUP_EMPTY_SUFFIX"); !ok || value != "value" {
+		t.Errorf("Expected the value of the variable, got %q, %v", value, ok)
+	}
+	if _, ok := lookupEnv("ECS_TEST_LOOKUP_UNSET"); ok {
+		t.Error("Expected an unset variable not to be set")
+	}
+}
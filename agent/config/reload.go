@@ -0,0 +1,115 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Change is a field of the config whose value differs between two configs.
+type Change struct {
+	Name string
+	Old  string
+	New  string
+	// Reloadable is true if the field has the `reload` tag, and can be
+	// changed while the agent is running.
+	Reloadable bool
+}
+
+// Changes lists the fields whose values differ between old and new. The
+// values of fields with the `sensitive` tag are redacted.
+func Changes(old, new *Config) []Change {
+	oldElem := reflect.ValueOf(old).Elem()
+	newElem := reflect.ValueOf(new).Elem()
+	cfgStructField := oldElem.Type()
+
+	var changes []Change
+	for i := 0; i < oldElem.NumField(); i++ {
+		field := cfgStructField.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		oldValue := oldElem.Field(i).Interface()
+		newValue := newElem.Field(i).Interface()
+		if reflect.DeepEqual(oldValue, newValue) || (unset(oldValue) && unset(newValue)) {
+			continue
+		}
+		change := Change{Name: field.Name, Reloadable: field.Tag.Get("reload") != ""}
+		if field.Tag.Get("sensitive") != "" {
+			change.Old, change.New = redactedValue, redactedValue
+		} else {
+			change.Old, change.New = formatValue(oldValue), formatValue(newValue)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// ApplyReloadable sets the fields with the `reload` tag to their values in
+// from, along with their sources. The sources are copied rather than updated
+// in place, as copies of a config share them.
+func (cfg *Config) ApplyReloadable(from *Config) {
+	cfgElem := reflect.ValueOf(cfg).Elem()
+	fromElem := reflect.ValueOf(from).Elem()
+	cfgStructField := cfgElem.Type()
+
+	sources := make(map[string]string, len(cfg.sources))
+	for name, source := range cfg.sources {
+		sources[name] = source
+	}
+	for i := 0; i < cfgElem.NumField(); i++ {
+		field := cfgStructField.Field(i)
+		if field.Tag.Get("reload") == "" {
+			continue
+		}
+		cfgElem.Field(i).Set(fromElem.Field(i))
+		if source, ok := from.sources[field.Name]; ok {
+			sources[field.Name] = source
+		}
+	}
+	cfg.sources = sources
+}
+
+// Holder holds the config the agent is running with, for what reads the
+// reloadable settings while the config may be reloaded. Reloading replaces
+// the held config with an updated copy rather than changing it in place, so
+// a config returned by Get can be read without further locking.
+type Holder struct {
+	lock sync.RWMutex
+	cfg  *Config
+}
+
+// NewHolder returns a Holder of cfg.
+func NewHolder(cfg *Config) *Holder {
+	return &Holder{cfg: cfg}
+}
+
+// Get returns the current config. It must not be modified.
+func (holder *Holder) Get() *Config {
+	holder.lock.RLock()
+	defer holder.lock.RUnlock()
+	return holder.cfg
+}
+
+// ApplyReloadable replaces the current config with a copy of it that has the
+// reloadable settings of from, and returns the copy.
+func (holder *Holder) ApplyReloadable(from *Config) *Config {
+	holder.lock.Lock()
+	defer holder.lock.Unlock()
+	updated := *holder.cfg
+	updated.ApplyReloadable(from)
+	holder.cfg = &updated
+	return holder.cfg
+}
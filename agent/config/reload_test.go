@@ -0,0 +1,97 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+)
+
+func TestChanges(t *testing.T) {
+	old := DefaultConfig()
+	old.Cluster = "old"
+	old.EngineAuthData = NewSensitiveRawMessage([]byte(`{"registry.tld":{}}`))
+	new := DefaultConfig()
+	new.Cluster = "new"
+	new.ReservedPorts = []uint16{22}
+	new.EngineAuthData = NewSensitiveRawMessage([]byte(`{"other.tld":{}}`))
+	new.StateChangeWebhookURLs = []string{}
+
+	expected := map[string]Change{
+		"Cluster":        {"Cluster", "old", "new", false},
+		"ReservedPorts":  {"ReservedPorts", "[22,2375,2376,51678]", "[22]", true},
+		"EngineAuthData": {"EngineAuthData", redactedValue, redactedValue, true},
+	}
+	changes := Changes(&old, &new)
+	for _, change := range changes {
+		if change != expected[change.Name] {
+			t.Errorf("Expected %v, got %v", expected[change.Name], change)
+		}
+	}
+	if len(changes) != len(expected) {
+		t.Errorf("Expected %d changes, got %v", len(expected), changes)
+	}
+}
+
+func TestApplyReloadable(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	os.Setenv("AWS_DEFAULT_REGION", "us-west-2")
+	os.Setenv("ECS_CLUSTER", "old")
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	running := *cfg
+
+	os.Setenv("ECS_CLUSTER", "new")
+	os.Setenv("ECS_ENGINE_TASK_CLEANUP_WAIT_DURATION", "1h")
+	reloaded, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	running.ApplyReloadable(reloaded)
+
+	if running.TaskCleanupWaitDuration != time.Hour || running.sources["TaskCleanupWaitDuration"] != SourceEnvironment {
+		t.Errorf("Expected the task cleanup wait duration to be applied, got %v from %v", running.TaskCleanupWaitDuration, running.sources["TaskCleanupWaitDuration"])
+	}
+	if running.Cluster != "old" {
+		t.Errorf("Expected the cluster not to be applied, got %q", running.Cluster)
+	}
+	if cfg.sources["TaskCleanupWaitDuration"] != SourceDefault {
+		t.Errorf("Expected the sources of the copied config to be left as is, got %v", cfg.sources["TaskCleanupWaitDuration"])
+	}
+}
+
+func TestHolderApplyReloadable(t *testing.T) {
+	cfg := DefaultConfig()
+	holder := NewHolder(&cfg)
+	reloaded := DefaultConfig()
+	reloaded.Cluster = "new"
+	reloaded.ReservedPorts = []uint16{22}
+
+	updated := holder.ApplyReloadable(&reloaded)
+	if holder.Get() != updated {
+		t.Error("Expected the holder to return the updated config")
+	}
+	if len(updated.ReservedPorts) != 1 || updated.ReservedPorts[0] != 22 || updated.Cluster != "" {
+		t.Errorf("Expected only the reloadable settings to be applied, got %v and %q", updated.ReservedPorts, updated.Cluster)
+	}
+	if len(cfg.ReservedPorts) == 1 {
+		t.Error("Expected the previously held config to be left as is")
+	}
+}
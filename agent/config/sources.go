@@ -0,0 +1,217 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+	"github.com/aws/amazon-ecs-agent/agent/utils"
+)
+
+// defaultConfigFilePath is where the config file is read from unless
+// ECS_AGENT_CONFIG_FILE_PATH is set.
+const defaultConfigFilePath = "/etc/ecs_container_agent/config.json"
+
+// configSource is the config read from one source, with the fields that
+// source set. A field can be set to its zero value, such as a `false` in the
+// environment overriding a `true` in the config file.
+type configSource struct {
+	name   string
+	config Config
+	set    map[string]bool
+}
+
+func newConfigSource(name string) *configSource {
+	return &configSource{name: name, set: make(map[string]bool)}
+}
+
+// problems collects the values which couldn't be used while loading the
+// config. Each is logged as a warning, and they're fatal in strict mode.
+type problems []string
+
+func (p *problems) add(format string, args ...interface{}) {
+	problem := fmt.Sprintf(format, args...)
+	log.Warn(problem)
+	*p = append(*p, problem)
+}
+
+// readEnvironment reads every field with an `env` tag from the environment
+// variable it names. Empty variables are unset, and so are variables set in
+// the environment from env files, which are read from the files instead.
+func readEnvironment(problems *problems) *configSource {
+	source := newConfigSource(SourceEnvironment)
+	lookup := func(name string) string {
+		if exportedFromEnvFile(name) {
+			return ""
+		}
+		return os.Getenv(name)
+	}
+	describe := func(name string) string {
+		return strconv.Quote(name) + " environment variable"
+	}
+	readVariables(source, lookup, describe, problems)
+	return source
+}
+
+// readVariables reads every field with an `env` tag from the variable it
+// names, as returned by lookup. Problems refer to variables as describe
+// returns them.
+func readVariables(source *configSource, lookup func(name string) string, describe func(name string) string, problems *problems) {
+	cfgElem := reflect.ValueOf(&source.config).Elem()
+	cfgStructField := cfgElem.Type()
+
+	for i := 0; i < cfgElem.NumField(); i++ {
+		field := cfgStructField.Field(i)
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		value := lookup(name)
+		if field.Tag.Get("trim") != "" || field.Type.Kind() != reflect.String {
+			value = strings.TrimSpace(value)
+		}
+		if value == "" {
+			continue
+		}
+		err := parseEnvironmentValue(cfgElem.Field(i), value)
+		if err != nil {
+			problems.add("Invalid format for %s: %v", describe(name), err)
+			continue
+		}
+		source.set[field.Name] = true
+	}
+}
+
+// parseEnvironmentValue sets field to the value of an environment variable.
+// Lists are JSON arrays, and maps JSON objects.
+func parseEnvironmentValue(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(value)
+	case bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("expected true or false, got " + strconv.Quote(value))
+		}
+		field.SetBool(parsed)
+	case uint16:
+		parsed, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return errors.New("expected an unsigned integer below 65536, got " + strconv.Quote(value))
+		}
+		field.SetUint(parsed)
+	case time.Duration:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("expected a duration like \"90s\", got " + strconv.Quote(value))
+		}
+		field.SetInt(int64(parsed))
+	case *SensitiveRawMessage:
+		field.Set(reflect.ValueOf(NewSensitiveRawMessage([]byte(value))))
+	default:
+		err := json.Unmarshal([]byte(value), field.Addr().Interface())
+		if err != nil && field.Kind() == reflect.Map {
+			return fmt.Errorf("expected a JSON object: %v", err)
+		} else if err != nil {
+			return fmt.Errorf("expected a JSON array: %v", err)
+		}
+	}
+	return nil
+}
+
+// readFile reads the JSON config file. Its keys are the names of the fields
+// of Config, and keys with a null value are unset.
+func readFile(problems *problems) *configSource {
+	source := newConfigSource(SourceFile)
+	path := utils.DefaultIfBlank(os.Getenv("ECS_AGENT_CONFIG_FILE_PATH"), defaultConfigFilePath)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			problems.add("Unable to read config file %s: %v", path, err)
+		}
+		return source
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		// empty file, not an error
+		return source
+	}
+	var values map[string]json.RawMessage
+	err = json.Unmarshal(data, &values)
+	if err != nil {
+		problems.add("Error reading config file %s: %v", path, err)
+		return source
+	}
+
+	cfgElem := reflect.ValueOf(&source.config).Elem()
+	for key, value := range values {
+		// Keys are matched to fields as encoding/json would
+		field, ok := cfgElem.Type().FieldByNameFunc(func(name string) bool {
+			return strings.EqualFold(name, key)
+		})
+		if !ok || field.PkgPath != "" {
+			problems.add("Unknown key %q in config file %s", key, path)
+			continue
+		}
+		if string(value) == "null" {
+			continue
+		}
+		err = json.Unmarshal(value, cfgElem.FieldByIndex(field.Index).Addr().Interface())
+		if err != nil {
+			problems.add("Invalid value for %q in config file %s: %v", key, path, err)
+			continue
+		}
+		source.set[field.Name] = true
+	}
+	source.config.trimWhitespace()
+
+	// Handle any deprecated keys correctly here
+	if !source.set["Cluster"] && source.set["ClusterArn"] {
+		source.config.Cluster = source.config.ClusterArn
+		source.set["Cluster"] = true
+	}
+	return source
+}
+
+func ec2MetadataConfig(ec2client ec2.EC2MetadataClient) *configSource {
+	source := newConfigSource(SourceEC2Metadata)
+	iid, err := ec2client.InstanceIdentityDocument()
+	if err != nil {
+		log.Crit("Unable to communicate with EC2 Metadata service to infer region: " + err.Error())
+		return source
+	}
+	source.config.AWSRegion = iid.Region
+	source.set["AWSRegion"] = true
+	return source
+}
+
+// defaultSource sets every field, to its value in DefaultConfig.
+func defaultSource() *configSource {
+	source := newConfigSource(SourceDefault)
+	source.config = DefaultConfig()
+	cfgStructField := reflect.TypeOf(source.config)
+	for i := 0; i < cfgStructField.NumField(); i++ {
+		source.set[cfgStructField.Field(i).Name] = true
+	}
+	return source
+}
@@ -28,81 +28,193 @@ type Config struct {
 	// Cluster can either be the Name or full ARN of a Cluster. This is the
 	// cluster the agent should register this ContainerInstance into. If this
 	// value is not set, it will default to "default"
-	Cluster string `trim:"true"`
+	Cluster string `env:"ECS_CLUSTER" trim:"true"`
 	// APIEndpoint is the endpoint, such as "ecs.us-east-1.amazonaws.com", to
 	// make calls against. If this value is not set, it will default to the
 	// endpoint for your current AWSRegion
-	APIEndpoint string `trim:"true"`
+	APIEndpoint string `env:"ECS_BACKEND_HOST" trim:"true"`
 	// DockerEndpoint is the address the agent will attempt to connect to the
 	// Docker daemon at. This should have the same value as "DOCKER_HOST"
 	// normally would to interact with the daemon. It defaults to
 	// unix:///var/run/docker.sock
-	DockerEndpoint string
+	DockerEndpoint string `env:"DOCKER_HOST"`
 	// AWSRegion is the region to run in (such as "us-east-1"). This value will
 	// be inferred from the EC2 metadata service, but if it cannot be found this
 	// will be fatal.
-	AWSRegion string `missing:"fatal" trim:"true"`
+	AWSRegion string `env:"AWS_DEFAULT_REGION" missing:"fatal" trim:"true"`
 
 	// ReservedPorts is an array of ports which should be registerd as
 	// unavailable. If not set, they default to [22,2375,2376,51678].
-	ReservedPorts []uint16
+	ReservedPorts []uint16 `env:"ECS_RESERVED_PORTS" reload:"true"`
 	// ReservedPortsUDP is an array of UDP ports which should be registered as
 	// unavailable. If not set, it defaults to [].
-	ReservedPortsUDP []uint16
+	ReservedPortsUDP []uint16 `env:"ECS_RESERVED_PORTS_UDP" reload:"true"`
 
 	// DataDir is the directory data is saved to in order to preserve state
 	// across agent restarts. It is only used if "Checkpoint" is true as well.
-	DataDir string
+	DataDir string `env:"ECS_DATADIR"`
 	// Checkpoint configures whether data should be periodically to a checkpoint
 	// file, in DataDir, such that on instance or agent restarts it will resume
 	// as the same ContainerInstance. It defaults to false.
-	Checkpoint bool
+	Checkpoint bool `env:"ECS_CHECKPOINT"`
+	// StateStore is how state is checkpointed in DataDir; "json" for a file
+	// rewritten on each save, or "boltdb" for a database with a record for
+	// each task and container, which are only written when they change.
+	StateStore string `env:"ECS_STATE_STORE" trim:"true"`
+	// StateEncryptionKeyFile, if set, is a file with the keys checkpointed
+	// state is encrypted with, one base64 encoded 32 byte key per line. The
+	// first key encrypts; the others can still decrypt state saved before the
+	// keys were rotated.
+	StateEncryptionKeyFile string `env:"ECS_STATE_ENCRYPTION_KEY_FILE" trim:"true"`
+	// StateEncryptionKeyCmd, if set, is a command printing the keys in the
+	// format of StateEncryptionKeyFile, for keys kept in a secret store. It's
+	// split on whitespace and run without a shell.
+	StateEncryptionKeyCmd string `env:"ECS_STATE_ENCRYPTION_KEY_COMMAND" trim:"true"`
+
+	// StandaloneTaskDir, if set, runs the agent without the ECS backend: it
+	// doesn't register a container instance or connect to ACS or TCS, and
+	// instead runs the tasks described by the JSON files in this directory.
+	// AWSRegion isn't required in this mode.
+	StandaloneTaskDir string `env:"ECS_STANDALONE_TASK_DIR" trim:"true"`
+	// StandaloneEventsFile is the path of a file to which state changes are
+	// appended as JSON lines in standalone mode. They're only logged if it
+	// isn't set.
+	StandaloneEventsFile string `env:"ECS_STANDALONE_EVENTS_FILE" trim:"true"`
+
+	// RecordDir, if set, is a directory in which a journal of the agent's
+	// interactions with ACS and docker is recorded, for replaying them in
+	// tests. A new journal is started every time the agent starts.
+	RecordDir string `env:"ECS_RECORD_DIR" trim:"true"`
 
 	// EngineAuthType configures what type of data is in EngineAuthData.
 	// Supported types, right now, can be found in the dockerauth package: https://godoc.org/github.com/aws/amazon-ecs-agent/agent/engine/dockerauth
-	EngineAuthType string `trim:"true"`
+	EngineAuthType string `env:"ECS_ENGINE_AUTH_TYPE" trim:"true" reload:"true"`
 	// EngineAuthData contains authentication data. Please see the documentation
 	// for EngineAuthType for more information.
-	EngineAuthData *SensitiveRawMessage
+	EngineAuthData *SensitiveRawMessage `env:"ECS_ENGINE_AUTH_DATA" sensitive:"true" reload:"true"`
 
 	// UpdatesEnabled specifies whether updates should be applied to this agent.
 	// Default true
-	UpdatesEnabled bool
+	UpdatesEnabled bool `env:"ECS_UPDATES_ENABLED"`
 	// UpdateDownloadDir specifies where new agent versions should be placed
 	// within the container in order for the external updating process to
 	// correctly handle them.
-	UpdateDownloadDir string
+	UpdateDownloadDir string `env:"ECS_UPDATE_DOWNLOAD_DIR"`
 
 	// DisableMetrics configures whether task utilization metrics should be
 	// sent to the ECS telemetry endpoint
-	DisableMetrics bool
-
-	// DockerGraphPath specifies the path for docker graph directory.
-	DockerGraphPath string
+	DisableMetrics bool `env:"ECS_DISABLE_METRICS"`
+	// TelemetryBufferRetention is how long metrics which couldn't be
+	// delivered to the telemetry endpoint, or weren't acknowledged, are kept
+	// to be sent again after reconnecting. It defaults to 5 minutes.
+	TelemetryBufferRetention time.Duration `env:"ECS_TELEMETRY_BUFFER_RETENTION"`
+
+	// PrometheusMetricsEnabled configures whether the agent's own operational
+	// metrics are served, in the Prometheus text format, at /metrics on the
+	// introspection server. It defaults to false.
+	PrometheusMetricsEnabled bool `env:"ECS_ENABLE_PROMETHEUS_METRICS"`
+
+	// StatsDEndpoint is the host:port of a StatsD server to which container
+	// utilization samples are sent over UDP. Sinks are independent of
+	// DisableMetrics.
+	StatsDEndpoint string `env:"ECS_STATSD_ENDPOINT" trim:"true"`
+	// GraphiteEndpoint is the host:port of a Graphite server to which
+	// container utilization samples are sent using the plaintext protocol.
+	GraphiteEndpoint string `env:"ECS_GRAPHITE_ENDPOINT" trim:"true"`
+	// StatsFile is the path of a file to which container utilization samples
+	// are appended as JSON lines.
+	StatsFile string `env:"ECS_STATS_FILE" trim:"true"`
+	// StatsSinkInterval is how often container utilization samples are
+	// written to the configured sinks. It defaults to 10 seconds.
+	StatsSinkInterval time.Duration `env:"ECS_STATS_SINK_INTERVAL"`
+
+	// DockerGraphPath specifies the path for docker graph directory. It was
+	// used to find the libcontainer state files of containers, and is no
+	// longer used now that stats are read from cgroups directly.
+	DockerGraphPath string `env:"ECS_DOCKER_GRAPHPATH"`
+
+	// HostProcPath is where the host's procfs is mounted. Network stats of
+	// containers are read from it. It defaults to /proc.
+	HostProcPath string `env:"ECS_HOST_PROC_PATH"`
+
+	// StatsCollector is where container stats are read from; "cgroup" for the
+	// host's cgroup filesystem, or "docker" for the Docker remote API. The
+	// other is used if the preferred one keeps failing. It defaults to
+	// "cgroup".
+	StatsCollector string `env:"ECS_STATS_COLLECTOR" trim:"true"`
+
+	// StatsAlertRules raise alerts when a metric of a container stays above
+	// a threshold. Alerts are logged, listed on the introspection server and
+	// posted to StatsAlertWebhookURL.
+	StatsAlertRules []StatsAlertRule `env:"ECS_STATS_ALERT_RULES"`
+	// StatsAlertWebhookURL receives a JSON POST whenever an alert fires or
+	// resolves.
+	StatsAlertWebhookURL string `env:"ECS_STATS_ALERT_WEBHOOK_URL" trim:"true"`
+
+	// StateChangeWebhookURLs receive a JSON POST for every task and container
+	// state change the agent submits to ECS. Deliveries to each URL are
+	// retried independently and never hold up submission to ECS.
+	StateChangeWebhookURLs []string `env:"ECS_STATE_CHANGE_WEBHOOK_URLS"`
+	// StateChangeWebhookSecret, if set, is used to sign the body of every
+	// state change delivery with HMAC-SHA256.
+	StateChangeWebhookSecret string `env:"ECS_STATE_CHANGE_WEBHOOK_SECRET" sensitive:"true"`
 
 	// ReservedMemory specifies the amount of memory (in MB) to reserve for things
 	// other than containers managed by ECS
-	ReservedMemory uint16
+	ReservedMemory uint16 `env:"ECS_RESERVED_MEMORY"`
 
 	// AvailableLoggingDrivers specifies the logging drivers available for use
 	// with Docker.  If not set, it defaults to ["json-file"].
-	AvailableLoggingDrivers []dockerclient.LoggingDriver
+	AvailableLoggingDrivers []dockerclient.LoggingDriver `env:"ECS_AVAILABLE_LOGGING_DRIVERS" reload:"true"`
 
 	// PrivilegedDisabled specified whether the Agent is capable of launching
 	// tasks with privileged containers
-	PrivilegedDisabled bool
+	PrivilegedDisabled bool `env:"ECS_DISABLE_PRIVILEGED" reload:"true"`
 
 	// SELinxuCapable specifies whether the Agent is capable of using SELinux
 	// security options
-	SELinuxCapable bool
+	SELinuxCapable bool `env:"ECS_SELINUX_CAPABLE" reload:"true"`
 
 	// AppArmorCapable specifies whether the Agent is capable of using AppArmor
 	// security options
-	AppArmorCapable bool
+	AppArmorCapable bool `env:"ECS_APPARMOR_CAPABLE" reload:"true"`
 
 	// TaskCleanupWaitDuration specifies the time to wait after a task is stopped
 	// until cleanup of task resources is started.
-	TaskCleanupWaitDuration time.Duration
+	TaskCleanupWaitDuration time.Duration `env:"ECS_ENGINE_TASK_CLEANUP_WAIT_DURATION" reload:"true"`
+
+	// InstanceAttributes are custom attributes the container instance is
+	// registered with, by name, for placement constraints to target. They
+	// must follow the ECS rules for attribute names and values.
+	InstanceAttributes map[string]string `env:"ECS_INSTANCE_ATTRIBUTES" reload:"true"`
+
+	// StrictConfig makes any value which can't be parsed or is out of range
+	// an error when loading the config, rather than a warning after which the
+	// value is ignored or overridden with its default.
+	StrictConfig bool `env:"ECS_STRICT_CONFIG"`
+
+	// sources records the source each field was set from, by field name. It's
+	// filled in by NewConfig.
+	sources map[string]string
+}
+
+// StatsAlertRule fires an alert for a container when a metric stays above a
+// threshold for a duration, like "memoryUtilizationPerc above 90 for 2m".
+type StatsAlertRule struct {
+	Name      string  `json:"name"`
+	Metric    string  `json:"metric"`
+	Threshold float64 `json:"threshold"`
+	// For is a duration like "2m". The alert fires as soon as the threshold
+	// is crossed if it's empty.
+	For string `json:"for"`
+}
+
+// Duration parses For.
+func (rule StatsAlertRule) Duration() (time.Duration, error) {
+	if rule.For == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(rule.For)
 }
 
 // SensitiveRawMessage is a struct to store some data that should not be logged
@@ -0,0 +1,65 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+	"github.com/aws/amazon-ecs-agent/agent/handlers"
+)
+
+var configCommand = &command{
+	name:        "config",
+	usage:       "[-agent endpoint | -local] [-json]",
+	description: "Show the effective config of the agent with the source of every value. Secrets are redacted.",
+}
+
+func init() {
+	configCommand.run = runConfig
+}
+
+func runConfig(args []string, out io.Writer) error {
+	flags := newFlagSet(configCommand)
+	agent := addAgentFlag(flags)
+	local := flags.Bool("local", false, "Read the config from the environment and config file of this process, as the agent would, rather than asking the agent")
+	asJSON := flags.Bool("json", false, "Print the settings as JSON")
+	if err := parseFlags(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	var resp handlers.ConfigResponse
+	if *local {
+		cfg, err := config.NewConfig(ec2.DefaultClient)
+		if err != nil {
+			// The config is still shown, since it's what the agent would
+			// have to work with
+			fmt.Fprintln(os.Stderr, "Warning: the agent wouldn't start with this config:", err)
+		}
+		resp.Settings = config.Describe(cfg)
+	} else {
+		err := newIntrospectionClient(*agent).get("/v1/config", nil, &resp)
+		if err != nil {
+			return err
+		}
+	}
+	if *asJSON {
+		return writeJSON(out, &resp)
+	}
+
+	return config.PrintSettings(out, resp.Settings)
+}
@@ -0,0 +1,188 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
+)
+
+// eventsFilePollInterval is how often a followed events file is checked for
+// new lines.
+const eventsFilePollInterval = 500 * time.Millisecond
+
+var eventsCommand = &command{
+	name:        "events",
+	usage:       "(-file path [-from-start] | -listen address [-secret secret]) [-json]",
+	description: "Follow task and container state changes, from the events file of standalone mode or by receiving them as a state change webhook.",
+}
+
+func init() {
+	eventsCommand.run = runEvents
+}
+
+func runEvents(args []string, out io.Writer) error {
+	flags := newFlagSet(eventsCommand)
+	file := flags.String("file", "", "Follow the events file of standalone mode (ECS_STANDALONE_EVENTS_FILE)")
+	fromStart := flags.Bool("from-start", false, "Print the changes already in the events file before following it")
+	listen := flags.String("listen", "", "Listen for state change webhook deliveries on this address, like localhost:9000, for an agent with ECS_STATE_CHANGE_WEBHOOK_URLS pointing at it")
+	secret := flags.String("secret", "", "Reject webhook deliveries which aren't signed with this secret (ECS_STATE_CHANGE_WEBHOOK_SECRET)")
+	asJSON := flags.Bool("json", false, "Print every change as a line of JSON")
+	if err := parseFlags(flags, args, 0, 0); err != nil {
+		return err
+	}
+	if (*file == "") == (*listen == "") {
+		return errUsage("Exactly one of -file and -listen is required")
+	}
+
+	printer := &eventPrinter{out: out, asJSON: *asJSON}
+	if *file != "" {
+		return followEventsFile(*file, *fromStart, printer, nil)
+	}
+	fmt.Fprintln(os.Stderr, "Listening for state changes on", *listen)
+	return http.ListenAndServe(*listen, newWebhookHandler([]byte(*secret), printer))
+}
+
+// eventPrinter prints state changes as they arrive.
+type eventPrinter struct {
+	lock   sync.Mutex
+	out    io.Writer
+	asJSON bool
+}
+
+func (printer *eventPrinter) print(notification *eventhandler.StateChangeNotification) {
+	printer.lock.Lock()
+	defer printer.lock.Unlock()
+	if printer.asJSON {
+		data, _ := json.Marshal(notification)
+		fmt.Fprintln(printer.out, string(data))
+		return
+	}
+	fmt.Fprintln(printer.out, formatEvent(notification))
+}
+
+// formatEvent returns a line describing a state change.
+func formatEvent(notification *eventhandler.StateChangeNotification) string {
+	fields := []string{notification.Time.Format(time.RFC3339), notification.Type, notification.TaskArn}
+	if notification.ContainerName != "" {
+		fields = append(fields, notification.ContainerName)
+	}
+	fields = append(fields, notification.Status)
+	if notification.ExitCode != nil {
+		fields = append(fields, fmt.Sprintf("exitCode=%d", *notification.ExitCode))
+	}
+	for _, binding := range notification.NetworkBindings {
+		fields = append(fields, fmt.Sprintf("%s:%d->%d/%s", binding.BindIP, binding.HostPort, binding.ContainerPort, binding.Protocol))
+	}
+	if notification.Reason != "" {
+		fields = append(fields, fmt.Sprintf("reason=%q", notification.Reason))
+	}
+	return strings.Join(fields, " ")
+}
+
+// followEventsFile prints the changes appended to an events file until done
+// is closed. The file is read again from the start if it's truncated.
+func followEventsFile(path string, fromStart bool, printer *eventPrinter, done <-chan struct{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	offset := int64(0)
+	if !fromStart {
+		offset, err = file.Seek(0, os.SEEK_END)
+		if err != nil {
+			return err
+		}
+	}
+
+	reader := bufio.NewReader(file)
+	partial := ""
+	for {
+		line, err := reader.ReadString('\n')
+		offset += int64(len(line))
+		if err == nil {
+			printEventLine(partial+line, printer)
+			partial = ""
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+		// Keep the start of a line still being written
+		partial += line
+
+		select {
+		case <-done:
+			return nil
+		case <-time.After(eventsFilePollInterval):
+		}
+		if info, err := file.Stat(); err == nil && info.Size() < offset {
+			offset, partial = 0, ""
+			if _, err := file.Seek(0, os.SEEK_SET); err != nil {
+				return err
+			}
+		}
+		reader.Reset(file)
+	}
+}
+
+func printEventLine(line string, printer *eventPrinter) {
+	notification := &eventhandler.StateChangeNotification{}
+	err := json.Unmarshal([]byte(line), notification)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Skipping invalid line:", strings.TrimSpace(line))
+		return
+	}
+	printer.print(notification)
+}
+
+// newWebhookHandler returns a handler receiving state change webhook
+// deliveries. Deliveries without a valid signature are rejected if secret
+// isn't empty.
+func newWebhookHandler(secret []byte, printer *eventPrinter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(secret) > 0 {
+			expected := "sha256=" + eventhandler.SignWebhookBody(secret, body)
+			if !hmac.Equal([]byte(r.Header.Get(eventhandler.WebhookSignatureHeader)), []byte(expected)) {
+				fmt.Fprintln(os.Stderr, "Rejected a delivery with an invalid signature from", r.RemoteAddr)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		notification := &eventhandler.StateChangeNotification{}
+		err = json.Unmarshal(body, notification)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		printer.print(notification)
+	})
+}
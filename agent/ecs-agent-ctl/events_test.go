@@ -0,0 +1,112 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
+)
+
+// syncBuffer is a buffer written to and read by different goroutines.
+type syncBuffer struct {
+	lock   sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (buffer *syncBuffer) Write(data []byte) (int, error) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	return buffer.buffer.Write(data)
+}
+
+func (buffer *syncBuffer) String() string {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	return buffer.buffer.String()
+}
+
+const (
+	runningEvent = `{"type":"task","cluster":"default","taskArn":"arn:task","status":"RUNNING","time":"2015-11-10T20:00:00Z"}` + "\n"
+	stoppedEvent = `{"type":"container","cluster":"default","taskArn":"arn:task","containerName":"app","status":"STOPPED","exitCode":1,"time":"2015-11-10T20:01:00Z"}` + "\n"
+)
+
+func TestFollowEventsFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "ecs-agent-ctl-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(runningEvent)
+
+	out := &syncBuffer{}
+	done := make(chan struct{})
+	followed := make(chan error)
+	go func() {
+		followed <- followEventsFile(file.Name(), true, &eventPrinter{out: out}, done)
+	}()
+
+	// The second event is written in two parts, like a line still being
+	// appended
+	time.Sleep(2 * eventsFilePollInterval)
+	file.WriteString(stoppedEvent[:20])
+	time.Sleep(2 * eventsFilePollInterval)
+	file.WriteString(stoppedEvent[20:])
+	file.Close()
+	time.Sleep(2 * eventsFilePollInterval)
+	close(done)
+	if err := <-followed; err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "2015-11-10T20:00:00Z task arn:task RUNNING\n" +
+		"2015-11-10T20:01:00Z container arn:task app STOPPED exitCode=1\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	out := &syncBuffer{}
+	server := httptest.NewServer(newWebhookHandler([]byte("secret"), &eventPrinter{out: out, asJSON: true}))
+	defer server.Close()
+
+	post := func(signature string) int {
+		req, _ := http.NewRequest("POST", server.URL, strings.NewReader(runningEvent))
+		req.Header.Set(eventhandler.WebhookSignatureHeader, signature)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := post("sha256=invalid"); status != http.StatusUnauthorized {
+		t.Errorf("Expected an invalid signature to be rejected, got %d", status)
+	}
+	if status := post("sha256=" + eventhandler.SignWebhookBody([]byte("secret"), []byte(runningEvent))); status != http.StatusOK {
+		t.Errorf("Expected a signed delivery to be accepted, got %d", status)
+	}
+	if !strings.Contains(out.String(), `"taskArn":"arn:task"`) || strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("Expected the signed delivery to be printed once, got %s", out.String())
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+)
+
+const introspectionTimeout = 5 * time.Second
+
+// defaultAgentEndpoint is where the introspection API of an agent running on
+// the same host listens.
+var defaultAgentEndpoint = "http://localhost:" + strconv.Itoa(config.AGENT_INTROSPECTION_PORT)
+
+// introspectionClient calls the introspection API of an agent.
+type introspectionClient struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+// addAgentFlag adds the flag selecting the agent to talk to to a command.
+func addAgentFlag(flags *flag.FlagSet) *string {
+	return flags.String("agent", defaultAgentEndpoint, "Endpoint of the introspection API of the agent")
+}
+
+func newIntrospectionClient(endpoint string) *introspectionClient {
+	return &introspectionClient{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		httpClient: &http.Client{Timeout: introspectionTimeout},
+	}
+}
+
+// get calls an API and decodes its JSON response into out.
+func (client *introspectionClient) get(path string, query url.Values, out interface{}) error {
+	requestURL := client.endpoint + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	resp, err := client.httpClient.Get(requestURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(path + " returned " + resp.Status)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// writeJSON writes a value as indented JSON.
+func writeJSON(out io.Writer, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
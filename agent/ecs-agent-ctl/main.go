@@ -0,0 +1,157 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// ecs-agent-ctl is a command line tool for operators of the agent. It lists
+// and describes tasks through the introspection API, inspects the state file
+// offline, shows the effective config, renders the docker config of a task
+// and follows state changes.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	exitSuccess = 0
+	exitError   = 1
+	exitUsage   = 2
+)
+
+// command is a subcommand of the tool. run is given the arguments following
+// the name of the command.
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(args []string, out io.Writer) error
+}
+
+var commands = []*command{
+	tasksCommand,
+	taskCommand,
+	stateCommand,
+	configCommand,
+	renderCommand,
+	eventsCommand,
+}
+
+// errUsage is returned by commands given invalid arguments; the usage of the
+// command is printed after the error. An empty errUsage means the usage was
+// printed already.
+type errUsage string
+
+func (err errUsage) Error() string {
+	return string(err)
+}
+
+func main() {
+	os.Exit(_main(os.Args[1:]))
+}
+
+func _main(args []string) int {
+	defer log.Flush()
+	// The packages of the agent log to stdout, which is where the output of
+	// the commands goes
+	logger.SetLevel(os.Getenv(logger.LOGLEVEL_ENV_VAR))
+	if os.Getenv(logger.LOGLEVEL_ENV_VAR) == "" {
+		logger.SetLevel("none")
+	}
+
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	err := cmd.run(args[1:], os.Stdout)
+	switch err := err.(type) {
+	case nil:
+		return exitSuccess
+	case errUsage:
+		if err == "" {
+			// The flag set printed the usage already
+			return exitUsage
+		}
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintf(os.Stderr, "Usage: ecs-agent-ctl %s %s\n", cmd.name, cmd.usage)
+		return exitUsage
+	default:
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: ecs-agent-ctl <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	names := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// Only the first sentence of the description is listed
+		summary := strings.SplitN(findCommand(name).description, ". ", 2)[0]
+		fmt.Fprintf(w, "  %-8s %s\n", name, strings.TrimSuffix(summary, "."))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'ecs-agent-ctl <command> -h' for the arguments of a command.")
+}
+
+// newFlagSet returns the flag set of a command. Parsing errors are returned
+// rather than exiting, and the usage printed on -h includes the positional
+// arguments of the command.
+func newFlagSet(cmd *command) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ecs-agent-ctl %s %s\n\n%s\n\n", cmd.name, cmd.usage, cmd.description)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses the arguments of a command and checks the number of
+// positional arguments left.
+func parseFlags(flags *flag.FlagSet, args []string, minArgs, maxArgs int) error {
+	if err := flags.Parse(args); err != nil {
+		// The flag set prints the error and the usage itself
+		return errUsage("")
+	}
+	if flags.NArg() < minArgs || flags.NArg() > maxArgs {
+		return errUsage("Wrong number of arguments: " + strings.Join(flags.Args(), " "))
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/standalone"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// randomSuffixPlaceholder stands for the random suffix of the names of
+// docker containers, which is only chosen when they're created.
+const randomSuffixPlaceholder = "{random}"
+
+var renderCommand = &command{
+	name:        "render",
+	usage:       "[-container name] <task file>",
+	description: "Render the docker Config and HostConfig the agent would create the containers of a task with. The task file is in the format of standalone mode.",
+}
+
+func init() {
+	renderCommand.run = runRender
+}
+
+// renderedContainer is what the agent would pass to docker to create a
+// container.
+type renderedContainer struct {
+	Name       string
+	DockerName string
+	Config     *docker.Config     `json:",omitempty"`
+	HostConfig *docker.HostConfig `json:",omitempty"`
+	Error      string             `json:",omitempty"`
+}
+
+func runRender(args []string, out io.Writer) error {
+	flags := newFlagSet(renderCommand)
+	containerName := flags.String("container", "", "Only render the container with this name")
+	if err := parseFlags(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	task, err := standalone.ReadTaskFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	rendered, err := renderTask(task, *containerName)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(out, rendered)
+	if err != nil {
+		return err
+	}
+	for _, container := range rendered {
+		if container.Error != "" {
+			return errors.New("the agent can't create container " + container.Name + ": " + container.Error)
+		}
+	}
+	return nil
+}
+
+// renderTask renders the containers of a task, or only the named one.
+// Containers the agent would fail to create are rendered with the error.
+func renderTask(task *api.Task, containerName string) ([]*renderedContainer, error) {
+	task.PostUnmarshalTask()
+	// Empty volumes are created by docker for an internal container, so
+	// their host path is only known once it has run
+	for _, volume := range task.Volumes {
+		if empty, ok := volume.Volume.(*api.EmptyHostVolume); ok && empty.HostPath == "" {
+			empty.HostPath = "{empty volume " + volume.Name + "}"
+		}
+	}
+
+	// Links and volumes refer to the other containers by their docker names
+	containerMap := make(map[string]*api.DockerContainer)
+	for _, container := range task.Containers {
+		containerMap[container.Name] = &api.DockerContainer{
+			DockerName: engine.ContainerNamePrefix(task, container) + randomSuffixPlaceholder,
+			Container:  container,
+		}
+	}
+
+	var rendered []*renderedContainer
+	for _, container := range task.Containers {
+		if containerName != "" && container.Name != containerName {
+			continue
+		}
+		result := &renderedContainer{
+			Name:       container.Name,
+			DockerName: containerMap[container.Name].DockerName,
+		}
+		hostConfig, hcerr := task.DockerHostConfig(container, containerMap)
+		config, err := task.DockerConfig(container)
+		if hcerr != nil {
+			result.Error = hcerr.Error()
+		} else if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Config = config
+			result.HostConfig = hostConfig
+		}
+		rendered = append(rendered, result)
+	}
+	if len(rendered) == 0 {
+		return nil, errors.New("the task has no container " + containerName)
+	}
+	return rendered, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+)
+
+func TestRenderTask(t *testing.T) {
+	task := &api.Task{
+		Arn:     "arn:task",
+		Family:  "web",
+		Version: "1",
+		Containers: []*api.Container{
+			{Name: "app", Image: "nginx", Links: []string{"db:database"}, Ports: []api.PortBinding{{ContainerPort: 80, HostPort: 8080}}},
+			{Name: "db", Image: "redis"},
+		},
+	}
+	rendered, err := renderTask(task, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rendered) != 1 || rendered[0].Error != "" {
+		t.Fatalf("Expected the app container to be rendered, got %v", rendered)
+	}
+	if rendered[0].DockerName != "ecs-web-1-app-{random}" || rendered[0].Config.Image != "nginx" {
+		t.Errorf("Wrong container rendered: %v", rendered[0])
+	}
+	if !reflect.DeepEqual(rendered[0].HostConfig.Links, []string{"ecs-web-1-db-{random}:database"}) {
+		t.Errorf("Wrong links: %v", rendered[0].HostConfig.Links)
+	}
+	if _, err := renderTask(task, "missing"); err == nil {
+		t.Error("Expected an error rendering a missing container")
+	}
+}
+
+func TestRenderInvalidContainer(t *testing.T) {
+	task := &api.Task{
+		Family:     "web",
+		Version:    "1",
+		Containers: []*api.Container{{Name: "app", Image: "nginx", Links: []string{"missing"}}},
+	}
+	rendered, err := renderTask(task, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered[0].Error == "" || rendered[0].Config != nil {
+		t.Errorf("Expected the error creating the container, got %v", rendered[0])
+	}
+}
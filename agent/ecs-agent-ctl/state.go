@@ -0,0 +1,387 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/statemanager"
+	utilatomic "github.com/aws/amazon-ecs-agent/agent/utils/atomic"
+)
+
+const (
+	// stateFileName is the name of the state file in the data directory.
+	stateFileName = "ecs_agent_data.json"
+	// databaseFileName is the name of the state database in the data
+	// directory, used instead of the state file with ECS_STATE_STORE=boltdb.
+	databaseFileName = "ecs_agent_data.db"
+	// defaultStatePath is where the data directory of the agent is usually
+	// mounted from on the host.
+	defaultStatePath = "/var/lib/ecs/data/" + stateFileName
+)
+
+var stateCommand = &command{
+	name:  "state",
+	usage: "<show | validate | migrate> [state file or data directory]",
+	description: "Pretty-print, validate or migrate the state file of a stopped agent. It defaults to " + defaultStatePath + ". " +
+		"The state database is read instead if a data directory only has that.",
+}
+
+var stateMigrateCommand = &command{
+	name:  "state migrate",
+	usage: "[-to version] [-force] [-o output file] [state file or data directory]",
+	description: "Upgrade or downgrade the state file of a stopped agent to the version another release of the agent saves, " +
+		"in place unless -o is given. The original file is kept with the old version as a suffix.",
+}
+
+func init() {
+	stateCommand.run = runState
+	stateMigrateCommand.run = runStateMigrate
+}
+
+// statePath returns the state file given as the argument at index, if any.
+func statePath(flags *flag.FlagSet, index int) string {
+	path := defaultStatePath
+	if flags.NArg() > index {
+		path = flags.Arg(index)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		dir := path
+		path = filepath.Join(dir, stateFileName)
+		if _, err := os.Stat(path); os.IsNotExist(err) && fileExists(filepath.Join(dir, databaseFileName)) {
+			path = filepath.Join(dir, databaseFileName)
+		}
+	}
+	return path
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// isDatabase returns true if path is a state database rather than a file.
+func isDatabase(path string) bool {
+	return filepath.Ext(path) == filepath.Ext(databaseFileName)
+}
+
+func runState(args []string, out io.Writer) error {
+	if len(args) > 0 && args[0] == "migrate" {
+		// migrate has flags of its own following it
+		return stateMigrateCommand.run(args[1:], out)
+	}
+	flags := newFlagSet(stateCommand)
+	if err := parseFlags(flags, args, 1, 2); err != nil {
+		return err
+	}
+	path := statePath(flags, 1)
+
+	switch flags.Arg(0) {
+	case "show":
+		return showState(path, out)
+	case "validate":
+		return validateState(path, out)
+	}
+	return errUsage("Unknown state command: " + flags.Arg(0))
+}
+
+func showState(path string, out io.Writer) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if isDatabase(path) {
+		// Show the database in the layout of the state file
+		data, err = databaseJSON(path)
+		if err != nil {
+			return err
+		}
+	}
+	var indented bytes.Buffer
+	err = json.Indent(&indented, data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%s isn't valid JSON: %v", path, err)
+	}
+	indented.WriteByte('\n')
+	_, err = indented.WriteTo(out)
+	return err
+}
+
+// loadedState is the state the agent restores from its state file.
+type loadedState struct {
+	Version              int
+	TaskEngine           engine.TaskEngine
+	ContainerInstanceArn string
+	Cluster              string
+	EC2InstanceID        string
+	ACSSeqNum            *utilatomic.IncreasingInt64
+	// LoadStatus is which generation of the state file was loaded
+	LoadStatus statemanager.LoadStatus
+}
+
+// loadState loads the state file or database at path the way the agent does
+// on startup.
+func loadState(path string) (*loadedState, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &loadedState{
+		TaskEngine: engine.NewTaskEngine(&config.Config{}, false),
+		ACSSeqNum:  utilatomic.NewIncreasingInt64(0),
+	}
+	newStateManager := statemanager.NewStateManager
+	fileName := stateFileName
+	if isDatabase(path) {
+		// Only databases of the current version can be loaded
+		newStateManager = statemanager.NewBoltStateManager
+		fileName = databaseFileName
+		state.Version = statemanager.EcsDataVersion
+	} else {
+		var version struct{ Version int }
+		err = json.Unmarshal(data, &version)
+		// In a data dir, the agent falls back to older generations
+		if err != nil && filepath.Base(path) != stateFileName {
+			return nil, fmt.Errorf("%s isn't valid JSON: %v", path, err)
+		}
+		state.Version = version.Version
+	}
+
+	// The state manager reads the state file from a data directory. The
+	// database is always copied, as opening it takes a lock on it
+	dataDir := filepath.Dir(path)
+	if filepath.Base(path) != fileName || isDatabase(path) {
+		dataDir, err = ioutil.TempDir("", "ecs-agent-ctl")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dataDir)
+		err = ioutil.WriteFile(filepath.Join(dataDir, fileName), data, 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Encrypted state is read with the keys the agent is configured with
+	cfg := &config.Config{
+		DataDir:                dataDir,
+		StateEncryptionKeyFile: os.Getenv("ECS_STATE_ENCRYPTION_KEY_FILE"),
+		StateEncryptionKeyCmd:  os.Getenv("ECS_STATE_ENCRYPTION_KEY_COMMAND"),
+	}
+	manager, err := newStateManager(cfg,
+		statemanager.AddSaveable("TaskEngine", state.TaskEngine),
+		statemanager.AddSaveable("ContainerInstanceArn", &state.ContainerInstanceArn),
+		statemanager.AddSaveable("Cluster", &state.Cluster),
+		statemanager.AddSaveable("EC2InstanceID", &state.EC2InstanceID),
+		statemanager.AddSaveable("ACSSeqNum", state.ACSSeqNum),
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = manager.Load()
+	if closer, ok := manager.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reporter, ok := manager.(statemanager.LoadStatusReporter); ok {
+		state.LoadStatus = reporter.LoadStatus()
+	}
+	if generation := state.LoadStatus.Generation; generation > 0 {
+		data, err = ioutil.ReadFile(path + "." + strconv.Itoa(generation))
+		if err == nil {
+			state.Version, _ = statemanager.DataVersion(data)
+		}
+	}
+	return state, nil
+}
+
+// databaseJSON returns the state in the database at path in the layout of
+// the state file.
+func databaseJSON(path string) ([]byte, error) {
+	state, err := loadState(path)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"Data": map[string]interface{}{
+			"TaskEngine":           state.TaskEngine,
+			"ContainerInstanceArn": state.ContainerInstanceArn,
+			"Cluster":              state.Cluster,
+			"EC2InstanceID":        state.EC2InstanceID,
+			"ACSSeqNum":            state.ACSSeqNum,
+		},
+		"Version": state.Version,
+	})
+}
+
+// stateProblems returns what's inconsistent in a state the agent was able
+// to load.
+func stateProblems(state *loadedState) []string {
+	var problems []string
+	for _, skipped := range state.LoadStatus.Skipped {
+		problems = append(problems, "the agent would skip "+skipped)
+	}
+	if state.LoadStatus.Generation > 0 {
+		problems = append(problems, fmt.Sprintf("the agent would load generation %d of the state file, saved at %s", state.LoadStatus.Generation, state.LoadStatus.SavedAt.Format(time.RFC3339)))
+	}
+	if state.ContainerInstanceArn != "" && state.Cluster == "" {
+		problems = append(problems, "the container instance "+state.ContainerInstanceArn+" has no cluster")
+	}
+	tasks, _ := state.TaskEngine.ListTasks()
+	for _, task := range tasks {
+		if task.Arn == "" {
+			problems = append(problems, "a task of "+task.Family+":"+task.Version+" has no arn")
+		}
+		if len(task.Containers) == 0 {
+			problems = append(problems, "task "+task.Arn+" has no containers")
+		}
+		for _, container := range task.Containers {
+			if container.Name == "" {
+				problems = append(problems, "a container of task "+task.Arn+" has no name")
+			}
+		}
+	}
+	return problems
+}
+
+func validateState(path string, out io.Writer) error {
+	state, err := loadState(path)
+	if err != nil {
+		return fmt.Errorf("the agent can't load %s: %v", path, err)
+	}
+
+	tasks, _ := state.TaskEngine.ListTasks()
+	containers := 0
+	for _, task := range tasks {
+		containers += len(task.Containers)
+	}
+	if state.Version < statemanager.EcsDataVersion {
+		fmt.Fprintf(out, "Version:              %d (upgraded to %d when the agent saves it)\n", state.Version, statemanager.EcsDataVersion)
+	} else {
+		fmt.Fprintf(out, "Version:              %d\n", state.Version)
+	}
+	fmt.Fprintf(out, "Cluster:              %s\n", state.Cluster)
+	fmt.Fprintf(out, "Container instance:   %s\n", state.ContainerInstanceArn)
+	fmt.Fprintf(out, "EC2 instance:         %s\n", state.EC2InstanceID)
+	fmt.Fprintf(out, "ACS sequence number:  %d\n", state.ACSSeqNum.Get())
+	fmt.Fprintf(out, "Tasks:                %d (%d containers)\n", len(tasks), containers)
+
+	problems := stateProblems(state)
+	if len(problems) == 0 {
+		fmt.Fprintln(out, "The state file is valid.")
+		return nil
+	}
+	fmt.Fprintln(out, "\nProblems:")
+	for _, problem := range problems {
+		fmt.Fprintln(out, "  "+problem)
+	}
+	return errors.New(strconv.Itoa(len(problems)) + " problems found in " + path)
+}
+
+func runStateMigrate(args []string, out io.Writer) error {
+	flags := newFlagSet(stateMigrateCommand)
+	toVersion := flags.Int("to", statemanager.EcsDataVersion, "The version to migrate the state file to")
+	force := flags.Bool("force", false, "Write the migrated file even if downgrading it loses state")
+	output := flags.String("o", "", "Where to write the migrated file instead of replacing the state file")
+	if err := parseFlags(flags, args, 0, 1); err != nil {
+		return err
+	}
+	path := statePath(flags, 0)
+
+	if isDatabase(path) {
+		return errors.New("only state files can be migrated; " + path + " is a state database")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	fromVersion, err := statemanager.DataVersion(data)
+	if err != nil {
+		return fmt.Errorf("%s isn't a state file: %v", path, err)
+	}
+	if fromVersion == *toVersion && *output == "" {
+		fmt.Fprintf(out, "%s is at version %d already.\n", path, fromVersion)
+		return nil
+	}
+	migrated, lost, err := statemanager.Migrate(data, *toVersion)
+	if err != nil {
+		return err
+	}
+	if len(lost) > 0 {
+		fmt.Fprintf(out, "Version %d can't store:\n", *toVersion)
+		for _, item := range lost {
+			fmt.Fprintln(out, "  "+item)
+		}
+		if !*force {
+			return errors.New("not writing " + path + " as migrating it loses state; run again with -force to write it anyway")
+		}
+	}
+
+	if *output != "" {
+		err = writeFileAtomically(*output, migrated)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Migrated %s from version %d to %d into %s.\n", path, fromVersion, *toVersion, *output)
+		return nil
+	}
+	backup := path + ".v" + strconv.Itoa(fromVersion)
+	err = ioutil.WriteFile(backup, data, 0600)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomically(path, migrated)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Migrated %s from version %d to %d; the original is in %s.\n", path, fromVersion, *toVersion, backup)
+	return nil
+}
+
+// writeFileAtomically replaces the file at path with data, so that an agent
+// never reads a partially written state file.
+func writeFileAtomically(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,181 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/statemanager"
+)
+
+const testStateDir = "../statemanager/testdata/v1/1"
+
+func TestValidateState(t *testing.T) {
+	var out bytes.Buffer
+	err := runState([]string{"validate", testStateDir}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Tasks:                3 (6 containers)") {
+		t.Errorf("Unexpected summary of the state:\n%s", out.String())
+	}
+}
+
+func TestValidateInconsistentState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs-agent-ctl-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+	ioutil.WriteFile(path, []byte(`{"Data": {"Cluster": "", "ContainerInstanceArn": "arn:instance",
+		"TaskEngine": {"Tasks": [{"Arn": "arn:task", "Containers": []}]}}, "Version": 4}`), 0600)
+	var out bytes.Buffer
+	err = runState([]string{"validate", path}, &out)
+	if err == nil {
+		t.Fatalf("Expected an error validating an inconsistent state:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "has no cluster") || !strings.Contains(out.String(), "task arn:task has no containers") {
+		t.Errorf("Unexpected problems:\n%s", out.String())
+	}
+
+	ioutil.WriteFile(path, []byte(`{"Data": `), 0600)
+	if runState([]string{"validate", path}, &bytes.Buffer{}) == nil {
+		t.Error("Expected an error validating a truncated state")
+	}
+	if runState([]string{"show", path}, &bytes.Buffer{}) == nil {
+		t.Error("Expected an error showing a truncated state")
+	}
+}
+
+func TestMigrateState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs-agent-ctl-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	original, err := ioutil.ReadFile("../statemanager/testdata/v4/1/" + stateFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, stateFileName)
+	ioutil.WriteFile(path, original, 0600)
+
+	var out bytes.Buffer
+	err = runState([]string{"migrate", "-to", "2", dir}, &out)
+	if err == nil || !strings.Contains(out.String(), "the udp port binding 53->53") {
+		t.Fatalf("Expected downgrading to fail without -force, got %v:\n%s", err, out.String())
+	}
+	if data, _ := ioutil.ReadFile(path); !bytes.Equal(data, original) {
+		t.Error("Expected the state file to be unchanged")
+	}
+
+	err = runState([]string{"migrate", "-to", "2", "-force", dir}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(path + ".v4"); !bytes.Equal(data, original) {
+		t.Error("Expected the original state file to be kept")
+	}
+	out.Reset()
+	err = runState([]string{"validate", dir}, &out)
+	if err != nil || !strings.Contains(out.String(), "Version:              2 (upgraded to") {
+		t.Errorf("Expected the downgraded state to be valid, got %v:\n%s", err, out.String())
+	}
+
+	output := filepath.Join(dir, "upgraded.json")
+	err = runState([]string{"migrate", "-o", output, path}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	err = runState([]string{"validate", output}, &out)
+	if err != nil || !strings.Contains(out.String(), "Version:              4\n") {
+		t.Errorf("Expected the upgraded state to be valid, got %v:\n%s", err, out.String())
+	}
+}
+
+func TestValidateDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs-agent-ctl-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data, err := ioutil.ReadFile(filepath.Join(testStateDir, stateFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, stateFileName), data, 0600)
+
+	// Import the state file into a database like the agent does
+	state := &loadedState{}
+	manager, err := statemanager.NewBoltStateManager(&config.Config{DataDir: dir},
+		statemanager.AddSaveable("Cluster", &state.Cluster))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = manager.Load()
+	manager.(io.Closer).Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = runState([]string{"validate", dir}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Cluster:              test") {
+		t.Errorf("Unexpected summary of the database:\n%s", out.String())
+	}
+	out.Reset()
+	err = runState([]string{"show", filepath.Join(dir, databaseFileName)}, &out)
+	if err != nil || !strings.Contains(out.String(), `"Cluster": "test"`) {
+		t.Errorf("Expected the database to be shown, got %v:\n%s", err, out.String())
+	}
+	if runState([]string{"migrate", dir}, &bytes.Buffer{}) == nil {
+		t.Error("Expected an error migrating a database")
+	}
+}
+
+func TestValidateReportsOlderGeneration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs-agent-ctl-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data, err := ioutil.ReadFile(filepath.Join(testStateDir, stateFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, stateFileName+".1"), data, 0600)
+	ioutil.WriteFile(filepath.Join(dir, stateFileName), []byte(`{"Data": `), 0600)
+
+	var out bytes.Buffer
+	err = runState([]string{"validate", dir}, &out)
+	if err == nil {
+		t.Fatalf("Expected an error validating a truncated state:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "would load generation 1") || !strings.Contains(out.String(), "Version:              1 ") {
+		t.Errorf("Expected the older generation to be reported:\n%s", out.String())
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/handlers"
+	"github.com/aws/amazon-ecs-agent/agent/stats"
+)
+
+var tasksCommand = &command{
+	name:        "tasks",
+	usage:       "[-agent endpoint] [-json]",
+	description: "List the tasks known to the agent.",
+}
+
+var taskCommand = &command{
+	name:        "task",
+	usage:       "[-agent endpoint] [-json] <task arn | docker id>",
+	description: "Describe a task, with the utilization of its containers and its stats alerts.",
+}
+
+func init() {
+	tasksCommand.run = runTasks
+	taskCommand.run = runTask
+}
+
+func runTasks(args []string, out io.Writer) error {
+	flags := newFlagSet(tasksCommand)
+	agent := addAgentFlag(flags)
+	asJSON := flags.Bool("json", false, "Print the response of the introspection API")
+	if err := parseFlags(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	var resp handlers.TasksResponse
+	err := newIntrospectionClient(*agent).get("/v1/tasks", nil, &resp)
+	if err != nil {
+		return err
+	}
+	sort.Sort(tasksByArn(resp.Tasks))
+	if *asJSON {
+		return writeJSON(out, &resp)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ARN\tDEFINITION\tDESIRED\tKNOWN\tCONTAINERS")
+	for _, task := range resp.Tasks {
+		names := make([]string, len(task.Containers))
+		for i, container := range task.Containers {
+			names[i] = container.Name
+		}
+		fmt.Fprintf(w, "%s\t%s:%s\t%s\t%s\t%s\n", task.Arn, task.Family, task.Version, task.DesiredStatus, task.KnownStatus, strings.Join(names, ","))
+	}
+	return w.Flush()
+}
+
+type tasksByArn []*handlers.TaskResponse
+
+func (tasks tasksByArn) Len() int           { return len(tasks) }
+func (tasks tasksByArn) Less(i, j int) bool { return tasks[i].Arn < tasks[j].Arn }
+func (tasks tasksByArn) Swap(i, j int)      { tasks[i], tasks[j] = tasks[j], tasks[i] }
+
+// taskDescription is what's known about a task from the introspection API.
+type taskDescription struct {
+	Task       *handlers.TaskResponse
+	Usage      *stats.TaskUsage       `json:",omitempty"`
+	Containers []stats.ContainerUsage `json:",omitempty"`
+	Alerts     []stats.Alert          `json:",omitempty"`
+}
+
+func runTask(args []string, out io.Writer) error {
+	flags := newFlagSet(taskCommand)
+	agent := addAgentFlag(flags)
+	asJSON := flags.Bool("json", false, "Print the description as JSON")
+	if err := parseFlags(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	client := newIntrospectionClient(*agent)
+	query := url.Values{}
+	id := flags.Arg(0)
+	if strings.HasPrefix(id, "arn:") {
+		query.Set("taskarn", id)
+	} else {
+		query.Set("dockerid", id)
+	}
+	description := &taskDescription{Task: &handlers.TaskResponse{}}
+	err := client.get("/v1/tasks", query, description.Task)
+	if err != nil {
+		return fmt.Errorf("unable to find task %s: %v", id, err)
+	}
+
+	// Utilization is only known once the containers have run for a while,
+	// so the task is described without it if it can't be read
+	taskQuery := url.Values{"taskarn": {description.Task.Arn}}
+	var taskStats handlers.TaskStatsResponse
+	if client.get("/v1/stats/tasks", taskQuery, &taskStats) == nil && len(taskStats.Tasks) > 0 {
+		description.Usage = &taskStats.Tasks[0]
+	}
+	var containerStats handlers.StatsResponse
+	if client.get("/v1/stats", taskQuery, &containerStats) == nil {
+		description.Containers = containerStats.Containers
+	}
+	var alerts handlers.AlertsResponse
+	if client.get("/v1/alerts", taskQuery, &alerts) == nil {
+		description.Alerts = alerts.Alerts
+	}
+
+	if *asJSON {
+		return writeJSON(out, description)
+	}
+	return writeTaskDescription(out, description)
+}
+
+func writeTaskDescription(out io.Writer, description *taskDescription) error {
+	task := description.Task
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Arn:\t%s\n", task.Arn)
+	fmt.Fprintf(w, "Definition:\t%s:%s\n", task.Family, task.Version)
+	fmt.Fprintf(w, "Desired status:\t%s\n", task.DesiredStatus)
+	fmt.Fprintf(w, "Known status:\t%s\n", task.KnownStatus)
+	if usage := description.Usage; usage != nil {
+		fmt.Fprintf(w, "CPU:\t%.1f%%\n", usage.CPUUsagePerc)
+		fmt.Fprintf(w, "Memory:\t%d MiB (working set %d MiB)\n", usage.MemoryUsageInMegs, usage.MemoryWorkingSetInMegs)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	usageByDockerID := make(map[string]stats.ContainerUsage)
+	for _, usage := range description.Containers {
+		usageByDockerID[usage.DockerID] = usage
+	}
+	fmt.Fprintln(out, "\nContainers:")
+	w = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "  NAME\tDOCKER ID\tDOCKER NAME\tCPU\tMEMORY")
+	for _, container := range task.Containers {
+		cpu, memory := "-", "-"
+		if usage, ok := usageByDockerID[container.DockerId]; ok {
+			cpu = fmt.Sprintf("%.1f%%", usage.CPUUsagePerc)
+			memory = fmt.Sprintf("%d MiB", usage.MemoryUsageInMegs)
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", container.Name, container.DockerId, container.DockerName, cpu, memory)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(description.Alerts) == 0 {
+		return nil
+	}
+	fmt.Fprintln(out, "\nAlerts:")
+	w = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "  RULE\tCONTAINER\tSTATE\tVALUE\tSINCE")
+	for _, alert := range description.Alerts {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%g\t%s\n", alert.Rule, alert.ContainerName, alert.State, alert.Value, alert.Since.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,90 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/handlers"
+	"github.com/aws/amazon-ecs-agent/agent/stats"
+)
+
+func newIntrospectionServer() *httptest.Server {
+	task := &handlers.TaskResponse{
+		Arn:           "arn:task",
+		DesiredStatus: "RUNNING",
+		KnownStatus:   "RUNNING",
+		Family:        "web",
+		Version:       "1",
+		Containers:    []handlers.ContainerResponse{{DockerId: "dockerid", DockerName: "ecs-web-1-app-1234", Name: "app"}},
+	}
+	responses := map[string]interface{}{
+		"/v1/tasks":                    &handlers.TasksResponse{Tasks: []*handlers.TaskResponse{task}},
+		"/v1/tasks?taskarn=arn%3Atask": task,
+		"/v1/tasks?dockerid=dockerid":  task,
+		"/v1/stats?taskarn=arn%3Atask": &handlers.StatsResponse{Containers: []stats.ContainerUsage{{
+			TaskArn:    "arn:task",
+			DockerID:   "dockerid",
+			UsageStats: stats.UsageStats{CPUUsagePerc: 12.5, MemoryUsageInMegs: 64},
+		}}},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestTasks(t *testing.T) {
+	server := newIntrospectionServer()
+	defer server.Close()
+
+	var out bytes.Buffer
+	err := runTasks([]string{"-agent", server.URL}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "arn:task  web:1") || !strings.Contains(out.String(), "app") {
+		t.Errorf("Unexpected list of tasks:\n%s", out.String())
+	}
+}
+
+func TestDescribeTask(t *testing.T) {
+	server := newIntrospectionServer()
+	defer server.Close()
+
+	for _, id := range []string{"arn:task", "dockerid"} {
+		var out bytes.Buffer
+		err := runTask([]string{"-agent", server.URL, id}, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), "Arn:") || !strings.Contains(out.String(), "12.5%") {
+			t.Errorf("Unexpected description of %s:\n%s", id, out.String())
+		}
+	}
+
+	err := runTask([]string{"-agent", server.URL, "arn:unknown"}, &bytes.Buffer{})
+	if err == nil {
+		t.Error("Expected an error describing an unknown task")
+	}
+}
@@ -16,6 +16,7 @@ package engine
 import (
 	"archive/tar"
 	"bufio"
+	"encoding/json"
 	"io"
 	"os"
 	"strings"
@@ -31,6 +32,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockeriface"
 	"github.com/aws/amazon-ecs-agent/agent/engine/emptyvolume"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
 	"github.com/cihub/seelog"
@@ -83,6 +85,12 @@ type DockerClient interface {
 	ListContainers(bool) ListContainersResponse
 
 	Version() (string, error)
+	// Info returns what the docker daemon reports about the host it runs on.
+	Info() (DockerInfo, error)
+
+	// UpdateAuth replaces the auth data images are pulled with when the pull
+	// doesn't come with its own.
+	UpdateAuth(authType string, authData *config.SensitiveRawMessage)
 }
 
 // DockerGoClient wraps the underlying go-dockerclient library.
@@ -103,7 +111,7 @@ type DockerClient interface {
 type dockerGoClient struct {
 	clientFactory    dockerclient.Factory
 	version          dockerclient.DockerVersion
-	auth             dockerauth.DockerAuthProvider
+	auth             dockerauth.UpdatableDockerAuthProvider
 	ecrClientFactory ecr.ECRFactory
 }
 
@@ -148,11 +156,23 @@ func NewDockerGoClient(clientFactory dockerclient.Factory, authType string, auth
 
 	return &dockerGoClient{
 		clientFactory:    clientFactory,
-		auth:             dockerauth.NewDockerAuthProvider(authType, authData.Contents()),
+		auth:             dockerauth.NewDockerAuthProvider(authType, authContents(authData)),
 		ecrClientFactory: ecr.NewECRFactory(acceptInsecureCert),
 	}, nil
 }
 
+func (dg *dockerGoClient) UpdateAuth(authType string, authData *config.SensitiveRawMessage) {
+	dg.auth.UpdateAuthData(authType, authContents(authData))
+}
+
+// authContents returns the contents of authData, which may be unset.
+func authContents(authData *config.SensitiveRawMessage) json.RawMessage {
+	if authData == nil {
+		return nil
+	}
+	return authData.Contents()
+}
+
 func (dg *dockerGoClient) dockerClient() (dockeriface.Client, error) {
 	if dg.version == "" {
 		return dg.clientFactory.GetDefaultClient()
@@ -160,7 +180,7 @@ func (dg *dockerGoClient) dockerClient() (dockeriface.Client, error) {
 	return dg.clientFactory.GetClient(dg.version)
 }
 
-func (dg *dockerGoClient) PullImage(image string, authData *api.RegistryAuthenticationData) DockerContainerMetadata {
+func (dg *dockerGoClient) PullImage(image string, authData *api.RegistryAuthenticationData) (metadata DockerContainerMetadata) {
 	timeout := ttime.After(pullImageTimeout)
 
 	// Workaround for devicemapper bug. See:
@@ -168,6 +188,12 @@ func (dg *dockerGoClient) PullImage(image string, authData *api.RegistryAuthenti
 	pullLock.Lock()
 	defer pullLock.Unlock()
 
+	start := ttime.Now()
+	defer func() {
+		recordDockerCall("pull", start, metadata.Error)
+		metrics.ImagePullDuration.Observe(metrics.SinceInSeconds(start), dockerCallOutcome(metadata.Error))
+	}()
+
 	response := make(chan DockerContainerMetadata, 1)
 	go func() { response <- dg.pullImage(image, authData) }()
 	select {
@@ -213,6 +239,8 @@ func (dg *dockerGoClient) pullImage(image string, authData *api.RegistryAuthenti
 	opts := docker.PullImageOptions{
 		Repository:   repository,
 		OutputStream: pullWriter,
+		// The json stream carries the size of each layer downloaded
+		RawJSONStream: true,
 	}
 	timeout := ttime.After(dockerPullBeginTimeout)
 	// pullBegan is a channel indicating that we have seen at least one line of data on the 'OutputStream' above.
@@ -223,6 +251,10 @@ func (dg *dockerGoClient) pullImage(image string, authData *api.RegistryAuthenti
 
 	go func() {
 		reader := bufio.NewReader(pullDebugOut)
+		progress := newPullProgress()
+		defer func() {
+			metrics.ImagePullBytes.Add(float64(progress.bytes()))
+		}()
 		var line string
 		var err error
 		for err == nil {
@@ -233,8 +265,9 @@ func (dg *dockerGoClient) pullImage(image string, authData *api.RegistryAuthenti
 			pullBeganOnce.Do(func() {
 				pullBegan <- true
 			})
-			log.Debug("Pulling image", "image", image, "status", line)
-			if strings.Contains(line, "already being pulled by another client. Waiting.") {
+			status := progress.update(line)
+			log.Debug("Pulling image", "image", image, "status", status)
+			if strings.Contains(status, "already being pulled by another client. Waiting.") {
 				// This can mean the deamon is 'hung' in pulling status for this image, but we can't be sure.
 				log.Error("Image 'pull' status marked as already being pulled", "image", image, "status", line)
 			}
@@ -315,8 +348,9 @@ func (dg *dockerGoClient) getAuthdata(image string, authData *api.RegistryAuthen
 	return authConfig, nil
 }
 
-func (dg *dockerGoClient) CreateContainer(config *docker.Config, hostConfig *docker.HostConfig, name string) DockerContainerMetadata {
+func (dg *dockerGoClient) CreateContainer(config *docker.Config, hostConfig *docker.HostConfig, name string) (metadata DockerContainerMetadata) {
 	timeout := ttime.After(createContainerTimeout)
+	defer func(start time.Time) { recordDockerCall("create", start, metadata.Error) }(ttime.Now())
 
 	ctx, cancelFunc := context.WithCancel(context.TODO()) // Could pass one through from engine
 	response := make(chan DockerContainerMetadata, 1)
@@ -350,8 +384,9 @@ func (dg *dockerGoClient) createContainer(ctx context.Context, config *docker.Co
 	return dg.containerMetadata(dockerContainer.ID)
 }
 
-func (dg *dockerGoClient) StartContainer(id string) DockerContainerMetadata {
+func (dg *dockerGoClient) StartContainer(id string) (metadata DockerContainerMetadata) {
 	timeout := ttime.After(startContainerTimeout)
+	defer func(start time.Time) { recordDockerCall("start", start, metadata.Error) }(ttime.Now())
 
 	ctx, cancelFunc := context.WithCancel(context.TODO()) // Could pass one through from engine
 	response := make(chan DockerContainerMetadata, 1)
@@ -401,8 +436,9 @@ func (dg *dockerGoClient) DescribeContainer(dockerId string) (api.ContainerStatu
 	return dockerStateToState(dockerContainer.State), metadataFromContainer(dockerContainer)
 }
 
-func (dg *dockerGoClient) InspectContainer(dockerId string) (*docker.Container, error) {
+func (dg *dockerGoClient) InspectContainer(dockerId string) (dockerContainer *docker.Container, err error) {
 	timeout := ttime.After(inspectContainerTimeout)
+	defer func(start time.Time) { recordDockerCall("inspect", start, err) }(ttime.Now())
 
 	type inspectResponse struct {
 		container *docker.Container
@@ -429,8 +465,9 @@ func (dg *dockerGoClient) inspectContainer(dockerId string) (*docker.Container,
 	return client.InspectContainer(dockerId)
 }
 
-func (dg *dockerGoClient) StopContainer(dockerId string) DockerContainerMetadata {
+func (dg *dockerGoClient) StopContainer(dockerId string) (metadata DockerContainerMetadata) {
 	timeout := ttime.After(stopContainerTimeout)
+	defer func(start time.Time) { recordDockerCall("stop", start, metadata.Error) }(ttime.Now())
 
 	ctx, cancelFunc := context.WithCancel(context.TODO()) // Could pass one through from engine
 	// Buffered channel so in the case of timeout it takes one write, never gets
@@ -470,8 +507,9 @@ func (dg *dockerGoClient) stopContainer(ctx context.Context, dockerId string) Do
 	return metadata
 }
 
-func (dg *dockerGoClient) RemoveContainer(dockerId string) error {
+func (dg *dockerGoClient) RemoveContainer(dockerId string) (err error) {
 	timeout := ttime.After(removeContainerTimeout)
+	defer func(start time.Time) { recordDockerCall("remove", start, err) }(ttime.Now())
 
 	response := make(chan error, 1)
 	go func() { response <- dg.removeContainer(dockerId) }()
@@ -641,8 +679,9 @@ func (dg *dockerGoClient) ContainerEvents(ctx context.Context) (<-chan DockerCon
 }
 
 // ListContainers returns a slice of container IDs.
-func (dg *dockerGoClient) ListContainers(all bool) ListContainersResponse {
+func (dg *dockerGoClient) ListContainers(all bool) (listResponse ListContainersResponse) {
 	timeout := ttime.After(listContainersTimeout)
+	defer func(start time.Time) { recordDockerCall("list", start, listResponse.Error) }(ttime.Now())
 
 	response := make(chan ListContainersResponse, 1)
 	go func() { response <- dg.listContainers(all) }()
@@ -679,7 +718,8 @@ func (dg *dockerGoClient) SupportedVersions() []dockerclient.DockerVersion {
 	return dg.clientFactory.FindAvailableVersions()
 }
 
-func (dg *dockerGoClient) Version() (string, error) {
+func (dg *dockerGoClient) Version() (version string, err error) {
+	defer func(start time.Time) { recordDockerCall("version", start, err) }(ttime.Now())
 	client, err := dg.dockerClient()
 	if err != nil {
 		return "", err
@@ -690,3 +730,39 @@ func (dg *dockerGoClient) Version() (string, error) {
 	}
 	return "DockerVersion: " + info.Get("Version"), nil
 }
+
+func (dg *dockerGoClient) Info() (dockerInfo DockerInfo, err error) {
+	defer func(start time.Time) { recordDockerCall("info", start, err) }(ttime.Now())
+	client, err := dg.dockerClient()
+	if err != nil {
+		return DockerInfo{}, err
+	}
+	info, err := client.Info()
+	if err != nil {
+		return DockerInfo{}, err
+	}
+	return DockerInfo{
+		OperatingSystem: info.Get("OperatingSystem"),
+		KernelVersion:   info.Get("KernelVersion"),
+		StorageDriver:   info.Get("Driver"),
+		CgroupVersion:   info.Get("CgroupVersion"),
+	}, nil
+}
+
+// recordDockerCall records the outcome and latency of a call to the docker
+// API.
+func recordDockerCall(operation string, start time.Time, err error) {
+	outcome := dockerCallOutcome(err)
+	metrics.DockerCalls.Inc(operation, outcome)
+	metrics.DockerCallDuration.Observe(metrics.SinceInSeconds(start), operation, outcome)
+}
+
+func dockerCallOutcome(err error) string {
+	if err == nil {
+		return metrics.OutcomeSuccess
+	}
+	if _, ok := err.(*DockerTimeoutError); ok {
+		return metrics.OutcomeTimeout
+	}
+	return metrics.OutcomeError
+}
@@ -14,11 +14,13 @@
 package engine
 
 import (
+	"bytes"
 	"encoding/base64"
 	"errors"
 	"io"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -36,6 +38,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockeriface/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/engine/emptyvolume"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
 	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
 )
 
@@ -695,3 +698,23 @@ func TestUnavailableVersionError(t *testing.T) {
 		t.Fatal("Error was not a named error")
 	}
 }
+
+func TestRecordDockerCall(t *testing.T) {
+	recordDockerCall("test_call", time.Now(), nil)
+	recordDockerCall("test_call", time.Now(), &DockerTimeoutError{duration: time.Second, transition: "test"})
+
+	var buf bytes.Buffer
+	err := metrics.DefaultRegistry.WriteText(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	for _, outcome := range []string{metrics.OutcomeSuccess, metrics.OutcomeTimeout} {
+		if !strings.Contains(text, `docker_calls_total{operation="test_call",outcome="`+outcome+`"} 1`) {
+			t.Errorf("Expected a %s call to be counted, got:\n%s", outcome, text)
+		}
+		if !strings.Contains(text, `docker_call_duration_seconds_count{operation="test_call",outcome="`+outcome+`"} 1`) {
+			t.Errorf("Expected the latency of a %s call to be observed, got:\n%s", outcome, text)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import "encoding/json"
+
+const (
+	pullStatusDownloading      = "Downloading"
+	pullStatusDownloadComplete = "Download complete"
+)
+
+// pullProgressMessage is a single message of docker's json pull progress
+// stream.
+type pullProgressMessage struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+}
+
+// pullProgress tracks how many bytes of each layer have been downloaded
+// during a single pull. Layers which already exist locally are never
+// downloaded and so don't count.
+type pullProgress struct {
+	downloaded map[string]int64
+	totals     map[string]int64
+}
+
+func newPullProgress() *pullProgress {
+	return &pullProgress{
+		downloaded: make(map[string]int64),
+		totals:     make(map[string]int64),
+	}
+}
+
+// update parses a line of the pull progress stream. It returns the status
+// message of the line, or the line itself if it could not be parsed.
+func (progress *pullProgress) update(line string) string {
+	var msg pullProgressMessage
+	err := json.Unmarshal([]byte(line), &msg)
+	if err != nil {
+		return line
+	}
+	switch msg.Status {
+	case pullStatusDownloading:
+		if msg.ProgressDetail.Current > progress.downloaded[msg.ID] {
+			progress.downloaded[msg.ID] = msg.ProgressDetail.Current
+		}
+		if msg.ProgressDetail.Total > 0 {
+			progress.totals[msg.ID] = msg.ProgressDetail.Total
+		}
+	case pullStatusDownloadComplete:
+		// Progress messages are rate limited, so the last one seen is
+		// unlikely to be for the final chunk
+		if total, ok := progress.totals[msg.ID]; ok {
+			progress.downloaded[msg.ID] = total
+		}
+	}
+	return msg.Status
+}
+
+// bytes returns the number of bytes downloaded so far.
+func (progress *pullProgress) bytes() int64 {
+	var sum int64
+	for _, downloaded := range progress.downloaded {
+		sum += downloaded
+	}
+	return sum
+}
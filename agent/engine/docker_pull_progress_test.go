@@ -0,0 +1,53 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import "testing"
+
+func TestPullProgressBytes(t *testing.T) {
+	lines := []string{
+		`{"status":"Pulling from library/busybox","id":"latest"}` + "\r\n",
+		`{"status":"Already exists","progressDetail":{},"id":"aaa"}` + "\r\n",
+		`{"status":"Downloading","progressDetail":{"current":100,"total":1000},"id":"bbb"}` + "\r\n",
+		`{"status":"Downloading","progressDetail":{"current":900,"total":1000},"id":"bbb"}` + "\r\n",
+		`{"status":"Download complete","progressDetail":{},"id":"bbb"}` + "\r\n",
+		`{"status":"Downloading","progressDetail":{"current":50,"total":500},"id":"ccc"}` + "\r\n",
+		`{"status":"Pull complete","progressDetail":{},"id":"bbb"}` + "\r\n",
+	}
+
+	progress := newPullProgress()
+	for _, line := range lines {
+		progress.update(line)
+	}
+	// bbb completed so counts fully; ccc only partially downloaded
+	if progress.bytes() != 1050 {
+		t.Errorf("Expected 1050 bytes downloaded, got %d", progress.bytes())
+	}
+}
+
+func TestPullProgressStatus(t *testing.T) {
+	progress := newPullProgress()
+	status := progress.update(`{"status":"Repository docker.io/library/busybox already being pulled by another client. Waiting."}` + "\n")
+	if status != "Repository docker.io/library/busybox already being pulled by another client. Waiting." {
+		t.Errorf("Unexpected status: %s", status)
+	}
+
+	status = progress.update("not json\n")
+	if status != "not json\n" {
+		t.Errorf("Expected unparseable line to be returned as is, got: %s", status)
+	}
+	if progress.bytes() != 0 {
+		t.Errorf("Expected no bytes downloaded, got %d", progress.bytes())
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
+	"github.com/aws/amazon-ecs-agent/agent/recorder"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// The operations of docker calls in journals.
+const (
+	PullImageOperation         = "PullImage"
+	CreateContainerOperation   = "CreateContainer"
+	StartContainerOperation    = "StartContainer"
+	StopContainerOperation     = "StopContainer"
+	DescribeContainerOperation = "DescribeContainer"
+	RemoveContainerOperation   = "RemoveContainer"
+	GetContainerNameOperation  = "GetContainerName"
+	InspectContainerOperation  = "InspectContainer"
+	ListContainersOperation    = "ListContainers"
+	VersionOperation           = "Version"
+	InfoOperation              = "Info"
+)
+
+// DockerCallArgs are the recorded arguments of a docker call. Only those the
+// call takes are set.
+type DockerCallArgs struct {
+	// APIVersion is the remote API version the call was made with, if not the
+	// default one.
+	APIVersion dockerclient.DockerVersion      `json:"apiVersion,omitempty"`
+	Image      string                          `json:"image,omitempty"`
+	AuthData   *api.RegistryAuthenticationData `json:"authData,omitempty"`
+	Config     *docker.Config                  `json:"config,omitempty"`
+	HostConfig *docker.HostConfig              `json:"hostConfig,omitempty"`
+	Name       string                          `json:"name,omitempty"`
+	DockerId   string                          `json:"dockerId,omitempty"`
+	All        bool                            `json:"all,omitempty"`
+}
+
+// RecordedMetadata is the form of DockerContainerMetadata in journals, with
+// its error flattened to a name and message.
+type RecordedMetadata struct {
+	DockerId     string                 `json:"dockerId,omitempty"`
+	ExitCode     *int                   `json:"exitCode,omitempty"`
+	PortBindings []api.PortBinding      `json:"portBindings,omitempty"`
+	Volumes      map[string]string      `json:"volumes,omitempty"`
+	Error        *api.DefaultNamedError `json:"error,omitempty"`
+}
+
+// NewRecordedMetadata returns the recorded form of metadata.
+func NewRecordedMetadata(metadata DockerContainerMetadata) *RecordedMetadata {
+	recorded := &RecordedMetadata{
+		DockerId:     metadata.DockerId,
+		ExitCode:     metadata.ExitCode,
+		PortBindings: metadata.PortBindings,
+		Volumes:      metadata.Volumes,
+	}
+	if metadata.Error != nil {
+		recorded.Error = api.NewNamedError(metadata.Error)
+	}
+	return recorded
+}
+
+// DockerContainerMetadata returns the metadata which was recorded.
+func (recorded *RecordedMetadata) DockerContainerMetadata() DockerContainerMetadata {
+	if recorded == nil {
+		return DockerContainerMetadata{}
+	}
+	metadata := DockerContainerMetadata{
+		DockerId:     recorded.DockerId,
+		ExitCode:     recorded.ExitCode,
+		PortBindings: recorded.PortBindings,
+		Volumes:      recorded.Volumes,
+	}
+	if recorded.Error != nil {
+		metadata.Error = recorded.Error
+	}
+	return metadata
+}
+
+// DockerCallResult is the recorded result of a docker call, or a recorded
+// docker event. Only the fields the call returns are set.
+type DockerCallResult struct {
+	Status    *api.ContainerStatus   `json:"status,omitempty"`
+	Metadata  *RecordedMetadata      `json:"metadata,omitempty"`
+	Name      string                 `json:"name,omitempty"`
+	Version   string                 `json:"version,omitempty"`
+	Info      *DockerInfo            `json:"info,omitempty"`
+	DockerIds []string               `json:"dockerIds,omitempty"`
+	Container *docker.Container      `json:"container,omitempty"`
+	Error     *api.DefaultNamedError `json:"error,omitempty"`
+}
+
+func recordedError(err error) *api.DefaultNamedError {
+	if err == nil {
+		return nil
+	}
+	return api.NewNamedError(err)
+}
+
+// Err returns the recorded error, if any.
+func (result *DockerCallResult) Err() error {
+	if result.Error == nil {
+		return nil
+	}
+	return result.Error
+}
+
+// recordingDockerClient records the calls made to the DockerClient it wraps,
+// with their results, and the events it emits.
+type recordingDockerClient struct {
+	DockerClient
+	recorder   *recorder.Recorder
+	apiVersion dockerclient.DockerVersion
+}
+
+// NewRecordingDockerClient wraps client so that its calls and events are
+// recorded. If rec is nil, client is returned as is.
+func NewRecordingDockerClient(client DockerClient, rec *recorder.Recorder) DockerClient {
+	if rec == nil {
+		return client
+	}
+	return &recordingDockerClient{DockerClient: client, recorder: rec}
+}
+
+func (client *recordingDockerClient) record(operation string, args *DockerCallArgs, result *DockerCallResult) {
+	args.APIVersion = client.apiVersion
+	client.recorder.RecordCall(operation, args, result)
+}
+
+func (client *recordingDockerClient) WithVersion(version dockerclient.DockerVersion) DockerClient {
+	return &recordingDockerClient{
+		DockerClient: client.DockerClient.WithVersion(version),
+		recorder:     client.recorder,
+		apiVersion:   version,
+	}
+}
+
+func (client *recordingDockerClient) ContainerEvents(ctx context.Context) (<-chan DockerContainerChangeEvent, error) {
+	events, err := client.DockerClient.ContainerEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recorded := make(chan DockerContainerChangeEvent)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-events:
+				client.recorder.Record(recorder.DockerEvent, &DockerCallResult{
+					Status:   &event.Status,
+					Metadata: NewRecordedMetadata(event.DockerContainerMetadata),
+				})
+				select {
+				case recorded <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return recorded, nil
+}
+
+func (client *recordingDockerClient) PullImage(image string, authData *api.RegistryAuthenticationData) DockerContainerMetadata {
+	metadata := client.DockerClient.PullImage(image, authData)
+	client.record(PullImageOperation, &DockerCallArgs{Image: image, AuthData: authData}, &DockerCallResult{Metadata: NewRecordedMetadata(metadata)})
+	return metadata
+}
+
+func (client *recordingDockerClient) CreateContainer(config *docker.Config, hostConfig *docker.HostConfig, name string) DockerContainerMetadata {
+	metadata := client.DockerClient.CreateContainer(config, hostConfig, name)
+	client.record(CreateContainerOperation, &DockerCallArgs{Config: config, HostConfig: hostConfig, Name: name}, &DockerCallResult{Metadata: NewRecordedMetadata(metadata)})
+	return metadata
+}
+
+func (client *recordingDockerClient) StartContainer(id string) DockerContainerMetadata {
+	metadata := client.DockerClient.StartContainer(id)
+	client.record(StartContainerOperation, &DockerCallArgs{DockerId: id}, &DockerCallResult{Metadata: NewRecordedMetadata(metadata)})
+	return metadata
+}
+
+func (client *recordingDockerClient) StopContainer(id string) DockerContainerMetadata {
+	metadata := client.DockerClient.StopContainer(id)
+	client.record(StopContainerOperation, &DockerCallArgs{DockerId: id}, &DockerCallResult{Metadata: NewRecordedMetadata(metadata)})
+	return metadata
+}
+
+func (client *recordingDockerClient) DescribeContainer(id string) (api.ContainerStatus, DockerContainerMetadata) {
+	status, metadata := client.DockerClient.DescribeContainer(id)
+	client.record(DescribeContainerOperation, &DockerCallArgs{DockerId: id}, &DockerCallResult{Status: &status, Metadata: NewRecordedMetadata(metadata)})
+	return status, metadata
+}
+
+func (client *recordingDockerClient) RemoveContainer(id string) error {
+	err := client.DockerClient.RemoveContainer(id)
+	client.record(RemoveContainerOperation, &DockerCallArgs{DockerId: id}, &DockerCallResult{Error: recordedError(err)})
+	return err
+}
+
+func (client *recordingDockerClient) GetContainerName(id string) (string, error) {
+	name, err := client.DockerClient.GetContainerName(id)
+	client.record(GetContainerNameOperation, &DockerCallArgs{DockerId: id}, &DockerCallResult{Name: name, Error: recordedError(err)})
+	return name, err
+}
+
+func (client *recordingDockerClient) InspectContainer(id string) (*docker.Container, error) {
+	container, err := client.DockerClient.InspectContainer(id)
+	client.record(InspectContainerOperation, &DockerCallArgs{DockerId: id}, &DockerCallResult{Container: container, Error: recordedError(err)})
+	return container, err
+}
+
+func (client *recordingDockerClient) ListContainers(all bool) ListContainersResponse {
+	response := client.DockerClient.ListContainers(all)
+	client.record(ListContainersOperation, &DockerCallArgs{All: all}, &DockerCallResult{DockerIds: response.DockerIds, Error: recordedError(response.Error)})
+	return response
+}
+
+func (client *recordingDockerClient) Version() (string, error) {
+	version, err := client.DockerClient.Version()
+	client.record(VersionOperation, &DockerCallArgs{}, &DockerCallResult{Version: version, Error: recordedError(err)})
+	return version, err
+}
+
+func (client *recordingDockerClient) Info() (DockerInfo, error) {
+	info, err := client.DockerClient.Info()
+	client.record(InfoOperation, &DockerCallArgs{}, &DockerCallResult{Info: &info, Error: recordedError(err)})
+	return info, err
+}
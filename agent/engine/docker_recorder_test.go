@@ -0,0 +1,54 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+)
+
+func TestRecordedMetadataRoundTrip(t *testing.T) {
+	exitCode := 137
+	metadata := DockerContainerMetadata{
+		DockerId:     "id",
+		ExitCode:     &exitCode,
+		PortBindings: []api.PortBinding{{ContainerPort: 80, HostPort: 8080}},
+		Error:        OutOfMemoryError{},
+	}
+	data, err := json.Marshal(NewRecordedMetadata(metadata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorded RecordedMetadata
+	err = json.Unmarshal(data, &recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := recorded.DockerContainerMetadata()
+	if replayed.DockerId != "id" || *replayed.ExitCode != 137 || len(replayed.PortBindings) != 1 || replayed.PortBindings[0].HostPort != 8080 {
+		t.Errorf("Wrong metadata replayed: %v", replayed)
+	}
+	namedErr, ok := replayed.Error.(api.NamedError)
+	if !ok || namedErr.ErrorName() != "OutOfMemoryError" {
+		t.Errorf("Wrong error replayed: %v", replayed.Error)
+	}
+
+	replayed = (&RecordedMetadata{DockerId: "id"}).DockerContainerMetadata()
+	if replayed.Error != nil {
+		t.Errorf("Expected no error, got %v", replayed.Error)
+	}
+}
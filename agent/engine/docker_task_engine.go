@@ -26,6 +26,8 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/recorder"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	utilsync "github.com/aws/amazon-ecs-agent/agent/utils/sync"
@@ -43,7 +45,10 @@ const (
 type DockerTaskEngine struct {
 	// implements TaskEngine
 
+	// cfg is replaced, never changed in place, when the config is reloaded,
+	// and should be read with currentConfig.
 	cfg                *config.Config
+	cfgLock            sync.RWMutex
 	acceptInsecureCert bool
 
 	initialized  bool
@@ -62,6 +67,9 @@ type DockerTaskEngine struct {
 	containerEvents chan api.ContainerStateChange
 	taskEvents      chan api.TaskStateChange
 	saver           statemanager.Saver
+	// recorder, if set, records docker calls and events, and the state
+	// changes emitted by the engine.
+	recorder *recorder.Recorder
 
 	client     DockerClient
 	clientLock sync.Mutex
@@ -107,6 +115,18 @@ func (engine *DockerTaskEngine) MarshalJSON() ([]byte, error) {
 	return engine.state.MarshalJSON()
 }
 
+// SaveRecords returns the tasks and containers of the state as separate
+// records
+func (engine *DockerTaskEngine) SaveRecords() (map[string][]byte, error) {
+	return engine.state.SaveRecords()
+}
+
+// LoadRecords restores a task-engine state from records returned by
+// SaveRecords
+func (engine *DockerTaskEngine) LoadRecords(records map[string][]byte) error {
+	return engine.state.LoadRecords(records)
+}
+
 // Init initializes a DockerTaskEngine such that it may communicate with docker
 // and operate normally.
 // This function must be called before any other function, except serializing and deserializing, can succeed without error.
@@ -129,10 +149,38 @@ func (engine *DockerTaskEngine) Init() error {
 	engine.synchronizeState()
 	// Now catch up and start processing new events per normal
 	go engine.handleDockerEvents(ctx)
+	engine.registerMetrics()
 	engine.initialized = true
 	return nil
 }
 
+// registerMetrics exposes the number of tasks and containers in each known
+// status as gauges in the agent's metrics registry.
+func (engine *DockerTaskEngine) registerMetrics() {
+	metrics.DefaultRegistry.RegisterGaugeFunc(metrics.Namespace+"tasks", "Tasks managed by the agent, by known status.", []string{"status"},
+		func(emit func(float64, ...string)) {
+			counts := make(map[string]int)
+			for _, task := range engine.state.AllTasks() {
+				counts[task.KnownStatus.String()]++
+			}
+			for status, count := range counts {
+				emit(float64(count), status)
+			}
+		})
+	metrics.DefaultRegistry.RegisterGaugeFunc(metrics.Namespace+"containers", "Containers managed by the agent, by known status.", []string{"status"},
+		func(emit func(float64, ...string)) {
+			counts := make(map[string]int)
+			for _, task := range engine.state.AllTasks() {
+				for _, container := range task.Containers {
+					counts[container.KnownStatus.String()]++
+				}
+			}
+			for status, count := range counts {
+				emit(float64(count), status)
+			}
+		})
+}
+
 func (engine *DockerTaskEngine) initDockerClient() error {
 	if engine.client != nil {
 		return nil
@@ -143,15 +191,38 @@ func (engine *DockerTaskEngine) initDockerClient() error {
 	if engine.client != nil {
 		return nil
 	}
-	client, err := NewDockerGoClient(nil, engine.cfg.EngineAuthType, engine.cfg.EngineAuthData, engine.acceptInsecureCert)
+	cfg := engine.currentConfig()
+	client, err := NewDockerGoClient(nil, cfg.EngineAuthType, cfg.EngineAuthData, engine.acceptInsecureCert)
 	if err != nil {
 		return err
 	}
-	engine.client = client
+	engine.client = NewRecordingDockerClient(client, engine.recorder)
 
 	return nil
 }
 
+func (engine *DockerTaskEngine) currentConfig() *config.Config {
+	engine.cfgLock.RLock()
+	defer engine.cfgLock.RUnlock()
+	return engine.cfg
+}
+
+// UpdateConfig applies the settings of cfg which can change while tasks are
+// running; the others keep the values the engine was created with.
+func (engine *DockerTaskEngine) UpdateConfig(cfg *config.Config) {
+	engine.cfgLock.Lock()
+	updated := *engine.cfg
+	updated.ApplyReloadable(cfg)
+	engine.cfg = &updated
+	engine.cfgLock.Unlock()
+
+	engine.clientLock.Lock()
+	defer engine.clientLock.Unlock()
+	if engine.client != nil {
+		engine.client.UpdateAuth(updated.EngineAuthType, updated.EngineAuthData)
+	}
+}
+
 // SetDockerClient provides a way to override the client used for communication with docker as a testing hook.
 func (engine *DockerTaskEngine) SetDockerClient(client DockerClient) {
 	engine.clientLock.Lock()
@@ -187,6 +258,12 @@ func (engine *DockerTaskEngine) SetSaver(saver statemanager.Saver) {
 	engine.saver = saver
 }
 
+// SetRecorder records the engine's docker calls and events, and the state
+// changes it emits. It must be called before the engine is initialized.
+func (engine *DockerTaskEngine) SetRecorder(rec *recorder.Recorder) {
+	engine.recorder = rec
+}
+
 // Shutdown makes a best-effort attempt to cleanup after the task engine.
 // This should not be relied on for anything more complicated than testing.
 func (engine *DockerTaskEngine) Shutdown() {
@@ -300,6 +377,7 @@ func (engine *DockerTaskEngine) emitTaskEvent(task *api.Task, reason string) {
 		SentStatus: &task.SentStatus,
 	}
 	log.Info("Task change event", "event", event)
+	engine.recorder.Record(recorder.TaskStateChange, &event)
 	engine.taskEvents <- event
 }
 
@@ -344,6 +422,7 @@ func (engine *DockerTaskEngine) emitContainerEvent(task *api.Task, cont *api.Con
 		SentStatus:    &cont.SentStatus,
 	}
 	log.Debug("Container change event", "event", event)
+	engine.recorder.Record(recorder.ContainerStateChange, &event)
 	engine.containerEvents <- event
 	log.Debug("Container change event passed on", "event", event)
 }
@@ -453,16 +532,7 @@ func (engine *DockerTaskEngine) createContainer(task *api.Task, container *api.C
 		return DockerContainerMetadata{Error: api.NamedError(err)}
 	}
 
-	name := ""
-	for i := 0; i < len(container.Name); i++ {
-		c := container.Name[i]
-		if !((c <= '9' && c >= '0') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c == '-')) {
-			continue
-		}
-		name += string(c)
-	}
-
-	containerName := "ecs-" + task.Family + "-" + task.Version + "-" + name + "-" + utils.RandHex()
+	containerName := ContainerNamePrefix(task, container) + utils.RandHex()
 
 	// Pre-add the container in case we stop before the next, more useful,
 	// AddContainer call. This ensures we have a way to get the container if
@@ -480,6 +550,20 @@ func (engine *DockerTaskEngine) createContainer(task *api.Task, container *api.C
 	return metadata
 }
 
+// ContainerNamePrefix returns the name given to the docker container of a
+// container, up to the random suffix which makes it unique.
+func ContainerNamePrefix(task *api.Task, container *api.Container) string {
+	name := ""
+	for i := 0; i < len(container.Name); i++ {
+		c := container.Name[i]
+		if !((c <= '9' && c >= '0') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c == '-')) {
+			continue
+		}
+		name += string(c)
+	}
+	return "ecs-" + task.Family + "-" + task.Version + "-" + name + "-"
+}
+
 func (engine *DockerTaskEngine) startContainer(task *api.Task, container *api.Container) DockerContainerMetadata {
 	log.Info("Starting container", "task", task, "container", container)
 	client := engine.client
@@ -628,8 +712,9 @@ func (engine *DockerTaskEngine) Capabilities() []string {
 	if err != nil {
 		return nil
 	}
+	cfg := engine.currentConfig()
 	capabilities := []string{}
-	if !engine.cfg.PrivilegedDisabled {
+	if !cfg.PrivilegedDisabled {
 		capabilities = append(capabilities, capabilityPrefix+"privileged-container")
 	}
 	versions := make(map[dockerclient.DockerVersion]bool)
@@ -638,17 +723,17 @@ func (engine *DockerTaskEngine) Capabilities() []string {
 		versions[version] = true
 	}
 
-	for _, loggingDriver := range engine.cfg.AvailableLoggingDrivers {
+	for _, loggingDriver := range cfg.AvailableLoggingDrivers {
 		requiredVersion := dockerclient.LoggingDriverMinimumVersion[loggingDriver]
 		if _, ok := versions[requiredVersion]; ok {
 			capabilities = append(capabilities, capabilityPrefix+"logging-driver."+string(loggingDriver))
 		}
 	}
 
-	if engine.cfg.SELinuxCapable {
+	if cfg.SELinuxCapable {
 		capabilities = append(capabilities, capabilityPrefix+"selinux")
 	}
-	if engine.cfg.AppArmorCapable {
+	if cfg.AppArmorCapable {
 		capabilities = append(capabilities, capabilityPrefix+"apparmor")
 	}
 
@@ -558,3 +558,31 @@ func TestCapabilitiesECR(t *testing.T) {
 		t.Errorf("Could not find ECR capability when expected; got capabilities %v", capabilities)
 	}
 }
+
+func TestUpdateConfig(t *testing.T) {
+	conf := &config.Config{Cluster: "cluster", PrivilegedDisabled: true}
+	ctrl, client, taskEngine := mocks(t, conf)
+	defer ctrl.Finish()
+
+	authData := config.NewSensitiveRawMessage([]byte(`{"registry.tld":{"username":"user","password":"swordfish"}}`))
+	client.EXPECT().UpdateAuth("docker", authData)
+	client.EXPECT().SupportedVersions().Return([]dockerclient.DockerVersion{dockerclient.Version_1_17})
+
+	taskEngine.UpdateConfig(&config.Config{
+		Cluster:            "other",
+		PrivilegedDisabled: false,
+		EngineAuthType:     "docker",
+		EngineAuthData:     authData,
+	})
+
+	capabilities := taskEngine.Capabilities()
+	if len(capabilities) == 0 || capabilities[0] != "com.amazonaws.ecs.capability.privileged-container" {
+		t.Errorf("Expected the updated config to be used for capabilities, got %v", capabilities)
+	}
+	if cfg := taskEngine.(*DockerTaskEngine).currentConfig(); cfg.Cluster != "cluster" {
+		t.Errorf("Expected settings which can't be reloaded to be kept, got cluster %q", cfg.Cluster)
+	}
+	if !conf.PrivilegedDisabled {
+		t.Error("Expected the config the engine was created with to be left as is")
+	}
+}
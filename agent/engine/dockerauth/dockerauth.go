@@ -19,20 +19,30 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"strings"
+	"sync"
 
 	"github.com/cihub/seelog"
 	"github.com/docker/docker/pkg/parsers"
 	docker "github.com/fsouza/go-dockerclient"
 )
 
-func NewDockerAuthProvider(authType string, authData json.RawMessage) DockerAuthProvider {
+func NewDockerAuthProvider(authType string, authData json.RawMessage) UpdatableDockerAuthProvider {
 	return &dockerAuthProvider{
 		authMap: parseAuthData(authType, authData),
 	}
 }
 
 type dockerAuthProvider struct {
-	authMap dockerAuths
+	authMap     dockerAuths
+	authMapLock sync.RWMutex
+}
+
+// UpdateAuthData replaces the auth data the provider was created with.
+func (authProvider *dockerAuthProvider) UpdateAuthData(authType string, authData json.RawMessage) {
+	authMap := parseAuthData(authType, authData)
+	authProvider.authMapLock.Lock()
+	defer authProvider.authMapLock.Unlock()
+	authProvider.authMap = authMap
 }
 
 // map from registry url (minus schema) to auth information
@@ -48,7 +58,9 @@ type dockercfgData map[string]dockercfgConfigEntry
 func (authProvider *dockerAuthProvider) GetAuthconfig(image string) (docker.AuthConfiguration, error) {
 	// Ignore 'tag', not used in auth determination
 	repository, _ := parsers.ParseRepositoryTag(image)
+	authProvider.authMapLock.RLock()
 	authDataMap := authProvider.authMap
+	authProvider.authMapLock.RUnlock()
 
 	// Ignore repo/image name for some auth checks (see use of 'image' below for where it's not ignored.
 	indexName, _ := splitReposName(repository)
@@ -133,3 +133,18 @@ func TestEmptyConfig(t *testing.T) {
 		t.Errorf("Expected empty authconfig to not return any auth data at all")
 	}
 }
+
+func TestUpdateAuthData(t *testing.T) {
+	provider := NewDockerAuthProvider("", []byte(""))
+	provider.UpdateAuthData("docker", []byte(`{"registry.tld":{"username":"user","password":"swordfish"}}`))
+	authConfig, _ := provider.GetAuthconfig("registry.tld/nginx")
+	if authConfig.Username != "user" || authConfig.Password != "swordfish" {
+		t.Errorf("Expected the updated auth data to be used, got %v", authConfig)
+	}
+
+	provider.UpdateAuthData("", []byte(""))
+	authConfig, _ = provider.GetAuthconfig("registry.tld/nginx")
+	if !reflect.DeepEqual(authConfig, docker.AuthConfiguration{}) {
+		t.Errorf("Expected the auth data to be removed, got %v", authConfig)
+	}
+}
@@ -16,6 +16,8 @@
 package dockerauth
 
 import (
+	"encoding/json"
+
 	docker "github.com/fsouza/go-dockerclient"
 )
 
@@ -23,3 +25,10 @@ import (
 type DockerAuthProvider interface {
 	GetAuthconfig(image string) (docker.AuthConfiguration, error)
 }
+
+// UpdatableDockerAuthProvider is a DockerAuthProvider whose auth data can be
+// replaced while it's in use, when the config is reloaded.
+type UpdatableDockerAuthProvider interface {
+	DockerAuthProvider
+	UpdateAuthData(authType string, authData json.RawMessage)
+}
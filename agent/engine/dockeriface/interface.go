@@ -23,6 +23,7 @@ type Client interface {
 	AddEventListener(listener chan<- *docker.APIEvents) error
 	CreateContainer(opts docker.CreateContainerOptions) (*docker.Container, error)
 	ImportImage(opts docker.ImportImageOptions) error
+	Info() (*docker.Env, error)
 	InspectContainer(id string) (*docker.Container, error)
 	InspectImage(name string) (*docker.Image, error)
 	ListContainers(opts docker.ListContainersOptions) ([]docker.APIContainers, error)
@@ -31,6 +32,7 @@ type Client interface {
 	RemoveContainer(opts docker.RemoveContainerOptions) error
 	RemoveEventListener(listener chan *docker.APIEvents) error
 	StartContainer(id string, hostConfig *docker.HostConfig) error
+	Stats(opts docker.StatsOptions) error
 	StopContainer(id string, timeout uint) error
 	Version() (*docker.Env, error)
 }
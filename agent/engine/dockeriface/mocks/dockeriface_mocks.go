@@ -73,6 +73,17 @@ func (_mr *_MockClientRecorder) ImportImage(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "ImportImage", arg0)
 }
 
+func (_m *MockClient) Info() (*go_dockerclient.Env, error) {
+	ret := _m.ctrl.Call(_m, "Info")
+	ret0, _ := ret[0].(*go_dockerclient.Env)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) Info() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Info")
+}
+
 func (_m *MockClient) InspectContainer(_param0 string) (*go_dockerclient.Container, error) {
 	ret := _m.ctrl.Call(_m, "InspectContainer", _param0)
 	ret0, _ := ret[0].(*go_dockerclient.Container)
@@ -156,6 +167,16 @@ func (_mr *_MockClientRecorder) StartContainer(arg0, arg1 interface{}) *gomock.C
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "StartContainer", arg0, arg1)
 }
 
+func (_m *MockClient) Stats(_param0 go_dockerclient.StatsOptions) error {
+	ret := _m.ctrl.Call(_m, "Stats", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) Stats(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Stats", arg0)
+}
+
 func (_m *MockClient) StopContainer(_param0 string, _param1 uint) error {
 	ret := _m.ctrl.Call(_m, "StopContainer", _param0, _param1)
 	ret0, _ := ret[0].(error)
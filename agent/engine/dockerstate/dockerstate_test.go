@@ -151,3 +151,42 @@ func TestRemoveTask(t *testing.T) {
 		t.Error("Expected task to be removed")
 	}
 }
+
+func TestRecords(t *testing.T) {
+	state := NewDockerTaskEngineState()
+	testContainer := &api.Container{
+		Name: "c1",
+	}
+	testTask := &api.Task{
+		Arn:        "t1",
+		Containers: []*api.Container{testContainer},
+	}
+	state.AddTask(testTask)
+	state.AddContainer(&api.DockerContainer{DockerId: "did", DockerName: "dname", Container: testContainer}, testTask)
+
+	records, err := state.SaveRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records["task/t1"] == nil || records["container/did"] == nil {
+		t.Fatalf("Expected a record for the task and one for the container, got %v", records)
+	}
+
+	loaded := NewDockerTaskEngineState()
+	err = loaded.LoadRecords(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, ok := loaded.TaskByArn("t1")
+	if !ok {
+		t.Fatal("Expected the task to be loaded")
+	}
+	container, ok := loaded.ContainerById("did")
+	if !ok || container.DockerName != "dname" || container.Container != task.Containers[0] {
+		t.Errorf("Expected the container to be loaded as the container of its task, got %v", container)
+	}
+
+	if loaded.LoadRecords(map[string][]byte{"container/did": records["container/did"]}) == nil {
+		t.Error("Expected an error loading a container without its task")
+	}
+}
@@ -16,6 +16,7 @@ package dockerstate
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
 )
@@ -28,6 +29,19 @@ type savedState struct {
 	IdToTask      map[string]string               // DockerId -> taskarn
 }
 
+// Prefixes of the keys of the records of tasks and containers
+const (
+	taskRecordPrefix      = "task/"
+	containerRecordPrefix = "container/"
+)
+
+// savedContainer is the record of a container; it includes the arn of the
+// task it belongs to, which is kept in IdToTask when saved as a whole.
+type savedContainer struct {
+	TaskArn string
+	*api.DockerContainer
+}
+
 func (state *DockerTaskEngineState) MarshalJSON() ([]byte, error) {
 	var toSave savedState
 	state.lock.RLock()
@@ -47,6 +61,66 @@ func (state *DockerTaskEngineState) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
+	return state.restore(saved)
+}
+
+// SaveRecords returns every task and container as a separate record, so that
+// a state manager can save only the ones which changed.
+func (state *DockerTaskEngineState) SaveRecords() (map[string][]byte, error) {
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+
+	records := make(map[string][]byte, len(state.tasks)+len(state.idToContainer))
+	for arn, task := range state.tasks {
+		data, err := json.Marshal(task)
+		if err != nil {
+			return nil, err
+		}
+		records[taskRecordPrefix+arn] = data
+	}
+	for id, container := range state.idToContainer {
+		data, err := json.Marshal(savedContainer{TaskArn: state.idToTask[id], DockerContainer: container})
+		if err != nil {
+			return nil, err
+		}
+		records[containerRecordPrefix+id] = data
+	}
+	return records, nil
+}
+
+// LoadRecords restores a state from the records returned by SaveRecords.
+func (state *DockerTaskEngineState) LoadRecords(records map[string][]byte) error {
+	saved := savedState{
+		IdToContainer: make(map[string]*api.DockerContainer),
+		IdToTask:      make(map[string]string),
+	}
+	for key, data := range records {
+		switch {
+		case strings.HasPrefix(key, taskRecordPrefix):
+			var task api.Task
+			err := json.Unmarshal(data, &task)
+			if err != nil {
+				return err
+			}
+			saved.Tasks = append(saved.Tasks, &task)
+		case strings.HasPrefix(key, containerRecordPrefix):
+			container := savedContainer{DockerContainer: &api.DockerContainer{}}
+			err := json.Unmarshal(data, &container)
+			if err != nil {
+				return err
+			}
+			id := strings.TrimPrefix(key, containerRecordPrefix)
+			saved.IdToContainer[id] = container.DockerContainer
+			saved.IdToTask[id] = container.TaskArn
+		default:
+			return errors.New("Could not load state; unknown record " + key)
+		}
+	}
+	return state.restore(saved)
+}
+
+// restore replaces the state with a saved one.
+func (state *DockerTaskEngineState) restore(saved savedState) error {
 	// reset it by just creating a new one and swapping shortly.
 	// This also means we don't have to lock for the remainder of this function
 	// because we are the only ones with a reference to clean
@@ -18,7 +18,9 @@ package engine
 
 import (
 	api "github.com/aws/amazon-ecs-agent/agent/api"
+	config "github.com/aws/amazon-ecs-agent/agent/config"
 	dockerclient "github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
+	recorder "github.com/aws/amazon-ecs-agent/agent/recorder"
 	statemanager "github.com/aws/amazon-ecs-agent/agent/statemanager"
 	go_dockerclient "github.com/fsouza/go-dockerclient"
 	gomock "github.com/golang/mock/gomock"
@@ -74,6 +76,16 @@ func (_mr *_MockTaskEngineRecorder) Disable() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Disable")
 }
 
+func (_m *MockTaskEngine) HostAttributes() map[string]string {
+	ret := _m.ctrl.Call(_m, "HostAttributes")
+	ret0, _ := ret[0].(map[string]string)
+	return ret0
+}
+
+func (_mr *_MockTaskEngineRecorder) HostAttributes() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "HostAttributes")
+}
+
 func (_m *MockTaskEngine) Init() error {
 	ret := _m.ctrl.Call(_m, "Init")
 	ret0, _ := ret[0].(error)
@@ -122,6 +134,14 @@ func (_mr *_MockTaskEngineRecorder) SetSaver(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetSaver", arg0)
 }
 
+func (_m *MockTaskEngine) SetRecorder(_param0 *recorder.Recorder) {
+	_m.ctrl.Call(_m, "SetRecorder", _param0)
+}
+
+func (_mr *_MockTaskEngineRecorder) SetRecorder(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetRecorder", arg0)
+}
+
 func (_m *MockTaskEngine) TaskEvents() (<-chan api.TaskStateChange, <-chan api.ContainerStateChange) {
 	ret := _m.ctrl.Call(_m, "TaskEvents")
 	ret0, _ := ret[0].(<-chan api.TaskStateChange)
@@ -143,6 +163,14 @@ func (_mr *_MockTaskEngineRecorder) UnmarshalJSON(arg0 interface{}) *gomock.Call
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "UnmarshalJSON", arg0)
 }
 
+func (_m *MockTaskEngine) UpdateConfig(_param0 *config.Config) {
+	_m.ctrl.Call(_m, "UpdateConfig", _param0)
+}
+
+func (_mr *_MockTaskEngineRecorder) UpdateConfig(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "UpdateConfig", arg0)
+}
+
 func (_m *MockTaskEngine) Version() (string, error) {
 	ret := _m.ctrl.Call(_m, "Version")
 	ret0, _ := ret[0].(string)
@@ -218,6 +246,17 @@ func (_mr *_MockDockerClientRecorder) GetContainerName(arg0 interface{}) *gomock
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetContainerName", arg0)
 }
 
+func (_m *MockDockerClient) Info() (DockerInfo, error) {
+	ret := _m.ctrl.Call(_m, "Info")
+	ret0, _ := ret[0].(DockerInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDockerClientRecorder) Info() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Info")
+}
+
 func (_m *MockDockerClient) InspectContainer(_param0 string) (*go_dockerclient.Container, error) {
 	ret := _m.ctrl.Call(_m, "InspectContainer", _param0)
 	ret0, _ := ret[0].(*go_dockerclient.Container)
@@ -289,6 +328,14 @@ func (_mr *_MockDockerClientRecorder) SupportedVersions() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SupportedVersions")
 }
 
+func (_m *MockDockerClient) UpdateAuth(_param0 string, _param1 *config.SensitiveRawMessage) {
+	_m.ctrl.Call(_m, "UpdateAuth", _param0, _param1)
+}
+
+func (_mr *_MockDockerClientRecorder) UpdateAuth(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "UpdateAuth", arg0, arg1)
+}
+
 func (_m *MockDockerClient) Version() (string, error) {
 	ret := _m.ctrl.Call(_m, "Version")
 	ret0, _ := ret[0].(string)
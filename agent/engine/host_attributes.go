@@ -0,0 +1,123 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+)
+
+// The names of the attributes HostAttributes returns.
+const (
+	OSReleaseAttribute     = "ecs.os-release"
+	KernelVersionAttribute = "ecs.kernel-version"
+	StorageDriverAttribute = "ecs.docker-storage-driver"
+	CgroupVersionAttribute = "ecs.cgroup-version"
+	CPUModelAttribute      = "ecs.cpu-model"
+)
+
+// The files the cgroup version and CPU model are read from. Both are the
+// host's even when the agent runs in a container.
+var (
+	cgroupRoot  = "/sys/fs/cgroup"
+	cpuInfoPath = "/proc/cpuinfo"
+)
+
+var (
+	trademarkPattern        = regexp.MustCompile(`\((R|TM)\)`)
+	invalidAttributePattern = regexp.MustCompile(`[^a-zA-Z0-9_.@/\\: -]+`)
+)
+
+// HostAttributes returns attributes describing the host tasks run on:
+//
+//	ecs.os-release
+//	ecs.kernel-version
+//	ecs.docker-storage-driver
+//	ecs.cgroup-version
+//	ecs.cpu-model
+//
+// Attributes which can't be detected are left out. Characters ECS doesn't
+// allow in attribute values are removed, and attributes which still break its
+// rules are left out, so that they're ready to register.
+func (engine *DockerTaskEngine) HostAttributes() map[string]string {
+	var info DockerInfo
+	err := engine.initDockerClient()
+	if err == nil {
+		info, err = engine.client.Info()
+	}
+	if err != nil {
+		log.Warn("Unable to get docker info for host attributes", "err", err)
+	}
+	if info.CgroupVersion == "" {
+		info.CgroupVersion = cgroupVersion()
+	}
+
+	attributes := make(map[string]string)
+	for name, value := range map[string]string{
+		OSReleaseAttribute:     info.OperatingSystem,
+		KernelVersionAttribute: info.KernelVersion,
+		StorageDriverAttribute: info.StorageDriver,
+		CgroupVersionAttribute: info.CgroupVersion,
+		CPUModelAttribute:      cpuModel(),
+	} {
+		value = trademarkPattern.ReplaceAllString(value, "")
+		value = strings.Join(strings.Fields(invalidAttributePattern.ReplaceAllString(value, " ")), " ")
+		if len(value) > 128 {
+			value = strings.TrimSpace(value[:128])
+		}
+		if value == "" {
+			continue
+		}
+		if err := config.ValidateAttribute(name, value); err != nil {
+			log.Warn("Leaving out invalid host attribute", "name", name, "err", err)
+			continue
+		}
+		attributes[name] = value
+	}
+	return attributes
+}
+
+// cgroupVersion returns "2" if the unified cgroup hierarchy is mounted, and
+// "1" otherwise, for versions of docker which don't report it.
+func cgroupVersion() string {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err == nil {
+		return "2"
+	}
+	if _, err := os.Stat(cgroupRoot); err == nil {
+		return "1"
+	}
+	return ""
+}
+
+// cpuModel returns the model name of the first CPU in /proc/cpuinfo.
+func cpuModel() string {
+	file, err := os.Open(cpuInfoPath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == "model name" {
+			return strings.TrimSpace(parts[1])
+		}
+	}
+	return ""
+}
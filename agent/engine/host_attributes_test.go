@@ -0,0 +1,81 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeHost points the host files HostAttributes reads at a temporary
+// directory, with the given /proc/cpuinfo.
+func fakeHost(t *testing.T, cpuInfo string, cgroup2 bool) func() {
+	dir, err := ioutil.TempDir("", "ecs_host_attributes_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalCgroupRoot, originalCPUInfoPath := cgroupRoot, cpuInfoPath
+	cgroupRoot = filepath.Join(dir, "cgroup")
+	cpuInfoPath = filepath.Join(dir, "cpuinfo")
+	os.Mkdir(cgroupRoot, 0755)
+	if cgroup2 {
+		ioutil.WriteFile(filepath.Join(cgroupRoot, "cgroup.controllers"), []byte("cpu memory"), 0644)
+	}
+	ioutil.WriteFile(cpuInfoPath, []byte(cpuInfo), 0644)
+	return func() {
+		cgroupRoot, cpuInfoPath = originalCgroupRoot, originalCPUInfoPath
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHostAttributes(t *testing.T) {
+	defer fakeHost(t, "processor\t: 0\nmodel name\t: Intel(R) Xeon(R) CPU E5-2676 v3 @ 2.40GHz\n\nprocessor\t: 1\nmodel name\t: Other\n", true)()
+	ctrl, client, taskEngine := mocks(t, &defaultConfig)
+	defer ctrl.Finish()
+
+	client.EXPECT().Info().Return(DockerInfo{
+		OperatingSystem: "Amazon Linux AMI 2016.03",
+		KernelVersion:   "4.4.5-15.26.amzn1.x86_64",
+		StorageDriver:   "devicemapper",
+	}, nil)
+
+	attributes := taskEngine.HostAttributes()
+	expected := map[string]string{
+		OSReleaseAttribute:     "Amazon Linux AMI 2016.03",
+		KernelVersionAttribute: "4.4.5-15.26.amzn1.x86_64",
+		StorageDriverAttribute: "devicemapper",
+		CgroupVersionAttribute: "2",
+		CPUModelAttribute:      "Intel Xeon CPU E5-2676 v3 @ 2.40GHz",
+	}
+	if !reflect.DeepEqual(attributes, expected) {
+		t.Errorf("Expected %v, got %v", expected, attributes)
+	}
+}
+
+func TestHostAttributesWithoutDocker(t *testing.T) {
+	defer fakeHost(t, "", false)()
+	ctrl, client, taskEngine := mocks(t, &defaultConfig)
+	defer ctrl.Finish()
+
+	client.EXPECT().Info().Return(DockerInfo{}, errors.New("Cannot connect to the docker daemon"))
+
+	attributes := taskEngine.HostAttributes()
+	if !reflect.DeepEqual(attributes, map[string]string{CgroupVersionAttribute: "1"}) {
+		t.Errorf("Expected only the attributes which don't come from docker, got %v", attributes)
+	}
+}
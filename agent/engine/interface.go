@@ -17,6 +17,8 @@ import (
 	"encoding/json"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/recorder"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager"
 )
 
@@ -33,6 +35,9 @@ type TaskEngine interface {
 	// running or stopped, as well as providing portbinding and other metadata
 	TaskEvents() (<-chan api.TaskStateChange, <-chan api.ContainerStateChange)
 	SetSaver(statemanager.Saver)
+	// SetRecorder sets where the engine's interactions with the container
+	// runtime are recorded. It must be called before Init.
+	SetRecorder(*recorder.Recorder)
 
 	// AddTask adds a new task to the task engine and manages its container's
 	// lifecycle. If it returns an error, the task was not added.
@@ -44,6 +49,12 @@ type TaskEngine interface {
 	// Capabilities returns an array of capabilities this task engine has, which
 	// should model what it can execute.
 	Capabilities() []string
+	// HostAttributes returns attributes describing the host tasks run on, by
+	// name.
+	HostAttributes() map[string]string
+	// UpdateConfig applies the settings of a reloaded config which can change
+	// while the engine is running.
+	UpdateConfig(*config.Config)
 
 	json.Marshaler
 	json.Unmarshaler
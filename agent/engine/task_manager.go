@@ -161,7 +161,7 @@ func (task *managedTask) overseeTask() {
 		llog.Debug("Marking done for this sequence", "seqnum", task.StopSequenceNumber)
 		task.engine.taskStopGroup.Done(task.StopSequenceNumber)
 	}
-	task.cleanupTask(task.engine.cfg.TaskCleanupWaitDuration)
+	task.cleanupTask(task.engine.currentConfig().TaskCleanupWaitDuration)
 }
 
 func (mtask *managedTask) emitCurrentStatus() {
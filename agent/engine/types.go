@@ -45,3 +45,12 @@ type ListContainersResponse struct {
 	DockerIds []string
 	Error     error
 }
+
+// DockerInfo is what the docker daemon reports about the host it runs on, for
+// the Info call. Versions of docker which don't report a value leave it empty.
+type DockerInfo struct {
+	OperatingSystem string
+	KernelVersion   string
+	StorageDriver   string
+	CgroupVersion   string
+}
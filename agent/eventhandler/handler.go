@@ -26,8 +26,25 @@ var log = logger.ForModule("eventhandler")
 // changes to a task or container's SentStatus
 var statesaver statemanager.Saver = statemanager.NewNoopStateManager()
 
-func HandleEngineEvents(taskEngine engine.TaskEngine, client api.ECSClient, saver statemanager.Saver) {
+// eventJournal is a package-wise journal of events which haven't been
+// submitted yet. It's nil if events aren't journaled.
+var eventJournal *Journal
+
+// webhookSink is a package-wise sink which state changes produced by the task
+// engine are delivered to. It's nil if no webhooks are configured.
+var webhookSink *WebhookSink
+
+// HandleEngineEvents submits the state changes of the task engine using the
+// given client. If journal is not nil, changes which were pending when the
+// agent last stopped are submitted first, and new ones are journaled until
+// they're submitted. If webhooks is not nil, new changes are also delivered
+// to it.
+func HandleEngineEvents(taskEngine engine.TaskEngine, client api.ECSClient, saver statemanager.Saver, journal *Journal, webhooks *WebhookSink) {
 	statesaver = saver
+	eventJournal = journal
+	webhookSink = webhooks
+	reportThrottles(client, handler.submitLimiter)
+	replayJournal(taskEngine, client)
 	for {
 		taskEvents, containerEvents := taskEngine.TaskEvents()
 
@@ -40,6 +57,7 @@ func HandleEngineEvents(taskEngine engine.TaskEngine, client api.ECSClient, save
 					break
 				}
 
+				webhookSink.containerChanged(event)
 				AddContainerEvent(event, client)
 			case event, open := <-taskEvents:
 				if !open {
@@ -48,8 +66,53 @@ func HandleEngineEvents(taskEngine engine.TaskEngine, client api.ECSClient, save
 					break
 				}
 
+				webhookSink.taskChanged(event)
 				AddTaskEvent(event, client)
 			}
 		}
 	}
 }
+
+// reportThrottles feeds the submissions the client throttles to the limiter
+// as they happen. Clients retrying them on their own would otherwise only
+// return them once the retries run out.
+func reportThrottles(client api.ECSClient, limiter *submitLimiter) {
+	if reporter, ok := client.(api.ThrottleReporter); ok {
+		reporter.OnSubmitThrottled(limiter.submitted)
+	}
+}
+
+// replayJournal queues the events which were pending when the agent last
+// stopped. They're linked to the sent statuses of the tasks and containers in
+// the task engine's state, so that changes already known to have been sent
+// are dropped as redundant.
+func replayJournal(taskEngine engine.TaskEngine, client api.ECSClient) {
+	events := eventJournal.pendingEvents()
+	if len(events) == 0 {
+		return
+	}
+	log.Info("Replaying pending state changes from the journal", "count", len(events))
+
+	tasks, err := taskEngine.ListTasks()
+	if err != nil {
+		log.Warn("Unable to list tasks to link pending state changes to", "err", err)
+	}
+	tasksByArn := make(map[string]*api.Task)
+	for _, task := range tasks {
+		tasksByArn[task.Arn] = task
+	}
+
+	for _, event := range events {
+		if task, ok := tasksByArn[event.taskArn()]; ok {
+			if !event.isContainerEvent {
+				event.taskChange.SentStatus = &task.SentStatus
+			}
+			for _, container := range task.Containers {
+				if event.isContainerEvent && container.Name == event.containerChange.ContainerName {
+					event.containerChange.SentStatus = &container.SentStatus
+				}
+			}
+		}
+		addEvent(event, client)
+	}
+}
@@ -14,8 +14,10 @@
 package eventhandler
 
 import (
+	"container/list"
 	"errors"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -36,7 +38,7 @@ type MockECSClient struct {
 func (m *MockECSClient) CredentialProvider() *credentials.Credentials {
 	return credentials.AnonymousCredentials
 }
-func (m *MockECSClient) RegisterContainerInstance(string, []string) (string, error) {
+func (m *MockECSClient) RegisterContainerInstance(string, []string, map[string]string) (string, error) {
 	return "", nil
 }
 func (m *MockECSClient) DiscoverPollEndpoint(string) (string, error) {
@@ -364,6 +366,73 @@ func TestSendsEvents(t *testing.T) {
 	}
 }
 
+func TestPendingEvents(t *testing.T) {
+	before := PendingEvents()
+
+	release := make(chan struct{})
+	submitted := make(chan struct{})
+	client := mockClient(
+		func(change api.TaskStateChange) error {
+			<-release
+			submitted <- struct{}{}
+			return nil
+		},
+		func(change api.ContainerStateChange) error {
+			return nil
+		},
+	)
+
+	AddTaskEvent(taskEvent("pending"), client)
+	if pending := PendingEvents(); pending != before+1 {
+		t.Errorf("Expected %d pending events while submitting, got %d", before+1, pending)
+	}
+
+	close(release)
+	<-submitted
+	for i := 0; i < 100 && PendingEvents() != before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pending := PendingEvents(); pending != before {
+		t.Errorf("Expected %d pending events after submitting, got %d", before, pending)
+	}
+}
+
+func TestMergesDuplicateEvents(t *testing.T) {
+	// Mark the task's events as being sent so that they stay queued
+	events := &eventList{List: list.New(), sending: true}
+	handler.Lock()
+	handler.taskMap["duplicates"] = events
+	handler.Unlock()
+	defer func() {
+		handler.Lock()
+		delete(handler.taskMap, "duplicates")
+		handler.Unlock()
+		atomic.AddInt64(&handler.pendingEvents, -int64(events.Len()))
+	}()
+
+	client := mockClient(nil, nil)
+	stopped := contEvent("duplicates")
+	stopped.Status = api.ContainerStopped
+	AddContainerEvent(contEvent("duplicates"), client)
+	AddContainerEvent(stopped, client)
+	AddContainerEvent(stopped, client)
+	AddTaskEvent(taskEvent("duplicates"), client)
+
+	var queued []string
+	for element := events.Front(); element != nil; element = element.Next() {
+		event := element.Value.(*sendableEvent)
+		if event.isContainerEvent {
+			queued = append(queued, "container "+event.containerChange.Status.String())
+		} else {
+			queued = append(queued, "task "+event.taskChange.Status.String())
+		}
+	}
+	expected := "container RUNNING,container STOPPED,task RUNNING"
+	if strings.Join(queued, ",") != expected {
+		t.Errorf("Expected the duplicate to be merged into %s, got %v", expected, queued)
+	}
+}
+
 func TestShouldBeSent(t *testing.T) {
 	sendableEvent := newSendableContainerEvent(api.ContainerStateChange{
 		Status: api.ContainerStopped,
@@ -0,0 +1,293 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+)
+
+// journalFile is the name of the file, in the data dir, to which pending
+// state changes are journaled.
+const journalFile = "ecs_agent_events.json"
+
+// journalCompactThreshold is the number of records after which the journal is
+// rewritten with only the pending state changes, once at least half of the
+// records are for changes which were submitted.
+const journalCompactThreshold = 1000
+
+// Journal persists state changes until they're submitted, so that those which
+// are pending when the agent stops are submitted, in order, after it restarts.
+// Every change is appended to the journal as a line of JSON when it's queued,
+// and a record marking it done is appended once it's submitted or found to be
+// redundant. Each record is synced to disk before the journal returns.
+//
+// A nil Journal doesn't persist anything.
+type Journal struct {
+	path             string
+	compactThreshold int
+
+	lock sync.Mutex
+	file *os.File
+	// nextSeq is the sequence number of the next change appended.
+	nextSeq uint64
+	// pending maps the sequence numbers of changes which aren't done to their
+	// records.
+	pending map[uint64]*journalRecord
+	// records is the number of records in the file.
+	records int
+}
+
+// journalRecord is a line of the journal. It holds either a state change or
+// marks the change with the same sequence number as done.
+type journalRecord struct {
+	Seq             uint64                    `json:"seq"`
+	Done            bool                      `json:"done,omitempty"`
+	ContainerChange *api.ContainerStateChange `json:"containerChange,omitempty"`
+	TaskChange      *api.TaskStateChange      `json:"taskChange,omitempty"`
+}
+
+// OpenJournal opens the journal in dataDir, creating it if needed, and
+// compacts it to the changes which are still pending.
+func OpenJournal(dataDir string) (*Journal, error) {
+	journal := &Journal{
+		path:             filepath.Join(dataDir, journalFile),
+		compactThreshold: journalCompactThreshold,
+		nextSeq:          1,
+		pending:          make(map[uint64]*journalRecord),
+	}
+	err := journal.load()
+	if err != nil {
+		return nil, err
+	}
+
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+	err = journal.compact()
+	if err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+// load reads the records in the journal file, if there is one.
+func (journal *Journal) load() error {
+	file, err := os.Open(journal.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				// Only the last record can be incomplete, if the agent stopped
+				// while appending it; that change was never queued.
+				log.Warn("Ignoring incomplete record at the end of the state change journal")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var record journalRecord
+		err = json.Unmarshal(line, &record)
+		if err != nil {
+			return err
+		}
+		if record.Seq >= journal.nextSeq {
+			journal.nextSeq = record.Seq + 1
+		}
+		if record.Done {
+			delete(journal.pending, record.Seq)
+		} else if record.ContainerChange != nil || record.TaskChange != nil {
+			journal.pending[record.Seq] = &record
+		}
+	}
+}
+
+// Close closes the journal file.
+func (journal *Journal) Close() error {
+	if journal == nil {
+		return nil
+	}
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+	return journal.file.Close()
+}
+
+// pendingEvents returns the changes which aren't done, in the order they were
+// appended.
+func (journal *Journal) pendingEvents() []*sendableEvent {
+	if journal == nil {
+		return nil
+	}
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+
+	seqs := journal.pendingSeqs()
+
+	events := make([]*sendableEvent, 0, len(seqs))
+	for _, seq := range seqs {
+		record := journal.pending[seq]
+		var event *sendableEvent
+		if record.ContainerChange != nil {
+			event = newSendableContainerEvent(*record.ContainerChange)
+		} else {
+			event = newSendableTaskEvent(*record.TaskChange)
+		}
+		event.seq = seq
+		events = append(events, event)
+	}
+	return events
+}
+
+// append journals a change which was queued, assigning it a sequence number.
+func (journal *Journal) append(event *sendableEvent) error {
+	if journal == nil {
+		return nil
+	}
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+
+	record := &journalRecord{Seq: journal.nextSeq}
+	if event.isContainerEvent {
+		change := event.containerChange
+		record.ContainerChange = &change
+	} else {
+		change := event.taskChange
+		record.TaskChange = &change
+	}
+	err := journal.write(record)
+	if err != nil {
+		return err
+	}
+	event.seq = record.Seq
+	journal.nextSeq++
+	journal.pending[record.Seq] = record
+	return nil
+}
+
+// done journals that a change was submitted or found to be redundant, so
+// that it isn't replayed. The journal is compacted once enough changes are
+// done.
+func (journal *Journal) done(event *sendableEvent) error {
+	if journal == nil || event.seq == 0 {
+		return nil
+	}
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+
+	err := journal.write(&journalRecord{Seq: event.seq, Done: true})
+	if err != nil {
+		return err
+	}
+	delete(journal.pending, event.seq)
+	if journal.records >= journal.compactThreshold && journal.records >= 2*len(journal.pending) {
+		return journal.compact()
+	}
+	return nil
+}
+
+// write appends a record to the file and syncs it. The lock must be held by
+// the caller.
+func (journal *Journal) write(record *journalRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = journal.file.Write(data)
+	if err != nil {
+		return err
+	}
+	journal.records++
+	return journal.file.Sync()
+}
+
+// compact replaces the file with one holding only the pending changes, and
+// opens it for appending. The lock must be held by the caller.
+func (journal *Journal) compact() error {
+	seqs := journal.pendingSeqs()
+
+	// The temp file is in the same directory so that it can be renamed
+	// atomically over the journal.
+	tmpfile, err := ioutil.TempFile(filepath.Dir(journal.path), "tmp_ecs_agent_events")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmpfile)
+	for _, seq := range seqs {
+		data, err := json.Marshal(journal.pending[seq])
+		if err != nil {
+			tmpfile.Close()
+			os.Remove(tmpfile.Name())
+			return err
+		}
+		writer.Write(data)
+		writer.WriteByte('\n')
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = tmpfile.Sync()
+	}
+	tmpfile.Close()
+	if err == nil {
+		err = os.Rename(tmpfile.Name(), journal.path)
+	}
+	if err != nil {
+		os.Remove(tmpfile.Name())
+		return err
+	}
+
+	if journal.file != nil {
+		journal.file.Close()
+	}
+	journal.file, err = os.OpenFile(journal.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	journal.records = len(seqs)
+	return nil
+}
+
+// pendingSeqs returns the sequence numbers of the pending changes in order.
+// The lock must be held by the caller.
+func (journal *Journal) pendingSeqs() []uint64 {
+	seqs := make([]uint64, 0, len(journal.pending))
+	for seq := range journal.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Sort(uint64Slice(seqs))
+	return seqs
+}
+
+type uint64Slice []uint64
+
+func (s uint64Slice) Len() int           { return len(s) }
+func (s uint64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,201 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/golang/mock/gomock"
+)
+
+func journalLines(t *testing.T, dir string) int {
+	data, err := ioutil.ReadFile(filepath.Join(dir, journalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestJournalReplaysPending(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs_eventhandler_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	journal, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exitCode := 137
+	stopped := contEvent("t1")
+	stopped.Status = api.ContainerStopped
+	stopped.Reason = "OOM"
+	stopped.ExitCode = &exitCode
+	events := []*sendableEvent{
+		newSendableContainerEvent(stopped),
+		newSendableTaskEvent(taskEvent("t1")),
+		newSendableContainerEvent(contEvent("t2")),
+	}
+	for _, event := range events {
+		if err := journal.append(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := journal.done(events[1]); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	journal, err = OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	pending := journal.pendingEvents()
+	if len(pending) != 2 || pending[0].seq != 1 || pending[1].seq != 3 {
+		t.Fatalf("Expected the events which weren't done, in order, got %v", pending)
+	}
+	replayed := pending[0].containerChange
+	if !pending[0].isContainerEvent || replayed.Status != api.ContainerStopped || replayed.Reason != "OOM" || replayed.ExitCode == nil || *replayed.ExitCode != 137 {
+		t.Errorf("Replayed event doesn't match the journaled one: %v", pending[0])
+	}
+	if lines := journalLines(t, dir); lines != 2 {
+		t.Errorf("Expected the journal to be compacted to the pending events, got %d records", lines)
+	}
+
+	event := newSendableTaskEvent(taskEvent("t3"))
+	journal.append(event)
+	if event.seq != 4 {
+		t.Errorf("Expected sequence numbers to continue after reopening, got %d", event.seq)
+	}
+}
+
+func TestJournalIncompleteRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs_eventhandler_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := `{"seq":1,"taskChange":{"TaskArn":"t1","Status":"STOPPED","Reason":""}}` + "\n" + `{"seq":2,"contai`
+	err = ioutil.WriteFile(filepath.Join(dir, journalFile), []byte(data), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	pending := journal.pendingEvents()
+	if len(pending) != 1 || pending[0].taskChange.TaskArn != "t1" || pending[0].taskChange.Status != api.TaskStopped {
+		t.Errorf("Expected only the complete record to be replayed, got %v", pending)
+	}
+}
+
+func TestJournalCompacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs_eventhandler_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	journal, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	journal.compactThreshold = 4
+
+	first := newSendableTaskEvent(taskEvent("t1"))
+	second := newSendableTaskEvent(taskEvent("t2"))
+	journal.append(first)
+	journal.append(second)
+	journal.done(first)
+	if lines := journalLines(t, dir); lines != 3 {
+		t.Errorf("Expected 3 records before compacting, got %d", lines)
+	}
+	journal.done(second)
+	if lines := journalLines(t, dir); lines != 0 {
+		t.Errorf("Expected the journal to be compacted, got %d records", lines)
+	}
+}
+
+func TestReplayJournal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dir, err := ioutil.TempDir("", "ecs_eventhandler_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	journal, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	journal.append(newSendableContainerEvent(contEvent("replayed")))
+	journal.append(newSendableTaskEvent(taskEvent("replayed")))
+
+	eventJournal = journal
+	defer func() {
+		eventJournal = nil
+	}()
+
+	// The task change was sent before the agent stopped, but the container
+	// change wasn't
+	task := &api.Task{Arn: "replayed", SentStatus: api.TaskRunning, Containers: []*api.Container{{Name: "containerName"}}}
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().ListTasks().Return([]*api.Task{task}, nil)
+
+	contStatus := make(chan api.ContainerStateChange, 1)
+	client := mockClient(
+		func(change api.TaskStateChange) error {
+			t.Errorf("Expected the task change not to be submitted again: %v", change)
+			return nil
+		},
+		func(change api.ContainerStateChange) error {
+			contStatus <- change
+			return nil
+		},
+	)
+	replayJournal(taskEngine, client)
+
+	select {
+	case change := <-contStatus:
+		if change.TaskArn != "replayed" || change.ContainerName != "containerName" {
+			t.Errorf("Unexpected container change submitted: %v", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the replayed container change")
+	}
+	for i := 0; i < 100 && len(journal.pendingEvents()) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pending := journal.pendingEvents(); len(pending) != 0 {
+		t.Errorf("Expected every replayed event to be done, got %v", pending)
+	}
+	if task.Containers[0].SentStatus != api.ContainerRunning {
+		t.Errorf("Expected the container's sent status to be updated, got %v", task.Containers[0].SentStatus)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+)
+
+const (
+	// maxConcurrentEventCalls bounds how far the number of tasks handled at
+	// once may grow while submissions aren't throttled.
+	maxConcurrentEventCalls = 10
+
+	// concurrencyIncreaseAfter is the number of successful submissions in a
+	// row after which one more task may be handled at once.
+	concurrencyIncreaseAfter = 20
+)
+
+// submitLimiter bounds the number of tasks whose events are submitted at once.
+// Tasks waiting to submit a terminal event are let through before the others,
+// since those free capacity in the cluster; events of a single task are still
+// submitted in order. The bound adapts to the API: it's halved whenever a
+// submission is throttled, and raised by one after a run of successful
+// submissions, up to maxConcurrentEventCalls.
+type submitLimiter struct {
+	lock sync.Mutex
+	cond *sync.Cond
+	// limit is the number of tasks which may be handled at once.
+	limit  int
+	active int
+	// waitingTerminal is the number of tasks waiting to submit a terminal
+	// event.
+	waitingTerminal int
+	successes       int
+}
+
+func newSubmitLimiter(limit int) *submitLimiter {
+	limiter := &submitLimiter{limit: limit}
+	limiter.cond = sync.NewCond(&limiter.lock)
+	return limiter
+}
+
+// acquire waits until a task may be handled. Tasks with a terminal event to
+// submit go first.
+func (limiter *submitLimiter) acquire(terminal bool) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	if terminal {
+		limiter.waitingTerminal++
+	}
+	for limiter.active >= limiter.limit || (!terminal && limiter.waitingTerminal > 0) {
+		limiter.cond.Wait()
+	}
+	if terminal {
+		limiter.waitingTerminal--
+	}
+	limiter.active++
+}
+
+// release lets another task be handled.
+func (limiter *submitLimiter) release() {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	limiter.active--
+	limiter.cond.Broadcast()
+}
+
+// submitted adapts the limit to the outcome of a submission.
+func (limiter *submitLimiter) submitted(err error) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	if err == nil {
+		limiter.successes++
+		if limiter.successes >= concurrencyIncreaseAfter && limiter.limit < maxConcurrentEventCalls {
+			limiter.limit++
+			limiter.successes = 0
+			log.Debug("Raised the number of tasks whose events are submitted at once", "limit", limiter.limit)
+			limiter.cond.Broadcast()
+		}
+		return
+	}
+
+	limiter.successes = 0
+	if !api.IsThrottlingError(err) {
+		return
+	}
+	if limiter.limit > 1 {
+		limiter.limit /= 2
+	}
+	log.Warn("State change submission throttled; lowered the number of tasks whose events are submitted at once", "limit", limiter.limit)
+}
+
+// currentLimit returns the number of tasks which may be handled at once.
+func (limiter *submitLimiter) currentLimit() int {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	return limiter.limit
+}
@@ -0,0 +1,132 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestSubmitLimiterAdapts(t *testing.T) {
+	limiter := newSubmitLimiter(4)
+	throttled := awserr.New("ThrottlingException", "Rate exceeded", nil)
+
+	limiter.submitted(throttled)
+	if limit := limiter.currentLimit(); limit != 2 {
+		t.Errorf("Expected the limit to be halved, got %d", limit)
+	}
+	limiter.submitted(throttled)
+	limiter.submitted(throttled)
+	if limit := limiter.currentLimit(); limit != 1 {
+		t.Errorf("Expected the limit not to go under 1, got %d", limit)
+	}
+	limiter.submitted(errors.New("connection reset"))
+	if limit := limiter.currentLimit(); limit != 1 {
+		t.Errorf("Expected other errors not to change the limit, got %d", limit)
+	}
+
+	for i := 0; i < concurrencyIncreaseAfter; i++ {
+		limiter.submitted(nil)
+	}
+	if limit := limiter.currentLimit(); limit != 2 {
+		t.Errorf("Expected the limit to be raised after a run of successes, got %d", limit)
+	}
+
+	limiter = newSubmitLimiter(maxConcurrentEventCalls)
+	for i := 0; i < concurrencyIncreaseAfter; i++ {
+		limiter.submitted(nil)
+	}
+	if limit := limiter.currentLimit(); limit != maxConcurrentEventCalls {
+		t.Errorf("Expected the limit not to go over %d, got %d", maxConcurrentEventCalls, limit)
+	}
+}
+
+func TestSubmitLimiterPrioritizesTerminal(t *testing.T) {
+	limiter := newSubmitLimiter(1)
+	limiter.acquire(false)
+
+	order := make(chan string, 2)
+	go func() {
+		limiter.acquire(false)
+		order <- "running"
+		limiter.release()
+	}()
+	// Give the non-terminal task a head start
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		limiter.acquire(true)
+		order <- "stopped"
+		limiter.release()
+	}()
+	for i := 0; i < 100; i++ {
+		limiter.lock.Lock()
+		waiting := limiter.waitingTerminal
+		limiter.lock.Unlock()
+		if waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	limiter.release()
+	for _, expected := range []string{"stopped", "running"} {
+		select {
+		case actual := <-order:
+			if actual != expected {
+				t.Errorf("Expected the %s task to go next, got the %s one", expected, actual)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the limiter")
+		}
+	}
+}
+
+func TestSubmitLimiterSeesRetriedThrottles(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ThrottlingException","message":"Rate exceeded"}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{AWSRegion: "us-east-1", Cluster: "default", APIEndpoint: server.URL}
+	client := api.NewECSClient(credentials.NewStaticCredentials("id", "secret", ""), config.NewHolder(cfg), http.DefaultClient, nil)
+	limiter := newSubmitLimiter(4)
+	reportThrottles(client, limiter)
+
+	err := client.SubmitTaskStateChange(taskEvent("arn"))
+	if err != nil {
+		t.Fatalf("Expected the throttled submission to be retried, got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected 2 calls to the API, got %d", n)
+	}
+	if limit := limiter.currentLimit(); limit != 2 {
+		t.Errorf("Expected the retried throttle to halve the limit, got %d", limit)
+	}
+}
@@ -15,9 +15,11 @@ package eventhandler
 
 import (
 	"container/list"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 )
 
@@ -25,6 +27,14 @@ var handler *taskHandler
 
 func init() {
 	handler = newTaskHandler()
+	metrics.DefaultRegistry.RegisterGaugeFunc(metrics.Namespace+"pending_state_changes", "State changes queued for submission to ECS.", nil,
+		func(emit func(float64, ...string)) {
+			emit(float64(PendingEvents()))
+		})
+	metrics.DefaultRegistry.RegisterGaugeFunc(metrics.Namespace+"state_change_submit_concurrency", "Tasks whose state changes may be submitted to ECS at once.", nil,
+		func(emit func(float64, ...string)) {
+			emit(float64(handler.submitLimiter.currentLimit()))
+		})
 }
 
 // AddTaskEvent queues up a state change for sending using the given client.
@@ -37,6 +47,12 @@ func AddContainerEvent(change api.ContainerStateChange, client api.ECSClient) {
 	addEvent(newSendableContainerEvent(change), client)
 }
 
+// PendingEvents returns the number of state changes which have been queued
+// but not yet submitted.
+func PendingEvents() int {
+	return int(atomic.LoadInt64(&handler.pendingEvents))
+}
+
 // Prepares a given event to be sent by adding it to the handler's appropriate
 // eventList
 func addEvent(change *sendableEvent, client api.ECSClient) {
@@ -60,8 +76,29 @@ func addEvent(change *sendableEvent, client api.ECSClient) {
 	taskList.Lock()
 	defer taskList.Unlock()
 
+	// The API takes a single container or task change per call, so the only
+	// changes which can be merged are duplicates queued back to back, such as a
+	// change replayed from the journal which the engine emits again on startup.
+	if back := taskList.Back(); back != nil && back.Value.(*sendableEvent).duplicates(change) {
+		log.Info("Merging duplicate event", "change", change)
+		err := eventJournal.done(change)
+		if err != nil {
+			log.Warn("Error journaling merged event", "change", change, "err", err)
+		}
+		return
+	}
+
+	// Events replayed from the journal are already in it
+	if change.seq == 0 {
+		err := eventJournal.append(change)
+		if err != nil {
+			log.Warn("Error journaling event; it won't be submitted if the agent restarts first", "change", change, "err", err)
+		}
+	}
+
 	// Update taskEvent
 	taskList.PushBack(change)
+	atomic.AddInt64(&handler.pendingEvents, 1)
 
 	if !taskList.sending {
 		taskList.sending = true
@@ -70,7 +107,8 @@ func addEvent(change *sendableEvent, client api.ECSClient) {
 }
 
 // Continuously retries sending an event until it succeeds, sleeping between each
-// attempt
+// attempt. Tasks with a terminal event to send are let through the
+// handler's submitLimiter first.
 func SubmitTaskEvents(events *eventList, client api.ECSClient) {
 	backoff := utils.NewSimpleBackoff(1*time.Second, 30*time.Second, 0.20, 1.3)
 
@@ -85,9 +123,9 @@ func SubmitTaskEvents(events *eventList, client api.ECSClient) {
 		utils.RetryWithBackoff(backoff, func() error {
 			// Lock and unlock within this function, allowing the list to be added
 			// to while we're not actively sending an event
-			log.Debug("Waiting on semaphore to send...")
-			handler.submitSemaphore.Wait()
-			defer handler.submitSemaphore.Post()
+			log.Debug("Waiting on limiter to send...")
+			handler.submitLimiter.acquire(events.frontIsTerminal())
+			defer handler.submitLimiter.release()
 
 			log.Debug("Aquiring lock for sending event...")
 			events.Lock()
@@ -111,6 +149,7 @@ func SubmitTaskEvents(events *eventList, client api.ECSClient) {
 			if event.containerShouldBeSent() {
 				llog.Info("Sending container change", "change", event)
 				err = client.SubmitContainerStateChange(event.containerChange)
+				handler.submitLimiter.submitted(err)
 				if err == nil {
 					// submitted; ensure we don't retry it
 					event.containerSent = true
@@ -120,13 +159,15 @@ func SubmitTaskEvents(events *eventList, client api.ECSClient) {
 					statesaver.Save()
 					llog.Debug("Submitted container state change")
 					backoff.Reset()
-					events.Remove(eventToSubmit)
+					removeEvent(events, eventToSubmit)
 				} else {
+					metrics.StateChangeSubmitErrors.Inc("container")
 					llog.Error("Unretriable error submitting container state change", "err", err)
 				}
 			} else if event.taskShouldBeSent() {
 				llog.Info("Sending task change", "change", event)
 				err = client.SubmitTaskStateChange(event.taskChange)
+				handler.submitLimiter.submitted(err)
 				if err == nil {
 					// submitted or can't be retried; ensure we don't retry it
 					event.taskSent = true
@@ -136,14 +177,15 @@ func SubmitTaskEvents(events *eventList, client api.ECSClient) {
 					statesaver.Save()
 					llog.Debug("Submitted task state change")
 					backoff.Reset()
-					events.Remove(eventToSubmit)
+					removeEvent(events, eventToSubmit)
 				} else {
+					metrics.StateChangeSubmitErrors.Inc("task")
 					llog.Error("Unretriable error submitting container state change", "err", err)
 				}
 			} else {
 				// Shouldn't be sent as either a task or container change event; must have been already sent
 				llog.Info("Not submitting redundant event; just removing")
-				events.Remove(eventToSubmit)
+				removeEvent(events, eventToSubmit)
 			}
 
 			if events.Len() == 0 {
@@ -157,3 +199,14 @@ func SubmitTaskEvents(events *eventList, client api.ECSClient) {
 		})
 	}
 }
+
+// removeEvent removes a submitted or redundant event from its list. The list
+// must be locked by the caller.
+func removeEvent(events *eventList, event *list.Element) {
+	events.Remove(event)
+	atomic.AddInt64(&handler.pendingEvents, -1)
+	err := eventJournal.done(event.Value.(*sendableEvent))
+	if err != nil {
+		log.Warn("Error journaling submitted event; it may be submitted again if the agent restarts", "event", event.Value, "err", err)
+	}
+}
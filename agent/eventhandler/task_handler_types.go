@@ -18,10 +18,10 @@ import (
 	"sync"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
-	"github.com/aws/amazon-ecs-agent/agent/utils"
 )
 
-// Maximum number of tasks that may be handled at once by the taskHandler
+// Number of tasks that may be handled at once by the taskHandler until it's
+// adapted by the submitLimiter
 const concurrentEventCalls = 3
 
 // a state change that may have a container and, optionally, a task event to
@@ -35,6 +35,10 @@ type sendableEvent struct {
 
 	taskSent   bool
 	taskChange api.TaskStateChange
+
+	// seq is the sequence number of the event in the journal, or 0 if it
+	// isn't journaled
+	seq uint64
 }
 
 func (event sendableEvent) String() string {
@@ -68,6 +72,27 @@ func (event *sendableEvent) taskArn() string {
 	return event.taskChange.TaskArn
 }
 
+// isTerminal returns true if the event is for a stopped container or task.
+func (event *sendableEvent) isTerminal() bool {
+	if event.isContainerEvent {
+		return event.containerChange.Status.Terminal()
+	}
+	return event.taskChange.Status.Terminal()
+}
+
+// duplicates returns true if other changes the same container or task to the
+// same status as this event.
+func (event *sendableEvent) duplicates(other *sendableEvent) bool {
+	if event.isContainerEvent != other.isContainerEvent || event.taskArn() != other.taskArn() {
+		return false
+	}
+	if event.isContainerEvent {
+		return event.containerChange.ContainerName == other.containerChange.ContainerName &&
+			event.containerChange.Status == other.containerChange.Status
+	}
+	return event.taskChange.Status == other.taskChange.Status
+}
+
 func (event *sendableEvent) taskShouldBeSent() bool {
 	if event.isContainerEvent {
 		return false
@@ -99,19 +124,27 @@ type eventList struct {
 	*list.List      // list of *sendableEvents
 }
 
+// frontIsTerminal returns true if the next event to submit is terminal.
+func (events *eventList) frontIsTerminal() bool {
+	events.Lock()
+	defer events.Unlock()
+	front := events.Front()
+	return front != nil && front.Value.(*sendableEvent).isTerminal()
+}
+
 type taskHandler struct {
-	submitSemaphore utils.Semaphore       // Semaphore on the number of tasks that may be handled at once
-	taskMap         map[string]*eventList // arn:*eventList map so events may be serialized per task
+	pendingEvents int64                 // Number of events queued across all tasks; accessed atomically, so keep it first for alignment
+	submitLimiter *submitLimiter        // Bounds the number of tasks that may be handled at once
+	taskMap       map[string]*eventList // arn:*eventList map so events may be serialized per task
 
 	sync.RWMutex // Lock for the taskMap
 }
 
 func newTaskHandler() *taskHandler {
 	taskMap := make(map[string]*eventList)
-	submitSemaphore := utils.NewSemaphore(concurrentEventCalls)
 
 	return &taskHandler{
-		taskMap:         taskMap,
-		submitSemaphore: submitSemaphore,
+		taskMap:       taskMap,
+		submitLimiter: newSubmitLimiter(concurrentEventCalls),
 	}
 }
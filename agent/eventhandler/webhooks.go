@@ -0,0 +1,246 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/utils"
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+)
+
+const (
+	// WebhookSignatureHeader holds the HMAC-SHA256 of the body of a delivery,
+	// as "sha256=<hex>", when a secret is configured.
+	WebhookSignatureHeader = "X-Ecs-Agent-Signature"
+
+	// webhookQueueSize is the number of deliveries queued per webhook before
+	// new ones are dropped.
+	webhookQueueSize = 1000
+	// webhookMaxAttempts is the number of times a delivery is attempted.
+	webhookMaxAttempts = 5
+	webhookTimeout     = 10 * time.Second
+)
+
+// Reasons used as the value of the webhook failures metric's "reason" label.
+const (
+	webhookFailureOverflow = "overflow"
+	webhookFailureFailed   = "failed"
+)
+
+// Types of StateChangeNotification.
+const (
+	StateChangeTypeTask      = "task"
+	StateChangeTypeContainer = "container"
+)
+
+// StateChangeNotification is the body of a delivery to a state change
+// webhook. It holds the same data as the change submitted to ECS.
+type StateChangeNotification struct {
+	Type                 string                  `json:"type"`
+	Cluster              string                  `json:"cluster"`
+	ContainerInstanceArn string                  `json:"containerInstanceArn"`
+	TaskArn              string                  `json:"taskArn"`
+	ContainerName        string                  `json:"containerName,omitempty"`
+	Status               string                  `json:"status"`
+	Reason               string                  `json:"reason,omitempty"`
+	ExitCode             *int                    `json:"exitCode,omitempty"`
+	NetworkBindings      []WebhookNetworkBinding `json:"networkBindings,omitempty"`
+	Time                 time.Time               `json:"time"`
+}
+
+// WebhookNetworkBinding is a port of a container bound on the host.
+type WebhookNetworkBinding struct {
+	BindIP        string `json:"bindIP"`
+	ContainerPort uint16 `json:"containerPort"`
+	HostPort      uint16 `json:"hostPort"`
+	Protocol      string `json:"protocol"`
+}
+
+// WebhookSink posts task and container state changes to local HTTP
+// endpoints. Each endpoint has its own queue, drained by its own goroutine,
+// so a slow or failing endpoint holds up neither the others nor submission
+// to ECS.
+//
+// A nil WebhookSink doesn't post anything.
+type WebhookSink struct {
+	cluster              string
+	containerInstanceArn string
+	endpoints            []*webhookEndpoint
+}
+
+type webhookEndpoint struct {
+	url        string
+	secret     []byte
+	httpClient *http.Client
+	queue      chan []byte
+}
+
+// NewWebhookSink starts delivering state changes to the given urls, signing
+// them with secret if it isn't empty. It returns nil if there are no urls.
+func NewWebhookSink(urls []string, secret string, cluster, containerInstanceArn string) *WebhookSink {
+	if len(urls) == 0 {
+		return nil
+	}
+	sink := &WebhookSink{
+		cluster:              cluster,
+		containerInstanceArn: containerInstanceArn,
+	}
+	for _, url := range urls {
+		endpoint := &webhookEndpoint{
+			url:        url,
+			secret:     []byte(secret),
+			httpClient: &http.Client{Timeout: webhookTimeout},
+			queue:      make(chan []byte, webhookQueueSize),
+		}
+		sink.endpoints = append(sink.endpoints, endpoint)
+		go endpoint.deliverLoop()
+	}
+	return sink
+}
+
+// taskChanged queues a task state change for delivery. Changes known to
+// have been submitted already aren't delivered again.
+func (sink *WebhookSink) taskChanged(change api.TaskStateChange) {
+	if sink == nil || !newSendableTaskEvent(change).taskShouldBeSent() {
+		return
+	}
+	sink.notify(NewTaskStateChangeNotification(change))
+}
+
+// containerChanged queues a container state change for delivery. Changes
+// known to have been submitted already aren't delivered again.
+func (sink *WebhookSink) containerChanged(change api.ContainerStateChange) {
+	if sink == nil || !newSendableContainerEvent(change).containerShouldBeSent() {
+		return
+	}
+	sink.notify(NewContainerStateChangeNotification(change))
+}
+
+// NewTaskStateChangeNotification returns the notification for a task state
+// change, timestamped now.
+func NewTaskStateChangeNotification(change api.TaskStateChange) StateChangeNotification {
+	return StateChangeNotification{
+		Type:    StateChangeTypeTask,
+		TaskArn: change.TaskArn,
+		Status:  change.Status.String(),
+		Reason:  change.Reason,
+		Time:    ttime.Now().UTC(),
+	}
+}
+
+// NewContainerStateChangeNotification returns the notification for a
+// container state change, timestamped now.
+func NewContainerStateChangeNotification(change api.ContainerStateChange) StateChangeNotification {
+	notification := StateChangeNotification{
+		Type:          StateChangeTypeContainer,
+		TaskArn:       change.TaskArn,
+		ContainerName: change.ContainerName,
+		Status:        change.Status.String(),
+		Reason:        change.Reason,
+		ExitCode:      change.ExitCode,
+		Time:          ttime.Now().UTC(),
+	}
+	for _, binding := range change.PortBindings {
+		notification.NetworkBindings = append(notification.NetworkBindings, WebhookNetworkBinding{
+			BindIP:        binding.BindIp,
+			ContainerPort: binding.ContainerPort,
+			HostPort:      binding.HostPort,
+			Protocol:      binding.Protocol.String(),
+		})
+	}
+	return notification
+}
+
+func (sink *WebhookSink) notify(notification StateChangeNotification) {
+	notification.Cluster = sink.cluster
+	notification.ContainerInstanceArn = sink.containerInstanceArn
+	body, err := json.Marshal(notification)
+	if err != nil {
+		log.Warn("Error marshaling state change for webhooks", "notification", notification, "err", err)
+		return
+	}
+	for _, endpoint := range sink.endpoints {
+		select {
+		case endpoint.queue <- body:
+		default:
+			log.Warn("State change webhook queue is full; dropping state change", "url", endpoint.url, "task", notification.TaskArn, "status", notification.Status)
+			metrics.StateChangeWebhookFailures.Inc(webhookFailureOverflow)
+		}
+	}
+}
+
+// deliverLoop delivers the queued state changes in order, retrying each with
+// a backoff before moving on to the next.
+func (endpoint *webhookEndpoint) deliverLoop() {
+	for body := range endpoint.queue {
+		backoff := utils.NewSimpleBackoff(time.Second, 30*time.Second, 0.20, 2)
+		err := utils.RetryNWithBackoff(backoff, webhookMaxAttempts, func() error {
+			return endpoint.post(body)
+		})
+		if err != nil {
+			log.Warn("Giving up delivering state change to webhook", "url", endpoint.url, "err", err)
+			metrics.StateChangeWebhookFailures.Inc(webhookFailureFailed)
+		}
+	}
+}
+
+func (endpoint *webhookEndpoint) post(body []byte) error {
+	req, err := http.NewRequest("POST", endpoint.url, bytes.NewReader(body))
+	if err != nil {
+		return utils.NewRetriableError(utils.NewRetriable(false), err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(endpoint.secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookBody(endpoint.secret, body))
+	}
+	resp, err := endpoint.httpClient.Do(req)
+	if err != nil {
+		log.Debug("Error delivering state change to webhook", "url", endpoint.url, "err", err)
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	err = errors.New("webhook returned status " + strconv.Itoa(resp.StatusCode))
+	log.Debug("Error delivering state change to webhook", "url", endpoint.url, "err", err)
+	// Client errors other than throttling won't succeed on retry. 429 is Too
+	// Many Requests, which net/http has no constant for in the Go versions
+	// the agent builds with.
+	retry := resp.StatusCode >= 500 || resp.StatusCode == 429
+	return utils.NewRetriableError(utils.NewRetriable(retry), err)
+}
+
+// SignWebhookBody returns the hex-encoded HMAC-SHA256 of body, as sent in the
+// WebhookSignatureHeader of deliveries.
+func SignWebhookBody(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
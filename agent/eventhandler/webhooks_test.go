@@ -0,0 +1,133 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventhandler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+)
+
+func TestWebhookSinkDelivers(t *testing.T) {
+	testTime := ttime.NewTestTime()
+	testTime.LudicrousSpeed(true)
+	ttime.SetTime(testTime)
+	defer ttime.SetTime(&ttime.DefaultTime{})
+
+	var attempts int32
+	delivered := make(chan StateChangeNotification, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if signature := r.Header.Get(WebhookSignatureHeader); signature != "sha256="+SignWebhookBody([]byte("secret"), body) {
+			t.Errorf("Wrong signature: %s", signature)
+		}
+		// The first attempt fails and is retried
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var notification StateChangeNotification
+		if err := json.Unmarshal(body, &notification); err != nil {
+			t.Error(err)
+		}
+		delivered <- notification
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink([]string{server.URL}, "secret", "cluster", "instance")
+	exitCode := 1
+	stopped := contEvent("webhooks")
+	stopped.Status = api.ContainerStopped
+	stopped.Reason = "Essential container exited"
+	stopped.ExitCode = &exitCode
+	stopped.PortBindings = []api.PortBinding{{ContainerPort: 80, HostPort: 32768, BindIp: "0.0.0.0", Protocol: api.TransportProtocolUDP}}
+	sink.containerChanged(stopped)
+
+	select {
+	case notification := <-delivered:
+		if notification.Type != StateChangeTypeContainer || notification.Cluster != "cluster" || notification.ContainerInstanceArn != "instance" ||
+			notification.TaskArn != "webhooks" || notification.ContainerName != "containerName" || notification.Status != "STOPPED" ||
+			notification.Reason != stopped.Reason || notification.ExitCode == nil || *notification.ExitCode != 1 {
+			t.Errorf("Delivered state change doesn't match: %+v", notification)
+		}
+		expected := WebhookNetworkBinding{BindIP: "0.0.0.0", ContainerPort: 80, HostPort: 32768, Protocol: "udp"}
+		if len(notification.NetworkBindings) != 1 || notification.NetworkBindings[0] != expected {
+			t.Errorf("Expected network bindings [%+v], got %+v", expected, notification.NetworkBindings)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the state change to be delivered")
+	}
+}
+
+func TestWebhookSinkClientError(t *testing.T) {
+	testTime := ttime.NewTestTime()
+	testTime.LudicrousSpeed(true)
+	ttime.SetTime(testTime)
+	defer ttime.SetTime(&ttime.DefaultTime{})
+
+	var attempts int32
+	requests := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(WebhookSignatureHeader) != "" {
+			t.Error("Expected no signature without a secret")
+		}
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		var notification StateChangeNotification
+		json.NewDecoder(r.Body).Decode(&notification)
+		requests <- notification.Status
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink([]string{server.URL}, "", "cluster", "instance")
+	sink.taskChanged(taskEvent("webhooks"))
+	stopped := taskEvent("webhooks")
+	stopped.Status = api.TaskStopped
+	sink.taskChanged(stopped)
+
+	// The rejected change isn't retried, so the next one is delivered
+	for _, expected := range []string{"RUNNING", "STOPPED"} {
+		select {
+		case status := <-requests:
+			if status != expected {
+				t.Errorf("Expected a %s task to be delivered, got %s", expected, status)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the state change to be delivered")
+		}
+	}
+}
+
+func TestWebhookSinkSkipsSent(t *testing.T) {
+	var sink *WebhookSink
+	// A nil sink is a no-op
+	sink.taskChanged(taskEvent("webhooks"))
+
+	sink = &WebhookSink{endpoints: []*webhookEndpoint{{queue: make(chan []byte, 1)}}}
+	sent := api.TaskRunning
+	change := taskEvent("webhooks")
+	change.SentStatus = &sent
+	sink.taskChanged(change)
+	if len(sink.endpoints[0].queue) != 0 {
+		t.Error("Expected a change which was already submitted not to be delivered")
+	}
+}
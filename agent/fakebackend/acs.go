@@ -0,0 +1,144 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fakebackend
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// ACSServer is a fake ACS backend. Tests push messages to the agent and
+// assert on the acks and nacks it sends back.
+type ACSServer struct {
+	*wsServer
+	messageID int64
+	seqNum    int64
+}
+
+// NewACSServer starts a fake ACS backend.
+func NewACSServer() *ACSServer {
+	return &ACSServer{
+		wsServer: newWSServer(newTypeDecoder(
+			ecsacs.AckRequest{}, ecsacs.NackRequest{},
+		)),
+	}
+}
+
+// nextMessageID returns a message id which wasn't used by the server yet.
+func (acs *ACSServer) nextMessageID() string {
+	return "fakebackend-" + strconv.FormatInt(atomic.AddInt64(&acs.messageID, 1), 10)
+}
+
+// SendPayload sends the given tasks to the agent and returns the id of the
+// message, which the agent acks once it has handled them. Every payload has
+// a greater sequence number than the previous one.
+func (acs *ACSServer) SendPayload(cluster, containerInstanceArn string, tasks ...*ecsacs.Task) (string, error) {
+	messageID := acs.nextMessageID()
+	err := acs.Send(&ecsacs.PayloadMessage{
+		ClusterArn:           aws.String(cluster),
+		ContainerInstanceArn: aws.String(containerInstanceArn),
+		GeneratedAt:          aws.Int64(time.Now().Unix()),
+		MessageId:            aws.String(messageID),
+		SeqNum:               aws.Int64(atomic.AddInt64(&acs.seqNum, 1)),
+		Tasks:                tasks,
+	})
+	return messageID, err
+}
+
+// SendHeartbeat sends a heartbeat to the agent.
+func (acs *ACSServer) SendHeartbeat() error {
+	return acs.Send(&ecsacs.HeartbeatMessage{Healthy: aws.Bool(true)})
+}
+
+// SendStageUpdate asks the agent to download the update at location, and
+// returns the id of the message.
+func (acs *ACSServer) SendStageUpdate(cluster, containerInstanceArn, location, signature string) (string, error) {
+	messageID := acs.nextMessageID()
+	err := acs.Send(&ecsacs.StageUpdateMessage{
+		ClusterArn:           aws.String(cluster),
+		ContainerInstanceArn: aws.String(containerInstanceArn),
+		MessageId:            aws.String(messageID),
+		UpdateInfo: &ecsacs.UpdateInfo{
+			Location:  aws.String(location),
+			Signature: aws.String(signature),
+		},
+	})
+	return messageID, err
+}
+
+// SendPerformUpdate asks the agent to apply the update it staged, and
+// returns the id of the message.
+func (acs *ACSServer) SendPerformUpdate(cluster, containerInstanceArn, location, signature string) (string, error) {
+	messageID := acs.nextMessageID()
+	err := acs.Send(&ecsacs.PerformUpdateMessage{
+		ClusterArn:           aws.String(cluster),
+		ContainerInstanceArn: aws.String(containerInstanceArn),
+		MessageId:            aws.String(messageID),
+		UpdateInfo: &ecsacs.UpdateInfo{
+			Location:  aws.String(location),
+			Signature: aws.String(signature),
+		},
+	})
+	return messageID, err
+}
+
+// Acks returns the acks received from the agent, in order.
+func (acs *ACSServer) Acks() []*ecsacs.AckRequest {
+	var acks []*ecsacs.AckRequest
+	for _, message := range acs.Received() {
+		if ack, ok := message.(*ecsacs.AckRequest); ok {
+			acks = append(acks, ack)
+		}
+	}
+	return acks
+}
+
+// Nacks returns the nacks received from the agent, in order.
+func (acs *ACSServer) Nacks() []*ecsacs.NackRequest {
+	var nacks []*ecsacs.NackRequest
+	for _, message := range acs.Received() {
+		if nack, ok := message.(*ecsacs.NackRequest); ok {
+			nacks = append(nacks, nack)
+		}
+	}
+	return nacks
+}
+
+// WaitForAck waits for the agent to ack the message with the given id.
+func (acs *ACSServer) WaitForAck(messageID string, timeout time.Duration) (*ecsacs.AckRequest, error) {
+	message, err := acs.waitForMessage(func(message interface{}) bool {
+		ack, ok := message.(*ecsacs.AckRequest)
+		return ok && aws.StringValue(ack.MessageId) == messageID
+	}, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return message.(*ecsacs.AckRequest), nil
+}
+
+// WaitForNack waits for the agent to nack the message with the given id.
+func (acs *ACSServer) WaitForNack(messageID string, timeout time.Duration) (*ecsacs.NackRequest, error) {
+	message, err := acs.waitForMessage(func(message interface{}) bool {
+		nack, ok := message.(*ecsacs.NackRequest)
+		return ok && aws.StringValue(nack.MessageId) == messageID
+	}, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return message.(*ecsacs.NackRequest), nil
+}
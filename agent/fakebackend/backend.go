@@ -0,0 +1,72 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package fakebackend provides in-process fakes of the ECS backend the agent
+// talks to: the ECS API, and the ACS and TCS websocket services. They let
+// the agent's flows from registration to state submission run in tests
+// without credentials or network access.
+//
+// The fakes listen on TLS with self-signed certificates, so the agent must
+// be told to accept invalid certificates. Requests must be signed, but the
+// signatures aren't verified; Credentials returns credentials to sign them
+// with.
+package fakebackend
+
+import (
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+var log = logger.ForModule("fakebackend")
+
+// Region is the region the fake backend pretends to be in.
+const Region = "us-west-2"
+
+// Backend bundles a fake ECS API with the fake ACS and TCS backends it
+// returns from DiscoverPollEndpoint.
+type Backend struct {
+	ECS *ECSServer
+	ACS *ACSServer
+	TCS *TCSServer
+}
+
+// NewBackend starts a fake ECS backend.
+func NewBackend() *Backend {
+	acs := NewACSServer()
+	tcs := NewTCSServer()
+	return &Backend{
+		ECS: NewECSServer(acs.URL(), tcs.URL()),
+		ACS: acs,
+		TCS: tcs,
+	}
+}
+
+// Configure points the agent's config at the fake backend.
+func (backend *Backend) Configure(cfg *config.Config) {
+	cfg.APIEndpoint = backend.ECS.URL()
+	cfg.AWSRegion = Region
+}
+
+// Close stops the servers of the backend.
+func (backend *Backend) Close() {
+	backend.ECS.Close()
+	backend.ACS.Close()
+	backend.TCS.Close()
+}
+
+// Credentials returns static credentials the agent can sign its requests to
+// the fake backend with.
+func Credentials() *credentials.Credentials {
+	return credentials.NewStaticCredentials("AKIDFAKEBACKEND", "fakebackend", "")
+}
@@ -0,0 +1,206 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fakebackend
+
+import (
+	"testing"
+	"time"
+
+	acshandler "github.com/aws/amazon-ecs-agent/agent/acs/handler"
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/httpclient"
+	"github.com/aws/amazon-ecs-agent/agent/statemanager"
+	"github.com/aws/amazon-ecs-agent/agent/stats/mock"
+	"github.com/aws/amazon-ecs-agent/agent/tcs/client"
+	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"golang.org/x/net/context"
+)
+
+const waitTimeout = 10 * time.Second
+
+func newTestClient(backend *Backend) (*config.Config, api.ECSClient) {
+	cfg := &config.Config{Cluster: "fakebackend"}
+	backend.Configure(cfg)
+	client := api.NewECSClient(Credentials(), config.NewHolder(cfg), httpclient.New(api.RoundtripTimeout, true), ec2.NewBlackholeEC2MetadataClient())
+	return cfg, client
+}
+
+func TestRegisterAndSubmitStateChanges(t *testing.T) {
+	backend := NewBackend()
+	defer backend.Close()
+	_, client := newTestClient(backend)
+
+	arn, err := client.RegisterContainerInstance("", []string{"com.amazonaws.ecs.capability.docker-remote-api.1.17"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registrations := backend.ECS.Registrations()
+	if len(registrations) != 1 || aws.StringValue(registrations[0].Cluster) != "fakebackend" || len(registrations[0].Attributes) != 1 {
+		t.Fatalf("Unexpected registrations: %v", registrations)
+	}
+	reregistered, err := client.RegisterContainerInstance(arn, nil, nil)
+	if err != nil || reregistered != arn {
+		t.Errorf("Expected re-registering to keep the arn %s, got %s: %v", arn, reregistered, err)
+	}
+
+	endpoint, err := client.DiscoverPollEndpoint(arn)
+	if err != nil || endpoint != backend.ACS.URL() {
+		t.Errorf("Expected the fake ACS endpoint, got %s: %v", endpoint, err)
+	}
+	endpoint, err = client.DiscoverTelemetryEndpoint(arn)
+	if err != nil || endpoint != backend.TCS.URL() {
+		t.Errorf("Expected the fake TCS endpoint, got %s: %v", endpoint, err)
+	}
+
+	// Throttled submissions are retried by the SDK
+	backend.ECS.FailNext("SubmitTaskStateChange", "ThrottlingException")
+	err = client.SubmitTaskStateChange(api.TaskStateChange{TaskArn: "arn:task", Status: api.TaskRunning})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.ECS.WaitForTaskStateChange("arn:task", "RUNNING", waitTimeout); err != nil {
+		t.Error(err)
+	}
+	if changes := backend.ECS.TaskStateChanges(); len(changes) != 1 {
+		t.Errorf("Expected the throttled submission to be recorded once, got %v", changes)
+	}
+
+	exitCode := 1
+	err = client.SubmitContainerStateChange(api.ContainerStateChange{TaskArn: "arn:task", ContainerName: "web", Status: api.ContainerStopped, ExitCode: &exitCode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err := backend.ECS.WaitForContainerStateChange("arn:task", "web", "STOPPED", waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.Int64Value(change.ExitCode) != 1 {
+		t.Errorf("Wrong exit code submitted: %v", change)
+	}
+}
+
+func TestACSSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	backend := NewBackend()
+	defer backend.Close()
+	cfg, client := newTestClient(backend)
+	cfg.UpdatesEnabled = true
+
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker: 1.9.1", nil).AnyTimes()
+	added := make(chan *api.Task, 1)
+	taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *api.Task) {
+		added <- task
+	}).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go acshandler.StartSession(ctx, acshandler.StartSessionArguments{
+		AcceptInvalidCert:    true,
+		Config:               cfg,
+		ContainerInstanceArn: "arn:instance",
+		CredentialProvider:   Credentials(),
+		ECSClient:            client,
+		StateManager:         statemanager.NewNoopStateManager(),
+		TaskEngine:           taskEngine,
+	})
+
+	query, err := backend.ACS.WaitForConnection(1, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("clusterArn") != "fakebackend" || query.Get("containerInstanceArn") != "arn:instance" {
+		t.Errorf("Unexpected connection query: %v", query)
+	}
+	if err := backend.ACS.SendHeartbeat(); err != nil {
+		t.Error(err)
+	}
+
+	messageID, err := backend.ACS.SendPayload("fakebackend", "arn:instance", &ecsacs.Task{
+		Arn:           aws.String("arn:task"),
+		Family:        aws.String("web"),
+		Version:       aws.String("1"),
+		DesiredStatus: aws.String("RUNNING"),
+		Containers:    []*ecsacs.Container{{Name: aws.String("nginx"), Image: aws.String("nginx:latest")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case task := <-added:
+		if task.Arn != "arn:task" || len(task.Containers) != 1 {
+			t.Errorf("Unexpected task added: %v", task)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("Timed out waiting for the task to be added")
+	}
+	if _, err := backend.ACS.WaitForAck(messageID, waitTimeout); err != nil {
+		t.Error(err)
+	}
+
+	// Nothing was staged, so the update is nacked
+	messageID, err = backend.ACS.SendPerformUpdate("fakebackend", "arn:instance", "https://localhost/update.tar", "sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.ACS.WaitForNack(messageID, waitTimeout); err != nil {
+		t.Error(err)
+	}
+
+	// The agent reconnects when the connection is closed
+	backend.ACS.Disconnect()
+	if _, err := backend.ACS.WaitForConnection(2, time.Minute); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTCSPublishMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	backend := NewBackend()
+	defer backend.Close()
+
+	statsEngine := mock_stats.NewMockEngine(ctrl)
+	statsEngine.EXPECT().GetInstanceMetrics().Return(&ecstcs.MetricsMetadata{
+		Cluster:           aws.String("fakebackend"),
+		ContainerInstance: aws.String("arn:instance"),
+		Idle:              aws.Bool(true),
+	}, []*ecstcs.TaskMetric{}, nil).AnyTimes()
+
+	publishBuffer := tcsclient.NewPublishBuffer(time.Minute)
+	client := tcsclient.New(backend.TCS.URL(), Region, Credentials(), true, statsEngine, publishBuffer, 10*time.Millisecond)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	go client.Serve()
+
+	requests, err := backend.TCS.WaitForPublishMetrics(2, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(requests[0].Metadata.Cluster) != "fakebackend" {
+		t.Errorf("Unexpected metrics published: %v", requests[0])
+	}
+	if err := backend.TCS.SendHeartbeat(); err != nil {
+		t.Error(err)
+	}
+}
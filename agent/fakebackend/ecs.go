@@ -0,0 +1,280 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fakebackend
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/ecs_client/model/ecs"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+)
+
+const (
+	// ecsTargetPrefix prefixes the operation in the X-Amz-Target header of
+	// ECS API requests.
+	ecsTargetPrefix = "AmazonEC2ContainerServiceV20141113."
+
+	containerInstanceArnPrefix = "arn:aws:ecs:us-west-2:000000000000:container-instance/"
+	clusterArnPrefix           = "arn:aws:ecs:us-west-2:000000000000:cluster/"
+)
+
+// ECSServer is a fake of the ECS API calls the agent makes, speaking the
+// JSON 1.1 protocol of the SDK over TLS with a self-signed certificate. It
+// registers container instances, returns the endpoints of the fake ACS and
+// TCS backends, and records state changes for assertions.
+type ECSServer struct {
+	*recorder
+	server *httptest.Server
+
+	pollEndpoint      string
+	telemetryEndpoint string
+	// failures maps operations to the error codes their next calls fail with.
+	failures map[string][]string
+
+	clusters              []string
+	registrations         []*ecs.RegisterContainerInstanceInput
+	taskStateChanges      []*ecs.SubmitTaskStateChangeInput
+	containerStateChanges []*ecs.SubmitContainerStateChangeInput
+}
+
+// NewECSServer starts a fake ECS API. DiscoverPollEndpoint returns the
+// given endpoints.
+func NewECSServer(pollEndpoint, telemetryEndpoint string) *ECSServer {
+	server := &ECSServer{
+		recorder:          newRecorder(),
+		pollEndpoint:      pollEndpoint,
+		telemetryEndpoint: telemetryEndpoint,
+		failures:          make(map[string][]string),
+	}
+	server.server = httptest.NewTLSServer(http.HandlerFunc(server.serveHTTP))
+	return server
+}
+
+// URL returns the endpoint of the API, for config.Config.APIEndpoint.
+func (server *ECSServer) URL() string {
+	return server.server.URL
+}
+
+// Close stops the server.
+func (server *ECSServer) Close() {
+	server.server.Close()
+}
+
+// FailNext makes the next call of an operation, such as
+// "SubmitTaskStateChange", fail with the given error code, such as
+// "ThrottlingException". Failures queued for an operation are used in order.
+func (server *ECSServer) FailNext(operation, code string) {
+	server.record(func() {
+		server.failures[operation] = append(server.failures[operation], code)
+	})
+}
+
+// ecsError is the body of an error response.
+type ecsError struct {
+	Code    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+func (server *ECSServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), ecsTargetPrefix)
+	if !isSigned(r) {
+		writeECSError(w, http.StatusForbidden, "AccessDeniedException", "Request is not signed")
+		return
+	}
+
+	var code string
+	server.record(func() {
+		if failures := server.failures[operation]; len(failures) > 0 {
+			code = failures[0]
+			server.failures[operation] = failures[1:]
+		}
+	})
+	if code != "" {
+		writeECSError(w, http.StatusBadRequest, code, "Failure injected by the fake backend")
+		return
+	}
+
+	var output interface{}
+	var err error
+	switch operation {
+	case "CreateCluster":
+		output, err = server.createCluster(r)
+	case "RegisterContainerInstance":
+		output, err = server.registerContainerInstance(r)
+	case "DiscoverPollEndpoint":
+		input := &ecs.DiscoverPollEndpointInput{}
+		err = jsonutil.UnmarshalJSON(input, r.Body)
+		output = &ecs.DiscoverPollEndpointOutput{
+			Endpoint:          aws.String(server.pollEndpoint),
+			TelemetryEndpoint: aws.String(server.telemetryEndpoint),
+		}
+	case "SubmitTaskStateChange":
+		input := &ecs.SubmitTaskStateChangeInput{}
+		err = jsonutil.UnmarshalJSON(input, r.Body)
+		if err == nil {
+			server.record(func() {
+				server.taskStateChanges = append(server.taskStateChanges, input)
+			})
+		}
+		output = &ecs.SubmitTaskStateChangeOutput{Acknowledgment: aws.String("ack")}
+	case "SubmitContainerStateChange":
+		input := &ecs.SubmitContainerStateChangeInput{}
+		err = jsonutil.UnmarshalJSON(input, r.Body)
+		if err == nil {
+			server.record(func() {
+				server.containerStateChanges = append(server.containerStateChanges, input)
+			})
+		}
+		output = &ecs.SubmitContainerStateChangeOutput{Acknowledgment: aws.String("ack")}
+	default:
+		writeECSError(w, http.StatusBadRequest, "UnknownOperationException", "Operation not supported by the fake backend: "+operation)
+		return
+	}
+	if err != nil {
+		writeECSError(w, http.StatusBadRequest, "ClientException", err.Error())
+		return
+	}
+
+	data, err := jsonutil.BuildJSON(output)
+	if err != nil {
+		writeECSError(w, http.StatusInternalServerError, "ServerException", err.Error())
+		return
+	}
+	w.Write(data)
+}
+
+func (server *ECSServer) createCluster(r *http.Request) (interface{}, error) {
+	input := &ecs.CreateClusterInput{}
+	err := jsonutil.UnmarshalJSON(input, r.Body)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.ClusterName)
+	server.record(func() {
+		server.clusters = append(server.clusters, name)
+	})
+	return &ecs.CreateClusterOutput{Cluster: &ecs.Cluster{
+		ClusterArn:  aws.String(clusterArnPrefix + name),
+		ClusterName: aws.String(name),
+		Status:      aws.String("ACTIVE"),
+	}}, nil
+}
+
+// registerContainerInstance registers a new container instance, or
+// re-registers the given one.
+func (server *ECSServer) registerContainerInstance(r *http.Request) (interface{}, error) {
+	input := &ecs.RegisterContainerInstanceInput{}
+	err := jsonutil.UnmarshalJSON(input, r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(input.Cluster) == "" {
+		return nil, errors.New("cluster is required")
+	}
+	arn := aws.StringValue(input.ContainerInstanceArn)
+	server.record(func() {
+		server.registrations = append(server.registrations, input)
+		if arn == "" {
+			arn = containerInstanceArnPrefix + strconv.Itoa(len(server.registrations))
+		}
+	})
+	return &ecs.RegisterContainerInstanceOutput{ContainerInstance: &ecs.ContainerInstance{
+		ContainerInstanceArn: aws.String(arn),
+		Status:               aws.String("ACTIVE"),
+		AgentConnected:       aws.Bool(true),
+	}}, nil
+}
+
+func writeECSError(w http.ResponseWriter, status int, code, message string) {
+	data, _ := json.Marshal(&ecsError{Code: code, Message: message})
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// Clusters returns the names of the clusters created by the agent.
+func (server *ECSServer) Clusters() []string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return append([]string(nil), server.clusters...)
+}
+
+// Registrations returns the registration requests made by the agent, in
+// order.
+func (server *ECSServer) Registrations() []*ecs.RegisterContainerInstanceInput {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return append([]*ecs.RegisterContainerInstanceInput(nil), server.registrations...)
+}
+
+// TaskStateChanges returns the task state changes submitted by the agent,
+// in order.
+func (server *ECSServer) TaskStateChanges() []*ecs.SubmitTaskStateChangeInput {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return append([]*ecs.SubmitTaskStateChangeInput(nil), server.taskStateChanges...)
+}
+
+// ContainerStateChanges returns the container state changes submitted by
+// the agent, in order.
+func (server *ECSServer) ContainerStateChanges() []*ecs.SubmitContainerStateChangeInput {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return append([]*ecs.SubmitContainerStateChangeInput(nil), server.containerStateChanges...)
+}
+
+// WaitForTaskStateChange waits for the agent to submit the given status of
+// a task.
+func (server *ECSServer) WaitForTaskStateChange(taskArn, status string, timeout time.Duration) (*ecs.SubmitTaskStateChangeInput, error) {
+	var found *ecs.SubmitTaskStateChangeInput
+	ok := server.waitFor(func() bool {
+		for _, change := range server.taskStateChanges {
+			if aws.StringValue(change.Task) == taskArn && aws.StringValue(change.Status) == status {
+				found = change
+				return true
+			}
+		}
+		return false
+	}, timeout)
+	if !ok {
+		return nil, errors.New("fakebackend: timed out waiting for task " + taskArn + " to be " + status)
+	}
+	return found, nil
+}
+
+// WaitForContainerStateChange waits for the agent to submit the given status
+// of a container.
+func (server *ECSServer) WaitForContainerStateChange(taskArn, containerName, status string, timeout time.Duration) (*ecs.SubmitContainerStateChangeInput, error) {
+	var found *ecs.SubmitContainerStateChangeInput
+	ok := server.waitFor(func() bool {
+		for _, change := range server.containerStateChanges {
+			if aws.StringValue(change.Task) == taskArn && aws.StringValue(change.ContainerName) == containerName && aws.StringValue(change.Status) == status {
+				found = change
+				return true
+			}
+		}
+		return false
+	}, timeout)
+	if !ok {
+		return nil, errors.New("fakebackend: timed out waiting for container " + containerName + " of task " + taskArn + " to be " + status)
+	}
+	return found, nil
+}
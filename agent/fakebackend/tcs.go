@@ -0,0 +1,117 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fakebackend
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// TCSServer is a fake TCS backend. It records the metrics the agent
+// publishes and acks them, unless acks are turned off with SetAutoAck.
+type TCSServer struct {
+	*wsServer
+	// autoAck is 1 if publish requests are acked as they're received.
+	autoAck int32
+}
+
+// NewTCSServer starts a fake TCS backend.
+func NewTCSServer() *TCSServer {
+	tcs := &TCSServer{
+		wsServer: newWSServer(newTypeDecoder(
+			ecstcs.PublishMetricsRequest{}, ecstcs.StartTelemetrySessionRequest{},
+		)),
+		autoAck: 1,
+	}
+	tcs.handle = tcs.ackPublishMetrics
+	tcs.unwrap = unwrapSignedMessage
+	return tcs
+}
+
+// unwrapSignedMessage returns the frame of a message from the TCS client,
+// which prefixes every frame with the headers of a request signing it.
+func unwrapSignedMessage(data []byte) ([]byte, error) {
+	reader := bufio.NewReader(bytes.NewReader(data))
+	header, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	if !isSigned(&http.Request{Header: http.Header(header)}) {
+		return nil, errors.New("fakebackend: message is not signed")
+	}
+	return ioutil.ReadAll(reader)
+}
+
+func (tcs *TCSServer) ackPublishMetrics(message interface{}) {
+	if _, ok := message.(*ecstcs.PublishMetricsRequest); !ok || atomic.LoadInt32(&tcs.autoAck) == 0 {
+		return
+	}
+	err := tcs.Send(&ecstcs.AckPublishMetric{Message: aws.String("ack")})
+	if err != nil {
+		log.Warn("Unable to ack published metrics", "err", err)
+	}
+}
+
+// SetAutoAck sets whether publish requests are acked as they're received.
+func (tcs *TCSServer) SetAutoAck(autoAck bool) {
+	var value int32
+	if autoAck {
+		value = 1
+	}
+	atomic.StoreInt32(&tcs.autoAck, value)
+}
+
+// SendHeartbeat sends a heartbeat to the agent.
+func (tcs *TCSServer) SendHeartbeat() error {
+	return tcs.Send(&ecstcs.HeartbeatMessage{Healthy: aws.Bool(true)})
+}
+
+// PublishMetricsRequests returns the metrics published by the agent, in
+// order.
+func (tcs *TCSServer) PublishMetricsRequests() []*ecstcs.PublishMetricsRequest {
+	var requests []*ecstcs.PublishMetricsRequest
+	for _, message := range tcs.Received() {
+		if request, ok := message.(*ecstcs.PublishMetricsRequest); ok {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// WaitForPublishMetrics waits until the agent has published metrics n times
+// in total.
+func (tcs *TCSServer) WaitForPublishMetrics(n int, timeout time.Duration) ([]*ecstcs.PublishMetricsRequest, error) {
+	ok := tcs.waitFor(func() bool {
+		count := 0
+		for _, message := range tcs.received {
+			if _, ok := message.(*ecstcs.PublishMetricsRequest); ok {
+				count++
+			}
+		}
+		return count >= n
+	}, timeout)
+	if !ok {
+		return nil, errors.New("fakebackend: timed out waiting for the agent to publish metrics")
+	}
+	return tcs.PublishMetricsRequests(), nil
+}
@@ -0,0 +1,276 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fakebackend
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/gorilla/websocket"
+)
+
+// errNotConnected is returned when sending a message before the agent has
+// connected.
+var errNotConnected = errors.New("fakebackend: the agent isn't connected")
+
+// typeDecoder implements wsclient.TypeDecoder for the messages of a backend.
+type typeDecoder map[string]reflect.Type
+
+func newTypeDecoder(types ...interface{}) typeDecoder {
+	decoder := make(typeDecoder)
+	for _, t := range types {
+		decoder[reflect.TypeOf(t).Name()] = reflect.TypeOf(t)
+	}
+	return decoder
+}
+
+func (decoder typeDecoder) NewOfType(typeName string) (interface{}, bool) {
+	rtype, ok := decoder[typeName]
+	if !ok {
+		return nil, false
+	}
+	return reflect.New(rtype).Interface(), true
+}
+
+func (decoder typeDecoder) GetRecognizedTypes() map[string]reflect.Type {
+	return decoder
+}
+
+// recorder records what a fake server received and lets tests wait for it.
+type recorder struct {
+	lock sync.Mutex
+	// changed is closed and replaced whenever something is recorded.
+	changed chan struct{}
+}
+
+func newRecorder() *recorder {
+	return &recorder{changed: make(chan struct{})}
+}
+
+// record calls f with the lock held and wakes up anything waiting.
+func (r *recorder) record(f func()) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	f()
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// waitFor waits until cond, called with the lock held, returns true.
+func (r *recorder) waitFor(cond func() bool, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		r.lock.Lock()
+		done := cond()
+		changed := r.changed
+		r.lock.Unlock()
+		if done {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// wsServer is a websocket server speaking the framing of the ACS and TCS
+// backends, {"type":"FooMessage","message":{...}}. It accepts connections
+// signed like those of wsclient.ClientServerImpl, on a TLS listener with a
+// self-signed certificate. Only the latest connection is kept.
+type wsServer struct {
+	*recorder
+	server   *httptest.Server
+	decoder  typeDecoder
+	upgrader websocket.Upgrader
+	// handle, if set, is called with every message received, without the
+	// lock held.
+	handle func(message interface{})
+	// unwrap, if set, extracts the frame from every message received.
+	unwrap func(data []byte) ([]byte, error)
+
+	writeLock sync.Mutex
+	conn      *websocket.Conn
+	// queries holds the query of every connection, in order.
+	queries  []url.Values
+	received []interface{}
+}
+
+func newWSServer(decoder typeDecoder) *wsServer {
+	ws := &wsServer{
+		recorder: newRecorder(),
+		decoder:  decoder,
+		upgrader: websocket.Upgrader{ReadBufferSize: 4096, WriteBufferSize: 4096},
+	}
+	ws.server = httptest.NewTLSServer(http.HandlerFunc(ws.serveHTTP))
+	return ws
+}
+
+// URL returns the https url of the server, as returned by the discovery
+// APIs.
+func (ws *wsServer) URL() string {
+	return ws.server.URL
+}
+
+// Close closes the connection to the agent and stops the server.
+func (ws *wsServer) Close() {
+	ws.Disconnect()
+	ws.server.Close()
+}
+
+func (ws *wsServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isSigned(r) {
+		http.Error(w, `{"AccessDeniedException":"Request is not signed"}`, http.StatusForbidden)
+		return
+	}
+	conn, err := ws.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	ws.record(func() {
+		if ws.conn != nil {
+			ws.conn.Close()
+		}
+		ws.conn = conn
+		ws.queries = append(ws.queries, r.URL.Query())
+	})
+	go ws.readLoop(conn)
+}
+
+func (ws *wsServer) readLoop(conn *websocket.Conn) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			ws.record(func() {
+				if ws.conn == conn {
+					ws.conn = nil
+				}
+			})
+			return
+		}
+		if ws.unwrap != nil {
+			data, err = ws.unwrap(data)
+			if err != nil {
+				log.Warn("Unable to unwrap message from the agent", "err", err)
+				continue
+			}
+		}
+		message, _, err := wsclient.DecodeData(data, ws.decoder)
+		if err != nil {
+			log.Warn("Unable to decode message from the agent", "message", string(data), "err", err)
+			continue
+		}
+		ws.record(func() {
+			ws.received = append(ws.received, message)
+		})
+		if ws.handle != nil {
+			ws.handle(message)
+		}
+	}
+}
+
+// Send sends a message, a pointer to a struct of the backend's model, to the
+// agent.
+func (ws *wsServer) Send(message interface{}) error {
+	typeName := reflect.TypeOf(message).Elem().Name()
+	data, err := jsonutil.BuildJSON(message)
+	if err != nil {
+		return err
+	}
+	frame, err := json.Marshal(&wsclient.RequestMessage{Type: typeName, Message: json.RawMessage(data)})
+	if err != nil {
+		return err
+	}
+
+	ws.lock.Lock()
+	conn := ws.conn
+	ws.lock.Unlock()
+	if conn == nil {
+		return errNotConnected
+	}
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+	return conn.WriteMessage(websocket.TextMessage, frame)
+}
+
+// Disconnect closes the connection to the agent, if it's connected, as the
+// backend does when it goes away.
+func (ws *wsServer) Disconnect() {
+	ws.lock.Lock()
+	conn := ws.conn
+	ws.lock.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// WaitForConnection waits until the agent has connected n times in total,
+// and returns the query of its latest connection.
+func (ws *wsServer) WaitForConnection(n int, timeout time.Duration) (url.Values, error) {
+	var query url.Values
+	ok := ws.waitFor(func() bool {
+		if len(ws.queries) < n || ws.conn == nil {
+			return false
+		}
+		query = ws.queries[len(ws.queries)-1]
+		return true
+	}, timeout)
+	if !ok {
+		return nil, errors.New("fakebackend: timed out waiting for the agent to connect")
+	}
+	return query, nil
+}
+
+// Received returns the messages received from the agent, in order.
+func (ws *wsServer) Received() []interface{} {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	return append([]interface{}(nil), ws.received...)
+}
+
+// waitForMessage waits for a message received from the agent for which
+// match returns true, and returns it.
+func (ws *wsServer) waitForMessage(match func(interface{}) bool, timeout time.Duration) (interface{}, error) {
+	var found interface{}
+	ok := ws.waitFor(func() bool {
+		for _, message := range ws.received {
+			if match(message) {
+				found = message
+				return true
+			}
+		}
+		return false
+	}, timeout)
+	if !ok {
+		return nil, errors.New("fakebackend: timed out waiting for a message from the agent")
+	}
+	return found, nil
+}
+
+// isSigned returns whether a request carries a SigV4 signature. The
+// signature itself isn't verified, since the fake backend doesn't know the
+// agent's credentials.
+func isSigned(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") && r.Header.Get("X-Amz-Date") != ""
+}
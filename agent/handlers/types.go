@@ -13,7 +13,11 @@
 
 package handlers
 
-import "github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+import (
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/aws/amazon-ecs-agent/agent/stats"
+)
 
 type MetadataResponse struct {
 	Cluster              string
@@ -40,6 +44,22 @@ type ContainerResponse struct {
 	Name       string
 }
 
+type StatsResponse struct {
+	Containers []stats.ContainerUsage
+}
+
+type TaskStatsResponse struct {
+	Tasks []stats.TaskUsage
+}
+
+type AlertsResponse struct {
+	Alerts []stats.Alert
+}
+
+type ConfigResponse struct {
+	Settings []config.Setting
+}
+
 type DockerStateResolver interface {
 	State() *dockerstate.DockerTaskEngineState
 }
@@ -25,8 +25,12 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/aws/amazon-ecs-agent/agent/health"
 	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/stats"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
+	utilatomic "github.com/aws/amazon-ecs-agent/agent/utils/atomic"
 	"github.com/aws/amazon-ecs-agent/agent/version"
 )
 
@@ -36,6 +40,7 @@ const statusBadRequest = 400
 const statusNotImplemented = 501
 const statusOK = 200
 const statusInternalServerError = 500
+const statusServiceUnavailable = 503
 
 const dockerIdQueryField = "dockerid"
 const taskArnQueryField = "taskarn"
@@ -44,15 +49,17 @@ type rootResponse struct {
 	AvailableCommands []string
 }
 
-func metadataV1RequestHandlerMaker(containerInstanceArn *string, cfg *config.Config) func(http.ResponseWriter, *http.Request) {
-	resp := &MetadataResponse{
-		Cluster:              cfg.Cluster,
-		ContainerInstanceArn: containerInstanceArn,
-		Version:              version.String(),
-	}
-	responseJSON, _ := json.Marshal(resp)
-
+func metadataV1RequestHandlerMaker(containerInstanceArn *utilatomic.String, cfgHolder *config.Holder) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Marshal on each request; the server may be started before
+		// registration has filled in the container instance arn
+		arn := containerInstanceArn.Get()
+		resp := &MetadataResponse{
+			Cluster:              cfgHolder.Get().Cluster,
+			ContainerInstanceArn: &arn,
+			Version:              version.String(),
+		}
+		responseJSON, _ := json.Marshal(resp)
 		w.Write(responseJSON)
 	}
 }
@@ -151,6 +158,94 @@ func tasksV1RequestHandlerMaker(taskEngine DockerStateResolver) func(http.Respon
 	}
 }
 
+// Creates response for the 'v1/stats' API. Lists the most recent utilization
+// of every container if the request doesn't contain any fields. Only the
+// containers of a task are listed if 'taskarn' is specified, and only a
+// single container if 'dockerid' is.
+func statsV1RequestHandlerMaker(statsEngine stats.Engine) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dockerId, dockerIdExists := valueFromRequest(r, dockerIdQueryField)
+		taskArn, taskArnExists := valueFromRequest(r, taskArnQueryField)
+		if dockerIdExists && taskArnExists {
+			log.Info("Request contains both ", dockerIdQueryField, " and ", taskArnQueryField, ". Expect at most one of these.")
+			w.WriteHeader(statusBadRequest)
+			return
+		}
+
+		response := &StatsResponse{Containers: []stats.ContainerUsage{}}
+		for _, usage := range statsEngine.GetContainerUsage() {
+			if (dockerIdExists && usage.DockerID != dockerId) || (taskArnExists && usage.TaskArn != taskArn) {
+				continue
+			}
+			response.Containers = append(response.Containers, usage)
+		}
+		responseJSON, _ := json.Marshal(response)
+		w.Write(responseJSON)
+	}
+}
+
+// Creates response for the 'v1/stats/tasks' API. Lists the utilization of
+// every task, aggregated over its containers, if the request doesn't contain
+// any fields. Only a single task is listed if 'taskarn' is specified.
+func taskStatsV1RequestHandlerMaker(statsEngine stats.Engine) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskArn, taskArnExists := valueFromRequest(r, taskArnQueryField)
+
+		response := &TaskStatsResponse{Tasks: []stats.TaskUsage{}}
+		for _, usage := range statsEngine.GetTaskUsage() {
+			if taskArnExists && usage.TaskArn != taskArn {
+				continue
+			}
+			response.Tasks = append(response.Tasks, usage)
+		}
+		responseJSON, _ := json.Marshal(response)
+		w.Write(responseJSON)
+	}
+}
+
+// Creates response for the 'v1/alerts' API. Lists the firing stats alerts
+// followed by the recently resolved ones. Only the alerts of a task are
+// listed if 'taskarn' is specified.
+func alertsV1RequestHandlerMaker(statsEngine stats.Engine) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskArn, taskArnExists := valueFromRequest(r, taskArnQueryField)
+
+		response := &AlertsResponse{Alerts: []stats.Alert{}}
+		for _, alert := range statsEngine.GetAlerts() {
+			if taskArnExists && alert.TaskArn != taskArn {
+				continue
+			}
+			response.Alerts = append(response.Alerts, alert)
+		}
+		responseJSON, _ := json.Marshal(response)
+		w.Write(responseJSON)
+	}
+}
+
+// Creates response for the 'v1/config' API. Lists every field of the config
+// with its value and the source it was read from. Sensitive values are
+// redacted. The config is read on each request, as it may have been reloaded.
+func configV1RequestHandlerMaker(cfgHolder *config.Holder) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseJSON, _ := json.Marshal(&ConfigResponse{Settings: config.Describe(cfgHolder.Get())})
+		w.Write(responseJSON)
+	}
+}
+
+// healthReportHandlerMaker creates a handler which runs the checks selected by
+// runChecks and writes the resulting report. The status code is 200 if every
+// check passed and 503 otherwise.
+func healthReportHandlerMaker(runChecks func() *health.Report) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := runChecks()
+		responseJSON, _ := json.Marshal(report)
+		if !report.Healthy {
+			w.WriteHeader(statusServiceUnavailable)
+		}
+		w.Write(responseJSON)
+	}
+}
+
 var licenseProvider = utils.NewLicenseProvider()
 
 func licenseHandler(w http.ResponseWriter, h *http.Request) {
@@ -162,11 +257,20 @@ func licenseHandler(w http.ResponseWriter, h *http.Request) {
 	}
 }
 
-func setupServer(containerInstanceArn *string, taskEngine DockerStateResolver, cfg *config.Config) http.Server {
+func setupServer(containerInstanceArn *utilatomic.String, taskEngine DockerStateResolver, cfgHolder *config.Holder, checker *health.Checker, statsEngine stats.Engine) http.Server {
 	serverFunctions := map[string]func(w http.ResponseWriter, r *http.Request){
-		"/v1/metadata": metadataV1RequestHandlerMaker(containerInstanceArn, cfg),
-		"/v1/tasks":    tasksV1RequestHandlerMaker(taskEngine),
-		"/license":     licenseHandler,
+		"/v1/metadata":    metadataV1RequestHandlerMaker(containerInstanceArn, cfgHolder),
+		"/v1/tasks":       tasksV1RequestHandlerMaker(taskEngine),
+		"/v1/stats":       statsV1RequestHandlerMaker(statsEngine),
+		"/v1/stats/tasks": taskStatsV1RequestHandlerMaker(statsEngine),
+		"/v1/alerts":      alertsV1RequestHandlerMaker(statsEngine),
+		"/v1/config":      configV1RequestHandlerMaker(cfgHolder),
+		"/v1/health":      healthReportHandlerMaker(checker.Health),
+		"/v1/ready":       healthReportHandlerMaker(checker.Readiness),
+		"/license":        licenseHandler,
+	}
+	if cfgHolder.Get().PrometheusMetricsEnabled {
+		serverFunctions["/metrics"] = metrics.DefaultRegistry.ServeHTTP
 	}
 
 	paths := make([]string, 0, len(serverFunctions))
@@ -202,13 +306,14 @@ func setupServer(containerInstanceArn *string, taskEngine DockerStateResolver, c
 }
 
 // ServeHttp serves information about this agent / containerInstance and tasks
-// running on it.
-func ServeHttp(containerInstanceArn *string, taskEngine engine.TaskEngine, cfg *config.Config) {
+// running on it, as well as the results of the given health checks and the
+// utilization of containers.
+func ServeHttp(containerInstanceArn *utilatomic.String, taskEngine engine.TaskEngine, cfgHolder *config.Holder, checker *health.Checker, statsEngine stats.Engine) {
 	// Is this the right level to type assert, assuming we'd abstract multiple taskengines here?
 	// Revisit if we ever add another type..
 	dockerTaskEngine := taskEngine.(*engine.DockerTaskEngine)
 
-	server := setupServer(containerInstanceArn, dockerTaskEngine, cfg)
+	server := setupServer(containerInstanceArn, dockerTaskEngine, cfgHolder, checker, statsEngine)
 	for {
 		once := sync.Once{}
 		utils.RetryWithBackoff(utils.NewSimpleBackoff(time.Second, time.Minute, 0.2, 2), func() error {
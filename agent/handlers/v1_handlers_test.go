@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
@@ -26,7 +27,10 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	"github.com/aws/amazon-ecs-agent/agent/handlers/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/handlers/mocks/http"
-	"github.com/aws/amazon-ecs-agent/agent/utils"
+	"github.com/aws/amazon-ecs-agent/agent/health"
+	"github.com/aws/amazon-ecs-agent/agent/stats"
+	"github.com/aws/amazon-ecs-agent/agent/stats/mock"
+	utilatomic "github.com/aws/amazon-ecs-agent/agent/utils/atomic"
 	"github.com/aws/amazon-ecs-agent/agent/utils/mocks"
 	"github.com/golang/mock/gomock"
 )
@@ -35,7 +39,7 @@ const testContainerInstanceArn = "test_container_instance_arn"
 const testClusterArn = "test_cluster_arn"
 
 func TestMetadataHandler(t *testing.T) {
-	metadataHandler := metadataV1RequestHandlerMaker(utils.Strptr(testContainerInstanceArn), &config.Config{Cluster: testClusterArn})
+	metadataHandler := metadataV1RequestHandlerMaker(utilatomic.NewString(testContainerInstanceArn), config.NewHolder(&config.Config{Cluster: testClusterArn}))
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "http://localhost:"+strconv.Itoa(config.AGENT_INTROSPECTION_PORT), nil)
@@ -189,6 +193,257 @@ func TestLicenseHandlerError(t *testing.T) {
 	licenseHandler(mockResponseWriter, nil)
 }
 
+func TestHealthHandler(t *testing.T) {
+	checker := health.NewChecker()
+	checker.AddLivenessCheck("live", func() (string, error) { return "ok", nil })
+	checker.AddReadinessCheck("ready", func() (string, error) { return "", errors.New("not yet") })
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/health", nil)
+	healthReportHandlerMaker(checker.Health)(recorder, req)
+
+	if recorder.Code != statusOK {
+		t.Errorf("Expected 200 when liveness checks pass, was %v", recorder.Code)
+	}
+	var report health.Report
+	err := json.Unmarshal(recorder.Body.Bytes(), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Healthy || len(report.Checks) != 1 || report.Checks[0].Name != "live" {
+		t.Errorf("Unexpected health report: %+v", report)
+	}
+}
+
+func TestReadyHandlerUnavailable(t *testing.T) {
+	checker := health.NewChecker()
+	checker.AddLivenessCheck("live", func() (string, error) { return "ok", nil })
+	checker.AddReadinessCheck("ready", func() (string, error) { return "", errors.New("not yet") })
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/ready", nil)
+	healthReportHandlerMaker(checker.Readiness)(recorder, req)
+
+	if recorder.Code != statusServiceUnavailable {
+		t.Errorf("Expected 503 when a readiness check fails, was %v", recorder.Code)
+	}
+	var report health.Report
+	err := json.Unmarshal(recorder.Body.Bytes(), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Healthy || len(report.Checks) != 2 {
+		t.Fatalf("Unexpected readiness report: %+v", report)
+	}
+	if report.Checks[1].Healthy || report.Checks[1].Message != "not yet" {
+		t.Errorf("Expected the failing check to be reported, got %+v", report.Checks[1])
+	}
+}
+
+func TestMetricsHandlerToggledByConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+
+	for _, enabled := range []bool{true, false} {
+		cfg := &config.Config{Cluster: testClusterArn, PrometheusMetricsEnabled: enabled}
+		server := setupServer(utilatomic.NewString(testContainerInstanceArn), mockStateResolver, config.NewHolder(cfg), health.NewChecker(), nil)
+
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		server.Handler.ServeHTTP(recorder, req)
+
+		served := strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+		if served != enabled {
+			t.Errorf("Expected metrics to be served: %v, but they were: %v", enabled, served)
+		}
+		if enabled && !strings.Contains(recorder.Body.String(), "ecs_agent_goroutines") {
+			t.Errorf("Expected goroutine gauge in metrics, got %s", recorder.Body.String())
+		}
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+	statsEngine := mock_stats.NewMockEngine(ctrl)
+	usage := []stats.ContainerUsage{
+		{TaskArn: "t1", DockerID: "c1", UsageStats: stats.UsageStats{CPUUsagePerc: 1, Network: &stats.NetworkUsage{RxBytesPerSec: 10}}},
+		{TaskArn: "t1", DockerID: "c2", UsageStats: stats.UsageStats{CPUUsagePerc: 2}},
+		{TaskArn: "t2", DockerID: "c3", UsageStats: stats.UsageStats{CPUUsagePerc: 3, BlockIO: &stats.BlockIOUsage{ReadBytesPerSec: 20}}},
+	}
+	statsEngine.EXPECT().GetContainerUsage().Return(usage).AnyTimes()
+	server := setupServer(utilatomic.NewString(testContainerInstanceArn), mockStateResolver, config.NewHolder(&config.Config{Cluster: testClusterArn}), health.NewChecker(), statsEngine)
+
+	for path, expected := range map[string][]string{
+		"/v1/stats":             {"c1", "c2", "c3"},
+		"/v1/stats?taskarn=t1":  {"c1", "c2"},
+		"/v1/stats?dockerid=c3": {"c3"},
+		"/v1/stats?dockerid=c4": {},
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		server.Handler.ServeHTTP(recorder, req)
+		if recorder.Code != 200 {
+			t.Errorf("Expected 200 for %s, got %d", path, recorder.Code)
+			continue
+		}
+		var response StatsResponse
+		err := json.Unmarshal(recorder.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dockerIDs []string
+		for _, container := range response.Containers {
+			dockerIDs = append(dockerIDs, container.DockerID)
+		}
+		if strings.Join(dockerIDs, ",") != strings.Join(expected, ",") {
+			t.Errorf("Expected containers %v for %s, got %v", expected, path, dockerIDs)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/stats?dockerid=c3", nil)
+	server.Handler.ServeHTTP(recorder, req)
+	if !strings.Contains(recorder.Body.String(), `"blockIO":{"readBytesPerSec":20`) || strings.Contains(recorder.Body.String(), `"network"`) {
+		t.Errorf("Unexpected stats response: %s", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/stats?dockerid=c1&taskarn=t1", nil)
+	server.Handler.ServeHTTP(recorder, req)
+	if recorder.Code != 400 {
+		t.Errorf("Expected 400 when both dockerid and taskarn are given, got %d", recorder.Code)
+	}
+}
+
+func TestTaskStatsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+	statsEngine := mock_stats.NewMockEngine(ctrl)
+	utilization := 95.0
+	usage := []stats.TaskUsage{
+		{TaskArn: "t1", CPUUsagePerc: 10, MemoryLimitInMegs: 100, MemoryUtilizationPerc: &utilization, NearOOM: true},
+		{TaskArn: "t2", CPUUsagePerc: 20},
+	}
+	statsEngine.EXPECT().GetTaskUsage().Return(usage).AnyTimes()
+	server := setupServer(utilatomic.NewString(testContainerInstanceArn), mockStateResolver, config.NewHolder(&config.Config{Cluster: testClusterArn}), health.NewChecker(), statsEngine)
+
+	for path, expected := range map[string][]string{
+		"/v1/stats/tasks":            {"t1", "t2"},
+		"/v1/stats/tasks?taskarn=t2": {"t2"},
+		"/v1/stats/tasks?taskarn=t3": {},
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		server.Handler.ServeHTTP(recorder, req)
+		var response TaskStatsResponse
+		err := json.Unmarshal(recorder.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var taskArns []string
+		for _, task := range response.Tasks {
+			taskArns = append(taskArns, task.TaskArn)
+		}
+		if strings.Join(taskArns, ",") != strings.Join(expected, ",") {
+			t.Errorf("Expected tasks %v for %s, got %v", expected, path, taskArns)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/stats/tasks?taskarn=t1", nil)
+	server.Handler.ServeHTTP(recorder, req)
+	if !strings.Contains(recorder.Body.String(), `"memoryUtilizationPerc":95,"memoryLimitHits":0,"overLimit":false,"nearOOM":true`) {
+		t.Errorf("Unexpected task stats response: %s", recorder.Body.String())
+	}
+}
+
+func TestAlertsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStateResolver := mock_handlers.NewMockDockerStateResolver(ctrl)
+	statsEngine := mock_stats.NewMockEngine(ctrl)
+	alerts := []stats.Alert{
+		{Rule: "high-memory", TaskArn: "t1", DockerID: "c1", State: stats.AlertFiring},
+		{Rule: "high-cpu", TaskArn: "t2", DockerID: "c2", State: stats.AlertResolved},
+	}
+	statsEngine.EXPECT().GetAlerts().Return(alerts).AnyTimes()
+	server := setupServer(utilatomic.NewString(testContainerInstanceArn), mockStateResolver, config.NewHolder(&config.Config{Cluster: testClusterArn}), health.NewChecker(), statsEngine)
+
+	for path, expected := range map[string][]string{
+		"/v1/alerts":            {"high-memory", "high-cpu"},
+		"/v1/alerts?taskarn=t2": {"high-cpu"},
+		"/v1/alerts?taskarn=t3": {},
+	} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		server.Handler.ServeHTTP(recorder, req)
+		var response AlertsResponse
+		err := json.Unmarshal(recorder.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rules []string
+		for _, alert := range response.Alerts {
+			rules = append(rules, alert.Rule)
+		}
+		if strings.Join(rules, ",") != strings.Join(expected, ",") {
+			t.Errorf("Expected alerts %v for %s, got %v", expected, path, rules)
+		}
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	cfg := &config.Config{
+		Cluster:                  testClusterArn,
+		EngineAuthData:           config.NewSensitiveRawMessage([]byte(`{"registry":{"password":"secret"}}`)),
+		StateChangeWebhookSecret: "secret",
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/config", nil)
+	configV1RequestHandlerMaker(config.NewHolder(cfg))(w, req)
+
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("Expected sensitive values to be redacted, got %s", w.Body.String())
+	}
+	var resp ConfigResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	found := false
+	for _, setting := range resp.Settings {
+		if setting.Name == "Cluster" {
+			found = setting.Value == testClusterArn
+		}
+	}
+	if !found {
+		t.Errorf("Expected the cluster to be listed, got %v", resp.Settings)
+	}
+}
+
+func TestConfigHandlerReadsReloadedConfig(t *testing.T) {
+	cfgHolder := config.NewHolder(&config.Config{Cluster: testClusterArn})
+	handler := configV1RequestHandlerMaker(cfgHolder)
+	cfgHolder.ApplyReloadable(&config.Config{ReservedPorts: []uint16{22}})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/config", nil)
+	handler(w, req)
+
+	var resp ConfigResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	found := false
+	for _, setting := range resp.Settings {
+		if setting.Name == "ReservedPorts" {
+			found = setting.Value == "[22]"
+		}
+	}
+	if !found {
+		t.Errorf("Expected the reloaded reserved ports to be listed, got %v", resp.Settings)
+	}
+}
+
 func taskDiffHelper(t *testing.T, expected []*api.Task, actual TasksResponse) {
 	if len(expected) != len(actual.Tasks) {
 		t.Errorf("Expected %v tasks, had %v tasks", len(expected), len(actual.Tasks))
@@ -288,7 +543,7 @@ func performMockRequest(t *testing.T, path string) *httptest.ResponseRecorder {
 	stateSetupHelper(state, testTasks)
 
 	mockStateResolver.EXPECT().State().Return(state)
-	requestHandler := setupServer(utils.Strptr(testContainerInstanceArn), mockStateResolver, &config.Config{Cluster: testClusterArn})
+	requestHandler := setupServer(utilatomic.NewString(testContainerInstanceArn), mockStateResolver, config.NewHolder(&config.Config{Cluster: testClusterArn}), health.NewChecker(), nil)
 
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", path, nil)
@@ -0,0 +1,120 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package health
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/statemanager"
+	utilatomic "github.com/aws/amazon-ecs-agent/agent/utils/atomic"
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+)
+
+// DockerVersioner is the subset of the task engine used to reach docker.
+type DockerVersioner interface {
+	Version() (string, error)
+}
+
+// DockerCheck returns a check that passes if the docker daemon responds to a
+// version request.
+func DockerCheck(versioner DockerVersioner) CheckFunc {
+	return func() (string, error) {
+		version, err := versioner.Version()
+		if err != nil {
+			return "", fmt.Errorf("docker is unreachable: %v", err)
+		}
+		return version, nil
+	}
+}
+
+// ConnectionCheck returns a check that passes if the tracked connection is up
+// and has seen activity within maxIdle.
+func ConnectionCheck(tracker *ConnectionTracker, maxIdle time.Duration) CheckFunc {
+	return func() (string, error) {
+		status := tracker.Status()
+		if !status.Connected {
+			if status.LastConnected.IsZero() {
+				return "", errors.New("never connected")
+			}
+			return "", fmt.Errorf("disconnected; last connected %v ago", roundDuration(ttime.Since(status.LastConnected)))
+		}
+		idle := ttime.Since(status.LastMessage)
+		if idle > maxIdle {
+			return "", fmt.Errorf("connected, but no messages for %v", roundDuration(idle))
+		}
+		return fmt.Sprintf("connected; last message %v ago", roundDuration(idle)), nil
+	}
+}
+
+// StateSaveCheck returns a check that passes unless the most recent attempt
+// to save state failed. State managers that can't report on their saves, such
+// as the no-op one used when checkpointing is disabled, always pass.
+func StateSaveCheck(saver statemanager.Saver) CheckFunc {
+	return func() (string, error) {
+		reporter, ok := saver.(statemanager.SaveStatusReporter)
+		if !ok {
+			return "state is not checkpointed", nil
+		}
+		status := reporter.SaveStatus()
+		if status.LastAttempt.IsZero() {
+			return "no saves attempted", nil
+		}
+		if status.LastError != nil {
+			if status.LastSuccess.IsZero() {
+				return "", fmt.Errorf("saving state failed: %v; no successful saves", status.LastError)
+			}
+			return "", fmt.Errorf("saving state failed: %v; last successful save %v ago", status.LastError, roundDuration(ttime.Since(status.LastSuccess)))
+		}
+		return fmt.Sprintf("last successful save %v ago", roundDuration(ttime.Since(status.LastSuccess))), nil
+	}
+}
+
+// BacklogCheck returns a check that passes while the number of pending state
+// changes reported by pending is at most max.
+func BacklogCheck(pending func() int, max int) CheckFunc {
+	return func() (string, error) {
+		count := pending()
+		if count > max {
+			return "", fmt.Errorf("%d state changes pending submission; more than %d", count, max)
+		}
+		return fmt.Sprintf("%d state changes pending submission", count), nil
+	}
+}
+
+// RegistrationCheck returns a check that passes once the container instance
+// has been registered and has an ARN.
+func RegistrationCheck(containerInstanceArn *utilatomic.String) CheckFunc {
+	return func() (string, error) {
+		arn := containerInstanceArn.Get()
+		if arn == "" {
+			return "", errors.New("container instance is not registered")
+		}
+		return arn, nil
+	}
+}
+
+// DisabledCheck returns a check for a dependency which has been turned off by
+// configuration; it always passes.
+func DisabledCheck(reason string) CheckFunc {
+	return func() (string, error) {
+		return reason, nil
+	}
+}
+
+// roundDuration drops sub-second precision, which is noise in a report.
+func roundDuration(d time.Duration) time.Duration {
+	return d - d%time.Second
+}
@@ -0,0 +1,133 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/statemanager"
+	utilatomic "github.com/aws/amazon-ecs-agent/agent/utils/atomic"
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+)
+
+type fakeVersioner struct {
+	version string
+	err     error
+}
+
+func (v *fakeVersioner) Version() (string, error) {
+	return v.version, v.err
+}
+
+type fakeSaveReporter struct {
+	statemanager.NoopStateManager
+	status statemanager.SaveStatus
+}
+
+func (r *fakeSaveReporter) SaveStatus() statemanager.SaveStatus {
+	return r.status
+}
+
+func TestDockerCheck(t *testing.T) {
+	_, err := DockerCheck(&fakeVersioner{version: "DockerVersion: 1.9.1"})()
+	if err != nil {
+		t.Error("Expected docker check to pass", err)
+	}
+	_, err = DockerCheck(&fakeVersioner{err: errors.New("connection refused")})()
+	if err == nil {
+		t.Error("Expected docker check to fail")
+	}
+}
+
+func TestConnectionCheck(t *testing.T) {
+	testTime := ttime.NewTestTime()
+	ttime.SetTime(testTime)
+	defer ttime.SetTime(&ttime.DefaultTime{})
+
+	tracker := NewConnectionTracker()
+	check := ConnectionCheck(tracker, time.Minute)
+
+	if _, err := check(); err == nil {
+		t.Error("Expected a connection that was never made to fail")
+	}
+
+	tracker.Connected()
+	if _, err := check(); err != nil {
+		t.Error("Expected a new connection to pass", err)
+	}
+
+	testTime.Warp(2 * time.Minute)
+	if _, err := check(); err == nil {
+		t.Error("Expected an idle connection to fail")
+	}
+
+	tracker.MessageReceived()
+	if _, err := check(); err != nil {
+		t.Error("Expected an active connection to pass", err)
+	}
+
+	tracker.Disconnected()
+	if _, err := check(); err == nil {
+		t.Error("Expected a disconnected connection to fail")
+	}
+}
+
+func TestStateSaveCheck(t *testing.T) {
+	if _, err := StateSaveCheck(statemanager.NewNoopStateManager())(); err != nil {
+		t.Error("Expected the check to pass when state isn't checkpointed", err)
+	}
+
+	reporter := &fakeSaveReporter{}
+	if _, err := StateSaveCheck(reporter)(); err != nil {
+		t.Error("Expected the check to pass before any save", err)
+	}
+
+	now := time.Now()
+	reporter.status = statemanager.SaveStatus{LastAttempt: now, LastSuccess: now}
+	if _, err := StateSaveCheck(reporter)(); err != nil {
+		t.Error("Expected the check to pass after a successful save", err)
+	}
+
+	reporter.status.LastError = errors.New("disk full")
+	if _, err := StateSaveCheck(reporter)(); err == nil {
+		t.Error("Expected the check to fail after a failed save")
+	}
+}
+
+func TestBacklogCheck(t *testing.T) {
+	pending := 5
+	check := BacklogCheck(func() int { return pending }, 5)
+	if _, err := check(); err != nil {
+		t.Error("Expected a backlog at the limit to pass", err)
+	}
+	pending = 6
+	if _, err := check(); err == nil {
+		t.Error("Expected a backlog over the limit to fail")
+	}
+}
+
+func TestRegistrationCheck(t *testing.T) {
+	arn := utilatomic.NewString("")
+	check := RegistrationCheck(arn)
+	if _, err := check(); err == nil {
+		t.Error("Expected an unregistered instance to fail")
+	}
+	arn.Set("arn:aws:ecs:us-west-2:123456789012:container-instance/abc")
+	message, err := check()
+	if err != nil || message != arn.Get() {
+		t.Error("Expected a registered instance to pass and report its arn", message, err)
+	}
+}
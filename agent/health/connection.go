@@ -0,0 +1,74 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package health
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+)
+
+// ConnectionStatus is a snapshot of a ConnectionTracker.
+type ConnectionStatus struct {
+	Connected     bool
+	LastConnected time.Time
+	LastMessage   time.Time
+}
+
+// ConnectionTracker records the state of a long-lived backend connection,
+// such as the ACS or TCS websocket. It is safe for concurrent use.
+type ConnectionTracker struct {
+	lock   sync.RWMutex
+	status ConnectionStatus
+}
+
+// NewConnectionTracker returns a tracker for a connection that has not yet
+// been established.
+func NewConnectionTracker() *ConnectionTracker {
+	return &ConnectionTracker{}
+}
+
+// Connected records that the connection was established.
+func (tracker *ConnectionTracker) Connected() {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	now := ttime.Now()
+	tracker.status.Connected = true
+	tracker.status.LastConnected = now
+	// Establishing the connection counts as activity; otherwise a fresh
+	// connection would look idle until the first message arrives
+	tracker.status.LastMessage = now
+}
+
+// Disconnected records that the connection was closed.
+func (tracker *ConnectionTracker) Disconnected() {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	tracker.status.Connected = false
+}
+
+// MessageReceived records activity on the connection.
+func (tracker *ConnectionTracker) MessageReceived() {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	tracker.status.LastMessage = ttime.Now()
+}
+
+// Status returns the current state of the connection.
+func (tracker *ConnectionTracker) Status() ConnectionStatus {
+	tracker.lock.RLock()
+	defer tracker.lock.RUnlock()
+	return tracker.status
+}
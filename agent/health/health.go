@@ -0,0 +1,154 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package health evaluates the agent's dependencies for the health and
+// readiness introspection endpoints.
+package health
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+)
+
+// checkTimeout is the maximum time a single check may take before it is
+// considered to have failed. It is kept well under the introspection server's
+// write timeout.
+const checkTimeout = 2 * time.Second
+
+// CheckFunc evaluates a single dependency. It returns a human readable
+// description of what it found; a non-nil error marks the check as failed.
+type CheckFunc func() (string, error)
+
+// Result is the outcome of running a single check.
+type Result struct {
+	Name    string
+	Healthy bool
+	Message string `json:",omitempty"`
+}
+
+// Report is the outcome of running a set of checks. It is healthy only if
+// every check in it is healthy.
+type Report struct {
+	Healthy bool
+	Checks  []Result
+}
+
+type namedCheck struct {
+	name string
+	fn   CheckFunc
+	// readinessOnly checks are not part of the liveness report; a failure
+	// means the agent can't do useful work yet, not that it's broken.
+	readinessOnly bool
+}
+
+// Checker holds the set of registered checks.
+type Checker struct {
+	lock   sync.RWMutex
+	checks []namedCheck
+}
+
+// NewChecker returns a Checker with no checks registered.
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// AddLivenessCheck registers a check which is part of both the health and the
+// readiness reports.
+func (checker *Checker) AddLivenessCheck(name string, fn CheckFunc) {
+	checker.add(namedCheck{name: name, fn: fn})
+}
+
+// AddReadinessCheck registers a check which is only part of the readiness
+// report.
+func (checker *Checker) AddReadinessCheck(name string, fn CheckFunc) {
+	checker.add(namedCheck{name: name, fn: fn, readinessOnly: true})
+}
+
+func (checker *Checker) add(check namedCheck) {
+	checker.lock.Lock()
+	defer checker.lock.Unlock()
+	checker.checks = append(checker.checks, check)
+}
+
+// Health runs the liveness checks and reports whether the agent is healthy.
+func (checker *Checker) Health() *Report {
+	return checker.run(false)
+}
+
+// Readiness runs all checks and reports whether the agent is ready to run
+// tasks.
+func (checker *Checker) Readiness() *Report {
+	return checker.run(true)
+}
+
+// run evaluates the selected checks concurrently, preserving the order in
+// which they were registered in the returned report.
+func (checker *Checker) run(includeReadiness bool) *Report {
+	checker.lock.RLock()
+	var checks []namedCheck
+	for _, check := range checker.checks {
+		if check.readinessOnly && !includeReadiness {
+			continue
+		}
+		checks = append(checks, check)
+	}
+	checker.lock.RUnlock()
+
+	report := &Report{
+		Healthy: true,
+		Checks:  make([]Result, len(checks)),
+	}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+			report.Checks[i] = runCheck(check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if !result.Healthy {
+			report.Healthy = false
+		}
+	}
+	return report
+}
+
+func runCheck(check namedCheck) Result {
+	type checkResponse struct {
+		message string
+		err     error
+	}
+	// Buffered so that a check which finishes after timing out can still
+	// write its result and be garbage collected
+	response := make(chan checkResponse, 1)
+	go func() {
+		message, err := check.fn()
+		response <- checkResponse{message, err}
+	}()
+
+	select {
+	case resp := <-response:
+		if resp.err != nil {
+			return Result{Name: check.name, Healthy: false, Message: resp.err.Error()}
+		}
+		return Result{Name: check.name, Healthy: true, Message: resp.message}
+	case <-ttime.After(checkTimeout):
+		return Result{Name: check.name, Healthy: false, Message: fmt.Sprintf("timed out after %v", checkTimeout)}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package health
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+)
+
+func passing(message string) CheckFunc {
+	return func() (string, error) { return message, nil }
+}
+
+func failing(message string) CheckFunc {
+	return func() (string, error) { return "", errors.New(message) }
+}
+
+func TestHealthExcludesReadinessChecks(t *testing.T) {
+	checker := NewChecker()
+	checker.AddLivenessCheck("a", passing("a ok"))
+	checker.AddReadinessCheck("b", failing("b broken"))
+	checker.AddLivenessCheck("c", passing("c ok"))
+
+	report := checker.Health()
+	if !report.Healthy {
+		t.Error("Expected health report to ignore readiness checks")
+	}
+	if len(report.Checks) != 2 || report.Checks[0].Name != "a" || report.Checks[1].Name != "c" {
+		t.Errorf("Unexpected checks in health report: %+v", report.Checks)
+	}
+}
+
+func TestReadinessIncludesAllChecksInOrder(t *testing.T) {
+	checker := NewChecker()
+	checker.AddLivenessCheck("a", passing("a ok"))
+	checker.AddReadinessCheck("b", failing("b broken"))
+	checker.AddLivenessCheck("c", passing("c ok"))
+
+	report := checker.Readiness()
+	if report.Healthy {
+		t.Error("Expected readiness report to fail")
+	}
+	expected := []Result{
+		{Name: "a", Healthy: true, Message: "a ok"},
+		{Name: "b", Healthy: false, Message: "b broken"},
+		{Name: "c", Healthy: true, Message: "c ok"},
+	}
+	if len(report.Checks) != len(expected) {
+		t.Fatalf("Expected %d checks, got %d", len(expected), len(report.Checks))
+	}
+	for i, result := range expected {
+		if report.Checks[i] != result {
+			t.Errorf("Check %d: expected %+v, got %+v", i, result, report.Checks[i])
+		}
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	testTime := ttime.NewTestTime()
+	testTime.LudicrousSpeed(true)
+	ttime.SetTime(testTime)
+	defer ttime.SetTime(&ttime.DefaultTime{})
+
+	block := make(chan struct{})
+	defer close(block)
+	checker := NewChecker()
+	checker.AddLivenessCheck("hung", func() (string, error) {
+		<-block
+		return "", nil
+	})
+
+	report := checker.Health()
+	if report.Healthy || report.Checks[0].Healthy {
+		t.Error("Expected a check that never returns to fail")
+	}
+}
+
+func TestEmptyCheckerIsHealthy(t *testing.T) {
+	report := NewChecker().Readiness()
+	if !report.Healthy || len(report.Checks) != 0 {
+		t.Errorf("Expected an empty, healthy report; got %+v", report)
+	}
+}
@@ -78,6 +78,15 @@ func SetLevel(logLevel string) {
 	}
 }
 
+// SetLogfile sets the file logs are written to, as well as stdout. Nothing is
+// written to a file if it's empty.
+func SetLogfile(path string) {
+	if path != logfile {
+		logfile = path
+		reloadConfig()
+	}
+}
+
 // ForModule returns an OldLogger instance.  OldLogger is deprecated and kept
 // for compatibility reasons.  Prefer using Seelog directly.
 func ForModule(module string) OldLogger {
@@ -0,0 +1,99 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metrics
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+)
+
+// Namespace prefixes the name of every metric the agent exposes.
+const Namespace = "ecs_agent_"
+
+// Outcomes used as the value of "outcome" labels.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+	OutcomeTimeout = "timeout"
+)
+
+var (
+	// latencyBuckets suit calls which normally complete in well under a
+	// second, such as docker API calls and state saves.
+	latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+	// pullBuckets suit image pulls, which can take minutes.
+	pullBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+)
+
+// DefaultRegistry holds the agent's metrics and is served on the
+// introspection server when enabled.
+var DefaultRegistry = NewRegistry()
+
+var (
+	// DockerCalls counts calls to the docker API by operation and outcome.
+	DockerCalls = DefaultRegistry.NewCounter(Namespace+"docker_calls_total",
+		"Calls made to the docker API.", "operation", "outcome")
+	// DockerCallDuration observes the latency of calls to the docker API by
+	// operation and outcome.
+	DockerCallDuration = DefaultRegistry.NewHistogram(Namespace+"docker_call_duration_seconds",
+		"Latency of calls made to the docker API.", latencyBuckets, "operation", "outcome")
+
+	// ImagePullDuration observes how long image pulls take.
+	ImagePullDuration = DefaultRegistry.NewHistogram(Namespace+"image_pull_duration_seconds",
+		"Time taken to pull images.", pullBuckets, "outcome")
+	// ImagePullBytes counts the bytes of image layers downloaded.
+	ImagePullBytes = DefaultRegistry.NewCounter(Namespace+"image_pull_bytes_total",
+		"Bytes of image layers downloaded while pulling images.")
+
+	// StateChangeSubmitErrors counts failed attempts to submit task and
+	// container state changes to ECS.
+	StateChangeSubmitErrors = DefaultRegistry.NewCounter(Namespace+"state_change_submit_errors_total",
+		"Failed attempts to submit state changes to ECS.", "type")
+	// StateChangeWebhookFailures counts state changes which couldn't be
+	// delivered to a webhook, by reason.
+	StateChangeWebhookFailures = DefaultRegistry.NewCounter(Namespace+"state_change_webhook_failures_total",
+		"State changes which couldn't be delivered to a webhook.", "reason")
+
+	// BackendConnections counts connections established to the ACS and TCS
+	// backends; every increase after the first is a reconnect.
+	BackendConnections = DefaultRegistry.NewCounter(Namespace+"backend_connections_total",
+		"Connections established to a backend websocket.", "backend")
+
+	// TelemetryRequestsDropped counts metrics requests for the TCS backend
+	// which were dropped before being acknowledged, by reason.
+	TelemetryRequestsDropped = DefaultRegistry.NewCounter(Namespace+"telemetry_requests_dropped_total",
+		"Metrics requests dropped before being acknowledged by the telemetry backend.", "reason")
+
+	// StateSaveDuration observes how long saving the state file takes.
+	StateSaveDuration = DefaultRegistry.NewHistogram(Namespace+"state_save_duration_seconds",
+		"Time taken to save agent state.", latencyBuckets)
+	// StateSaveFailures counts failed attempts to save the state file.
+	StateSaveFailures = DefaultRegistry.NewCounter(Namespace+"state_save_failures_total",
+		"Failed attempts to save agent state.")
+)
+
+func init() {
+	DefaultRegistry.RegisterGaugeFunc(Namespace+"goroutines", "Number of goroutines that currently exist.", nil,
+		func(emit func(float64, ...string)) {
+			emit(float64(runtime.NumGoroutine()))
+		})
+}
+
+// SinceInSeconds returns the time elapsed since start in seconds, the unit
+// Prometheus expects durations in.
+func SinceInSeconds(start time.Time) float64 {
+	return ttime.Since(start).Seconds()
+}
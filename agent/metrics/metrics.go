@@ -0,0 +1,371 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package metrics records operational metrics about the agent itself and
+// exposes them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+)
+
+var log = logger.ForModule("metrics")
+
+// contentType is the content type of version 0.0.4 of the Prometheus text
+// exposition format.
+const contentType = "text/plain; version=0.0.4"
+
+const (
+	counterType   = "counter"
+	gaugeType     = "gauge"
+	histogramType = "histogram"
+)
+
+// family is a named group of series which share a type and label names.
+type family interface {
+	write(w io.Writer)
+}
+
+// series is a single set of label values within a family and its value.
+type series struct {
+	labelValues []string
+	value       float64
+	// Only used by histograms
+	bucketCounts []uint64
+	count        uint64
+}
+
+// vec holds every series of a single family.
+type vec struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	// buckets are the upper bounds of a histogram's buckets, in increasing
+	// order
+	buckets []float64
+
+	lock   sync.Mutex
+	series map[string]*series
+}
+
+func newVec(name, help, metricType string, labelNames []string) *vec {
+	return &vec{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		series:     make(map[string]*series),
+	}
+}
+
+// get returns the series for the given label values, creating it if needed.
+// It returns nil if the number of label values is wrong. The caller must hold
+// the lock.
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labelNames) {
+		log.Warn("Wrong number of label values for metric; dropping", "metric", v.name, "expected", len(v.labelNames), "got", len(labelValues))
+		return nil
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		if v.metricType == histogramType {
+			s.bucketCounts = make([]uint64, len(v.buckets))
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec) write(w io.Writer) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.metricType)
+
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := v.series[key]
+		if v.metricType != histogramType {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labelNames, s.labelValues, "", ""), formatValue(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range v.buckets {
+			cumulative += s.bucketCounts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labelNames, s.labelValues, "le", formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labelNames, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, formatLabels(v.labelNames, s.labelValues, "", ""), formatValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, formatLabels(v.labelNames, s.labelValues, "", ""), s.count)
+	}
+}
+
+// Counter is a family of monotonically increasing values.
+type Counter struct {
+	vec *vec
+}
+
+// Inc increments the counter with the given label values by one.
+func (counter *Counter) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+// Add increments the counter with the given label values by delta, which
+// must not be negative.
+func (counter *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		log.Warn("Counters cannot decrease; dropping", "metric", counter.vec.name, "delta", delta)
+		return
+	}
+	counter.vec.lock.Lock()
+	defer counter.vec.lock.Unlock()
+	if s := counter.vec.get(labelValues); s != nil {
+		s.value += delta
+	}
+}
+
+// Gauge is a family of values which can go up and down.
+type Gauge struct {
+	vec *vec
+}
+
+// Set sets the gauge with the given label values to value.
+func (gauge *Gauge) Set(value float64, labelValues ...string) {
+	gauge.vec.lock.Lock()
+	defer gauge.vec.lock.Unlock()
+	if s := gauge.vec.get(labelValues); s != nil {
+		s.value = value
+	}
+}
+
+// Add adds delta, which may be negative, to the gauge with the given label
+// values.
+func (gauge *Gauge) Add(delta float64, labelValues ...string) {
+	gauge.vec.lock.Lock()
+	defer gauge.vec.lock.Unlock()
+	if s := gauge.vec.get(labelValues); s != nil {
+		s.value += delta
+	}
+}
+
+// Histogram is a family of observations counted in configurable buckets.
+type Histogram struct {
+	vec *vec
+}
+
+// Observe adds a single observation to the histogram with the given label
+// values.
+func (histogram *Histogram) Observe(value float64, labelValues ...string) {
+	histogram.vec.lock.Lock()
+	defer histogram.vec.lock.Unlock()
+	s := histogram.vec.get(labelValues)
+	if s == nil {
+		return
+	}
+	for i, bound := range histogram.vec.buckets {
+		if value <= bound {
+			s.bucketCounts[i]++
+			break
+		}
+	}
+	s.value += value
+	s.count++
+}
+
+// GaugeFunc is called on every scrape to produce the current values of a
+// gauge family. It should call emit once per set of label values.
+type GaugeFunc func(emit func(value float64, labelValues ...string))
+
+// CounterFunc is called on every scrape to produce the current values of a
+// counter family, which are cumulative totals kept elsewhere. It should call
+// emit once per set of label values.
+type CounterFunc func(emit func(value float64, labelValues ...string))
+
+// funcFamily is a family whose values are computed when scraped.
+type funcFamily struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	fn         func(emit func(value float64, labelValues ...string))
+}
+
+func (family *funcFamily) write(w io.Writer) {
+	v := newVec(family.name, family.help, family.metricType, family.labelNames)
+	family.fn(func(value float64, labelValues ...string) {
+		// Not locked; the vec is local to this scrape
+		if s := v.get(labelValues); s != nil {
+			s.value = value
+		}
+	})
+	v.write(w)
+}
+
+// Registry is a set of metric families which are written out together.
+type Registry struct {
+	lock     sync.RWMutex
+	families map[string]family
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]family),
+	}
+}
+
+// NewCounter creates a counter family with the given label names and adds it
+// to the registry.
+func (registry *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	counter := &Counter{vec: newVec(name, help, counterType, labelNames)}
+	registry.register(name, counter.vec)
+	return counter
+}
+
+// NewGauge creates a gauge family with the given label names and adds it to
+// the registry.
+func (registry *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	gauge := &Gauge{vec: newVec(name, help, gaugeType, labelNames)}
+	registry.register(name, gauge.vec)
+	return gauge
+}
+
+// NewHistogram creates a histogram family with the given bucket upper bounds
+// and label names and adds it to the registry.
+func (registry *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	v := newVec(name, help, histogramType, labelNames)
+	v.buckets = append([]float64{}, buckets...)
+	sort.Float64s(v.buckets)
+	histogram := &Histogram{vec: v}
+	registry.register(name, v)
+	return histogram
+}
+
+// RegisterGaugeFunc adds a gauge family whose values are computed by fn each
+// time the registry is written. Registering a name again replaces the earlier
+// function.
+func (registry *Registry) RegisterGaugeFunc(name, help string, labelNames []string, fn GaugeFunc) {
+	registry.register(name, &funcFamily{
+		name:       name,
+		help:       help,
+		metricType: gaugeType,
+		labelNames: labelNames,
+		fn:         fn,
+	})
+}
+
+// RegisterCounterFunc adds a counter family whose values are computed by fn
+// each time the registry is written. Registering a name again replaces the
+// earlier function.
+func (registry *Registry) RegisterCounterFunc(name, help string, labelNames []string, fn CounterFunc) {
+	registry.register(name, &funcFamily{
+		name:       name,
+		help:       help,
+		metricType: counterType,
+		labelNames: labelNames,
+		fn:         fn,
+	})
+}
+
+func (registry *Registry) register(name string, f family) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.families[name] = f
+}
+
+// WriteText writes every family in the registry, sorted by name, in the
+// Prometheus text exposition format.
+func (registry *Registry) WriteText(w io.Writer) error {
+	registry.lock.RLock()
+	names := make([]string, 0, len(registry.families))
+	for name := range registry.families {
+		names = append(names, name)
+	}
+	families := make([]family, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		families = append(families, registry.families[name])
+	}
+	registry.lock.RUnlock()
+
+	buffered := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(buffered)
+	}
+	return buffered.Flush()
+}
+
+// ServeHTTP writes the registry in response to a scrape.
+func (registry *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	err := registry.WriteText(w)
+	if err != nil {
+		log.Warn("Error writing metrics", "err", err)
+	}
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabelValue(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+escapeLabelValue(extraValue)+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
@@ -0,0 +1,160 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func writeText(t *testing.T, registry *Registry) string {
+	var buf bytes.Buffer
+	err := registry.WriteText(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestCounterText(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("test_calls_total", "Calls made.", "operation", "outcome")
+	counter.Inc("pull", "success")
+	counter.Inc("pull", "success")
+	counter.Add(3, "create", "error")
+	// Dropped; counters can't decrease
+	counter.Add(-1, "create", "error")
+	// Dropped; wrong number of labels
+	counter.Inc("pull")
+
+	expected := `# HELP test_calls_total Calls made.
+# TYPE test_calls_total counter
+test_calls_total{operation="create",outcome="error"} 3
+test_calls_total{operation="pull",outcome="success"} 2
+`
+	if text := writeText(t, registry); text != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, text)
+	}
+}
+
+func TestGaugeText(t *testing.T) {
+	registry := NewRegistry()
+	gauge := registry.NewGauge("test_depth", "Queue depth.")
+	gauge.Set(5)
+	gauge.Add(-2)
+
+	expected := `# HELP test_depth Queue depth.
+# TYPE test_depth gauge
+test_depth 3
+`
+	if text := writeText(t, registry); text != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, text)
+	}
+}
+
+func TestHistogramText(t *testing.T) {
+	registry := NewRegistry()
+	histogram := registry.NewHistogram("test_duration_seconds", "Durations.", []float64{1, 0.1}, "operation")
+	histogram.Observe(0.05, "pull")
+	histogram.Observe(0.5, "pull")
+	histogram.Observe(5, "pull")
+
+	expected := `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{operation="pull",le="0.1"} 1
+test_duration_seconds_bucket{operation="pull",le="1"} 2
+test_duration_seconds_bucket{operation="pull",le="+Inf"} 3
+test_duration_seconds_sum{operation="pull"} 5.55
+test_duration_seconds_count{operation="pull"} 3
+`
+	if text := writeText(t, registry); text != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, text)
+	}
+}
+
+func TestGaugeFuncText(t *testing.T) {
+	registry := NewRegistry()
+	value := 1.0
+	registry.RegisterGaugeFunc("test_tasks", "Tasks.", []string{"status"}, func(emit func(float64, ...string)) {
+		emit(value, "RUNNING")
+	})
+	value = 2
+
+	if text := writeText(t, registry); !strings.Contains(text, `test_tasks{status="RUNNING"} 2`) {
+		t.Errorf("Expected gauge func to be evaluated when written, got:\n%s", text)
+	}
+
+	// Registering again replaces the earlier function
+	registry.RegisterGaugeFunc("test_tasks", "Tasks.", []string{"status"}, func(emit func(float64, ...string)) {
+		emit(4, "STOPPED")
+	})
+	text := writeText(t, registry)
+	if strings.Contains(text, "RUNNING") || !strings.Contains(text, `test_tasks{status="STOPPED"} 4`) {
+		t.Errorf("Expected replaced gauge func, got:\n%s", text)
+	}
+}
+
+func TestCounterFuncText(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegisterCounterFunc("test_restarts_total", "Restarts.", []string{"container"}, func(emit func(float64, ...string)) {
+		emit(3, "web")
+	})
+
+	text := writeText(t, registry)
+	if !strings.Contains(text, "# TYPE test_restarts_total counter\n") || !strings.Contains(text, `test_restarts_total{container="web"} 3`) {
+		t.Errorf("Expected counter func to be written as a counter, got:\n%s", text)
+	}
+}
+
+func TestFamiliesSortedAndEscaped(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewGauge("test_b", "Second.").Set(1)
+	registry.NewGauge("test_a", "First\nline \\ two.", "name").Set(1, "quote\" newline\n backslash\\")
+
+	expected := `# HELP test_a First\nline \\ two.
+# TYPE test_a gauge
+test_a{name="quote\" newline\n backslash\\"} 1
+# HELP test_b Second.
+# TYPE test_b gauge
+test_b 1
+`
+	if text := writeText(t, registry); text != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, text)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("test_total", "Total.").Inc()
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	registry.ServeHTTP(recorder, req)
+
+	if recorder.Header().Get("Content-Type") != contentType {
+		t.Errorf("Wrong content type: %s", recorder.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(recorder.Body.String(), "test_total 1\n") {
+		t.Errorf("Unexpected body: %s", recorder.Body.String())
+	}
+}
+
+func TestDefaultRegistryHasGoroutines(t *testing.T) {
+	if text := writeText(t, DefaultRegistry); !strings.Contains(text, Namespace+"goroutines ") {
+		t.Errorf("Expected goroutine gauge in default registry, got:\n%s", text)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package recorder
+
+import (
+	"reflect"
+
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+)
+
+// acsClientServer records the messages received from and sent to ACS by the
+// ClientServer it wraps.
+type acsClientServer struct {
+	wsclient.ClientServer
+	recorder *Recorder
+}
+
+// NewACSClientServer wraps an ACS client so that it records the messages it
+// receives and sends. Messages are only recorded as received once an
+// AnyRequestHandler is set. If recorder is nil, cs is returned as is.
+func NewACSClientServer(cs wsclient.ClientServer, recorder *Recorder) wsclient.ClientServer {
+	if recorder == nil {
+		return cs
+	}
+	return &acsClientServer{ClientServer: cs, recorder: recorder}
+}
+
+func (cs *acsClientServer) SetAnyRequestHandler(f wsclient.RequestHandler) {
+	cs.ClientServer.SetAnyRequestHandler(func(message interface{}) {
+		cs.recorder.RecordMessage(ACSMessage, message)
+		if f != nil {
+			reflect.ValueOf(f).Call([]reflect.Value{reflect.ValueOf(message)})
+		}
+	})
+}
+
+func (cs *acsClientServer) MakeRequest(input interface{}) error {
+	err := cs.ClientServer.MakeRequest(input)
+	if err == nil {
+		cs.recorder.RecordMessage(ACSRequest, input)
+	}
+	return err
+}
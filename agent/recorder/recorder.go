@@ -0,0 +1,239 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package recorder records the agent's interactions with ACS and Docker to a
+// journal, so that bugs seen in the field can be reproduced by replaying the
+// journal against a task engine. Recording is opt-in; secrets are redacted
+// before anything is written.
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+)
+
+var log = logger.ForModule("recorder")
+
+// The kinds of journal entries.
+const (
+	// ACSMessage is a message received from ACS.
+	ACSMessage = "acs_message"
+	// ACSRequest is a message, such as an ack or a nack, sent to ACS.
+	ACSRequest = "acs_request"
+	// DockerCall is a call made to docker, with its arguments and result.
+	DockerCall = "docker_call"
+	// DockerEvent is a container event received from docker.
+	DockerEvent = "docker_event"
+	// TaskStateChange is a task state change emitted by the task engine.
+	TaskStateChange = "task_state_change"
+	// ContainerStateChange is a container state change emitted by the task
+	// engine.
+	ContainerStateChange = "container_state_change"
+)
+
+// journalFilePrefix prefixes the names of journal files, which are suffixed
+// with the time the recording started.
+const journalFilePrefix = "ecs_agent_record_"
+
+// Entry is a line of a journal.
+type Entry struct {
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"`
+	// Type is the name of the Go type of Data, such as "PayloadMessage".
+	Type string `json:"type,omitempty"`
+	// Operation is the name of the docker call of DockerCall entries.
+	Operation string `json:"operation,omitempty"`
+	// Args holds the arguments of DockerCall entries.
+	Args json.RawMessage `json:"args,omitempty"`
+	// Data holds the message, event or state change of the entry, or the
+	// result of a docker call.
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Recorder appends entries to a journal file. Entries are written as lines of
+// JSON as they're recorded. Errors writing them are logged, and don't affect
+// the agent.
+//
+// A nil Recorder doesn't record anything.
+type Recorder struct {
+	path string
+
+	lock sync.Mutex
+	file *os.File
+}
+
+// New starts a new journal in dir, named by the current time.
+func New(dir string) (*Recorder, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	name := journalFilePrefix + ttime.Now().UTC().Format("20060102T150405Z") + ".json"
+	path := filepath.Join(dir, name)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Recording interactions with ACS and docker", "path", path)
+	return &Recorder{path: path, file: file}, nil
+}
+
+// Path returns the path of the journal file.
+func (recorder *Recorder) Path() string {
+	if recorder == nil {
+		return ""
+	}
+	return recorder.path
+}
+
+// Record records data, which is marshaled with encoding/json.
+func (recorder *Recorder) Record(kind string, data interface{}) {
+	if recorder == nil {
+		return
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		log.Warn("Unable to record entry", "kind", kind, "err", err)
+		return
+	}
+	recorder.write(&Entry{Kind: kind, Type: typeName(data)}, encoded)
+}
+
+// RecordMessage records a message of the ACS model, marshaled like it is on
+// the wire.
+func (recorder *Recorder) RecordMessage(kind string, message interface{}) {
+	if recorder == nil {
+		return
+	}
+	encoded, err := jsonutil.BuildJSON(message)
+	if err != nil {
+		log.Warn("Unable to record message", "kind", kind, "err", err)
+		return
+	}
+	recorder.write(&Entry{Kind: kind, Type: typeName(message)}, encoded)
+}
+
+// RecordCall records a docker call with its arguments and result.
+func (recorder *Recorder) RecordCall(operation string, args, result interface{}) {
+	if recorder == nil {
+		return
+	}
+	encodedArgs, err := json.Marshal(args)
+	if err != nil {
+		log.Warn("Unable to record docker call", "operation", operation, "err", err)
+		return
+	}
+	encodedArgs, err = Redact(encodedArgs)
+	if err != nil {
+		log.Warn("Unable to redact docker call", "operation", operation, "err", err)
+		return
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		log.Warn("Unable to record docker call", "operation", operation, "err", err)
+		return
+	}
+	recorder.write(&Entry{Kind: DockerCall, Operation: operation, Args: encodedArgs}, encoded)
+}
+
+// write redacts data and appends the entry with it to the journal.
+func (recorder *Recorder) write(entry *Entry, data []byte) {
+	redacted, err := Redact(data)
+	if err != nil {
+		log.Warn("Unable to redact entry", "kind", entry.Kind, "err", err)
+		return
+	}
+	entry.Time = ttime.Now()
+	entry.Data = redacted
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Warn("Unable to record entry", "kind", entry.Kind, "err", err)
+		return
+	}
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if recorder.file == nil {
+		return
+	}
+	_, err = recorder.file.Write(append(line, '\n'))
+	if err != nil {
+		log.Warn("Unable to write to the journal", "path", recorder.path, "err", err)
+	}
+}
+
+// Close stops recording.
+func (recorder *Recorder) Close() error {
+	if recorder == nil {
+		return nil
+	}
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if recorder.file == nil {
+		return nil
+	}
+	err := recorder.file.Close()
+	recorder.file = nil
+	return err
+}
+
+// ReadJournal reads the entries of a journal. An incomplete last line, left
+// if the agent stopped while writing it, is ignored.
+func ReadJournal(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var entry Entry
+		err = json.Unmarshal(line, &entry)
+		if err != nil {
+			return nil, errors.New("recorder: invalid journal entry: " + err.Error())
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// typeName returns the name of the type of v, dereferencing pointers.
+func typeName(v interface{}) string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return t.Name()
+}
@@ -0,0 +1,137 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package recorder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+)
+
+func newTestRecorder(t *testing.T) (*Recorder, func()) {
+	dir, err := ioutil.TempDir("", "recorder_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recorder, func() {
+		recorder.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRecordAndReadJournal(t *testing.T) {
+	recorder, cleanup := newTestRecorder(t)
+	defer cleanup()
+	if !strings.HasPrefix(filepath.Base(recorder.Path()), journalFilePrefix) {
+		t.Errorf("Unexpected journal path %s", recorder.Path())
+	}
+
+	recorder.RecordMessage(ACSMessage, &ecsacs.PayloadMessage{
+		MessageId: aws.String("id"),
+		Tasks: []*ecsacs.Task{{Containers: []*ecsacs.Container{{
+			Environment: map[string]*string{"SECRET": aws.String("hunter2")},
+		}}}},
+	})
+	recorder.RecordCall("StartContainer", map[string]string{"dockerId": "c1"}, map[string]string{"dockerId": "c1"})
+	recorder.Record(TaskStateChange, map[string]string{"status": "RUNNING"})
+	recorder.Close()
+	// Entries recorded after closing are dropped
+	recorder.Record(TaskStateChange, map[string]string{"status": "STOPPED"})
+
+	entries, err := ReadJournal(recorder.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].Kind != ACSMessage || entries[0].Type != "PayloadMessage" || entries[0].Time.IsZero() {
+		t.Errorf("Wrong message entry: %v", entries[0])
+	}
+	var payload map[string]interface{}
+	json.Unmarshal(entries[0].Data, &payload)
+	if payload["messageId"] != "id" {
+		t.Errorf("Expected the message to be recorded like on the wire: %s", entries[0].Data)
+	}
+	if strings.Contains(string(entries[0].Data), "hunter2") {
+		t.Errorf("Environment not redacted: %s", entries[0].Data)
+	}
+	if entries[1].Kind != DockerCall || entries[1].Operation != "StartContainer" || string(entries[1].Args) != `{"dockerId":"c1"}` {
+		t.Errorf("Wrong call entry: %v", entries[1])
+	}
+	if entries[2].Kind != TaskStateChange || string(entries[2].Data) != `{"status":"RUNNING"}` {
+		t.Errorf("Wrong state change entry: %v", entries[2])
+	}
+}
+
+func TestNilRecorder(t *testing.T) {
+	var recorder *Recorder
+	recorder.Record(TaskStateChange, "change")
+	recorder.RecordMessage(ACSMessage, &ecsacs.HeartbeatMessage{})
+	recorder.RecordCall("Version", nil, nil)
+	if recorder.Close() != nil {
+		t.Error("Expected closing a nil recorder to succeed")
+	}
+}
+
+func TestACSClientServerRecordsMessages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	recorder, cleanup := newTestRecorder(t)
+	defer cleanup()
+
+	cs := mock_wsclient.NewMockClientServer(ctrl)
+	if NewACSClientServer(cs, nil) != cs {
+		t.Error("Expected the client to be returned as is without a recorder")
+	}
+
+	var anyHandler func(interface{})
+	cs.EXPECT().SetAnyRequestHandler(gomock.Any()).Do(func(f interface{}) {
+		anyHandler = f.(func(interface{}))
+	})
+	ack := &ecsacs.AckRequest{MessageId: aws.String("id")}
+	cs.EXPECT().MakeRequest(ack).Return(nil)
+
+	client := NewACSClientServer(cs, recorder)
+	handled := false
+	client.SetAnyRequestHandler(func(interface{}) { handled = true })
+	anyHandler(&ecsacs.HeartbeatMessage{Healthy: aws.Bool(true)})
+	if !handled {
+		t.Error("Expected the handler to be called")
+	}
+	err := client.MakeRequest(ack)
+	if err != nil {
+		t.Error(err)
+	}
+
+	entries, err := ReadJournal(recorder.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Type != "HeartbeatMessage" || entries[0].Kind != ACSMessage || entries[1].Type != "AckRequest" || entries[1].Kind != ACSRequest {
+		t.Errorf("Unexpected entries: %v", entries)
+	}
+}
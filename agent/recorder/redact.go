@@ -0,0 +1,124 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Redacted replaces the values of secrets in journals.
+const Redacted = "REDACTED"
+
+// sensitiveKeys are the keys, in lower case, whose values are redacted
+// wherever they appear.
+var sensitiveKeys = map[string]bool{
+	"engineauthdata":     true,
+	"auth":               true,
+	"password":           true,
+	"authorizationtoken": true,
+	"secretaccesskey":    true,
+	"sessiontoken":       true,
+}
+
+// embeddedDocumentKeys are the keys, in lower case, whose values may be JSON
+// documents given as strings, like the docker config and host config of
+// containers in tasks. Secrets in them are redacted too.
+var embeddedDocumentKeys = map[string]bool{
+	"config":     true,
+	"hostconfig": true,
+}
+
+// Redact returns a copy of the JSON document data with secrets replaced by
+// Redacted: authentication data, and the values of environment variables,
+// whether given as a map like in tasks, as name and value pairs, or as
+// "NAME=value" strings like in docker configs. Keys are matched regardless
+// of case.
+func Redact(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document interface{}
+	err := decoder.Decode(&document)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(redactValue(document))
+}
+
+func redactValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			switch lowerKey := strings.ToLower(key); {
+			case sensitiveKeys[lowerKey]:
+				if field != nil {
+					value[key] = Redacted
+				}
+			case lowerKey == "environment" || lowerKey == "env":
+				value[key] = redactEnvironment(field)
+			case embeddedDocumentKeys[lowerKey]:
+				value[key] = redactEmbeddedDocument(field)
+			default:
+				value[key] = redactValue(field)
+			}
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redactValue(item)
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+// redactEmbeddedDocument redacts a JSON document given as a string. Strings
+// which aren't JSON documents are left as they are.
+func redactEmbeddedDocument(field interface{}) interface{} {
+	document, ok := field.(string)
+	if !ok {
+		return redactValue(field)
+	}
+	redacted, err := Redact([]byte(document))
+	if err != nil {
+		return field
+	}
+	return string(redacted)
+}
+
+// redactEnvironment redacts the values of environment variables.
+func redactEnvironment(environment interface{}) interface{} {
+	switch environment := environment.(type) {
+	case map[string]interface{}:
+		for name := range environment {
+			environment[name] = Redacted
+		}
+	case []interface{}:
+		for i, variable := range environment {
+			switch variable := variable.(type) {
+			case string:
+				environment[i] = strings.SplitN(variable, "=", 2)[0] + "=" + Redacted
+			case map[string]interface{}:
+				for key := range variable {
+					if strings.ToLower(key) == "value" {
+						variable[key] = Redacted
+					}
+				}
+			}
+		}
+	}
+	return environment
+}
@@ -0,0 +1,101 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package recorder
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	data := []byte(`{
+		"engineAuthData": {"registry": {"password": "secret"}},
+		"containers": [{
+			"name": "web",
+			"environment": {"DB_PASSWORD": "hunter2", "EMPTY": null},
+			"Config": {"Env": ["TOKEN=abc=def", "FLAG"], "Image": "busybox"}
+		}],
+		"overrides": {"Environment": [{"name": "KEY", "value": "secret"}]},
+		"registryAuthentication": {"type": "ecr", "ecrAuthData": {"region": "us-west-2"}}
+	}`)
+	redacted, err := Redact(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual, expected interface{}
+	json.Unmarshal(redacted, &actual)
+	json.Unmarshal([]byte(`{
+		"engineAuthData": "REDACTED",
+		"containers": [{
+			"name": "web",
+			"environment": {"DB_PASSWORD": "REDACTED", "EMPTY": "REDACTED"},
+			"Config": {"Env": ["TOKEN=REDACTED", "FLAG=REDACTED"], "Image": "busybox"}
+		}],
+		"overrides": {"Environment": [{"name": "KEY", "value": "REDACTED"}]},
+		"registryAuthentication": {"type": "ecr", "ecrAuthData": {"region": "us-west-2"}}
+	}`), &expected)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Wrong redaction: %s", redacted)
+	}
+}
+
+func TestRedactEmbeddedDocuments(t *testing.T) {
+	data := []byte(`{"dockerConfig": {
+		"config": "{\"Env\":[\"DB_PASSWORD=hunter2\"],\"User\":\"app\"}",
+		"hostConfig": "{\"Env\":[\"KEY=secret\"]}",
+		"version": "1.17"
+	}, "hostConfig": "not json"}`)
+	redacted, err := Redact(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual struct {
+		DockerConfig struct {
+			Config     string `json:"config"`
+			HostConfig string `json:"hostConfig"`
+			Version    string `json:"version"`
+		} `json:"dockerConfig"`
+		HostConfig string `json:"hostConfig"`
+	}
+	json.Unmarshal(redacted, &actual)
+	if actual.DockerConfig.Config != `{"Env":["DB_PASSWORD=REDACTED"],"User":"app"}` {
+		t.Errorf("Wrong redaction of the config: %s", actual.DockerConfig.Config)
+	}
+	if actual.DockerConfig.HostConfig != `{"Env":["KEY=REDACTED"]}` || actual.DockerConfig.Version != "1.17" {
+		t.Errorf("Wrong redaction of the host config: %s", redacted)
+	}
+	if actual.HostConfig != "not json" {
+		t.Errorf("Expected a string which isn't JSON to be left as is, got %s", actual.HostConfig)
+	}
+}
+
+func TestRedactKeepsNumbers(t *testing.T) {
+	redacted, err := Redact([]byte(`{"seqNum":1234567890123456789,"password":null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(redacted) != `{"password":null,"seqNum":1234567890123456789}` {
+		t.Errorf("Wrong redaction: %s", redacted)
+	}
+}
+
+func TestRedactInvalidJSON(t *testing.T) {
+	_, err := Redact([]byte(`{"password":`))
+	if err == nil {
+		t.Error("Expected an error redacting invalid JSON")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package replay
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+)
+
+// collector collects the state changes emitted by an engine, marking them as
+// sent like the event handler would once they're submitted.
+type collector struct {
+	lock    sync.Mutex
+	changes []string
+	// changed is closed and replaced whenever a change is collected.
+	changed chan struct{}
+	done    chan struct{}
+}
+
+func newCollector(taskEngine engine.TaskEngine) *collector {
+	c := &collector{
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	taskEvents, containerEvents := taskEngine.TaskEvents()
+	// The sent status of events isn't updated, as the engine still reads it
+	// after passing them on
+	go func() {
+		for {
+			select {
+			case event := <-taskEvents:
+				c.add(formatTaskChange(event))
+			case event := <-containerEvents:
+				c.add(formatContainerChange(event))
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return c
+}
+
+func (c *collector) add(change string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.changes = append(c.changes, change)
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// waitFor waits until n changes were collected, or the deadline passes, and
+// returns the changes collected.
+func (c *collector) waitFor(n int, deadline time.Time) []string {
+	for {
+		c.lock.Lock()
+		changes := append([]string(nil), c.changes...)
+		changed := c.changed
+		c.lock.Unlock()
+		if len(changes) >= n {
+			return changes
+		}
+		select {
+		case <-changed:
+		case <-time.After(deadline.Sub(time.Now())):
+			return changes
+		}
+	}
+}
+
+func (c *collector) stop() {
+	close(c.done)
+}
@@ -0,0 +1,206 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package replay replays journals recorded by the agent against a task
+// engine, to reproduce how the engine handled what it was sent by ACS and
+// docker.
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/recorder"
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+)
+
+var log = logger.ForModule("replay")
+
+// Result is the outcome of a replay.
+type Result struct {
+	// Expected lists the state changes in the journal, and Actual those
+	// emitted by the engine during the replay, like "task arn RUNNING" or
+	// "container arn name RUNNING".
+	Expected []string
+	Actual   []string
+	// UnexpectedCalls lists the docker calls made by the engine which aren't
+	// in the journal, and UnusedCalls those in the journal it didn't make.
+	UnexpectedCalls []string
+	UnusedCalls     []string
+}
+
+// Err returns an error describing how the state changes of the replay
+// differ from those in the journal, or nil if the engine went through the
+// same transitions. Changes are compared per task and per container, since
+// the order of changes across tasks isn't deterministic.
+func (result *Result) Err() error {
+	expected := groupByEntity(result.Expected)
+	actual := groupByEntity(result.Actual)
+	var diffs []string
+	for entity, changes := range expected {
+		if strings.Join(changes, ",") != strings.Join(actual[entity], ",") {
+			diffs = append(diffs, fmt.Sprintf("%s: recorded %v, replayed %v", entity, changes, actual[entity]))
+		}
+	}
+	for entity, changes := range actual {
+		if _, ok := expected[entity]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: not recorded, replayed %v", entity, changes))
+		}
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+	return errors.New("replay: state changes differ from the journal: " + strings.Join(diffs, "; "))
+}
+
+// groupByEntity groups state changes by the task or container they're for.
+func groupByEntity(changes []string) map[string][]string {
+	grouped := make(map[string][]string)
+	for _, change := range changes {
+		split := strings.LastIndex(change, " ")
+		entity := change[:split]
+		grouped[entity] = append(grouped[entity], change[split+1:])
+	}
+	return grouped
+}
+
+// Replay feeds the ACS payloads and docker events of a journal, in order, to
+// a new DockerTaskEngine. Its docker client is scripted with the results of
+// the recorded calls, and the ttime test clock is warped to the time of each
+// entry as it's replayed, so that the engine's timers fire like they did when
+// recording. Before each entry is replayed, the docker calls recorded before
+// it are waited for.
+//
+// Replay returns once the engine has emitted as many state changes as the
+// journal holds and made all the recorded calls, or after timeout. It
+// replaces the clock of the ttime package while it runs.
+func Replay(entries []recorder.Entry, timeout time.Duration) (*Result, error) {
+	client, err := newScriptedClient(entries)
+	if err != nil {
+		return nil, err
+	}
+	testTime := ttime.NewTestTime()
+	ttime.SetTime(testTime)
+	defer ttime.SetTime(&ttime.DefaultTime{})
+
+	taskEngine := engine.NewDockerTaskEngine(&config.Config{TaskCleanupWaitDuration: config.DefaultTaskCleanupWaitDuration}, false)
+	taskEngine.SetDockerClient(client)
+	err = taskEngine.Init()
+	if err != nil {
+		return nil, err
+	}
+	defer taskEngine.Shutdown()
+
+	collector := newCollector(taskEngine)
+	defer collector.stop()
+
+	result := &Result{}
+	deadline := time.Now().Add(timeout)
+	var start, replayStart time.Time
+	for i, entry := range entries {
+		if !client.waitForCalls(i, deadline) {
+			log.Warn("Timed out waiting for recorded docker calls", "entry", i)
+		}
+		if i == 0 {
+			start, replayStart = entry.Time, testTime.Now()
+		}
+		if warp := replayStart.Add(entry.Time.Sub(start)).Sub(testTime.Now()); warp > 0 {
+			testTime.Warp(warp)
+		}
+
+		switch entry.Kind {
+		case recorder.ACSMessage:
+			if entry.Type != "PayloadMessage" {
+				continue
+			}
+			payload := &ecsacs.PayloadMessage{}
+			err = jsonutil.UnmarshalJSON(payload, strings.NewReader(string(entry.Data)))
+			if err != nil {
+				return nil, err
+			}
+			addPayloadTasks(taskEngine, payload)
+		case recorder.DockerEvent:
+			var recorded engine.DockerCallResult
+			err = json.Unmarshal(entry.Data, &recorded)
+			if err != nil {
+				return nil, err
+			}
+			event := engine.DockerContainerChangeEvent{DockerContainerMetadata: recorded.Metadata.DockerContainerMetadata()}
+			if recorded.Status != nil {
+				event.Status = *recorded.Status
+			}
+			select {
+			case client.events <- event:
+			case <-time.After(deadline.Sub(time.Now())):
+				log.Warn("Timed out sending a docker event to the engine", "entry", i)
+			}
+		case recorder.TaskStateChange:
+			var change api.TaskStateChange
+			err = json.Unmarshal(entry.Data, &change)
+			if err != nil {
+				return nil, err
+			}
+			result.Expected = append(result.Expected, formatTaskChange(change))
+		case recorder.ContainerStateChange:
+			var change api.ContainerStateChange
+			err = json.Unmarshal(entry.Data, &change)
+			if err != nil {
+				return nil, err
+			}
+			result.Expected = append(result.Expected, formatContainerChange(change))
+		}
+	}
+
+	client.waitForCalls(len(entries), deadline)
+	result.Actual = collector.waitFor(len(result.Expected), deadline)
+	result.UnexpectedCalls, result.UnusedCalls = client.summary()
+	return result, nil
+}
+
+// addPayloadTasks adds the tasks of a payload to the engine like the ACS
+// handler does, stopped tasks first.
+func addPayloadTasks(taskEngine engine.TaskEngine, payload *ecsacs.PayloadMessage) {
+	var tasks []*api.Task
+	for _, acsTask := range payload.Tasks {
+		task, err := api.TaskFromACS(acsTask, payload)
+		if err != nil {
+			log.Warn("Skipping invalid task in payload", "err", err)
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	for _, stopped := range []bool{true, false} {
+		for _, task := range tasks {
+			if (task.DesiredStatus == api.TaskStopped) == stopped {
+				taskEngine.AddTask(task)
+			}
+		}
+	}
+}
+
+func formatTaskChange(change api.TaskStateChange) string {
+	return "task " + change.TaskArn + " " + change.Status.String()
+}
+
+func formatContainerChange(change api.ContainerStateChange) string {
+	return "container " + change.TaskArn + " " + change.ContainerName + " " + change.Status.String()
+}
@@ -0,0 +1,170 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package replay
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/recorder"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+)
+
+const taskArn = "arn:aws:ecs:us-west-2:000000000000:task/replay"
+
+// record runs a task which exits after starting against a mock docker client,
+// and returns the journal recorded.
+func record(t *testing.T) []recorder.Entry {
+	dir, err := ioutil.TempDir("", "replay_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rec, err := recorder.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := engine.NewMockDockerClient(ctrl)
+	dockerEvents := make(chan engine.DockerContainerChangeEvent)
+	client.EXPECT().ContainerEvents(gomock.Any()).Return(dockerEvents, nil)
+	client.EXPECT().PullImage("busybox:latest", gomock.Any()).Return(engine.DockerContainerMetadata{})
+	client.EXPECT().CreateContainer(gomock.Any(), gomock.Any(), gomock.Any()).Return(engine.DockerContainerMetadata{DockerId: "container1"})
+	exitCode := 0
+	client.EXPECT().StartContainer("container1").Do(func(string) {
+		go func() {
+			dockerEvents <- engine.DockerContainerChangeEvent{
+				Status:                  api.ContainerStopped,
+				DockerContainerMetadata: engine.DockerContainerMetadata{DockerId: "container1", ExitCode: &exitCode},
+			}
+		}()
+	}).Return(engine.DockerContainerMetadata{DockerId: "container1"})
+
+	taskEngine := engine.NewDockerTaskEngine(&config.Config{}, false)
+	taskEngine.SetRecorder(rec)
+	taskEngine.SetDockerClient(engine.NewRecordingDockerClient(client, rec))
+	err = taskEngine.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taskEngine.Shutdown()
+
+	payload := &ecsacs.PayloadMessage{
+		MessageId: aws.String("message1"),
+		SeqNum:    aws.Int64(1),
+		Tasks: []*ecsacs.Task{{
+			Arn:           aws.String(taskArn),
+			Family:        aws.String("replay"),
+			Version:       aws.String("1"),
+			DesiredStatus: aws.String("RUNNING"),
+			Containers: []*ecsacs.Container{{
+				Name:        aws.String("busybox"),
+				Image:       aws.String("busybox:latest"),
+				Essential:   aws.Bool(true),
+				Environment: map[string]*string{"PASSWORD": aws.String("hunter2")},
+			}},
+		}},
+	}
+	rec.RecordMessage(recorder.ACSMessage, payload)
+	task, err := api.TaskFromACS(payload.Tasks[0], payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskEngine.AddTask(task)
+
+	taskEvents, containerEvents := taskEngine.TaskEvents()
+	timeout := time.After(10 * time.Second)
+	// The sent status of events isn't updated, as the engine still reads it
+	// after passing them on
+	for stopped := false; !stopped; {
+		select {
+		case event := <-taskEvents:
+			stopped = event.Status == api.TaskStopped
+		case <-containerEvents:
+		case <-timeout:
+			t.Fatal("Timed out waiting for the task to stop")
+		}
+	}
+	rec.Close()
+
+	entries, err := recorder.ReadJournal(rec.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestReplayReachesRecordedTransitions(t *testing.T) {
+	entries := record(t)
+	for _, entry := range entries {
+		if strings.Contains(string(entry.Data), "hunter2") || strings.Contains(string(entry.Args), "hunter2") {
+			t.Errorf("Secret recorded in %s entry: %s %s", entry.Kind, entry.Args, entry.Data)
+		}
+	}
+
+	result, err := Replay(entries, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := result.Err(); err != nil {
+		t.Error(err)
+	}
+	expected := []string{
+		"container " + taskArn + " busybox RUNNING",
+		"task " + taskArn + " RUNNING",
+		"container " + taskArn + " busybox STOPPED",
+		"task " + taskArn + " STOPPED",
+	}
+	if strings.Join(result.Expected, ",") != strings.Join(expected, ",") {
+		t.Errorf("Unexpected state changes recorded: %v", result.Expected)
+	}
+	if len(result.UnexpectedCalls) != 0 || len(result.UnusedCalls) != 0 {
+		t.Errorf("Expected the recorded calls to be replayed, got unexpected %v and unused %v", result.UnexpectedCalls, result.UnusedCalls)
+	}
+}
+
+func TestReplayDetectsDivergence(t *testing.T) {
+	entries := record(t)
+	// Make the container fail to start
+	for i, entry := range entries {
+		if entry.Operation == engine.StartContainerOperation {
+			data, err := json.Marshal(&engine.DockerCallResult{Metadata: &engine.RecordedMetadata{
+				Error: &api.DefaultNamedError{Name: "CannotStartContainerError", Err: "failed"},
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries[i].Data = data
+		}
+	}
+
+	result, err := Replay(entries, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := result.Err(); err == nil || !strings.Contains(err.Error(), "busybox") {
+		t.Errorf("Expected the container's transitions to differ, got %v: %v", err, result.Actual)
+	}
+}
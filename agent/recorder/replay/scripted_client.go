@@ -0,0 +1,255 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
+	"github.com/aws/amazon-ecs-agent/agent/recorder"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// unexpectedCallError is the name of the error returned for docker calls
+// which aren't in the journal.
+const unexpectedCallError = "UnexpectedReplayCallError"
+
+// scriptedCall is a docker call recorded in the journal.
+type scriptedCall struct {
+	// index is the index of the call in the journal.
+	index  int
+	result *engine.DockerCallResult
+}
+
+// scriptedClient is a DockerClient returning the results recorded in a
+// journal. Calls are matched to recorded ones by operation and by the
+// image, container name or docker id they're for, in the order they were
+// recorded.
+type scriptedClient struct {
+	events chan engine.DockerContainerChangeEvent
+
+	lock sync.Mutex
+	// changed is closed and replaced whenever a call is made.
+	changed chan struct{}
+	calls   map[string][]*scriptedCall
+	// pending holds the journal indices of the calls not made yet.
+	pending    map[int]string
+	unexpected []string
+}
+
+func newScriptedClient(entries []recorder.Entry) (*scriptedClient, error) {
+	client := &scriptedClient{
+		events:  make(chan engine.DockerContainerChangeEvent),
+		changed: make(chan struct{}),
+		calls:   make(map[string][]*scriptedCall),
+		pending: make(map[int]string),
+	}
+	for i, entry := range entries {
+		if entry.Kind != recorder.DockerCall {
+			continue
+		}
+		var args engine.DockerCallArgs
+		err := json.Unmarshal(entry.Args, &args)
+		if err != nil {
+			return nil, errors.New("replay: invalid arguments of docker call: " + err.Error())
+		}
+		result := &engine.DockerCallResult{}
+		err = json.Unmarshal(entry.Data, result)
+		if err != nil {
+			return nil, errors.New("replay: invalid result of docker call: " + err.Error())
+		}
+		key := callKey(entry.Operation, args)
+		client.calls[key] = append(client.calls[key], &scriptedCall{index: i, result: result})
+		client.pending[i] = key
+	}
+	return client, nil
+}
+
+// callKey returns the key by which a call is matched to recorded ones.
+func callKey(operation string, args engine.DockerCallArgs) string {
+	switch operation {
+	case engine.PullImageOperation:
+		return operation + " " + args.Image
+	case engine.CreateContainerOperation:
+		// Container names end with a random suffix
+		name := args.Name
+		if suffix := strings.LastIndex(name, "-"); suffix >= 0 {
+			name = name[:suffix]
+		}
+		return operation + " " + name
+	case engine.ListContainersOperation, engine.VersionOperation, engine.InfoOperation:
+		return operation
+	default:
+		return operation + " " + args.DockerId
+	}
+}
+
+// call returns the result of the next recorded call with the given key.
+func (client *scriptedClient) call(operation string, args engine.DockerCallArgs) *engine.DockerCallResult {
+	key := callKey(operation, args)
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	defer func() {
+		close(client.changed)
+		client.changed = make(chan struct{})
+	}()
+
+	calls := client.calls[key]
+	if len(calls) == 0 {
+		client.unexpected = append(client.unexpected, key)
+		return &engine.DockerCallResult{Error: &api.DefaultNamedError{
+			Name: unexpectedCallError,
+			Err:  "call not in the journal: " + key,
+		}}
+	}
+	client.calls[key] = calls[1:]
+	delete(client.pending, calls[0].index)
+	return calls[0].result
+}
+
+// waitForCalls waits until the calls recorded before the entry with the
+// given index were made, and returns false if the deadline passed first.
+func (client *scriptedClient) waitForCalls(index int, deadline time.Time) bool {
+	for {
+		client.lock.Lock()
+		waiting := false
+		for pending := range client.pending {
+			if pending < index {
+				waiting = true
+				break
+			}
+		}
+		changed := client.changed
+		client.lock.Unlock()
+		if !waiting {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-time.After(deadline.Sub(time.Now())):
+			return false
+		}
+	}
+}
+
+// summary returns the unexpected calls made, and the recorded calls which
+// weren't made, in journal order.
+func (client *scriptedClient) summary() ([]string, []string) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	indices := make([]int, 0, len(client.pending))
+	for index := range client.pending {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	unused := make([]string, 0, len(indices))
+	for _, index := range indices {
+		unused = append(unused, fmt.Sprintf("%s (entry %d)", client.pending[index], index))
+	}
+	return append([]string(nil), client.unexpected...), unused
+}
+
+func (client *scriptedClient) SupportedVersions() []dockerclient.DockerVersion {
+	return []dockerclient.DockerVersion{dockerclient.Version_1_17}
+}
+
+func (client *scriptedClient) WithVersion(dockerclient.DockerVersion) engine.DockerClient {
+	return client
+}
+
+func (client *scriptedClient) ContainerEvents(ctx context.Context) (<-chan engine.DockerContainerChangeEvent, error) {
+	return client.events, nil
+}
+
+func (client *scriptedClient) PullImage(image string, authData *api.RegistryAuthenticationData) engine.DockerContainerMetadata {
+	return client.metadata(client.call(engine.PullImageOperation, engine.DockerCallArgs{Image: image}))
+}
+
+func (client *scriptedClient) CreateContainer(config *docker.Config, hostConfig *docker.HostConfig, name string) engine.DockerContainerMetadata {
+	return client.metadata(client.call(engine.CreateContainerOperation, engine.DockerCallArgs{Name: name}))
+}
+
+func (client *scriptedClient) StartContainer(id string) engine.DockerContainerMetadata {
+	return client.metadata(client.call(engine.StartContainerOperation, engine.DockerCallArgs{DockerId: id}))
+}
+
+func (client *scriptedClient) StopContainer(id string) engine.DockerContainerMetadata {
+	return client.metadata(client.call(engine.StopContainerOperation, engine.DockerCallArgs{DockerId: id}))
+}
+
+func (client *scriptedClient) DescribeContainer(id string) (api.ContainerStatus, engine.DockerContainerMetadata) {
+	result := client.call(engine.DescribeContainerOperation, engine.DockerCallArgs{DockerId: id})
+	var status api.ContainerStatus
+	if result.Status != nil {
+		status = *result.Status
+	}
+	return status, client.metadata(result)
+}
+
+func (client *scriptedClient) RemoveContainer(id string) error {
+	return client.call(engine.RemoveContainerOperation, engine.DockerCallArgs{DockerId: id}).Err()
+}
+
+func (client *scriptedClient) GetContainerName(id string) (string, error) {
+	result := client.call(engine.GetContainerNameOperation, engine.DockerCallArgs{DockerId: id})
+	return result.Name, result.Err()
+}
+
+func (client *scriptedClient) InspectContainer(id string) (*docker.Container, error) {
+	result := client.call(engine.InspectContainerOperation, engine.DockerCallArgs{DockerId: id})
+	return result.Container, result.Err()
+}
+
+func (client *scriptedClient) ListContainers(all bool) engine.ListContainersResponse {
+	result := client.call(engine.ListContainersOperation, engine.DockerCallArgs{All: all})
+	return engine.ListContainersResponse{DockerIds: result.DockerIds, Error: result.Err()}
+}
+
+func (client *scriptedClient) Version() (string, error) {
+	result := client.call(engine.VersionOperation, engine.DockerCallArgs{})
+	return result.Version, result.Err()
+}
+
+func (client *scriptedClient) Info() (engine.DockerInfo, error) {
+	result := client.call(engine.InfoOperation, engine.DockerCallArgs{})
+	if result.Info == nil {
+		return engine.DockerInfo{}, result.Err()
+	}
+	return *result.Info, result.Err()
+}
+
+// UpdateAuth does nothing, as images are never pulled with it in a replay.
+func (client *scriptedClient) UpdateAuth(string, *config.SensitiveRawMessage) {
+}
+
+// metadata returns the metadata of a result, or its error for calls which
+// weren't in the journal.
+func (client *scriptedClient) metadata(result *engine.DockerCallResult) engine.DockerContainerMetadata {
+	if result.Metadata == nil {
+		return engine.DockerContainerMetadata{Error: result.Err()}
+	}
+	return result.Metadata.DockerContainerMetadata()
+}
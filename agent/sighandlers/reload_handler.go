@@ -0,0 +1,114 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sighandlers
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/utils"
+	"github.com/cihub/seelog"
+)
+
+// ConfigReloader reloads the config and applies the settings which can change
+// while the agent is running: those with the `reload` tag, and the log level
+// and file.
+type ConfigReloader struct {
+	// Config holds the config the agent is running with. Reloads replace
+	// it with a copy that has the reloaded settings.
+	Config *config.Holder
+	// Loaded is the config as it was last loaded, before anything the agent
+	// restored from its state was applied, to compare reloads against.
+	Loaded *config.Config
+	// Load loads the config again.
+	Load       func() (*config.Config, error)
+	TaskEngine engine.TaskEngine
+	// Register re-registers the container instance with the given
+	// capabilities, and the reserved ports and instance attributes of the
+	// config held by Config.
+	// It's nil if the agent doesn't register, as in standalone mode.
+	Register func(capabilities []string) error
+	// LogLevel is the log level set by flag, which takes precedence over
+	// the one in the environment.
+	LogLevel string
+}
+
+// StartReloadHandler reloads the config each time the agent gets a SIGHUP.
+func StartReloadHandler(reloader *ConfigReloader) {
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, syscall.SIGHUP)
+	go func() {
+		for range signalChannel {
+			reloader.Reload()
+		}
+	}()
+}
+
+// Reload loads the config and applies what changed in it that can be. The
+// changes which need a restart are logged. If the config can't be loaded,
+// nothing is applied.
+func (reloader *ConfigReloader) Reload() {
+	seelog.Info("Reloading configuration")
+	cfg, err := reloader.Load()
+	if err != nil {
+		seelog.Errorf("Error reloading config, keeping the current one: %v", err)
+		return
+	}
+
+	// The log level and file are set from the environment, which env files
+	// may have changed
+	logger.SetLogfile(os.Getenv(logger.LOGFILE_ENV_VAR))
+	if reloader.LogLevel == "" {
+		logger.SetLevel(utils.DefaultIfBlank(os.Getenv(logger.LOGLEVEL_ENV_VAR), logger.DEFAULT_LOGLEVEL))
+	}
+
+	changes := config.Changes(reloader.Loaded, cfg)
+	reloader.Loaded = cfg
+	reloadable := false
+	for _, change := range changes {
+		if change.Reloadable {
+			seelog.Infof("Applying %s: %s (was %s)", change.Name, change.New, change.Old)
+			reloadable = true
+		} else {
+			seelog.Warnf("Not applying %s: %s (is %s) until the agent is restarted", change.Name, change.New, change.Old)
+		}
+	}
+	if !reloadable {
+		return
+	}
+
+	capabilities := reloader.TaskEngine.Capabilities()
+	previous := reloader.Config.Get()
+	reloader.TaskEngine.UpdateConfig(cfg)
+	updated := reloader.Config.ApplyReloadable(cfg)
+	if reloader.Register == nil {
+		return
+	}
+	updatedCapabilities := reloader.TaskEngine.Capabilities()
+	if reflect.DeepEqual(capabilities, updatedCapabilities) &&
+		reflect.DeepEqual(previous.ReservedPorts, updated.ReservedPorts) &&
+		reflect.DeepEqual(previous.ReservedPortsUDP, updated.ReservedPortsUDP) &&
+		reflect.DeepEqual(previous.InstanceAttributes, updated.InstanceAttributes) {
+		return
+	}
+	seelog.Infof("Re-registering with capabilities %v", updatedCapabilities)
+	if err := reloader.Register(updatedCapabilities); err != nil {
+		seelog.Errorf("Error re-registering with the reloaded config: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sighandlers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/golang/mock/gomock"
+)
+
+func newReloader(t *testing.T, reloaded *config.Config, loadErr error) (*gomock.Controller, *engine.MockTaskEngine, *ConfigReloader, *[][]string) {
+	ctrl := gomock.NewController(t)
+	taskEngine := engine.NewMockTaskEngine(ctrl)
+	cfg := config.DefaultConfig()
+	loaded := cfg
+	var registered [][]string
+	reloader := &ConfigReloader{
+		Config: config.NewHolder(&cfg),
+		Loaded: &loaded,
+		Load: func() (*config.Config, error) {
+			return reloaded, loadErr
+		},
+		TaskEngine: taskEngine,
+		Register: func(capabilities []string) error {
+			registered = append(registered, capabilities)
+			return nil
+		},
+		LogLevel: "info",
+	}
+	return ctrl, taskEngine, reloader, &registered
+}
+
+func TestReloadReregistersChangedCapabilities(t *testing.T) {
+	reloaded := config.DefaultConfig()
+	reloaded.PrivilegedDisabled = true
+	reloaded.TaskCleanupWaitDuration = time.Hour
+	ctrl, taskEngine, reloader, registered := newReloader(t, &reloaded, nil)
+	defer ctrl.Finish()
+
+	gomock.InOrder(
+		taskEngine.EXPECT().Capabilities().Return([]string{"privileged-container", "selinux"}),
+		taskEngine.EXPECT().UpdateConfig(&reloaded),
+		taskEngine.EXPECT().Capabilities().Return([]string{"selinux"}),
+	)
+	reloader.Reload()
+
+	if !reflect.DeepEqual(*registered, [][]string{{"selinux"}}) {
+		t.Errorf("Expected to re-register with the changed capabilities, got %v", *registered)
+	}
+	if reloader.Config.Get().TaskCleanupWaitDuration != time.Hour {
+		t.Errorf("Expected the reloadable settings to be applied, got %v", reloader.Config.Get().TaskCleanupWaitDuration)
+	}
+	if reloader.Loaded != &reloaded {
+		t.Error("Expected later reloads to be compared with the reloaded config")
+	}
+}
+
+func TestReloadReregistersChangedPortsAndAttributes(t *testing.T) {
+	reloaded := config.DefaultConfig()
+	reloaded.ReservedPorts = []uint16{22}
+	reloaded.InstanceAttributes = map[string]string{"rack": "r12"}
+	ctrl, taskEngine, reloader, registered := newReloader(t, &reloaded, nil)
+	defer ctrl.Finish()
+
+	taskEngine.EXPECT().Capabilities().Return([]string{"selinux"}).Times(2)
+	taskEngine.EXPECT().UpdateConfig(&reloaded)
+	reloader.Reload()
+
+	if len(*registered) != 1 || !reflect.DeepEqual(reloader.Config.Get().ReservedPorts, []uint16{22}) {
+		t.Errorf("Expected to re-register with the reserved ports, got %v and %v", *registered, reloader.Config.Get().ReservedPorts)
+	}
+	if reloader.Config.Get().InstanceAttributes["rack"] != "r12" {
+		t.Errorf("Expected to re-register with the instance attributes, got %v", reloader.Config.Get().InstanceAttributes)
+	}
+}
+
+func TestReloadWithoutReloadableChanges(t *testing.T) {
+	reloaded := config.DefaultConfig()
+	reloaded.Cluster = "other"
+	ctrl, _, reloader, registered := newReloader(t, &reloaded, nil)
+	defer ctrl.Finish()
+
+	reloader.Reload()
+
+	if reloader.Config.Get().Cluster == "other" || len(*registered) != 0 {
+		t.Errorf("Expected nothing to be applied, got cluster %q", reloader.Config.Get().Cluster)
+	}
+}
+
+func TestReloadError(t *testing.T) {
+	ctrl, _, reloader, registered := newReloader(t, nil, errors.New("Invalid config"))
+	defer ctrl.Finish()
+	loaded := reloader.Loaded
+
+	reloader.Reload()
+
+	if reloader.Loaded != loaded || len(*registered) != 0 {
+		t.Error("Expected nothing to be applied when the config can't be loaded")
+	}
+}
@@ -16,6 +16,8 @@
 //   Flush state to disk and exit
 // SIGUSR1:
 //   Print a dump of goroutines to the logger and DON'T exit
+// SIGHUP:
+//   Reload the config and apply the settings which can change at runtime
 package sighandlers
 
 import (
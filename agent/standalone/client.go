@@ -0,0 +1,98 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package standalone runs the agent without the ECS backend. Tasks are read
+// from a directory of JSON files rather than received from ACS, and state
+// changes are recorded locally rather than submitted to ECS.
+package standalone
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+)
+
+var log = logger.ForModule("standalone")
+
+var errStandalone = errors.New("the ECS backend isn't used in standalone mode")
+
+// localClient is an api.ECSClient which records state changes locally. It
+// logs every change and, if it has a file, appends it as a line of JSON in
+// the format posted to state change webhooks.
+type localClient struct {
+	cluster string
+
+	lock sync.Mutex
+	file *os.File
+}
+
+// NewClient returns a client which records state changes to the file at
+// eventsPath, if it isn't empty.
+func NewClient(cluster, eventsPath string) (api.ECSClient, error) {
+	client := &localClient{cluster: cluster}
+	if eventsPath == "" {
+		return client, nil
+	}
+	file, err := os.OpenFile(eventsPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	client.file = file
+	return client, nil
+}
+
+func (client *localClient) RegisterContainerInstance(string, []string, map[string]string) (string, error) {
+	return "", errStandalone
+}
+
+func (client *localClient) SubmitTaskStateChange(change api.TaskStateChange) error {
+	log.Info("Task state change", "task", change.TaskArn, "status", change.Status.String(), "reason", change.Reason)
+	return client.record(eventhandler.NewTaskStateChangeNotification(change))
+}
+
+func (client *localClient) SubmitContainerStateChange(change api.ContainerStateChange) error {
+	log.Info("Container state change", "change", change.String())
+	return client.record(eventhandler.NewContainerStateChangeNotification(change))
+}
+
+func (client *localClient) DiscoverPollEndpoint(string) (string, error) {
+	return "", errStandalone
+}
+
+func (client *localClient) DiscoverTelemetryEndpoint(string) (string, error) {
+	return "", errStandalone
+}
+
+// record appends a state change to the file. A change which can't be
+// recorded is only logged, since retrying it wouldn't help.
+func (client *localClient) record(notification eventhandler.StateChangeNotification) error {
+	if client.file == nil {
+		return nil
+	}
+	notification.Cluster = client.cluster
+	data, err := json.Marshal(notification)
+	if err == nil {
+		client.lock.Lock()
+		_, err = client.file.Write(append(data, '\n'))
+		client.lock.Unlock()
+	}
+	if err != nil {
+		log.Warn("Error recording state change", "task", notification.TaskArn, "err", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package standalone
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
+)
+
+func TestClientRecordsStateChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs_standalone_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.json")
+	client, err := NewClient("local", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.RegisterContainerInstance("", nil, nil); err == nil {
+		t.Error("Expected registration to fail in standalone mode")
+	}
+	exitCode := 0
+	client.SubmitContainerStateChange(api.ContainerStateChange{TaskArn: "arn:web", ContainerName: "nginx", Status: api.ContainerStopped, ExitCode: &exitCode})
+	client.SubmitTaskStateChange(api.TaskStateChange{TaskArn: "arn:web", Status: api.TaskStopped})
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var recorded []eventhandler.StateChangeNotification
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var notification eventhandler.StateChangeNotification
+		if err := json.Unmarshal(scanner.Bytes(), &notification); err != nil {
+			t.Fatal(err)
+		}
+		recorded = append(recorded, notification)
+	}
+	if len(recorded) != 2 {
+		t.Fatalf("Expected 2 state changes to be recorded, got %v", recorded)
+	}
+	if container := recorded[0]; container.Type != eventhandler.StateChangeTypeContainer || container.Cluster != "local" || container.ContainerName != "nginx" || container.ExitCode == nil {
+		t.Errorf("Recorded container change doesn't match: %+v", container)
+	}
+	if task := recorded[1]; task.Type != eventhandler.StateChangeTypeTask || task.TaskArn != "arn:web" || task.Status != "STOPPED" {
+		t.Errorf("Recorded task change doesn't match: %+v", task)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package standalone
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+	"golang.org/x/net/context"
+)
+
+const (
+	// taskDirPollInterval is how often the task directory is scanned for
+	// changes.
+	taskDirPollInterval = 5 * time.Second
+
+	// localTaskArnPrefix prefixes the name of a task file, without its
+	// extension, to make the arn of a task which doesn't have one.
+	localTaskArnPrefix = "arn:aws:ecs:local:000000000000:task/"
+)
+
+// TaskWatcher runs the tasks described by the JSON files in a directory, in
+// the api.Task format. A task is added to the task engine when its file
+// appears, and stopped when its file is deleted or its desired status is
+// changed to STOPPED. Other changes to a task file don't affect the running
+// task; a stopped task is started again by giving it a new arn, or a new
+// file name if the file doesn't set one.
+type TaskWatcher struct {
+	dir          string
+	taskEngine   engine.TaskEngine
+	pollInterval time.Duration
+
+	// files maps the names of the task files seen to what was last applied
+	// from them.
+	files map[string]*taskFile
+	// scanned is whether the directory was scanned once already.
+	scanned bool
+}
+
+type taskFile struct {
+	modTime       time.Time
+	size          int64
+	arn           string
+	desiredStatus api.TaskStatus
+}
+
+// NewTaskWatcher returns a watcher of the task files in dir.
+func NewTaskWatcher(dir string, taskEngine engine.TaskEngine) *TaskWatcher {
+	return &TaskWatcher{
+		dir:          dir,
+		taskEngine:   taskEngine,
+		pollInterval: taskDirPollInterval,
+		files:        make(map[string]*taskFile),
+	}
+}
+
+// Watch scans the directory for changes until ctx is done.
+func (watcher *TaskWatcher) Watch(ctx context.Context) {
+	log.Info("Watching for task files", "dir", watcher.dir)
+	for {
+		watcher.scan()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ttime.After(watcher.pollInterval):
+		}
+	}
+}
+
+// scan applies the changes to the task files since the last scan. On the
+// first scan, tasks the engine restored from a previous run whose files are
+// gone are stopped.
+func (watcher *TaskWatcher) scan() {
+	entries, err := ioutil.ReadDir(watcher.dir)
+	if err != nil {
+		log.Warn("Unable to read the task directory", "dir", watcher.dir, "err", err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		seen[name] = true
+
+		file, known := watcher.files[name]
+		if known && file.modTime.Equal(entry.ModTime()) && file.size == entry.Size() {
+			continue
+		}
+		if !known {
+			file = &taskFile{}
+			watcher.files[name] = file
+		}
+		file.modTime = entry.ModTime()
+		file.size = entry.Size()
+
+		task, err := ReadTaskFile(filepath.Join(watcher.dir, name))
+		if err != nil {
+			log.Warn("Unable to read task file; it will be read again once it changes", "file", name, "err", err)
+			continue
+		}
+		if file.arn != "" && file.arn != task.Arn {
+			if !file.desiredStatus.Terminal() {
+				log.Info("Task file now describes another task; stopping the previous one", "file", name, "arn", file.arn)
+				watcher.stopTask(file.arn)
+			}
+		} else if file.arn == task.Arn && file.desiredStatus == task.DesiredStatus {
+			log.Info("Task file changed; only changes to its desired status are applied to its task", "file", name, "arn", task.Arn)
+			continue
+		}
+		file.arn = task.Arn
+		file.desiredStatus = task.DesiredStatus
+		watcher.applyTask(name, task)
+	}
+
+	for name, file := range watcher.files {
+		if seen[name] {
+			continue
+		}
+		delete(watcher.files, name)
+		if file.arn != "" && !file.desiredStatus.Terminal() {
+			log.Info("Task file was deleted; stopping its task", "file", name, "arn", file.arn)
+			watcher.stopTask(file.arn)
+		}
+	}
+
+	if !watcher.scanned {
+		watcher.scanned = true
+		watcher.stopOrphans()
+	}
+}
+
+// applyTask adds a task to the engine, or updates the desired status of the
+// task with the same arn if there is one. A task which is already stopped
+// isn't added.
+func (watcher *TaskWatcher) applyTask(name string, task *api.Task) {
+	if task.DesiredStatus.Terminal() && !watcher.hasTask(task.Arn) {
+		log.Debug("Not adding a task which is stopped", "file", name, "arn", task.Arn)
+		return
+	}
+	log.Info("Applying task file", "file", name, "arn", task.Arn, "status", task.DesiredStatus.String())
+	err := watcher.taskEngine.AddTask(task)
+	if err != nil {
+		log.Warn("Error adding task", "file", name, "arn", task.Arn, "err", err)
+	}
+}
+
+// stopTask stops the task with the given arn if the engine has it.
+func (watcher *TaskWatcher) stopTask(arn string) {
+	if !watcher.hasTask(arn) {
+		return
+	}
+	err := watcher.taskEngine.AddTask(&api.Task{Arn: arn, DesiredStatus: api.TaskStopped})
+	if err != nil {
+		log.Warn("Error stopping task", "arn", arn, "err", err)
+	}
+}
+
+// stopOrphans stops the tasks of the engine which aren't described by a task
+// file.
+func (watcher *TaskWatcher) stopOrphans() {
+	arns := make(map[string]bool)
+	for _, file := range watcher.files {
+		arns[file.arn] = true
+	}
+	tasks, err := watcher.taskEngine.ListTasks()
+	if err != nil {
+		log.Warn("Unable to list tasks to stop those without a task file", "err", err)
+		return
+	}
+	for _, task := range tasks {
+		if !arns[task.Arn] && !task.DesiredStatus.Terminal() {
+			log.Info("Task file is gone; stopping its task", "arn", task.Arn)
+			watcher.stopTask(task.Arn)
+		}
+	}
+}
+
+func (watcher *TaskWatcher) hasTask(arn string) bool {
+	tasks, err := watcher.taskEngine.ListTasks()
+	if err != nil {
+		log.Warn("Unable to list tasks", "err", err)
+		return false
+	}
+	for _, task := range tasks {
+		if task.Arn == arn {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadTaskFile reads a task from a file. A task without an arn is given one
+// based on the file name, and a task without a desired status is run.
+func ReadTaskFile(path string) (*api.Task, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	task := &api.Task{}
+	err = json.Unmarshal(data, task)
+	if err != nil {
+		return nil, err
+	}
+	if task.Arn == "" {
+		task.Arn = localTaskArnPrefix + strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if task.DesiredStatus == api.TaskStatusNone {
+		task.DesiredStatus = api.TaskRunning
+	}
+	if len(task.Containers) == 0 && !task.DesiredStatus.Terminal() {
+		return nil, errors.New("task has no containers")
+	}
+	return task, nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package standalone
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+)
+
+const testTaskFile = `{"Family": "web", "Version": "1", "Containers": [{"Name": "nginx", "Image": "nginx:latest", "Essential": true}]}`
+
+// fakeTaskEngine records the tasks added to it, keeping the first one added
+// for each arn like the real engine does.
+type fakeTaskEngine struct {
+	engine.TaskEngine
+	added []*api.Task
+	tasks []*api.Task
+}
+
+func (taskEngine *fakeTaskEngine) AddTask(task *api.Task) error {
+	taskEngine.added = append(taskEngine.added, task)
+	for _, existing := range taskEngine.tasks {
+		if existing.Arn == task.Arn {
+			if task.DesiredStatus > existing.DesiredStatus {
+				existing.DesiredStatus = task.DesiredStatus
+			}
+			return nil
+		}
+	}
+	taskEngine.tasks = append(taskEngine.tasks, task)
+	return nil
+}
+
+func (taskEngine *fakeTaskEngine) ListTasks() ([]*api.Task, error) {
+	return taskEngine.tasks, nil
+}
+
+// lastAdded returns the arn and desired status of the last task added, and
+// forgets the tasks added so far.
+func (taskEngine *fakeTaskEngine) lastAdded(t *testing.T) (string, api.TaskStatus) {
+	if len(taskEngine.added) != 1 {
+		t.Fatalf("Expected a single task to be added, got %v", taskEngine.added)
+	}
+	task := taskEngine.added[0]
+	taskEngine.added = nil
+	return task.Arn, task.DesiredStatus
+}
+
+// writeTaskFile writes a task file with a modification time in the past, so
+// that rewriting it is noticed even within the resolution of the filesystem.
+func writeTaskFile(t *testing.T, path, data string, age time.Duration) {
+	err := ioutil.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-age)
+	err = os.Chtimes(path, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTaskWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs_standalone_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	taskEngine := &fakeTaskEngine{}
+	watcher := NewTaskWatcher(dir, taskEngine)
+	path := filepath.Join(dir, "web.json")
+	writeTaskFile(t, path, testTaskFile, time.Hour)
+	ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a task"), 0644)
+
+	watcher.scan()
+	arn, status := taskEngine.lastAdded(t)
+	if arn != localTaskArnPrefix+"web" || status != api.TaskRunning {
+		t.Errorf("Expected the task to be run with an arn from its file name, got %s %s", arn, status.String())
+	}
+	if len(taskEngine.tasks[0].Containers) != 1 || taskEngine.tasks[0].Containers[0].Image != "nginx:latest" {
+		t.Errorf("Task doesn't match its file: %v", taskEngine.tasks[0])
+	}
+
+	// Nothing changed
+	watcher.scan()
+	if len(taskEngine.added) != 0 {
+		t.Errorf("Expected no task to be added again, got %v", taskEngine.added)
+	}
+
+	writeTaskFile(t, path, `{"DesiredStatus": "STOPPED", "Containers": []}`, time.Minute)
+	watcher.scan()
+	if arn, status := taskEngine.lastAdded(t); arn != localTaskArnPrefix+"web" || status != api.TaskStopped {
+		t.Errorf("Expected the task to be stopped, got %s %s", arn, status.String())
+	}
+
+	// A new task is started from a file, then stopped once the file is deleted
+	writeTaskFile(t, path, `{"Arn": "arn:web-2", "Containers": [{"Name": "nginx", "Image": "nginx:latest"}]}`, 0)
+	watcher.scan()
+	if arn, status := taskEngine.lastAdded(t); arn != "arn:web-2" || status != api.TaskRunning {
+		t.Errorf("Expected the new task to be run, got %s %s", arn, status.String())
+	}
+	os.Remove(path)
+	watcher.scan()
+	if arn, status := taskEngine.lastAdded(t); arn != "arn:web-2" || status != api.TaskStopped {
+		t.Errorf("Expected the task of the deleted file to be stopped, got %s %s", arn, status.String())
+	}
+}
+
+func TestTaskWatcherStopsOrphans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs_standalone_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The engine restored both tasks, but only one file is left
+	taskEngine := &fakeTaskEngine{tasks: []*api.Task{
+		{Arn: localTaskArnPrefix + "web", DesiredStatus: api.TaskRunning},
+		{Arn: localTaskArnPrefix + "gone", DesiredStatus: api.TaskRunning},
+	}}
+	writeTaskFile(t, filepath.Join(dir, "web.json"), testTaskFile, 0)
+
+	NewTaskWatcher(dir, taskEngine).scan()
+	if len(taskEngine.added) != 2 {
+		t.Fatalf("Expected the existing task to be updated and the orphan stopped, got %v", taskEngine.added)
+	}
+	if orphan := taskEngine.added[1]; orphan.Arn != localTaskArnPrefix+"gone" || orphan.DesiredStatus != api.TaskStopped {
+		t.Errorf("Expected the task without a file to be stopped, got %v", orphan)
+	}
+}
+
+func TestTaskWatcherInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs_standalone_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	taskEngine := &fakeTaskEngine{}
+	watcher := NewTaskWatcher(dir, taskEngine)
+	path := filepath.Join(dir, "web.json")
+	writeTaskFile(t, path, `{"Family": `, time.Hour)
+	watcher.scan()
+	writeTaskFile(t, filepath.Join(dir, "empty.json"), `{}`, time.Hour)
+	watcher.scan()
+	if len(taskEngine.added) != 0 {
+		t.Fatalf("Expected invalid task files not to be applied, got %v", taskEngine.added)
+	}
+
+	// The file is read again once it's fixed
+	writeTaskFile(t, path, testTaskFile, 0)
+	watcher.scan()
+	if arn, _ := taskEngine.lastAdded(t); arn != localTaskArnPrefix+"web" {
+		t.Errorf("Expected the fixed task file to be applied, got %s", arn)
+	}
+}
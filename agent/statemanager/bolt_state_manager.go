@@ -0,0 +1,394 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package statemanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/boltdb/bolt"
+)
+
+// Filename of the state database in the ECS_DATADIR
+const ecsDatabaseFile = "ecs_agent_data.db"
+
+// The state file is renamed with this suffix once it's imported into the
+// database, so that it isn't imported again
+const importedSuffix = ".imported"
+
+// How long to wait for another process to close the database before giving up
+const databaseOpenTimeout = 10 * time.Second
+
+// Buckets of the database. The version of the data is kept in the meta
+// bucket, each saveable in the saveables bucket, and the records of each
+// RecordSaveable in a bucket of its own in the records bucket.
+var (
+	metaBucket      = []byte("meta")
+	saveablesBucket = []byte("saveables")
+	recordsBucket   = []byte("records")
+
+	versionKey = []byte("Version")
+)
+
+// RecordSaveable is a Saveable made of records which change independently,
+// such as the tasks and containers of the task engine. The bolt state manager
+// saves each record under its own key, and only writes the ones that changed.
+type RecordSaveable interface {
+	// SaveRecords returns the JSON of every record by a key unique to it
+	SaveRecords() (map[string][]byte, error)
+	// LoadRecords restores the saveable from records returned by SaveRecords
+	LoadRecords(records map[string][]byte) error
+}
+
+type boltStateManager struct {
+	dataDir string
+	db      *bolt.DB
+
+	// legacy holds the saveables; it loads them from the state file saved
+	// before the database was used, to import it
+	legacy *basicStateManager
+
+	saveScheduler
+
+	savingLock sync.Mutex // guards saved and writes to the database
+	// savedSaveables and savedRecords hold what's in the database, so that
+	// only what changed is written
+	savedSaveables map[string][]byte
+	savedRecords   map[string]map[string][]byte
+	savedVersion   int // the version of the data in the database; 0 if empty
+	// reencrypt is true if what's in the database isn't all encrypted with
+	// the current key, so that the next save writes everything
+	reencrypt bool
+
+	saveStatusRecorder
+}
+
+// NewBoltStateManager constructs a StateManager which saves data to a bolt
+// database in the data dir in cfg, with each record of a RecordSaveable in its
+// own key. Saves are transactional and only write what changed since the last
+// one. If the database is empty, Load imports the state file saved by
+// the StateManager returned by NewStateManager.
+// Like it, the returned StateManager will not save more often than every 10
+// seconds. It holds a lock on the database until it's closed.
+func NewBoltStateManager(cfg *config.Config, options ...Option) (StateManager, error) {
+	legacy, err := NewStateManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filepath.Join(cfg.DataDir, ecsDatabaseFile), 0600, &bolt.Options{Timeout: databaseOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	manager := &boltStateManager{
+		dataDir:        cfg.DataDir,
+		db:             db,
+		legacy:         legacy.(*basicStateManager),
+		savedSaveables: make(map[string][]byte),
+		savedRecords:   make(map[string]map[string][]byte),
+	}
+	err = manager.readDatabase()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	for _, option := range options {
+		option(manager)
+	}
+
+	return manager, nil
+}
+
+// readDatabase creates the buckets of the database and reads what's in it.
+func (manager *boltStateManager) readDatabase() error {
+	return manager.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{metaBucket, saveablesBucket, recordsBucket} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+
+		if version := tx.Bucket(metaBucket).Get(versionKey); version != nil {
+			savedVersion, err := strconv.Atoi(string(version))
+			if err != nil {
+				return errors.New("Could not read the version of the state database: " + err.Error())
+			}
+			manager.savedVersion = savedVersion
+		}
+		err := tx.Bucket(saveablesBucket).ForEach(func(name, data []byte) error {
+			plaintext, err := manager.decryptValue(data, saveablesBucket, name)
+			manager.savedSaveables[string(name)] = plaintext
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(recordsBucket).ForEach(func(name, _ []byte) error {
+			records := make(map[string][]byte)
+			bucketName := append(append(copyBytes(recordsBucket), '/'), name...)
+			err := tx.Bucket(recordsBucket).Bucket(name).ForEach(func(key, data []byte) error {
+				plaintext, err := manager.decryptValue(data, bucketName, key)
+				records[string(key)] = plaintext
+				return err
+			})
+			manager.savedRecords[string(name)] = records
+			return err
+		})
+	})
+}
+
+// decryptValue returns the plaintext of a value read from the database,
+// copied as values are only valid during the transaction.
+func (manager *boltStateManager) decryptValue(value, bucketName, key []byte) ([]byte, error) {
+	plaintext, reencrypt, err := manager.legacy.keys.decryptValue(value, string(bucketName)+"/"+string(key))
+	if err != nil {
+		return nil, err
+	}
+	if reencrypt {
+		manager.reencrypt = true
+	}
+	return copyBytes(plaintext), nil
+}
+
+func (manager *boltStateManager) addSaveable(name string, saveable Saveable) {
+	manager.legacy.addSaveable(name, saveable)
+}
+
+// Save triggers a save to the database, though respects a minimum save
+// interval to wait between saves.
+func (manager *boltStateManager) Save() error {
+	return manager.saveScheduler.save(manager.ForceSave)
+}
+
+// ForceSave writes the saveables and records which changed since the last
+// save to the database in a single transaction, so either all of them are
+// saved or none are.
+// Like the StateManager returned by NewStateManager, it logs errors and
+// doesn't expect the caller to do anything about them.
+func (manager *boltStateManager) ForceSave() error {
+	manager.savingLock.Lock()
+	defer manager.savingLock.Unlock()
+	return manager.saveStatusRecorder.measureSave(manager.forceSave)
+}
+
+// forceSave does the work of ForceSave; it must be called with the savingLock
+// held.
+func (manager *boltStateManager) forceSave() error {
+	log.Info("Saving state!")
+	saveables := make(map[string][]byte)
+	records := make(map[string]map[string][]byte)
+	for name, saveable := range manager.legacy.state.Data {
+		if recordSaveable, ok := asRecordSaveable(saveable); ok {
+			saveableRecords, err := recordSaveable.SaveRecords()
+			if err != nil {
+				log.Error("Error saving state; could not marshal records", "saveable", name, "err", err)
+				return err
+			}
+			records[name] = saveableRecords
+			continue
+		}
+		data, err := json.Marshal(saveable)
+		if err != nil {
+			log.Error("Error saving state; could not marshal data", "saveable", name, "err", err)
+			return err
+		}
+		saveables[name] = data
+	}
+
+	written := 0
+	err := manager.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(metaBucket).Put(versionKey, []byte(strconv.Itoa(EcsDataVersion)))
+		if err != nil {
+			return err
+		}
+		written, err = manager.putChanged(tx.Bucket(saveablesBucket), string(saveablesBucket), manager.savedSaveables, saveables)
+		if err != nil {
+			return err
+		}
+		for name, saveableRecords := range records {
+			bucket, err := tx.Bucket(recordsBucket).CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+			changed, err := manager.putChanged(bucket, string(recordsBucket)+"/"+name, manager.savedRecords[name], saveableRecords)
+			if err != nil {
+				return err
+			}
+			written += changed
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("Error saving state; could not write to the database", "err", err)
+		return err
+	}
+
+	manager.savedVersion = EcsDataVersion
+	manager.reencrypt = false
+	for name, data := range saveables {
+		manager.savedSaveables[name] = data
+	}
+	for name, saveableRecords := range records {
+		manager.savedRecords[name] = saveableRecords
+	}
+	log.Debug("Saved state", "changes", written)
+	return nil
+}
+
+// putChanged writes the values in current which differ from the ones in saved
+// to bucket, and deletes the keys which are only in saved. It returns the
+// number of keys written or deleted. Everything is written if it needs to be
+// encrypted again.
+func (manager *boltStateManager) putChanged(bucket *bolt.Bucket, bucketName string, saved, current map[string][]byte) (int, error) {
+	changed := 0
+	for key, data := range current {
+		savedData, ok := saved[key]
+		if ok && bytes.Equal(savedData, data) && !manager.reencrypt {
+			continue
+		}
+		value, err := manager.legacy.keys.encryptValue(data, bucketName+"/"+key)
+		if err != nil {
+			return changed, err
+		}
+		err = bucket.Put([]byte(key), value)
+		if err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	for key := range saved {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		err := bucket.Delete([]byte(key))
+		if err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// Load restores the saveables from the database. If nothing was saved to it
+// yet, the state file in the data dir is imported instead.
+func (manager *boltStateManager) Load() error {
+	manager.savingLock.Lock()
+	defer manager.savingLock.Unlock()
+	log.Info("Loading state!")
+	if manager.savedVersion == 0 {
+		return manager.importStateFile()
+	}
+	if manager.savedVersion != EcsDataVersion {
+		// The state file migrations work on whole files; the database only
+		// exists since version 4
+		return errors.New("Unsupported data format: Version " + strconv.Itoa(manager.savedVersion) + " not " + strconv.Itoa(EcsDataVersion))
+	}
+
+	for name, data := range manager.savedSaveables {
+		actualPointer, ok := manager.legacy.state.Data[name]
+		if !ok {
+			log.Error("Loading state: potentially malformed json key of " + name)
+			continue
+		}
+		err := json.Unmarshal(data, actualPointer)
+		if err != nil {
+			log.Error("Could not load saveable", "saveable", name, "err", err)
+			return err
+		}
+	}
+	for name, records := range manager.savedRecords {
+		actualPointer, ok := manager.legacy.state.Data[name]
+		if !ok {
+			log.Error("Loading state: unknown records of " + name)
+			continue
+		}
+		recordSaveable, ok := asRecordSaveable(actualPointer)
+		if !ok {
+			return errors.New("Could not load state; records were saved for " + name + ", which can't load them")
+		}
+		err := recordSaveable.LoadRecords(records)
+		if err != nil {
+			log.Error("Could not load records", "saveable", name, "err", err)
+			return err
+		}
+	}
+
+	log.Debug("Loaded state!")
+	return nil
+}
+
+// importStateFile loads the state file saved by the StateManager returned by
+// NewStateManager, if there's one, and saves it to the database. It must be
+// called with the savingLock held.
+func (manager *boltStateManager) importStateFile() error {
+	stateFile := filepath.Join(manager.dataDir, ecsDataFile)
+	if _, err := os.Stat(stateFile); os.IsNotExist(err) {
+		return nil
+	}
+	log.Info("Importing the state file into the state database", "file", stateFile)
+	err := manager.legacy.Load()
+	if err != nil {
+		return err
+	}
+	err = manager.saveStatusRecorder.measureSave(manager.forceSave)
+	if err != nil {
+		return err
+	}
+	if manager.legacy.keys.encrypting() {
+		// Keeping the state file would keep what's encrypted on disk
+		log.Info("Removing the imported state file, as state is encrypted", "file", stateFile)
+		for generation := 0; generation <= stateFileGenerations; generation++ {
+			os.Remove(manager.legacy.generationPath(generation))
+		}
+		return nil
+	}
+	err = os.Rename(stateFile, stateFile+importedSuffix)
+	if err != nil {
+		// It won't be imported again now that the database has been saved to
+		log.Warn("Could not rename the imported state file", "file", stateFile, "err", err)
+	}
+	return nil
+}
+
+// Close releases the database, so that another StateManager can open it.
+func (manager *boltStateManager) Close() error {
+	return manager.db.Close()
+}
+
+// asRecordSaveable returns the saveable as a RecordSaveable if it is one, or
+// is a pointer to an interface holding one.
+func asRecordSaveable(saveable *Saveable) (RecordSaveable, bool) {
+	if recordSaveable, ok := (*saveable).(RecordSaveable); ok {
+		return recordSaveable, true
+	}
+	value := reflect.ValueOf(*saveable)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Interface {
+		return nil, false
+	}
+	recordSaveable, ok := value.Elem().Interface().(RecordSaveable)
+	return recordSaveable, ok
+}
+
+func copyBytes(data []byte) []byte {
+	return append([]byte(nil), data...)
+}
@@ -0,0 +1,173 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package statemanager_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/statemanager"
+	"github.com/boltdb/bolt"
+)
+
+// boltState is what the agent saves, loaded from a bolt state manager.
+type boltState struct {
+	manager    statemanager.StateManager
+	taskEngine engine.TaskEngine
+	cluster    string
+	seqNum     int64
+}
+
+func openBoltState(t *testing.T, dir string) *boltState {
+	state := &boltState{taskEngine: engine.NewTaskEngine(&config.Config{}, false)}
+	var containerInstanceArn, savedInstanceID string
+	manager, err := statemanager.NewBoltStateManager(&config.Config{DataDir: dir},
+		statemanager.AddSaveable("TaskEngine", state.taskEngine),
+		statemanager.AddSaveable("ContainerInstanceArn", &containerInstanceArn),
+		statemanager.AddSaveable("Cluster", &state.cluster),
+		statemanager.AddSaveable("EC2InstanceID", &savedInstanceID),
+		statemanager.AddSaveable("ACSSeqNum", &state.seqNum),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.manager = manager
+	err = manager.Load()
+	if err != nil {
+		t.Fatalf("Error loading state: %v", err)
+	}
+	return state
+}
+
+func (state *boltState) close() {
+	state.manager.(io.Closer).Close()
+}
+
+func (state *boltState) tasks() []*api.Task {
+	tasks, _ := state.taskEngine.ListTasks()
+	return tasks
+}
+
+func TestBoltImportsStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs_statemanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "ecs_agent_data.json")
+	ioutil.WriteFile(stateFile, readFixture(t, 2), 0600)
+
+	state := openBoltState(t, dir)
+	if len(state.tasks()) != 3 || state.cluster != "test" || state.seqNum != 42 {
+		t.Errorf("Wrong state imported: %d tasks, cluster %q, sequence number %d", len(state.tasks()), state.cluster, state.seqNum)
+	}
+	state.close()
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Error("Expected the state file to be moved aside once imported")
+	}
+	if _, err := os.Stat(stateFile + ".imported"); err != nil {
+		t.Errorf("Expected the imported state file to be kept: %v", err)
+	}
+
+	state = openBoltState(t, dir)
+	defer state.close()
+	if len(state.tasks()) != 3 || state.cluster != "test" || state.seqNum != 42 {
+		t.Errorf("Wrong state loaded: %d tasks, cluster %q, sequence number %d", len(state.tasks()), state.cluster, state.seqNum)
+	}
+	if nginxContainer(t, state.taskEngine).KnownStatus != api.ContainerStopped {
+		t.Error("Expected the container to be loaded with its status")
+	}
+}
+
+func TestBoltSavesChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs_statemanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	state := openBoltState(t, dir)
+	if len(state.tasks()) != 0 {
+		t.Fatal("Expected an empty state without a database or state file")
+	}
+	dockerState := state.taskEngine.(*engine.DockerTaskEngine).State()
+	for _, arn := range []string{"arn1", "arn2"} {
+		task := &api.Task{Arn: arn, Containers: []*api.Container{{Name: "c"}}}
+		dockerState.AddTask(task)
+		dockerState.AddContainer(&api.DockerContainer{DockerId: arn + "-id", DockerName: "d", Container: task.Containers[0]}, task)
+	}
+	state.cluster = "cluster"
+	err = state.manager.ForceSave()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task1, _ := dockerState.TaskByArn("arn1")
+	task1.Containers[0].KnownStatus = api.ContainerRunning
+	task2, _ := dockerState.TaskByArn("arn2")
+	dockerState.RemoveTask(task2)
+	err = state.manager.ForceSave()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.close()
+
+	state = openBoltState(t, dir)
+	defer state.close()
+	tasks := state.tasks()
+	if len(tasks) != 1 || tasks[0].Arn != "arn1" || state.cluster != "cluster" {
+		t.Fatalf("Wrong state loaded: %v, cluster %q", tasks, state.cluster)
+	}
+	container, ok := state.taskEngine.(*engine.DockerTaskEngine).State().ContainerById("arn1-id")
+	if !ok || container.Container != tasks[0].Containers[0] {
+		t.Error("Expected the container to be loaded as the container of its task")
+	}
+	if tasks[0].Containers[0].KnownStatus != api.ContainerRunning {
+		t.Errorf("Expected the change to the container to be saved, got %s", tasks[0].Containers[0].KnownStatus.String())
+	}
+}
+
+func TestBoltRefusesNewerVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs_statemanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "ecs_agent_data.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Update(func(tx *bolt.Tx) error {
+		meta, _ := tx.CreateBucket([]byte("meta"))
+		return meta.Put([]byte("Version"), []byte("99"))
+	})
+	db.Close()
+
+	manager, err := statemanager.NewBoltStateManager(&config.Config{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.(io.Closer).Close()
+	err = manager.Load()
+	if err == nil || !strings.Contains(err.Error(), "Version 99") {
+		t.Errorf("Expected an error loading a newer database, got %v", err)
+	}
+}
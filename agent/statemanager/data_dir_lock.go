@@ -0,0 +1,70 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package statemanager
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Filename of the lock file in the ECS_DATADIR
+const lockFile = "ecs_agent_data.lock"
+
+// DataDirLock is an exclusive lock on a data dir. An agent holds it while it
+// runs so that another agent can't save state to the same data dir.
+type DataDirLock struct {
+	file *os.File
+}
+
+// LockDataDir takes the lock on a data dir. It fails rather than waiting if
+// another process holds the lock; the pid of that process is in the error.
+func LockDataDir(dataDir string) (*DataDirLock, error) {
+	path := filepath.Join(dataDir, lockFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		holder, _ := ioutil.ReadAll(file)
+		file.Close()
+		return nil, errors.New("The data dir " + dataDir + " is in use by another agent (pid " + strings.TrimSpace(string(holder)) + ")")
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// The pid is only informational; an error writing it isn't worth failing
+	// over since the lock is held
+	err = file.Truncate(0)
+	if err == nil {
+		_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		log.Warn("Could not write the pid to the data dir lock file", "err", err)
+	}
+	return &DataDirLock{file: file}, nil
+}
+
+// Unlock releases the lock. The lock file is left in place, as removing it
+// could let two agents lock different files.
+func (lock *DataDirLock) Unlock() error {
+	return lock.file.Close()
+}
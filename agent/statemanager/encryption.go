@@ -0,0 +1,225 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package statemanager
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+)
+
+// Size of the keys state is encrypted with, for AES-256
+const stateKeySize = 32
+
+// How long the key command may run for
+const stateKeyCommandTimeout = 30 * time.Second
+
+// Encrypted values in the state database start with this, followed by the id
+// of the key and a colon. JSON never starts with it, so unencrypted values
+// can be told apart.
+const encryptedValuePrefix = "enc:"
+
+// stateKey is a key state is encrypted with. Its id is derived from the key,
+// so that what it encrypted can be matched to it without the key being saved.
+type stateKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// stateKeys are the keys configured to encrypt state with. The first one
+// encrypts, and all of them decrypt, so that state saved before the keys were
+// rotated can be loaded and re-encrypted with the new key on the next save.
+// State isn't encrypted if there are none.
+type stateKeys []stateKey
+
+// keyError is returned when state was encrypted with a key which isn't
+// configured. Older generations of the state aren't loaded instead, as
+// they'd be encrypted with the same key or the state in them would be lost.
+type keyError string
+
+func (err keyError) Error() string {
+	return string(err)
+}
+
+// loadStateKeys reads the keys to encrypt state with from the key file or
+// command in cfg.
+func loadStateKeys(cfg *config.Config) (stateKeys, error) {
+	if cfg.StateEncryptionKeyFile != "" {
+		data, err := ioutil.ReadFile(cfg.StateEncryptionKeyFile)
+		if err != nil {
+			return nil, errors.New("Could not read the state encryption key file: " + err.Error())
+		}
+		return parseStateKeys(data, cfg.StateEncryptionKeyFile)
+	}
+	if cfg.StateEncryptionKeyCmd != "" {
+		data, err := runKeyCommand(cfg.StateEncryptionKeyCmd)
+		if err != nil {
+			return nil, errors.New("Could not get the state encryption keys from the key command: " + err.Error())
+		}
+		return parseStateKeys(data, "the key command")
+	}
+	return nil, nil
+}
+
+// runKeyCommand runs command and returns what it printed.
+func runKeyCommand(command string) ([]byte, error) {
+	args := strings.Fields(command)
+	cmd := exec.Command(args[0], args[1:]...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(stateKeyCommandTimeout):
+		cmd.Process.Kill()
+		<-done
+		return nil, errors.New("timed out after " + stateKeyCommandTimeout.String())
+	}
+	if err != nil {
+		return nil, errors.New(err.Error() + ": " + strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseStateKeys parses one base64 encoded key per line. Blank lines and
+// lines starting with # are skipped.
+func parseStateKeys(data []byte, source string) (stateKeys, error) {
+	var keys stateKeys
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(text)
+		if err != nil || len(key) != stateKeySize {
+			// The key isn't in the error, as it would end up in the logs
+			return nil, errors.New("Invalid state encryption key on line " + strconv.Itoa(line) + " of " + source + "; expected 32 bytes encoded in base64")
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(key)
+		keys = append(keys, stateKey{id: hex.EncodeToString(sum[:8]), aead: aead})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("No state encryption keys in " + source)
+	}
+	return keys, nil
+}
+
+// encrypting returns true if state is encrypted.
+func (keys stateKeys) encrypting() bool {
+	return len(keys) > 0
+}
+
+// currentID returns the id of the key state is encrypted with.
+func (keys stateKeys) currentID() string {
+	if !keys.encrypting() {
+		return ""
+	}
+	return keys[0].id
+}
+
+// encrypt encrypts plaintext with the current key, authenticating it along
+// with name so that it can't be passed off as something else. The nonce is
+// prepended to what's returned.
+func (keys stateKeys) encrypt(plaintext []byte, name string) ([]byte, error) {
+	aead := keys[0].aead
+	nonce := make([]byte, aead.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(name)), nil
+}
+
+// decrypt decrypts what encrypt returned using the key with the given id.
+func (keys stateKeys) decrypt(ciphertext []byte, keyID string, name string) ([]byte, error) {
+	if !keys.encrypting() {
+		return nil, keyError("The state is encrypted with key " + keyID + ", but no state encryption key is configured; set ECS_STATE_ENCRYPTION_KEY_FILE or ECS_STATE_ENCRYPTION_KEY_COMMAND")
+	}
+	for _, key := range keys {
+		if key.id != keyID {
+			continue
+		}
+		nonceSize := key.aead.NonceSize()
+		if len(ciphertext) < nonceSize {
+			return nil, errors.New("the encrypted state is too short; corrupted data")
+		}
+		plaintext, err := key.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], []byte(name))
+		if err != nil {
+			return nil, errors.New("the encrypted state can't be decrypted; corrupted data")
+		}
+		return plaintext, nil
+	}
+	return nil, keyError("The state is encrypted with key " + keyID + ", which isn't among the configured state encryption keys")
+}
+
+// encryptValue encrypts a value of the state database, if state is
+// encrypted, prefixing it with the id of the key.
+func (keys stateKeys) encryptValue(value []byte, name string) ([]byte, error) {
+	if !keys.encrypting() {
+		return value, nil
+	}
+	ciphertext, err := keys.encrypt(value, name)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(encryptedValuePrefix+keys.currentID()+":"), ciphertext...), nil
+}
+
+// decryptValue decrypts a value returned by encryptValue. It returns whether
+// the value should be encrypted again, because it isn't encrypted with the
+// current key.
+func (keys stateKeys) decryptValue(value []byte, name string) ([]byte, bool, error) {
+	if !bytes.HasPrefix(value, []byte(encryptedValuePrefix)) {
+		return value, keys.encrypting(), nil
+	}
+	value = value[len(encryptedValuePrefix):]
+	separator := bytes.IndexByte(value, ':')
+	if separator < 0 {
+		return nil, false, errors.New("the encrypted value of " + name + " has no key id; corrupted data")
+	}
+	keyID := string(value[:separator])
+	plaintext, err := keys.decrypt(value[separator+1:], keyID, name)
+	return plaintext, keyID != keys.currentID(), err
+}
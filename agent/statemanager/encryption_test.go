@@ -0,0 +1,264 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package statemanager_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/statemanager"
+)
+
+const (
+	secretEnvironmentValue = "s3cr3t-environment-value"
+	secretDockerConfig     = "s3cr3t-docker-config"
+)
+
+func newStateKey(t *testing.T) string {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(rand.Reader, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// encryptionTest is a data dir with a key file.
+type encryptionTest struct {
+	t       *testing.T
+	dir     string
+	keyFile string
+}
+
+func newEncryptionTest(t *testing.T) *encryptionTest {
+	dir, err := ioutil.TempDir("", "ecs_statemanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &encryptionTest{t: t, dir: dir, keyFile: filepath.Join(dir, "keys")}
+}
+
+func (test *encryptionTest) close() {
+	os.RemoveAll(test.dir)
+}
+
+func (test *encryptionTest) setKeys(keys ...string) {
+	ioutil.WriteFile(test.keyFile, []byte("# The first key encrypts\n"+strings.Join(keys, "\n")+"\n"), 0600)
+}
+
+func (test *encryptionTest) config(store string) *config.Config {
+	return &config.Config{DataDir: test.dir, StateStore: store, StateEncryptionKeyFile: test.keyFile}
+}
+
+func newManager(cfg *config.Config, options ...statemanager.Option) (statemanager.StateManager, error) {
+	if cfg.StateStore == config.StateStoreBoltDB {
+		return statemanager.NewBoltStateManager(cfg, options...)
+	}
+	return statemanager.NewStateManager(cfg, options...)
+}
+
+// save saves a task with secrets in its environment and docker config.
+func (test *encryptionTest) save(cfg *config.Config) {
+	taskEngine := engine.NewTaskEngine(&config.Config{}, false)
+	dockerConfig := secretDockerConfig
+	task := &api.Task{Arn: "arn", Containers: []*api.Container{{
+		Name:         "c",
+		Environment:  map[string]string{"PASSWORD": secretEnvironmentValue},
+		DockerConfig: api.DockerConfig{Config: &dockerConfig},
+	}}}
+	taskEngine.(*engine.DockerTaskEngine).State().AddTask(task)
+	manager, err := newManager(cfg, statemanager.AddSaveable("TaskEngine", taskEngine))
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	err = manager.ForceSave()
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	if closer, ok := manager.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// load loads the task saved by save.
+func (test *encryptionTest) load(cfg *config.Config) (*api.Task, error) {
+	taskEngine := engine.NewTaskEngine(&config.Config{}, false)
+	manager, err := newManager(cfg, statemanager.AddSaveable("TaskEngine", taskEngine))
+	if err != nil {
+		return nil, err
+	}
+	err = manager.Load()
+	if closer, ok := manager.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	task, _ := taskEngine.(*engine.DockerTaskEngine).State().TaskByArn("arn")
+	return task, nil
+}
+
+func (test *encryptionTest) assertLoads(cfg *config.Config) {
+	task, err := test.load(cfg)
+	if err != nil {
+		test.t.Fatalf("Error loading encrypted state: %v", err)
+	}
+	if task == nil || task.Containers[0].Environment["PASSWORD"] != secretEnvironmentValue || *task.Containers[0].DockerConfig.Config != secretDockerConfig {
+		test.t.Errorf("Expected the task to be loaded with its secrets, got %v", task)
+	}
+}
+
+// assertNoSecrets checks that no file in the data dir has the secrets in it.
+func (test *encryptionTest) assertNoSecrets() {
+	files, _ := ioutil.ReadDir(test.dir)
+	for _, file := range files {
+		data, _ := ioutil.ReadFile(filepath.Join(test.dir, file.Name()))
+		if bytes.Contains(data, []byte(secretEnvironmentValue)) || bytes.Contains(data, []byte(secretDockerConfig)) {
+			test.t.Errorf("Found a secret in %s", file.Name())
+		}
+	}
+}
+
+// keyID returns the id of the key the state file is encrypted with.
+func (test *encryptionTest) keyID() string {
+	data, _ := ioutil.ReadFile(filepath.Join(test.dir, "ecs_agent_data.json"))
+	var saved struct{ KeyID string }
+	json.Unmarshal(data, &saved)
+	return saved.KeyID
+}
+
+func TestEncryptedStateHasNoSecrets(t *testing.T) {
+	for _, store := range []string{config.StateStoreJSON, config.StateStoreBoltDB} {
+		test := newEncryptionTest(t)
+		test.setKeys(newStateKey(t))
+		cfg := test.config(store)
+		test.save(cfg)
+		test.assertNoSecrets()
+		test.assertLoads(cfg)
+		test.close()
+	}
+}
+
+func TestEncryptingPlaintextState(t *testing.T) {
+	for _, store := range []string{config.StateStoreJSON, config.StateStoreBoltDB} {
+		test := newEncryptionTest(t)
+		plaintext := &config.Config{DataDir: test.dir, StateStore: config.StateStoreJSON}
+		test.save(plaintext)
+		test.save(plaintext)
+
+		test.setKeys(newStateKey(t))
+		cfg := test.config(store)
+		test.assertLoads(cfg)
+		test.save(cfg)
+		test.assertNoSecrets()
+		test.assertLoads(cfg)
+		test.close()
+	}
+}
+
+func TestStateKeyRotation(t *testing.T) {
+	for _, store := range []string{config.StateStoreJSON, config.StateStoreBoltDB} {
+		test := newEncryptionTest(t)
+		oldKey, newKey := newStateKey(t), newStateKey(t)
+		test.setKeys(oldKey)
+		cfg := test.config(store)
+		test.save(cfg)
+		oldKeyID := test.keyID()
+
+		// Loading with the new key first re-encrypts with it on the next
+		// save, after which the old key isn't needed
+		test.setKeys(newKey, oldKey)
+		test.assertLoads(cfg)
+		manager, err := newManager(cfg, statemanager.AddSaveable("TaskEngine", engine.NewTaskEngine(&config.Config{}, false)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		manager.Load()
+		manager.ForceSave()
+		if closer, ok := manager.(io.Closer); ok {
+			closer.Close()
+		}
+		if store == config.StateStoreJSON && test.keyID() == oldKeyID {
+			t.Error("Expected the state to be encrypted with the new key")
+		}
+
+		test.setKeys(newKey)
+		test.assertLoads(cfg)
+
+		test.setKeys(oldKey)
+		_, err = test.load(cfg)
+		if err == nil || !strings.Contains(err.Error(), "isn't among the configured state encryption keys") {
+			t.Errorf("Expected an error loading state encrypted with a key that isn't configured, got %v", err)
+		}
+		test.close()
+	}
+}
+
+func TestMissingStateKey(t *testing.T) {
+	for _, store := range []string{config.StateStoreJSON, config.StateStoreBoltDB} {
+		test := newEncryptionTest(t)
+		test.setKeys(newStateKey(t))
+		test.save(test.config(store))
+
+		_, err := test.load(&config.Config{DataDir: test.dir, StateStore: store})
+		if err == nil || !strings.Contains(err.Error(), "no state encryption key is configured") {
+			t.Errorf("Expected an error loading encrypted state without a key, got %v", err)
+		}
+
+		os.Remove(test.keyFile)
+		_, err = newManager(test.config(store))
+		if err == nil || !strings.Contains(err.Error(), "state encryption key file") {
+			t.Errorf("Expected an error creating a state manager with a missing key file, got %v", err)
+		}
+		test.close()
+	}
+}
+
+func TestInvalidStateKeys(t *testing.T) {
+	test := newEncryptionTest(t)
+	defer test.close()
+	for _, keys := range []string{"", "not base64", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		ioutil.WriteFile(test.keyFile, []byte(keys), 0600)
+		_, err := newManager(test.config(config.StateStoreJSON))
+		if err == nil {
+			t.Errorf("Expected an error with the keys %q", keys)
+		}
+	}
+}
+
+func TestStateKeyCommand(t *testing.T) {
+	test := newEncryptionTest(t)
+	defer test.close()
+	test.setKeys(newStateKey(t))
+	cfg := &config.Config{DataDir: test.dir, StateEncryptionKeyCmd: "cat " + test.keyFile}
+	test.save(cfg)
+	test.assertNoSecrets()
+	test.assertLoads(cfg)
+
+	_, err := newManager(&config.Config{DataDir: test.dir, StateEncryptionKeyCmd: "false"})
+	if err == nil || !strings.Contains(err.Error(), "key command") {
+		t.Errorf("Expected an error when the key command fails, got %v", err)
+	}
+}
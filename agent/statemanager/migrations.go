@@ -0,0 +1,280 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package statemanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// migration changes saved state between a version of the data format and
+// the one before it. Migrations work on the generic JSON of the state file,
+// so they don't depend on the types the state is loaded into, which only
+// know the current format.
+type migration struct {
+	// version is the version up migrates to from the one before.
+	version     int
+	description string
+	// up upgrades the data of a state file from version-1 to version.
+	up func(data map[string]interface{}) error
+	// down downgrades the data of a state file from version to version-1.
+	// It returns what the older agent won't know about anymore.
+	down func(data map[string]interface{}) ([]string, error)
+}
+
+// migrations holds a migration to every version of the data format after
+// the first, in order. A change to the format increments EcsDataVersion and
+// adds its migration here, with a fixture state file of the new version in
+// testdata.
+var migrations = []migration{
+	{
+		version:     2,
+		description: "Add 'ACSSeqNum'; save 'DEAD' statuses as 'STOPPED' and 'UNKNOWN' ones as 'NONE'",
+		up: func(data map[string]interface{}) error {
+			forEachStatus(data, map[string]string{"DEAD": "STOPPED", "UNKNOWN": "NONE"})
+			return nil
+		},
+		down: func(data map[string]interface{}) ([]string, error) {
+			var lost []string
+			if seqNum, ok := data["ACSSeqNum"]; ok {
+				delete(data, "ACSSeqNum")
+				lost = append(lost, fmt.Sprintf("the ACS sequence number %v", seqNum))
+			}
+			forEachStatus(data, map[string]string{"STOPPED": "DEAD", "NONE": "UNKNOWN"})
+			return lost, nil
+		},
+	},
+	{
+		version:     3,
+		description: "Add 'Protocol' to 'portMappings' and 'KnownPortBindings'",
+		up: func(data map[string]interface{}) error {
+			forEachPortBinding(data, func(binding map[string]interface{}) bool {
+				if _, ok := binding["Protocol"]; !ok {
+					binding["Protocol"] = "tcp"
+				}
+				return true
+			})
+			return nil
+		},
+		down: func(data map[string]interface{}) ([]string, error) {
+			var lost []string
+			forEachPortBinding(data, func(binding map[string]interface{}) bool {
+				protocol := binding["Protocol"]
+				delete(binding, "Protocol")
+				if protocol != "udp" {
+					return true
+				}
+				// The older agent would take a udp binding for a tcp one
+				lost = append(lost, fmt.Sprintf("the udp port binding %v->%v", binding["HostPort"], binding["ContainerPort"]))
+				return false
+			})
+			return lost, nil
+		},
+	},
+	{
+		version:     4,
+		description: "Add 'DockerConfig' to containers",
+		up: func(data map[string]interface{}) error {
+			return nil
+		},
+		down: func(data map[string]interface{}) ([]string, error) {
+			var lost []string
+			forEachContainer(data, func(container map[string]interface{}) {
+				if dockerConfig, ok := container["dockerConfig"].(map[string]interface{}); ok {
+					for _, value := range dockerConfig {
+						if value != nil {
+							lost = append(lost, fmt.Sprintf("the docker config of container %v", container["Name"]))
+							break
+						}
+					}
+				}
+				delete(container, "dockerConfig")
+			})
+			return lost, nil
+		},
+	},
+}
+
+// DataVersion returns the version of the data format of a state file.
+func DataVersion(stateFile []byte) (int, error) {
+	tmps := versionOnlyState{}
+	err := json.Unmarshal(stateFile, &tmps)
+	return tmps.Version, err
+}
+
+// Migrate converts a state file to another version of the data format,
+// upgrading or downgrading it one version at a time. It returns the
+// migrated file along with what an agent using an older version won't know
+// about anymore, which is nothing for upgrades.
+func Migrate(stateFile []byte, toVersion int) ([]byte, []string, error) {
+	if toVersion < 1 || toVersion > EcsDataVersion {
+		return nil, nil, errors.New("Unsupported data format: Version " + strconv.Itoa(toVersion))
+	}
+	decoder := json.NewDecoder(bytes.NewReader(stateFile))
+	// Keep large numbers such as sequence numbers exact
+	decoder.UseNumber()
+	var file map[string]interface{}
+	err := decoder.Decode(&file)
+	if err != nil {
+		return nil, nil, err
+	}
+	version, err := DataVersion(stateFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version < 1 || version > EcsDataVersion {
+		return nil, nil, errors.New("Unsupported data format: Version " + strconv.Itoa(version))
+	}
+	if _, encrypted := file["EncryptedData"]; encrypted {
+		return nil, nil, errors.New("the state file is encrypted and can't be migrated")
+	}
+	data, ok := file["Data"].(map[string]interface{})
+	if !ok {
+		return nil, nil, errors.New("the state file has no data")
+	}
+
+	var lost []string
+	for version < toVersion {
+		m := migrations[version-1]
+		log.Info("Upgrading state", "version", m.version, "change", m.description)
+		err = m.up(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("upgrading to version %d: %v", m.version, err)
+		}
+		version = m.version
+	}
+	for version > toVersion {
+		m := migrations[version-2]
+		log.Info("Downgrading state", "version", m.version-1, "change", m.description)
+		lostByMigration, err := m.down(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("downgrading to version %d: %v", m.version-1, err)
+		}
+		for _, description := range lostByMigration {
+			// Containers are saved twice, so they'd be reported twice
+			if !contains(lost, description) {
+				lost = append(lost, description)
+			}
+		}
+		version = m.version - 1
+	}
+	file["Version"] = version
+	// The checksum covers the data, which changed
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	file["Data"] = json.RawMessage(dataJSON)
+	file["Checksum"] = checksum(dataJSON)
+
+	migrated, err := json.Marshal(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return migrated, lost, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachContainer calls fn with every container in the data of a state
+// file. The task engine saves containers both in their tasks and in its map
+// of docker ids to containers.
+func forEachContainer(data map[string]interface{}, fn func(container map[string]interface{})) {
+	taskEngine, _ := data["TaskEngine"].(map[string]interface{})
+	if taskEngine == nil {
+		return
+	}
+	tasks, _ := taskEngine["Tasks"].([]interface{})
+	for _, task := range tasks {
+		task, _ := task.(map[string]interface{})
+		if task == nil {
+			continue
+		}
+		containers, _ := task["Containers"].([]interface{})
+		for _, container := range containers {
+			if container, ok := container.(map[string]interface{}); ok {
+				fn(container)
+			}
+		}
+	}
+	idToContainer, _ := taskEngine["IdToContainer"].(map[string]interface{})
+	for _, dockerContainer := range idToContainer {
+		dockerContainer, _ := dockerContainer.(map[string]interface{})
+		if dockerContainer == nil {
+			continue
+		}
+		if container, ok := dockerContainer["Container"].(map[string]interface{}); ok {
+			fn(container)
+		}
+	}
+}
+
+// forEachStatus renames the statuses of tasks and containers in the data of
+// a state file.
+func forEachStatus(data map[string]interface{}, renames map[string]string) {
+	rename := func(object map[string]interface{}, fields ...string) {
+		for _, field := range fields {
+			status, ok := object[field].(string)
+			if !ok {
+				continue
+			}
+			if renamed, ok := renames[status]; ok {
+				object[field] = renamed
+			}
+		}
+	}
+	if taskEngine, ok := data["TaskEngine"].(map[string]interface{}); ok {
+		tasks, _ := taskEngine["Tasks"].([]interface{})
+		for _, task := range tasks {
+			if task, ok := task.(map[string]interface{}); ok {
+				rename(task, "DesiredStatus", "KnownStatus", "SentStatus")
+			}
+		}
+	}
+	forEachContainer(data, func(container map[string]interface{}) {
+		rename(container, "desiredStatus", "KnownStatus", "AppliedStatus", "SentStatus")
+	})
+}
+
+// forEachPortBinding calls fn with the port mappings and known port bindings
+// of every container in the data of a state file. Bindings for which fn
+// returns false are removed.
+func forEachPortBinding(data map[string]interface{}, fn func(binding map[string]interface{}) bool) {
+	forEachContainer(data, func(container map[string]interface{}) {
+		for _, field := range []string{"portMappings", "KnownPortBindings"} {
+			bindings, ok := container[field].([]interface{})
+			if !ok {
+				continue
+			}
+			kept := make([]interface{}, 0, len(bindings))
+			for _, binding := range bindings {
+				if bindingObject, ok := binding.(map[string]interface{}); ok && !fn(bindingObject) {
+					continue
+				}
+				kept = append(kept, binding)
+			}
+			container[field] = kept
+		}
+	})
+}
@@ -0,0 +1,233 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package statemanager_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/statemanager"
+)
+
+const nginxTaskArn = "arn:aws:ecs:us-west-2:1234567890:task/f44b4fc9-adb0-4f4f-9dff-871512310588"
+
+func fixtureDir(version int) string {
+	return filepath.Join(".", "testdata", "v"+strconv.Itoa(version), "1")
+}
+
+func readFixture(t *testing.T, version int) []byte {
+	data, err := ioutil.ReadFile(filepath.Join(fixtureDir(version), "ecs_agent_data.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// loadState loads the state file in dir the way the agent does.
+func loadState(t *testing.T, dir string) (engine.TaskEngine, int64) {
+	taskEngine := engine.NewTaskEngine(&config.Config{}, false)
+	var containerInstanceArn, cluster, savedInstanceID string
+	var sequenceNumber int64
+	stateManager, err := statemanager.NewStateManager(&config.Config{DataDir: dir},
+		statemanager.AddSaveable("TaskEngine", taskEngine),
+		statemanager.AddSaveable("ContainerInstanceArn", &containerInstanceArn),
+		statemanager.AddSaveable("Cluster", &cluster),
+		statemanager.AddSaveable("EC2InstanceID", &savedInstanceID),
+		statemanager.AddSaveable("ACSSeqNum", &sequenceNumber),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stateManager.Load()
+	if err != nil {
+		t.Fatalf("Error loading state from %s: %v", dir, err)
+	}
+	if cluster != "test" {
+		t.Errorf("Wrong cluster loaded from %s: %s", dir, cluster)
+	}
+	return taskEngine, sequenceNumber
+}
+
+func nginxContainer(t *testing.T, taskEngine engine.TaskEngine) *api.Container {
+	task, ok := taskEngine.(*engine.DockerTaskEngine).State().TaskByArn(nginxTaskArn)
+	if !ok {
+		t.Fatal("Could not find task expected to be in state")
+	}
+	return task.Containers[0]
+}
+
+func TestLoadsEveryVersion(t *testing.T) {
+	for version := 1; version <= statemanager.EcsDataVersion; version++ {
+		taskEngine, sequenceNumber := loadState(t, fixtureDir(version))
+		tasks, _ := taskEngine.ListTasks()
+		if len(tasks) != 3 {
+			t.Errorf("Expected 3 tasks in version %d, got %d", version, len(tasks))
+		}
+		container := nginxContainer(t, taskEngine)
+		if container.KnownStatus != api.ContainerStopped {
+			t.Errorf("Expected the container to be stopped in version %d, got %s", version, container.KnownStatus.String())
+		}
+
+		if version >= 2 && sequenceNumber != 42 {
+			t.Errorf("Wrong sequence number in version %d: %d", version, sequenceNumber)
+		}
+		expectedPorts := []api.PortBinding{{ContainerPort: 80, HostPort: 80}}
+		if version >= 3 {
+			expectedPorts = append(expectedPorts, api.PortBinding{ContainerPort: 53, HostPort: 53, Protocol: api.TransportProtocolUDP})
+		}
+		if !reflect.DeepEqual(container.Ports, expectedPorts) {
+			t.Errorf("Wrong ports in version %d: %v", version, container.Ports)
+		}
+		hasDockerConfig := container.DockerConfig.HostConfig != nil
+		if hasDockerConfig != (version >= 4) {
+			t.Errorf("Wrong docker config in version %d: %v", version, container.DockerConfig)
+		}
+	}
+}
+
+// equalJSON returns true if two documents decode to the same values.
+func equalJSON(t *testing.T, a, b []byte) bool {
+	var decodedA, decodedB interface{}
+	if err := json.Unmarshal(a, &decodedA); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &decodedB); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(decodedA, decodedB)
+}
+
+func TestMigrateRoundTrip(t *testing.T) {
+	for version := 1; version <= statemanager.EcsDataVersion; version++ {
+		original := readFixture(t, version)
+		upgraded, lost, err := statemanager.Migrate(original, statemanager.EcsDataVersion)
+		if err != nil {
+			t.Fatalf("Error upgrading version %d: %v", version, err)
+		}
+		if len(lost) != 0 {
+			t.Errorf("Expected nothing to be lost upgrading version %d, got %v", version, lost)
+		}
+		upgradedVersion, _ := statemanager.DataVersion(upgraded)
+		if upgradedVersion != statemanager.EcsDataVersion {
+			t.Errorf("Expected version %d to be upgraded, got version %d", version, upgradedVersion)
+		}
+
+		// Files saved before version 2 mix the old and new status names, so
+		// check that downgrading loses nothing the agent would load
+		downgraded, _, err := statemanager.Migrate(upgraded, version)
+		if err != nil {
+			t.Fatalf("Error downgrading to version %d: %v", version, err)
+		}
+		downgradedVersion, _ := statemanager.DataVersion(downgraded)
+		if downgradedVersion != version {
+			t.Errorf("Expected version %d after downgrading, got version %d", version, downgradedVersion)
+		}
+		reupgraded, _, err := statemanager.Migrate(downgraded, statemanager.EcsDataVersion)
+		if err != nil {
+			t.Fatalf("Error upgrading the downgraded version %d: %v", version, err)
+		}
+		if !equalJSON(t, upgraded, reupgraded) {
+			t.Errorf("Expected version %d to be unchanged by downgrading and upgrading it, got %s", version, reupgraded)
+		}
+	}
+}
+
+func TestMigrateUpgradesLikeLaterVersions(t *testing.T) {
+	// The fixtures of later versions are the same state as saved by those
+	// versions, apart from what was added to them
+	upgraded, _, err := statemanager.Migrate(readFixture(t, 1), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file map[string]interface{}
+	json.Unmarshal(readFixture(t, 2), &file)
+	delete(file["Data"].(map[string]interface{}), "ACSSeqNum")
+	expected, _ := json.Marshal(file)
+	// The fixtures were saved before state files had checksums
+	var migrated map[string]interface{}
+	json.Unmarshal(upgraded, &migrated)
+	delete(migrated, "Checksum")
+	upgraded, _ = json.Marshal(migrated)
+	if !equalJSON(t, upgraded, expected) {
+		t.Errorf("Expected version 1 to be upgraded to the version 2 fixture, got %s", upgraded)
+	}
+}
+
+func TestMigrateDowngradeReportsLoss(t *testing.T) {
+	downgraded, lost, err := statemanager.Migrate(readFixture(t, statemanager.EcsDataVersion), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"the docker config of container nginx",
+		"the udp port binding 53->53",
+		"the ACS sequence number 42",
+	}
+	if !reflect.DeepEqual(lost, expected) {
+		t.Errorf("Expected %v to be lost, got %v", expected, lost)
+	}
+	if strings.Contains(string(downgraded), "STOPPED") || !strings.Contains(string(downgraded), "DEAD") {
+		t.Error("Expected stopped statuses to be downgraded to dead")
+	}
+
+	dir, err := ioutil.TempDir("", "ecs_statemanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "ecs_agent_data.json"), downgraded, 0600)
+	taskEngine, _ := loadState(t, dir)
+	container := nginxContainer(t, taskEngine)
+	if len(container.Ports) != 1 || container.DockerConfig.HostConfig != nil {
+		t.Errorf("Expected the downgraded container to be loaded without what was lost, got %v %v", container.Ports, container.DockerConfig)
+	}
+}
+
+func TestMigrateUnsupportedVersions(t *testing.T) {
+	if _, _, err := statemanager.Migrate(readFixture(t, 1), statemanager.EcsDataVersion+1); err == nil {
+		t.Error("Expected an error migrating to an unknown version")
+	}
+	if _, _, err := statemanager.Migrate([]byte(`{"Data": {}, "Version": 99}`), 1); err == nil {
+		t.Error("Expected an error migrating from an unknown version")
+	}
+	if _, _, err := statemanager.Migrate([]byte(`{"Version": 1}`), 2); err == nil {
+		t.Error("Expected an error migrating a file without data")
+	}
+}
+
+func TestLoadRefusesNewerVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs_statemanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "ecs_agent_data.json"), []byte(`{"Data": {}, "Version": 99}`), 0600)
+	manager, err := statemanager.NewStateManager(&config.Config{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = manager.Load()
+	if err == nil || !strings.Contains(err.Error(), "ecs-agent-ctl state migrate") {
+		t.Errorf("Expected an error pointing at the migration tool, got %v", err)
+	}
+}
@@ -18,17 +18,21 @@
 package statemanager
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
 )
 
 // The current version of saved data. Any backwards or forwards incompatible
@@ -43,11 +47,18 @@ import (
 //      forward compatible)
 // 3) Add 'Protocol' field to 'portMappings' and 'KnownPortBindings'
 // 4) Add 'DockerConfig' struct
+// Older data is upgraded on load, and newer data can be downgraded offline,
+// by the migrations in migrations.go.
 const EcsDataVersion = 4
 
 // Filename in the ECS_DATADIR
 const ecsDataFile = "ecs_agent_data.json"
 
+// How many previous generations of the state file are kept, as
+// ecs_agent_data.json.1 and so on, to fall back to if the latest one can't be
+// loaded
+const stateFileGenerations = 3
+
 // How frequently to flush to disk
 const minSaveInterval = 10 * time.Second
 
@@ -88,6 +99,18 @@ type intermediateState struct {
 	Data intermediateSaveableState
 }
 
+// checksummedState is the layout of the state file. Checksum is the checksum
+// of Data, or of EncryptedData, as written; state files saved by older agents
+// don't have one. When state is encrypted, Data is encrypted into
+// EncryptedData with the key KeyID.
+type checksummedState struct {
+	Data          json.RawMessage `json:",omitempty"`
+	EncryptedData []byte          `json:",omitempty"`
+	KeyID         string          `json:",omitempty"`
+	Version       int
+	Checksum      string `json:",omitempty"`
+}
+
 type versionOnlyState struct {
 	Version int
 }
@@ -99,16 +122,82 @@ type StateManager interface {
 	Load() error
 }
 
-type basicStateManager struct {
-	statePath string // The path to a file in which state can be serialized
+// SaveStatus describes the outcome of the most recent attempts to save state.
+type SaveStatus struct {
+	// LastAttempt is the time the last save was attempted
+	LastAttempt time.Time
+	// LastSuccess is the time the last save completed successfully
+	LastSuccess time.Time
+	// LastError is the error from the last attempt, or nil if it succeeded
+	LastError error
+}
 
-	state *state // pointers to the data we should save / load into
+// SaveStatusReporter is implemented by state managers that can report how
+// their saves have been going.
+type SaveStatusReporter interface {
+	SaveStatus() SaveStatus
+}
+
+// LoadStatus describes the state restored by the last Load.
+type LoadStatus struct {
+	// Generation is the generation of the state file which was loaded; 0 is
+	// the latest, 1 the one saved before it and so on
+	Generation int
+	// SavedAt is when the loaded generation was saved
+	SavedAt time.Time
+	// Skipped describes the newer generations which couldn't be loaded, and
+	// why. What was saved in them was lost.
+	Skipped []string
+}
+
+// LoadStatusReporter is implemented by state managers that fall back to
+// older state when the latest can't be loaded.
+type LoadStatusReporter interface {
+	LoadStatus() LoadStatus
+}
 
+// unsupportedVersionError is returned when loading state saved by a newer
+// agent. Older generations aren't loaded instead, as they'd be just as new.
+type unsupportedVersionError int
+
+func (err unsupportedVersionError) Error() string {
+	return "Unsupported data format: Version " + strconv.Itoa(int(err)) + " not " + strconv.Itoa(EcsDataVersion) + "; downgrade it with 'ecs-agent-ctl state migrate'"
+}
+
+// saveScheduler limits saves to one every minSaveInterval. A save asked for
+// sooner is planned for when the interval has passed.
+type saveScheduler struct {
 	saveTimesLock   sync.Mutex // guards save times
 	lastSave        time.Time  //the last time a save completed
 	nextPlannedSave time.Time  //the next time a save is planned
+}
+
+// saveStatusRecorder records the outcome of saves for SaveStatus.
+type saveStatusRecorder struct {
+	statusLock sync.RWMutex // guards status
+	status     SaveStatus   // outcome of the most recent saves
+}
+
+type basicStateManager struct {
+	statePath string // The path to a file in which state can be serialized
+
+	state *state // pointers to the data we should save / load into
+
+	saveScheduler
 
 	savingLock sync.Mutex // guards marshal, write, and move
+	// latestLoaded is true once the state file is known to be good, by this
+	// manager loading or saving it; only then is it kept as a generation
+	latestLoaded bool
+
+	keys stateKeys // the keys state is encrypted with, if any
+	// plaintextRemoved is true once generations saved before state was
+	// encrypted have been removed
+	plaintextRemoved bool
+
+	saveStatusRecorder
+
+	loadStatus LoadStatus // guarded by savingLock
 }
 
 // NewStateManager constructs a new StateManager which saves data at the
@@ -124,6 +213,11 @@ func NewStateManager(cfg *config.Config, options ...Option) (StateManager, error
 		return nil, errors.New("State manager DataDir must exist")
 	}
 
+	keys, err := loadStateKeys(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	state := &state{
 		Data:    make(saveableState),
 		Version: EcsDataVersion,
@@ -131,6 +225,7 @@ func NewStateManager(cfg *config.Config, options ...Option) (StateManager, error
 	manager := &basicStateManager{
 		statePath: cfg.DataDir,
 		state:     state,
+		keys:      keys,
 	}
 
 	for _, option := range options {
@@ -146,33 +241,48 @@ func NewStateManager(cfg *config.Config, options ...Option) (StateManager, error
 // deserialized correctly.
 func AddSaveable(name string, saveable Saveable) Option {
 	return (Option)(func(m StateManager) {
-		manager, ok := m.(*basicStateManager)
+		manager, ok := m.(saveableAdder)
 		if !ok {
 			log.Crit("Unable to add to state manager; unknown instantiation")
 			return
 		}
-		manager.state.Data[name] = &saveable
+		manager.addSaveable(name, saveable)
 	})
 }
 
+// saveableAdder is implemented by the state managers AddSaveable works with.
+type saveableAdder interface {
+	addSaveable(name string, saveable Saveable)
+}
+
+func (manager *basicStateManager) addSaveable(name string, saveable Saveable) {
+	manager.state.Data[name] = &saveable
+}
+
 // Save triggers a save to file, though respects a minimum save interval to wait
 // between saves.
 func (manager *basicStateManager) Save() error {
-	manager.saveTimesLock.Lock()
-	defer manager.saveTimesLock.Unlock()
-	if time.Since(manager.lastSave) >= minSaveInterval {
+	return manager.saveScheduler.save(manager.ForceSave)
+}
+
+// save calls forceSave if the last save was at least minSaveInterval ago, or
+// else plans a call for when it will have been.
+func (scheduler *saveScheduler) save(forceSave func() error) error {
+	scheduler.saveTimesLock.Lock()
+	defer scheduler.saveTimesLock.Unlock()
+	if time.Since(scheduler.lastSave) >= minSaveInterval {
 		// we can just save
-		err := manager.ForceSave()
-		manager.lastSave = time.Now()
-		manager.nextPlannedSave = time.Time{} // re-zero it; assume all pending desires to save are fulfilled
+		err := forceSave()
+		scheduler.lastSave = time.Now()
+		scheduler.nextPlannedSave = time.Time{} // re-zero it; assume all pending desires to save are fulfilled
 		return err
-	} else if manager.nextPlannedSave.IsZero() {
+	} else if scheduler.nextPlannedSave.IsZero() {
 		// No save planned yet, we should plan one.
-		next := manager.lastSave.Add(minSaveInterval)
-		manager.nextPlannedSave = next
+		next := scheduler.lastSave.Add(minSaveInterval)
+		scheduler.nextPlannedSave = next
 		go func() {
 			time.Sleep(next.Sub(time.Now()))
-			manager.Save()
+			scheduler.save(forceSave)
 		}()
 	}
 	// else nextPlannedSave wasn't Zero so there's a save planned elsewhere that'll
@@ -190,11 +300,31 @@ func (manager *basicStateManager) Save() error {
 func (manager *basicStateManager) ForceSave() error {
 	manager.savingLock.Lock()
 	defer manager.savingLock.Unlock()
+	return manager.saveStatusRecorder.measureSave(manager.forceSave)
+}
+
+// forceSave does the work of ForceSave; it must be called with the savingLock
+// held.
+func (manager *basicStateManager) forceSave() error {
 	log.Info("Saving state!")
 	s := manager.state
 	s.Version = EcsDataVersion
 
-	data, err := json.Marshal(s)
+	data, err := json.Marshal(s.Data)
+	if err != nil {
+		log.Error("Error saving state; could not marshal data; this is odd", "err", err)
+		return err
+	}
+	saved := checksummedState{Data: data, Version: s.Version, Checksum: checksum(data)}
+	if manager.keys.encrypting() {
+		encrypted, err := manager.keys.encrypt(data, ecsDataFile)
+		if err != nil {
+			log.Error("Error saving state; could not encrypt data", "err", err)
+			return err
+		}
+		saved = checksummedState{EncryptedData: encrypted, KeyID: manager.keys.currentID(), Version: s.Version, Checksum: checksum(encrypted)}
+	}
+	data, err = json.Marshal(saved)
 	if err != nil {
 		log.Error("Error saving state; could not marshal data; this is odd", "err", err)
 		return err
@@ -207,48 +337,235 @@ func (manager *basicStateManager) ForceSave() error {
 		return err
 	}
 	_, err = tmpfile.Write(data)
+	if err == nil {
+		// Without syncing, the rename can reach the disk before the data
+		// does, leaving an empty state file after a power loss
+		err = tmpfile.Sync()
+	}
+	if closeErr := tmpfile.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		log.Error("Error saving state; could not write to temp file to save state", "err", err)
+		os.Remove(tmpfile.Name())
 		return err
 	}
-	err = os.Rename(tmpfile.Name(), filepath.Join(manager.statePath, ecsDataFile))
+	if manager.latestLoaded {
+		manager.keepGeneration()
+	}
+	err = os.Rename(tmpfile.Name(), manager.generationPath(0))
 	if err != nil {
 		log.Error("Error saving state; could not move to data file", "err", err)
+		os.Remove(tmpfile.Name())
+		return err
+	}
+	err = syncDir(manager.statePath)
+	if err != nil {
+		log.Error("Error saving state; could not sync the data dir", "err", err)
+		return err
+	}
+	manager.latestLoaded = true
+	if manager.keys.encrypting() && !manager.plaintextRemoved {
+		manager.removePlaintextGenerations()
+	}
+	return nil
+}
+
+// removePlaintextGenerations removes the generations of the state file saved
+// before state was encrypted, which would keep what was encrypted on disk.
+func (manager *basicStateManager) removePlaintextGenerations() {
+	for generation := 1; generation <= stateFileGenerations; generation++ {
+		path := manager.generationPath(generation)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var saved checksummedState
+		if json.Unmarshal(data, &saved) == nil && saved.KeyID != "" {
+			continue
+		}
+		log.Info("Removing a generation of the state file saved before state was encrypted", "file", path)
+		err = os.Remove(path)
+		if err != nil {
+			log.Warn("Could not remove an unencrypted generation of the state file", "file", path, "err", err)
+			return
+		}
+	}
+	manager.plaintextRemoved = true
+}
+
+// generationPath returns the path of a generation of the state file; 0 is the
+// latest.
+func (manager *basicStateManager) generationPath(generation int) string {
+	path := filepath.Join(manager.statePath, ecsDataFile)
+	if generation == 0 {
+		return path
+	}
+	return path + "." + strconv.Itoa(generation)
+}
+
+// keepGeneration makes the state file the first of the older generations,
+// dropping the oldest one. The state file is linked rather than moved so it's
+// in place until the new one replaces it.
+func (manager *basicStateManager) keepGeneration() {
+	for generation := stateFileGenerations - 1; generation > 0; generation-- {
+		err := os.Rename(manager.generationPath(generation), manager.generationPath(generation+1))
+		if err != nil && !os.IsNotExist(err) {
+			log.Warn("Could not keep an older generation of the state file", "generation", generation, "err", err)
+		}
+	}
+	os.Remove(manager.generationPath(1))
+	err := os.Link(manager.generationPath(0), manager.generationPath(1))
+	if err != nil {
+		log.Warn("Could not keep the previous generation of the state file", "err", err)
+	}
+}
+
+// syncDir makes renames in the directory at path durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// checksum returns the checksum of the data of a state file.
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// measureSave calls forceSave, recording its duration and outcome in the
+// metrics and for SaveStatus.
+func (recorder *saveStatusRecorder) measureSave(forceSave func() error) error {
+	start := time.Now()
+	err := forceSave()
+	metrics.StateSaveDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.StateSaveFailures.Inc()
 	}
+	recorder.recordSave(err)
 	return err
 }
 
+// recordSave records the outcome of a save attempt for SaveStatus.
+func (recorder *saveStatusRecorder) recordSave(err error) {
+	recorder.statusLock.Lock()
+	defer recorder.statusLock.Unlock()
+	now := time.Now()
+	recorder.status.LastAttempt = now
+	recorder.status.LastError = err
+	if err == nil {
+		recorder.status.LastSuccess = now
+	}
+}
+
+// SaveStatus returns the outcome of the most recent saves.
+func (recorder *saveStatusRecorder) SaveStatus() SaveStatus {
+	recorder.statusLock.RLock()
+	defer recorder.statusLock.RUnlock()
+	return recorder.status
+}
+
 // Load reads state off the disk from the well-known filepath and loads it into
-// the passed State object.
+// the passed State object. If the state file can't be loaded, because it's
+// corrupted or fails its checksum, the newest older generation which can be
+// is loaded instead. LoadStatus reports which one was loaded.
 func (manager *basicStateManager) Load() error {
+	manager.savingLock.Lock()
+	defer manager.savingLock.Unlock()
+	log.Info("Loading state!")
+	var skipped []string
+	for generation := 0; generation <= stateFileGenerations; generation++ {
+		path := manager.generationPath(generation)
+		savedAt, err := manager.loadFile(path)
+		if os.IsNotExist(err) {
+			// Happens every first run; not a real error
+			continue
+		}
+		switch err.(type) {
+		case unsupportedVersionError, keyError:
+			return err
+		}
+		if err != nil {
+			log.Error("Could not load the state file", "file", path, "err", err)
+			skipped = append(skipped, filepath.Base(path)+": "+err.Error())
+			continue
+		}
+
+		if len(skipped) > 0 {
+			log.Crit("Loaded an older generation of the state file; what was saved after it was lost", "file", path, "saved at", savedAt, "skipped", strings.Join(skipped, "; "))
+		}
+		manager.latestLoaded = generation == 0
+		manager.loadStatus = LoadStatus{Generation: generation, SavedAt: savedAt, Skipped: skipped}
+		return nil
+	}
+	if len(skipped) > 0 {
+		return errors.New("Could not load any generation of the state file: " + strings.Join(skipped, "; "))
+	}
+	return nil
+}
+
+// loadFile loads the state file at path into the saveables and returns when
+// it was saved.
+func (manager *basicStateManager) loadFile(path string) (time.Time, error) {
 	// Note that even if Save overwrites the file we're looking at here, we
 	// still hold the old inode and should read the old data so no locking is
 	// needed (given Linux and the ext* family of fs at least).
 	s := manager.state
-	log.Info("Loading state!")
-	file, err := os.Open(filepath.Join(manager.statePath, ecsDataFile))
+	file, err := os.Open(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			// Happens every first run; not a real error
-			return nil
-		}
-		return err
+		return time.Time{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return time.Time{}, err
 	}
 	data, err := ioutil.ReadAll(file)
 	if err != nil {
 		log.Error("Error reading existing state file", "err", err)
-		return err
+		return time.Time{}, err
 	}
-	// Dry-run to make sure this is a version we can understand
-	tmps := versionOnlyState{}
-	err = json.Unmarshal(data, &tmps)
+	// Dry-run to make sure this is a version we can understand, and that the
+	// data is what was saved
+	var saved checksummedState
+	err = json.Unmarshal(data, &saved)
 	if err != nil {
 		log.Crit("Could not unmarshal existing state; corrupted data?", "err", err, "data", data)
-		return err
+		return time.Time{}, err
+	}
+	if saved.Version > EcsDataVersion {
+		return time.Time{}, unsupportedVersionError(saved.Version)
 	}
-	if tmps.Version > EcsDataVersion {
-		strversion := strconv.Itoa(tmps.Version)
-		return errors.New("Unsupported data format: Version " + strversion + " not " + strconv.Itoa(EcsDataVersion))
+	payload := []byte(saved.Data)
+	if saved.KeyID != "" {
+		payload = saved.EncryptedData
+	}
+	if saved.Checksum != "" && saved.Checksum != checksum(payload) {
+		return time.Time{}, errors.New("the checksum of the data doesn't match; corrupted data")
+	}
+	if saved.KeyID != "" {
+		saved.Data, err = manager.keys.decrypt(saved.EncryptedData, saved.KeyID, ecsDataFile)
+		if err != nil {
+			return time.Time{}, err
+		}
+		data, err = json.Marshal(checksummedState{Data: saved.Data, Version: saved.Version})
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	if saved.KeyID != manager.keys.currentID() {
+		log.Info("The state will be encrypted with the configured key when next saved", "key", manager.keys.currentID(), "saved with key", saved.KeyID)
+	}
+	if saved.Version < EcsDataVersion {
+		data, _, err = Migrate(data, EcsDataVersion)
+		if err != nil {
+			log.Crit("Could not upgrade existing state", "version", saved.Version, "err", err)
+			return time.Time{}, err
+		}
 	}
 	// Now load it into the actual state. The reason we do this with the
 	// intermediate state is that we *must* unmarshal directly into the
@@ -261,7 +578,7 @@ func (manager *basicStateManager) Load() error {
 	err = json.Unmarshal(data, &intermediate)
 	if err != nil {
 		log.Debug("Could not unmarshal into intermediate")
-		return err
+		return time.Time{}, err
 	}
 
 	for key, rawJSON := range intermediate.Data {
@@ -273,10 +590,18 @@ func (manager *basicStateManager) Load() error {
 		err = json.Unmarshal(rawJSON, actualPointer)
 		if err != nil {
 			log.Debug("Could not unmarshal into actual")
-			return err
+			return time.Time{}, err
 		}
 	}
 
 	log.Debug("Loaded state!", "state", s)
-	return nil
+	return info.ModTime(), nil
+}
+
+// LoadStatus returns which generation of the state file the last Load
+// restored.
+func (manager *basicStateManager) LoadStatus() LoadStatus {
+	manager.savingLock.Lock()
+	defer manager.savingLock.Unlock()
+	return manager.loadStatus
 }
@@ -17,6 +17,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -170,3 +172,175 @@ func TestLoadsV1DataCorrectly(t *testing.T) {
 		t.Fatal("Time was not correct")
 	}
 }
+
+func TestSaveStatus(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("/tmp", "ecs_statemanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manager, err := statemanager.NewStateManager(&config.Config{DataDir: tmpDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter, ok := manager.(statemanager.SaveStatusReporter)
+	if !ok {
+		t.Fatal("Expected the state manager to report its save status")
+	}
+	if !reporter.SaveStatus().LastAttempt.IsZero() {
+		t.Error("Expected no save attempts before saving")
+	}
+
+	err = manager.ForceSave()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := reporter.SaveStatus()
+	if status.LastError != nil || status.LastSuccess.IsZero() || status.LastSuccess != status.LastAttempt {
+		t.Errorf("Expected a successful save to be recorded, got %+v", status)
+	}
+
+	// Saving into a directory that no longer exists must fail
+	os.RemoveAll(tmpDir)
+	err = manager.ForceSave()
+	if err == nil {
+		t.Fatal("Expected save to a missing directory to fail")
+	}
+	failedStatus := reporter.SaveStatus()
+	if failedStatus.LastError == nil || failedStatus.LastSuccess != status.LastSuccess {
+		t.Errorf("Expected a failed save to be recorded, got %+v", failedStatus)
+	}
+}
+
+// saveGenerations saves the given values of a saveable one after the other.
+func saveGenerations(t *testing.T, dir string, values ...string) {
+	var value string
+	manager, err := statemanager.NewStateManager(&config.Config{DataDir: dir}, statemanager.AddSaveable("Value", &value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value = range values {
+		err = manager.ForceSave()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// loadValue loads the saveable saved by saveGenerations.
+func loadValue(dir string) (string, statemanager.LoadStatus, error) {
+	var value string
+	manager, err := statemanager.NewStateManager(&config.Config{DataDir: dir}, statemanager.AddSaveable("Value", &value))
+	if err != nil {
+		return "", statemanager.LoadStatus{}, err
+	}
+	err = manager.Load()
+	return value, manager.(statemanager.LoadStatusReporter).LoadStatus(), err
+}
+
+func TestSaveKeepsGenerations(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("/tmp", "ecs_statemanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	saveGenerations(t, tmpDir, "1", "2", "3", "4", "5")
+	stateFile := filepath.Join(tmpDir, "ecs_agent_data.json")
+	for suffix, value := range map[string]string{"": "5", ".1": "4", ".2": "3", ".3": "2"} {
+		data, err := ioutil.ReadFile(stateFile + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `"Value":"`+value+`"`) || !strings.Contains(string(data), `"Checksum":"sha256:`) {
+			t.Errorf("Expected ecs_agent_data.json%s to have value %s and a checksum, got %s", suffix, value, data)
+		}
+	}
+	if _, err := os.Stat(stateFile + ".4"); !os.IsNotExist(err) {
+		t.Error("Expected only 3 older generations to be kept")
+	}
+	if files, _ := filepath.Glob(filepath.Join(tmpDir, "tmp_*")); len(files) != 0 {
+		t.Errorf("Expected no temp files to be left behind, got %v", files)
+	}
+}
+
+func TestLoadFallsBackToOlderGeneration(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("/tmp", "ecs_statemanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	saveGenerations(t, tmpDir, "first", "second", "third")
+	stateFile := filepath.Join(tmpDir, "ecs_agent_data.json")
+
+	// A state file cut short, like after a power loss
+	data, _ := ioutil.ReadFile(stateFile)
+	ioutil.WriteFile(stateFile, data[:len(data)/2], 0600)
+	value, status, err := loadValue(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "second" || status.Generation != 1 || len(status.Skipped) != 1 || status.SavedAt.IsZero() {
+		t.Errorf("Expected the previous generation to be loaded, got %q %+v", value, status)
+	}
+
+	// Valid JSON which isn't what was saved
+	data, _ = ioutil.ReadFile(stateFile + ".1")
+	ioutil.WriteFile(stateFile+".1", []byte(strings.Replace(string(data), "second", "fourth", 1)), 0600)
+	value, status, err = loadValue(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "first" || status.Generation != 2 || len(status.Skipped) != 2 {
+		t.Errorf("Expected the generation failing its checksum to be skipped, got %q %+v", value, status)
+	}
+	if !strings.Contains(status.Skipped[1], "checksum") {
+		t.Errorf("Expected the checksum to be why the generation was skipped, got %v", status.Skipped)
+	}
+
+	ioutil.WriteFile(stateFile+".2", []byte("{"), 0600)
+	_, _, err = loadValue(tmpDir)
+	if err == nil {
+		t.Error("Expected an error when no generation can be loaded")
+	}
+}
+
+func TestLoadDoesNotFallBackFromNewerVersion(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("/tmp", "ecs_statemanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	saveGenerations(t, tmpDir, "first", "second")
+	ioutil.WriteFile(filepath.Join(tmpDir, "ecs_agent_data.json"), []byte(`{"Data": {}, "Version": 99}`), 0600)
+
+	_, _, err = loadValue(tmpDir)
+	if err == nil {
+		t.Error("Expected an error loading state saved by a newer agent")
+	}
+}
+
+func TestLockDataDir(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("/tmp", "ecs_statemanager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	lock, err := statemanager.LockDataDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = statemanager.LockDataDir(tmpDir)
+	if err == nil || !strings.Contains(err.Error(), "pid "+strconv.Itoa(os.Getpid())) {
+		t.Errorf("Expected an error naming the agent holding the lock, got %v", err)
+	}
+
+	lock.Unlock()
+	lock, err = statemanager.LockDataDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Expected the lock to be released: %v", err)
+	}
+	lock.Unlock()
+}
@@ -0,0 +1,365 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/httpclient"
+)
+
+const (
+	// alertCheckInterval is how often the samples collected since the last
+	// check are evaluated against the alert rules. It's well under the
+	// interval at which queues are reset after publishing to the backend.
+	alertCheckInterval = 5 * time.Second
+
+	// alertWebhookTimeout bounds posting an alert to the webhook.
+	alertWebhookTimeout = 10 * time.Second
+
+	// maxResolvedAlerts is the number of resolved alerts kept for
+	// introspection.
+	maxResolvedAlerts = 100
+)
+
+// Metrics which alert rules can use in addition to those a Queue can
+// summarize. They're relative to the limits of the container, which the
+// queue doesn't know about.
+const (
+	// MetricCPUUtilizationPerc is the cpu usage as a percentage of the cpu
+	// shares of the container, where 1024 shares reserve a whole cpu.
+	MetricCPUUtilizationPerc Metric = "cpuUtilizationPerc"
+	// MetricMemoryUtilizationPerc is the working set as a percentage of the
+	// memory limit of the container.
+	MetricMemoryUtilizationPerc Metric = "memoryUtilizationPerc"
+)
+
+// AlertState is whether an alert is firing or resolved.
+type AlertState string
+
+const (
+	AlertFiring   AlertState = "firing"
+	AlertResolved AlertState = "resolved"
+)
+
+// Alert is raised for a container when a metric stays above the threshold
+// of a rule for the rule's duration.
+type Alert struct {
+	Rule          string     `json:"rule"`
+	Metric        string     `json:"metric"`
+	Threshold     float64    `json:"threshold"`
+	For           string     `json:"for"`
+	State         AlertState `json:"state"`
+	TaskArn       string     `json:"taskArn"`
+	ContainerName string     `json:"containerName"`
+	DockerID      string     `json:"dockerId"`
+	// Value is the most recent value of the metric.
+	Value float64 `json:"value"`
+	// Since is when the metric crossed the threshold.
+	Since      time.Time  `json:"since"`
+	FiredAt    time.Time  `json:"firedAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// alertMetricFunc returns the value of a metric in a sample of a container,
+// or NaN when it isn't known.
+type alertMetricFunc func(stat *UsageStats, metadata *ContainerMetadata) float64
+
+// alertRule is a rule from the config, ready to be evaluated.
+type alertRule struct {
+	config.StatsAlertRule
+	duration time.Duration
+	value    alertMetricFunc
+}
+
+// alertKey identifies the evaluation of a rule for a container.
+type alertKey struct {
+	rule     string
+	dockerID string
+}
+
+// alertEvaluation tracks a rule for a container between checks.
+type alertEvaluation struct {
+	// lastSample is the timestamp of the newest sample evaluated.
+	lastSample time.Time
+	lastValue  float64
+	// breachedSince is when the metric crossed the threshold, or zero if it's
+	// below the threshold.
+	breachedSince time.Time
+	// alert is set while the alert is firing.
+	alert *Alert
+}
+
+// alertManager evaluates alert rules against the samples of every watched
+// container and keeps the resulting alerts.
+type alertManager struct {
+	rules      []alertRule
+	webhookURL string
+	httpClient *http.Client
+
+	lock        sync.Mutex
+	evaluations map[alertKey]*alertEvaluation
+	// resolved are the most recently resolved alerts, oldest first.
+	resolved []Alert
+}
+
+// newAlertManager creates an alertManager for the rules in the config, or
+// returns nil if there are none which can be evaluated.
+func newAlertManager(cfg *config.Config) *alertManager {
+	var rules []alertRule
+	for _, rule := range cfg.StatsAlertRules {
+		value, ok := alertMetric(Metric(rule.Metric))
+		if !ok {
+			log.Warn("Unknown metric in stats alert rule, ignoring", "rule", rule.Name, "metric", rule.Metric)
+			continue
+		}
+		// The config only keeps rules with valid durations
+		duration, _ := rule.Duration()
+		rules = append(rules, alertRule{StatsAlertRule: rule, duration: duration, value: value})
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return &alertManager{
+		rules:       rules,
+		webhookURL:  cfg.StatsAlertWebhookURL,
+		httpClient:  httpclient.New(alertWebhookTimeout, false),
+		evaluations: make(map[alertKey]*alertEvaluation),
+	}
+}
+
+// alertMetric returns the function which reads a metric from a sample.
+func alertMetric(metric Metric) (alertMetricFunc, bool) {
+	switch metric {
+	case MetricCPUUtilizationPerc:
+		return func(stat *UsageStats, metadata *ContainerMetadata) float64 {
+			if metadata.CPUShares == 0 {
+				return math.NaN()
+			}
+			return float64(stat.CPUUsagePerc) * cpuSharesPerCPU / float64(metadata.CPUShares)
+		}, true
+	case MetricMemoryUtilizationPerc:
+		return func(stat *UsageStats, metadata *ContainerMetadata) float64 {
+			if metadata.MemoryLimitInMegs == 0 {
+				return math.NaN()
+			}
+			return 100 * float64(stat.Memory.WorkingSetBytes) / float64(metadata.MemoryLimitInMegs*BytesInMiB)
+		}, true
+	}
+	getter, ok := metricGetters[metric]
+	if !ok {
+		return nil, false
+	}
+	return func(stat *UsageStats, metadata *ContainerMetadata) float64 {
+		return getter(stat)
+	}, true
+}
+
+// alertLoop evaluates the alert rules every interval until the engine's
+// context is cancelled.
+func (engine *DockerStatsEngine) alertLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-engine.ctx.Done():
+			return
+		case <-ticker.C:
+			engine.evaluateAlerts()
+		}
+	}
+}
+
+// evaluateAlerts evaluates the alert rules against the samples collected
+// since the last evaluation, and emits every alert which fired or resolved.
+func (engine *DockerStatsEngine) evaluateAlerts() {
+	if engine.alerts == nil {
+		return
+	}
+	engine.containersLock.Lock()
+	changed := engine.alerts.evaluate(engine)
+	engine.containersLock.Unlock()
+
+	for _, alert := range changed {
+		engine.alerts.emit(alert)
+	}
+}
+
+// GetAlerts returns the firing alerts followed by the most recently resolved
+// ones, newest first.
+func (engine *DockerStatsEngine) GetAlerts() []Alert {
+	alerts := []Alert{}
+	if engine.alerts == nil {
+		return alerts
+	}
+	engine.alerts.lock.Lock()
+	defer engine.alerts.lock.Unlock()
+
+	for _, evaluation := range engine.alerts.evaluations {
+		if evaluation.alert != nil {
+			alerts = append(alerts, *evaluation.alert)
+		}
+	}
+	for i := len(engine.alerts.resolved) - 1; i >= 0; i-- {
+		alerts = append(alerts, engine.alerts.resolved[i])
+	}
+	return alerts
+}
+
+// evaluate walks the new samples of every container, oldest first, and
+// returns the alerts which fired or resolved. A rule's duration is measured
+// between sample timestamps. The containers lock must be held by the caller.
+func (manager *alertManager) evaluate(engine *DockerStatsEngine) []Alert {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	var changed []Alert
+	watched := make(map[alertKey]bool)
+	for taskArn, containerMap := range engine.tasksToContainers {
+		for dockerID, container := range containerMap {
+			// Watched containers keep their evaluations while they have no
+			// samples, as right after their queues are reset on publishing.
+			for _, rule := range manager.rules {
+				watched[alertKey{rule: rule.Name, dockerID: dockerID}] = true
+			}
+			if container.statsQueue == nil {
+				continue
+			}
+			usageStats, err := container.statsQueue.GetRawUsageStats(ContainerStatsBufferLength)
+			if err != nil {
+				// No data collected since the queue was created or reset
+				continue
+			}
+			metadata := engine.resolveMetadata(container)
+			for _, rule := range manager.rules {
+				key := alertKey{rule: rule.Name, dockerID: dockerID}
+				evaluation, ok := manager.evaluations[key]
+				if !ok {
+					evaluation = &alertEvaluation{}
+					manager.evaluations[key] = evaluation
+				}
+
+				// usageStats is ordered newest first
+				for i := len(usageStats) - 1; i >= 0; i-- {
+					stat := usageStats[i]
+					if !stat.Timestamp.After(evaluation.lastSample) {
+						continue
+					}
+					value := rule.value(&stat, metadata)
+					if math.IsNaN(value) {
+						continue
+					}
+					evaluation.lastSample = stat.Timestamp
+					evaluation.lastValue = value
+					if value <= rule.Threshold {
+						evaluation.breachedSince = time.Time{}
+					} else if evaluation.breachedSince.IsZero() {
+						evaluation.breachedSince = stat.Timestamp
+					}
+				}
+
+				breached := !evaluation.breachedSince.IsZero()
+				switch {
+				case breached && evaluation.alert == nil && evaluation.lastSample.Sub(evaluation.breachedSince) >= rule.duration:
+					evaluation.alert = &Alert{
+						Rule:          rule.Name,
+						Metric:        rule.Metric,
+						Threshold:     rule.Threshold,
+						For:           rule.For,
+						State:         AlertFiring,
+						TaskArn:       taskArn,
+						ContainerName: metadata.Name,
+						DockerID:      dockerID,
+						Value:         evaluation.lastValue,
+						Since:         evaluation.breachedSince,
+						FiredAt:       evaluation.lastSample,
+					}
+					changed = append(changed, *evaluation.alert)
+				case breached && evaluation.alert != nil:
+					evaluation.alert.Value = evaluation.lastValue
+				case !breached && evaluation.alert != nil:
+					changed = append(changed, manager.resolve(evaluation, evaluation.lastSample))
+				}
+			}
+		}
+	}
+
+	// Alerts of containers which are no longer watched are resolved
+	for key, evaluation := range manager.evaluations {
+		if watched[key] {
+			continue
+		}
+		if evaluation.alert != nil {
+			changed = append(changed, manager.resolve(evaluation, time.Now()))
+		}
+		delete(manager.evaluations, key)
+	}
+	return changed
+}
+
+// resolve resolves the firing alert of an evaluation, keeping it for
+// introspection. The manager's lock must be held by the caller.
+func (manager *alertManager) resolve(evaluation *alertEvaluation, resolvedAt time.Time) Alert {
+	alert := *evaluation.alert
+	alert.State = AlertResolved
+	alert.Value = evaluation.lastValue
+	alert.ResolvedAt = &resolvedAt
+	evaluation.alert = nil
+
+	manager.resolved = append(manager.resolved, alert)
+	if len(manager.resolved) > maxResolvedAlerts {
+		manager.resolved = manager.resolved[len(manager.resolved)-maxResolvedAlerts:]
+	}
+	return alert
+}
+
+// emit logs an alert which fired or resolved, and posts it to the webhook in
+// the background.
+func (manager *alertManager) emit(alert Alert) {
+	if alert.State == AlertFiring {
+		log.Warn("Stats alert firing", "rule", alert.Rule, "metric", alert.Metric, "value", alert.Value,
+			"threshold", alert.Threshold, "for", alert.For, "task", alert.TaskArn, "container", alert.ContainerName, "id", alert.DockerID)
+	} else {
+		log.Info("Stats alert resolved", "rule", alert.Rule, "metric", alert.Metric, "value", alert.Value,
+			"threshold", alert.Threshold, "task", alert.TaskArn, "container", alert.ContainerName, "id", alert.DockerID)
+	}
+	if manager.webhookURL != "" {
+		go manager.postAlert(alert)
+	}
+}
+
+// postAlert posts an alert to the webhook as JSON. Failures are only logged;
+// the alert remains available through introspection.
+func (manager *alertManager) postAlert(alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := manager.httpClient.Post(manager.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Warn("Error posting stats alert to webhook", "rule", alert.Rule, "err", err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Warn("Stats alert webhook returned an error", "rule", alert.Rule, "status", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	mock_resolver "github.com/aws/amazon-ecs-agent/agent/stats/resolver/mock"
+	"github.com/golang/mock/gomock"
+)
+
+var testAlertRule = config.StatsAlertRule{Name: "high-memory", Metric: "memoryUtilizationPerc", Threshold: 90, For: "2s"}
+
+func newAlertTestEngine(mockCtrl *gomock.Controller, cfg *config.Config) (*DockerStatsEngine, *Queue) {
+	resolver := mock_resolver.NewMockContainerMetadataResolver(mockCtrl)
+	resolver.EXPECT().ResolveContainer("c1").Return(&api.DockerContainer{DockerId: "c1", Container: &api.Container{Name: "web", Memory: 100}}, nil)
+
+	queue := NewQueue(ContainerStatsBufferLength)
+	engine := &DockerStatsEngine{
+		alerts:   newAlertManager(cfg),
+		resolver: resolver,
+		tasksToContainers: map[string]map[string]*CronContainer{
+			"t1": {"c1": &CronContainer{containerMetadata: &ContainerMetadata{DockerID: "c1"}, statsQueue: queue}},
+		},
+	}
+	return engine, queue
+}
+
+func TestAlertFiresAndResolves(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	posted := make(chan Alert, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("Error decoding alert: %v", err)
+		}
+		posted <- alert
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{StatsAlertRules: []config.StatsAlertRule{testAlertRule}, StatsAlertWebhookURL: server.URL}
+	engine, queue := newAlertTestEngine(mockCtrl, cfg)
+
+	start := time.Now()
+	addMemorySample(queue, 0, 95, 95, start)
+	addMemorySample(queue, 0, 95, 95, start.Add(time.Second))
+	engine.evaluateAlerts()
+	if alerts := engine.GetAlerts(); len(alerts) != 0 {
+		t.Fatalf("Expected no alerts before the rule's duration, got %+v", alerts)
+	}
+
+	addMemorySample(queue, 0, 96, 96, start.Add(2*time.Second))
+	engine.evaluateAlerts()
+	alerts := engine.GetAlerts()
+	if len(alerts) != 1 {
+		t.Fatalf("Expected a firing alert, got %+v", alerts)
+	}
+	alert := alerts[0]
+	if alert.State != AlertFiring || alert.Rule != "high-memory" || alert.TaskArn != "t1" || alert.ContainerName != "web" || alert.Value != 96 {
+		t.Errorf("Unexpected alert: %+v", alert)
+	}
+	if !alert.Since.Equal(start) || !alert.FiredAt.Equal(start.Add(2*time.Second)) {
+		t.Errorf("Unexpected alert times: %+v", alert)
+	}
+	select {
+	case alert := <-posted:
+		if alert.State != AlertFiring || alert.DockerID != "c1" {
+			t.Errorf("Unexpected alert posted: %+v", alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the alert to be posted")
+	}
+
+	addMemorySample(queue, 0, 50, 50, start.Add(3*time.Second))
+	engine.evaluateAlerts()
+	alerts = engine.GetAlerts()
+	if len(alerts) != 1 || alerts[0].State != AlertResolved || alerts[0].ResolvedAt == nil {
+		t.Fatalf("Expected a resolved alert, got %+v", alerts)
+	}
+	select {
+	case alert := <-posted:
+		if alert.State != AlertResolved {
+			t.Errorf("Expected the resolved alert to be posted, got %+v", alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the resolved alert to be posted")
+	}
+}
+
+func TestAlertBreachInterrupted(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg := &config.Config{StatsAlertRules: []config.StatsAlertRule{testAlertRule}}
+	engine, queue := newAlertTestEngine(mockCtrl, cfg)
+
+	start := time.Now()
+	addMemorySample(queue, 0, 95, 95, start)
+	engine.evaluateAlerts()
+	// A single sample under the threshold between checks restarts the breach
+	addMemorySample(queue, 0, 80, 80, start.Add(time.Second))
+	addMemorySample(queue, 0, 95, 95, start.Add(2*time.Second))
+	engine.evaluateAlerts()
+	addMemorySample(queue, 0, 95, 95, start.Add(3*time.Second))
+	engine.evaluateAlerts()
+	if alerts := engine.GetAlerts(); len(alerts) != 0 {
+		t.Fatalf("Expected no alerts, got %+v", alerts)
+	}
+
+	addMemorySample(queue, 0, 95, 95, start.Add(4*time.Second))
+	engine.evaluateAlerts()
+	if alerts := engine.GetAlerts(); len(alerts) != 1 || !alerts[0].Since.Equal(start.Add(2*time.Second)) {
+		t.Fatalf("Expected an alert since the breach restarted, got %+v", alerts)
+	}
+
+	// The alert is resolved once the container is no longer watched
+	delete(engine.tasksToContainers, "t1")
+	engine.evaluateAlerts()
+	if alerts := engine.GetAlerts(); len(alerts) != 1 || alerts[0].State != AlertResolved {
+		t.Fatalf("Expected the alert to be resolved, got %+v", alerts)
+	}
+}
+
+func TestAlertSurvivesStatsReset(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg := &config.Config{StatsAlertRules: []config.StatsAlertRule{testAlertRule}}
+	engine, queue := newAlertTestEngine(mockCtrl, cfg)
+
+	// The breach carries on across the publish resetting the queue
+	start := time.Now()
+	addMemorySample(queue, 0, 95, 95, start)
+	addMemorySample(queue, 0, 95, 95, start.Add(time.Second))
+	engine.evaluateAlerts()
+	engine.resetStats()
+	engine.evaluateAlerts()
+	addMemorySample(queue, 0, 95, 95, start.Add(2*time.Second))
+	engine.evaluateAlerts()
+	alerts := engine.GetAlerts()
+	if len(alerts) != 1 || alerts[0].State != AlertFiring || !alerts[0].Since.Equal(start) {
+		t.Fatalf("Expected an alert firing since the breach started before the reset, got %+v", alerts)
+	}
+
+	// A firing alert isn't resolved by the next publish
+	engine.resetStats()
+	engine.evaluateAlerts()
+	alerts = engine.GetAlerts()
+	if len(alerts) != 1 || alerts[0].State != AlertFiring {
+		t.Fatalf("Expected the alert to keep firing while the queue is empty, got %+v", alerts)
+	}
+	addMemorySample(queue, 0, 97, 97, start.Add(3*time.Second))
+	engine.evaluateAlerts()
+	alerts = engine.GetAlerts()
+	if len(alerts) != 1 || alerts[0].State != AlertFiring || alerts[0].Value != 97 || !alerts[0].FiredAt.Equal(start.Add(2*time.Second)) {
+		t.Fatalf("Expected the same alert to keep firing after the reset, got %+v", alerts)
+	}
+}
+
+func TestNewAlertManagerUnknownMetric(t *testing.T) {
+	cfg := &config.Config{StatsAlertRules: []config.StatsAlertRule{{Name: "bogus", Metric: "diskUsage", Threshold: 1}}}
+	if manager := newAlertManager(cfg); manager != nil {
+		t.Errorf("Expected no alert manager without valid rules, got %+v", manager)
+	}
+
+	cfg.StatsAlertRules = append(cfg.StatsAlertRules, config.StatsAlertRule{Name: "high-cpu", Metric: "cpuUtilizationPerc", Threshold: 95})
+	manager := newAlertManager(cfg)
+	if manager == nil || len(manager.rules) != 1 || manager.rules[0].Name != "high-cpu" {
+		t.Errorf("Expected only the valid rule to be kept, got %+v", manager)
+	}
+}
@@ -0,0 +1,463 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCgroupRoot is where the cgroup hierarchies are mounted.
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// cgroupV1Subsystems lists the directories a cgroup v1 subsystem may be
+// mounted at, relative to the cgroup root, in order of preference.
+var cgroupV1Subsystems = map[string][]string{
+	"cpuacct": {"cpuacct", "cpu,cpuacct", "cpuacct,cpu"},
+	"cpu":     {"cpu", "cpu,cpuacct", "cpuacct,cpu"},
+	"memory":  {"memory"},
+	"blkio":   {"blkio"},
+	"pids":    {"pids"},
+}
+
+// CgroupStatsCollector implements ContainerStatsCollector by reading the
+// files of a container's cgroup directly. Both cgroup v1 and the unified v2
+// hierarchy are supported, as are the cgroupfs and systemd cgroup drivers of
+// Docker.
+type CgroupStatsCollector struct {
+	// root is where the cgroup hierarchies are mounted.
+	root string
+	// procPath is where the host's procfs is mounted.
+	procPath string
+	// numCPUs divides cgroup v2 cpu usage, which isn't broken down per cpu.
+	numCPUs int
+	// cgroup is found on the first read and reused after.
+	cgroup *containerCgroup
+}
+
+// containerCgroup is the location of a container's cgroup.
+type containerCgroup struct {
+	// unified is true for the cgroup v2 hierarchy.
+	unified bool
+	// path is relative to the root of each hierarchy.
+	path string
+}
+
+func newCgroupStatsCollector(root string, procPath string) *CgroupStatsCollector {
+	return &CgroupStatsCollector{
+		root:     root,
+		procPath: procPath,
+		numCPUs:  runtime.NumCPU(),
+	}
+}
+
+// getContainerStats reads usage data of a container from its cgroup and its
+// network stats from procfs.
+func (collector *CgroupStatsCollector) getContainerStats(container *CronContainer) (*ContainerStats, error) {
+	if collector.cgroup == nil {
+		cgroup, err := findContainerCgroup(collector.root, container.containerMetadata.DockerID)
+		if err != nil {
+			// The cgroup is not created immediately when a container starts.
+			// Bubble up the error.
+			return nil, err
+		}
+		collector.cgroup = cgroup
+	}
+
+	var stats *ContainerStats
+	var procsPath string
+	var err error
+	if collector.cgroup.unified {
+		dir := filepath.Join(collector.root, collector.cgroup.path)
+		stats, err = readCgroupV2Stats(dir, collector.numCPUs)
+		procsPath = filepath.Join(dir, "cgroup.procs")
+	} else {
+		stats, err = collector.readCgroupV1Stats()
+		procsPath = filepath.Join(collector.subsystemPath("cpuacct"), "cgroup.procs")
+	}
+	if err != nil {
+		log.Error("Error getting cgroup stats", "err", err, "cgroup", collector.cgroup.path)
+		return nil, err
+	}
+
+	pid, err := readFirstPid(procsPath)
+	if err == nil {
+		stats.networkStats, err = readNetworkStats(collector.procPath, pid)
+	}
+	if err != nil {
+		// Report the rest of the stats without network utilization.
+		log.Debug("Error getting network stats", "err", err, "cgroup", collector.cgroup.path)
+	}
+	return stats, nil
+}
+
+// stop is a no-op; files are only open while they're read.
+func (collector *CgroupStatsCollector) stop() {}
+
+// findContainerCgroup finds the cgroup Docker created for a container, with
+// either the cgroupfs or the systemd cgroup driver.
+func findContainerCgroup(root string, dockerID string) (*containerCgroup, error) {
+	unified := fileExists(filepath.Join(root, "cgroup.controllers"))
+	candidates := []string{
+		// cgroupfs driver
+		filepath.Join("docker", dockerID),
+		// systemd driver
+		filepath.Join("system.slice", "docker-"+dockerID+".scope"),
+	}
+	for _, path := range candidates {
+		var probe string
+		if unified {
+			probe = filepath.Join(root, path)
+		} else {
+			probe = filepath.Join(findSubsystemRoot(root, "cpuacct"), path)
+		}
+		if fileExists(probe) {
+			return &containerCgroup{unified: unified, path: path}, nil
+		}
+	}
+	return nil, fmt.Errorf("Could not find cgroup of container %s in %s", dockerID, root)
+}
+
+// findSubsystemRoot returns the directory a cgroup v1 subsystem is mounted
+// at.
+func findSubsystemRoot(root string, subsystem string) string {
+	dirs := cgroupV1Subsystems[subsystem]
+	for _, dir := range dirs {
+		path := filepath.Join(root, dir)
+		if fileExists(path) {
+			return path
+		}
+	}
+	return filepath.Join(root, dirs[0])
+}
+
+// subsystemPath returns the container's cgroup directory in a cgroup v1
+// subsystem.
+func (collector *CgroupStatsCollector) subsystemPath(subsystem string) string {
+	return filepath.Join(findSubsystemRoot(collector.root, subsystem), collector.cgroup.path)
+}
+
+func (collector *CgroupStatsCollector) readCgroupV1Stats() (*ContainerStats, error) {
+	cpuacctPath := collector.subsystemPath("cpuacct")
+	totalUsage, err := readCgroupUint(cpuacctPath, "cpuacct.usage")
+	if err != nil {
+		return nil, err
+	}
+	percpuUsage, err := ioutil.ReadFile(filepath.Join(cpuacctPath, "cpuacct.usage_percpu"))
+	if err != nil {
+		return nil, err
+	}
+	// The number of per cpu values is the number of cores in the instance.
+	numCores := uint64(len(strings.Fields(string(percpuUsage))))
+	cpuUsage := uint64(0)
+	if numCores > 0 {
+		cpuUsage = totalUsage / numCores
+	}
+
+	// Throttling is only accounted for when the cpu subsystem is mounted
+	cpuStat, err := readOptionalKeyValueFile(filepath.Join(collector.subsystemPath("cpu"), "cpu.stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	memoryPath := collector.subsystemPath("memory")
+	memoryUsage, err := readCgroupUint(memoryPath, "memory.usage_in_bytes")
+	if err != nil {
+		return nil, err
+	}
+	memoryStat, err := readOptionalKeyValueFile(filepath.Join(memoryPath, "memory.stat"))
+	if err != nil {
+		return nil, err
+	}
+	// The file is missing on kernels built without memory accounting of
+	// limits
+	failcnt, _ := readCgroupUint(memoryPath, "memory.failcnt")
+
+	blockIOStats, err := readBlkioStats(collector.subsystemPath("blkio"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContainerStats{
+		cpuUsage:    cpuUsage,
+		memoryUsage: memoryUsage,
+		memoryStats: memoryCounters{
+			rss:   memoryStat["total_rss"],
+			cache: memoryStat["total_cache"],
+			// Only listed when swap accounting is enabled
+			swap:       memoryStat["total_swap"],
+			workingSet: workingSet(memoryUsage, memoryStat["total_inactive_file"]),
+			failcnt:    failcnt,
+		},
+		throttling: throttlingCounters{
+			periods:          cpuStat["nr_periods"],
+			throttledPeriods: cpuStat["nr_throttled"],
+			throttledTime:    cpuStat["throttled_time"],
+		},
+		blockIOStats: blockIOStats,
+		pids:         readPids(collector.subsystemPath("pids")),
+		timestamp:    time.Now(),
+	}, nil
+}
+
+// workingSet returns the memory usage less inactive file pages.
+func workingSet(usage uint64, inactiveFile uint64) uint64 {
+	if inactiveFile > usage {
+		return 0
+	}
+	return usage - inactiveFile
+}
+
+// readBlkioStats sums the reads and writes to every block device from the
+// CFQ scheduler stats, falling back to the throttling stats which are
+// available with every scheduler.
+func readBlkioStats(path string) (blockIOCounters, error) {
+	var counters blockIOCounters
+	found, err := readBlkioFile(filepath.Join(path, "blkio.io_serviced_recursive"), &counters.readOps, &counters.writeOps)
+	if err != nil {
+		return counters, err
+	}
+	if found {
+		_, err = readBlkioFile(filepath.Join(path, "blkio.io_service_bytes_recursive"), &counters.readBytes, &counters.writeBytes)
+		return counters, err
+	}
+	_, err = readBlkioFile(filepath.Join(path, "blkio.throttle.io_serviced"), &counters.readOps, &counters.writeOps)
+	if err != nil {
+		return counters, err
+	}
+	_, err = readBlkioFile(filepath.Join(path, "blkio.throttle.io_service_bytes"), &counters.readBytes, &counters.writeBytes)
+	return counters, err
+}
+
+// readBlkioFile adds up the Read and Write entries of a blkio stats file,
+// returning whether there were any device entries. The file is missing when
+// the blkio subsystem isn't mounted.
+//
+// Expected format:
+//
+//	8:0 Read 1282048
+//	8:0 Write 2195456
+//	8:0 Total 3477504
+//	Total 3477504
+func readBlkioFile(path string, read *uint64, write *uint64) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	found := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			// The grand total
+			continue
+		}
+		value, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("Invalid line found while parsing %s: %s", path, scanner.Text())
+		}
+		found = true
+		switch fields[1] {
+		case "Read":
+			*read += value
+		case "Write":
+			*write += value
+		}
+	}
+	return found, scanner.Err()
+}
+
+func readCgroupV2Stats(path string, numCPUs int) (*ContainerStats, error) {
+	cpuStat, err := readKeyValueFile(filepath.Join(path, "cpu.stat"))
+	if err != nil {
+		return nil, err
+	}
+	cpuUsage := uint64(0)
+	if numCPUs > 0 {
+		cpuUsage = cpuStat["usage_usec"] * uint64(time.Microsecond) / uint64(numCPUs)
+	}
+
+	memoryUsage, err := readCgroupUint(path, "memory.current")
+	if err != nil {
+		return nil, err
+	}
+	memoryStat, err := readOptionalKeyValueFile(filepath.Join(path, "memory.stat"))
+	if err != nil {
+		return nil, err
+	}
+	// The file is missing when swap accounting isn't enabled
+	swap, _ := readCgroupUint(path, "memory.swap.current")
+	// The usage hitting the limit is counted as "max" events
+	memoryEvents, err := readOptionalKeyValueFile(filepath.Join(path, "memory.events"))
+	if err != nil {
+		return nil, err
+	}
+
+	blockIOStats, err := readIOStat(filepath.Join(path, "io.stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContainerStats{
+		cpuUsage:    cpuUsage,
+		memoryUsage: memoryUsage,
+		memoryStats: memoryCounters{
+			rss:        memoryStat["anon"],
+			cache:      memoryStat["file"],
+			swap:       swap,
+			workingSet: workingSet(memoryUsage, memoryStat["inactive_file"]),
+			failcnt:    memoryEvents["max"],
+		},
+		throttling: throttlingCounters{
+			periods:          cpuStat["nr_periods"],
+			throttledPeriods: cpuStat["nr_throttled"],
+			throttledTime:    cpuStat["throttled_usec"] * uint64(time.Microsecond),
+		},
+		blockIOStats: blockIOStats,
+		pids:         readPids(path),
+		timestamp:    time.Now(),
+	}, nil
+}
+
+// readIOStat sums the reads and writes to every block device. The file is
+// missing when the io controller isn't enabled.
+//
+// Expected format:
+//
+//	8:0 rbytes=1282048 wbytes=2195456 rios=124 wios=104 dbytes=0 dios=0
+func readIOStat(path string) (blockIOCounters, error) {
+	var counters blockIOCounters
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return counters, nil
+		}
+		return counters, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		// The first field is the device
+		for _, field := range fields[1:] {
+			parts := strings.SplitN(field, "=", 2)
+			if len(parts) != 2 {
+				return counters, fmt.Errorf("Invalid line found while parsing %s: %s", path, scanner.Text())
+			}
+			value, err := strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				return counters, fmt.Errorf("Invalid line found while parsing %s: %s", path, scanner.Text())
+			}
+			switch parts[0] {
+			case "rbytes":
+				counters.readBytes += value
+			case "wbytes":
+				counters.writeBytes += value
+			case "rios":
+				counters.readOps += value
+			case "wios":
+				counters.writeOps += value
+			}
+		}
+	}
+	return counters, scanner.Err()
+}
+
+// readPids returns the number of processes in the cgroup, or 0 when the pids
+// controller isn't available.
+func readPids(path string) uint64 {
+	pids, err := readCgroupUint(path, "pids.current")
+	if err != nil {
+		return 0
+	}
+	return pids
+}
+
+// readKeyValueFile reads a file of "key value" lines, as memory.stat and
+// cpu.stat.
+func readKeyValueFile(path string) (map[string]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid line found while parsing %s: %s", path, scanner.Text())
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid line found while parsing %s: %s", path, scanner.Text())
+		}
+		values[fields[0]] = value
+	}
+	return values, scanner.Err()
+}
+
+// readOptionalKeyValueFile is readKeyValueFile for files which are missing when
+// a subsystem or controller isn't available, returning no values for them.
+func readOptionalKeyValueFile(path string) (map[string]uint64, error) {
+	values, err := readKeyValueFile(path)
+	if os.IsNotExist(err) {
+		return map[string]uint64{}, nil
+	}
+	return values, err
+}
+
+func readCgroupUint(dir string, file string) (uint64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readFirstPid returns a process in the cgroup, from which the network
+// namespace of the container can be found.
+func readFirstPid(procsPath string) (int, error) {
+	data, err := ioutil.ReadFile(procsPath)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("No processes in %s", procsPath)
+	}
+	return strconv.Atoi(fields[0])
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixtureDockerID is the id of the container in each of the fixture cgroup
+// trees in testdata/cgroup.
+const fixtureDockerID = "4f3c2b1a0e9d8c7b4f3c2b1a0e9d8c7b4f3c2b1a0e9d8c7b4f3c2b1a0e9d8c7b"
+
+func fixtureContainer() *CronContainer {
+	return &CronContainer{containerMetadata: &ContainerMetadata{DockerID: fixtureDockerID}}
+}
+
+func TestCgroupStatsCollector(t *testing.T) {
+	fixtureNetwork := &networkCounters{rxBytes: 2000, rxPackets: 20, rxErrors: 1, txBytes: 1000, txPackets: 10, txErrors: 3}
+	testCases := []struct {
+		fixture  string
+		unified  bool
+		path     string
+		expected ContainerStats
+	}{
+		{
+			fixture: "v1-cgroupfs",
+			path:    "docker/" + fixtureDockerID,
+			// The CFQ stats are empty, so the throttling stats are used
+			expected: ContainerStats{
+				cpuUsage:    100000000,
+				memoryUsage: 2097152,
+				// No swap accounting, and no cpu subsystem for throttling
+				memoryStats:  memoryCounters{rss: 1048576, cache: 786432, workingSet: 1572864},
+				blockIOStats: blockIOCounters{readBytes: 1286144, writeBytes: 2203648, readOps: 125, writeOps: 106},
+				pids:         3,
+				networkStats: fixtureNetwork,
+			},
+		},
+		{
+			fixture: "v1-systemd",
+			path:    "system.slice/docker-" + fixtureDockerID + ".scope",
+			expected: ContainerStats{
+				cpuUsage:     150000000,
+				memoryUsage:  1048576,
+				memoryStats:  memoryCounters{rss: 524288, cache: 262144, swap: 4096, workingSet: 917504, failcnt: 7},
+				throttling:   throttlingCounters{periods: 100, throttledPeriods: 10, throttledTime: 5000000},
+				blockIOStats: blockIOCounters{readBytes: 8192, writeBytes: 16384, readOps: 2, writeOps: 4},
+				networkStats: fixtureNetwork,
+			},
+		},
+		{
+			fixture: "v2-systemd",
+			unified: true,
+			path:    "system.slice/docker-" + fixtureDockerID + ".scope",
+			expected: ContainerStats{
+				cpuUsage:     100000000,
+				memoryUsage:  3145728,
+				memoryStats:  memoryCounters{rss: 2097152, cache: 1048576, swap: 8192, workingSet: 2883584, failcnt: 12},
+				throttling:   throttlingCounters{periods: 50, throttledPeriods: 5, throttledTime: 2500000},
+				blockIOStats: blockIOCounters{readBytes: 1286144, writeBytes: 2203648, readOps: 125, writeOps: 106},
+				pids:         5,
+				networkStats: fixtureNetwork,
+			},
+		},
+		{
+			fixture: "v2-cgroupfs",
+			unified: true,
+			path:    "docker/" + fixtureDockerID,
+			// No io or pids controllers, no memory.stat, and no procfs entry for
+			// network stats
+			expected: ContainerStats{
+				cpuUsage:    50000000,
+				memoryUsage: 4194304,
+				memoryStats: memoryCounters{workingSet: 4194304},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		collector := newCgroupStatsCollector(filepath.Join("testdata", "cgroup", testCase.fixture), "testdata/proc")
+		collector.numCPUs = 2
+		stats, err := collector.getContainerStats(fixtureContainer())
+		if err != nil {
+			t.Errorf("%s: %v", testCase.fixture, err)
+			continue
+		}
+		if collector.cgroup.unified != testCase.unified || collector.cgroup.path != testCase.path {
+			t.Errorf("%s: unexpected cgroup %+v", testCase.fixture, collector.cgroup)
+		}
+		expected := testCase.expected
+		if stats.cpuUsage != expected.cpuUsage || stats.memoryUsage != expected.memoryUsage || stats.pids != expected.pids {
+			t.Errorf("%s: expected cpu %d, memory %d and pids %d, got %d, %d and %d", testCase.fixture,
+				expected.cpuUsage, expected.memoryUsage, expected.pids, stats.cpuUsage, stats.memoryUsage, stats.pids)
+		}
+		if stats.memoryStats != expected.memoryStats {
+			t.Errorf("%s: expected memory %+v, got %+v", testCase.fixture, expected.memoryStats, stats.memoryStats)
+		}
+		if stats.throttling != expected.throttling {
+			t.Errorf("%s: expected throttling %+v, got %+v", testCase.fixture, expected.throttling, stats.throttling)
+		}
+		if stats.blockIOStats != expected.blockIOStats {
+			t.Errorf("%s: expected block io %+v, got %+v", testCase.fixture, expected.blockIOStats, stats.blockIOStats)
+		}
+		if (stats.networkStats == nil) != (expected.networkStats == nil) ||
+			(stats.networkStats != nil && *stats.networkStats != *expected.networkStats) {
+			t.Errorf("%s: expected network %+v, got %+v", testCase.fixture, expected.networkStats, stats.networkStats)
+		}
+	}
+}
+
+func TestCgroupStatsCollectorUnknownContainer(t *testing.T) {
+	collector := newCgroupStatsCollector(filepath.Join("testdata", "cgroup", "v1-cgroupfs"), "testdata/proc")
+	_, err := collector.getContainerStats(&CronContainer{containerMetadata: &ContainerMetadata{DockerID: "unknown"}})
+	if err == nil {
+		t.Error("Expected an error reading stats of a container without a cgroup")
+	}
+	if collector.cgroup != nil {
+		t.Error("Expected the cgroup to be looked up again on the next read")
+	}
+}
+
+func TestCgroupStatsCollectorNoPercpuUsage(t *testing.T) {
+	root, err := ioutil.TempDir("", "ecs_cgroup_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	cgroup := filepath.Join("docker", fixtureDockerID)
+	files := map[string]string{
+		filepath.Join("cpuacct", cgroup, "cpuacct.usage"):        "100\n",
+		filepath.Join("cpuacct", cgroup, "cpuacct.usage_percpu"): "\n",
+		filepath.Join("memory", cgroup, "memory.usage_in_bytes"): "1\n",
+	}
+	for path, content := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, path)), 0755)
+		err = ioutil.WriteFile(filepath.Join(root, path), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := newCgroupStatsCollector(root, "testdata/proc").getContainerStats(fixtureContainer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No divide by zero panic
+	if stats.cpuUsage != 0 {
+		t.Error("Unexpected value for cpuUsage", stats.cpuUsage)
+	}
+}
+
+func TestReadIOStatInvalid(t *testing.T) {
+	root, err := ioutil.TempDir("", "ecs_cgroup_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	path := filepath.Join(root, "io.stat")
+	ioutil.WriteFile(path, []byte("8:0 rbytes\n"), 0644)
+	_, err = readIOStat(path)
+	if err == nil {
+		t.Error("Expected an error parsing an invalid io.stat")
+	}
+}
+
+func TestReadBlkioStats(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected blockIOCounters
+	}{
+		{
+			// The CFQ stats are empty, so the throttling stats are used
+			path:     filepath.Join("testdata", "cgroup", "v1-cgroupfs", "blkio", "docker", fixtureDockerID),
+			expected: blockIOCounters{readBytes: 1286144, writeBytes: 2203648, readOps: 125, writeOps: 106},
+		},
+		{
+			path:     filepath.Join("testdata", "cgroup", "v1-systemd", "blkio", "system.slice", "docker-"+fixtureDockerID+".scope"),
+			expected: blockIOCounters{readBytes: 8192, writeBytes: 16384, readOps: 2, writeOps: 4},
+		},
+		{
+			// The blkio subsystem isn't mounted
+			path: filepath.Join("testdata", "cgroup", "v1-cgroupfs", "blkio", "docker", "missing"),
+		},
+	}
+
+	for _, testCase := range testCases {
+		counters, err := readBlkioStats(testCase.path)
+		if err != nil {
+			t.Errorf("Error reading %s: %v", testCase.path, err)
+			continue
+		}
+		if counters != testCase.expected {
+			t.Errorf("Expected %+v from %s, got %+v", testCase.expected, testCase.path, counters)
+		}
+	}
+}
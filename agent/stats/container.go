@@ -14,33 +14,68 @@
 package stats
 
 import (
-	"path/filepath"
+	"errors"
 	"time"
 
-	"github.com/docker/libcontainer"
 	"golang.org/x/net/context"
 )
 
 const (
-	// DockerExecDriverPath points to the docker exec driver path.
-	DockerExecDriverPath = "execdriver/native"
-
 	// SleepBetweenUsageDataCollection is the sleep duration between collecting usage data for a container.
 	SleepBetweenUsageDataCollection = 500 * time.Millisecond
 
 	// ContainerStatsBufferLength is the number of usage metrics stored in memory for a container. It is calculated as
 	// Number of usage metrics gathered in a second (2) * 60 * Time duration in minutes to store the data for (2)
 	ContainerStatsBufferLength = 240
+
+	// maxCollectorErrors is the number of consecutive errors from the preferred stats collector
+	// after which the fallback collector is used instead.
+	maxCollectorErrors = 10
 )
 
+// errNoNewStats is returned by collectors that receive stats asynchronously when no sample
+// has been received since the last call. It isn't counted as a failure.
+var errNoNewStats = errors.New("No new stats available")
+
 // ContainerStatsCollector defines methods to get container stats. This interface is defined to
 // make testing easier.
 type ContainerStatsCollector interface {
 	getContainerStats(container *CronContainer) (*ContainerStats, error)
+	// stop releases resources held for the container, once stats are no longer collected.
+	stop()
+}
+
+// fallbackStatsCollector gets stats from the preferred collector until it fails
+// maxCollectorErrors times in a row, and from the fallback collector after that.
+type fallbackStatsCollector struct {
+	preferred ContainerStatsCollector
+	fallback  ContainerStatsCollector
+	errors    int
+	fellBack  bool
+}
+
+func (collector *fallbackStatsCollector) getContainerStats(container *CronContainer) (*ContainerStats, error) {
+	if collector.fellBack {
+		return collector.fallback.getContainerStats(container)
+	}
+	stats, err := collector.preferred.getContainerStats(container)
+	if err == nil || err == errNoNewStats {
+		collector.errors = 0
+		return stats, err
+	}
+	collector.errors++
+	if collector.errors >= maxCollectorErrors {
+		log.Warn("Preferred stats collector keeps failing, falling back", "container", container.containerMetadata.DockerID, "err", err)
+		collector.preferred.stop()
+		collector.fellBack = true
+	}
+	return nil, err
 }
 
-// LibcontainerStatsCollector implements ContainerStatsCollector.
-type LibcontainerStatsCollector struct{}
+func (collector *fallbackStatsCollector) stop() {
+	collector.preferred.stop()
+	collector.fallback.stop()
+}
 
 // StartStatsCron starts a go routine to periodically pull usage data for the container.
 func (container *CronContainer) StartStatsCron() {
@@ -53,59 +88,40 @@ func (container *CronContainer) StartStatsCron() {
 	go container.cronStats()
 }
 
-// StopStatsCron stops the periodic collection of usage data for the container..
+// StopStatsCron stops the periodic collection of usage data for the container and
+// releases the resources held by its collector.
 func (container *CronContainer) StopStatsCron() {
 	container.cancel()
 }
 
 // newCronContainer creates a CronContainer object.
-func newCronContainer(dockerID string, dockerGraphPath string) *CronContainer {
-	statePath := filepath.Join(dockerGraphPath, DockerExecDriverPath, dockerID)
-
-	container := &CronContainer{
+func newCronContainer(dockerID string, statsCollector ContainerStatsCollector) *CronContainer {
+	return &CronContainer{
 		containerMetadata: &ContainerMetadata{
 			DockerID: dockerID,
 		},
-		statePath: statePath,
+		statsCollector: statsCollector,
 	}
-
-	container.statsCollector = &LibcontainerStatsCollector{}
-	return container
 }
 
-// cronStats periodically pulls usage data for the container from cgroup fs.
+// cronStats periodically pulls usage data for the container from its collector.
 func (container *CronContainer) cronStats() {
 	for {
 		select {
 		case <-container.ctx.Done():
+			container.statsCollector.stop()
 			return
 		default:
 			stats, err := container.statsCollector.getContainerStats(container)
-			if err != nil {
+			switch {
+			case err == errNoNewStats:
+				// Nothing to add until the next sample is received
+			case err != nil:
 				log.Debug("Error getting stats", "error", err, "contianer", container)
-			} else {
+			default:
 				container.statsQueue.Add(stats)
 			}
 			time.Sleep(SleepBetweenUsageDataCollection)
 		}
 	}
 }
-
-// getContainerStats reads usage data of a container from the cgroup fs.
-func (collector *LibcontainerStatsCollector) getContainerStats(container *CronContainer) (*ContainerStats, error) {
-	state, err := libcontainer.GetState(container.statePath)
-	if err != nil {
-		// The state file is not created immediately when a container starts.
-		// Bubble up the error.
-		return nil, err
-	}
-	// libcontainer.GetStats ignores the config argument. So, don't bother providing one.
-	containerStats, err := libcontainer.GetStats(nil, state)
-	if err != nil && !isNetworkStatsError(err) {
-		log.Error("Error getting libcontainer stats", "err", err)
-		return nil, err
-	}
-
-	cs := toContainerStats(*containerStats)
-	return cs, nil
-}
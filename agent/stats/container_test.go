@@ -73,6 +73,8 @@ func (collector *MockStatsCollector) getContainerStats(container *CronContainer)
 	return &cs, nil
 }
 
+func (collector *MockStatsCollector) stop() {}
+
 func TestContainerStatsAggregation(t *testing.T) {
 	var container *CronContainer
 	dockerID := "container1"
@@ -0,0 +1,211 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockeriface"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// dockerStatsTimeout bounds connecting to the stats endpoint, and how long a
+// stream may go without a sample before it's considered broken. Docker sends
+// a sample every second.
+const dockerStatsTimeout = 10 * time.Second
+
+// DockerStatsCollector implements ContainerStatsCollector using the stats
+// streaming endpoint of the Docker remote API, which doesn't need the host's
+// cgroup hierarchies to be mounted. A single stream is kept open for the
+// container until stop is called.
+type DockerStatsCollector struct {
+	client dockeriface.Client
+	// numCPUs divides cpu usage when Docker doesn't break it down per cpu.
+	numCPUs int
+
+	lock sync.Mutex
+	// done is closed to end the stream; it's nil when no stream is open.
+	done chan bool
+	// streamErr is why the last stream ended, until it's reported.
+	streamErr error
+	// latest is the most recent sample received.
+	latest *docker.Stats
+	// lastReceived is when the latest sample was received, or when the
+	// stream was opened.
+	lastReceived time.Time
+	// lastRead is the timestamp of the newest sample returned.
+	lastRead time.Time
+}
+
+func newDockerStatsCollector(client dockeriface.Client) *DockerStatsCollector {
+	return &DockerStatsCollector{
+		client:  client,
+		numCPUs: runtime.NumCPU(),
+	}
+}
+
+// getContainerStats returns the latest sample from the container's stats
+// stream, opening the stream if needed. errNoNewStats is returned until a
+// sample newer than the last one returned is received.
+func (collector *DockerStatsCollector) getContainerStats(container *CronContainer) (*ContainerStats, error) {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+
+	if collector.done == nil {
+		if err := collector.streamErr; err != nil {
+			// Report why the stream ended once; it's reopened on the next read.
+			collector.streamErr = nil
+			return nil, err
+		}
+		collector.openStream(container.containerMetadata.DockerID)
+	}
+
+	if collector.latest == nil || !collector.latest.Read.After(collector.lastRead) {
+		if time.Since(collector.lastReceived) > dockerStatsTimeout {
+			collector.closeStream()
+			return nil, fmt.Errorf("No stats received from docker in %s", dockerStatsTimeout)
+		}
+		return nil, errNoNewStats
+	}
+	collector.lastRead = collector.latest.Read
+	return dockerStatsToContainerStats(collector.latest, collector.numCPUs), nil
+}
+
+// stop closes the stream, if there is one.
+func (collector *DockerStatsCollector) stop() {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	collector.closeStream()
+}
+
+// openStream starts streaming stats of the container in the background. The
+// lock must be held by the caller.
+func (collector *DockerStatsCollector) openStream(dockerID string) {
+	done := make(chan bool)
+	samples := make(chan *docker.Stats)
+	collector.done = done
+	collector.lastReceived = time.Now()
+
+	go func() {
+		// Stats closes the samples channel when it returns
+		for sample := range samples {
+			collector.lock.Lock()
+			collector.latest = sample
+			collector.lastReceived = time.Now()
+			collector.lock.Unlock()
+		}
+	}()
+	go func() {
+		err := collector.client.Stats(docker.StatsOptions{
+			ID:      dockerID,
+			Stats:   samples,
+			Stream:  true,
+			Done:    done,
+			Timeout: dockerStatsTimeout,
+		})
+		collector.lock.Lock()
+		defer collector.lock.Unlock()
+		if collector.done != done {
+			// Closed by closeStream; nothing to report
+			return
+		}
+		collector.done = nil
+		if err == nil {
+			err = fmt.Errorf("Docker stats stream of %s ended", dockerID)
+		}
+		collector.streamErr = err
+	}()
+}
+
+// closeStream ends the stream, if there is one. The lock must be held by the
+// caller.
+func (collector *DockerStatsCollector) closeStream() {
+	if collector.done != nil {
+		close(collector.done)
+		collector.done = nil
+	}
+}
+
+// dockerStatsToContainerStats converts a sample from the Docker remote API.
+func dockerStatsToContainerStats(stats *docker.Stats, numCPUs int) *ContainerStats {
+	// The number of per cpu values is the number of cores in the instance.
+	numCores := uint64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	if numCores == 0 {
+		numCores = uint64(numCPUs)
+	}
+	cpuUsage := uint64(0)
+	if numCores > 0 {
+		cpuUsage = stats.CPUStats.CPUUsage.TotalUsage / numCores
+	}
+
+	var blockIO blockIOCounters
+	for _, entry := range stats.BlkioStats.IOServiceBytesRecursive {
+		addBlkioEntry(entry, &blockIO.readBytes, &blockIO.writeBytes)
+	}
+	for _, entry := range stats.BlkioStats.IOServicedRecursive {
+		addBlkioEntry(entry, &blockIO.readOps, &blockIO.writeOps)
+	}
+
+	memory := stats.MemoryStats
+	containerStats := &ContainerStats{
+		cpuUsage:    cpuUsage,
+		memoryUsage: memory.Usage,
+		// Swap isn't decoded by this version of the client. With cgroup v2,
+		// Docker reports the raw memory.stat keys, so only the working set,
+		// which is then the whole usage, is known.
+		memoryStats: memoryCounters{
+			rss:        memory.Stats.TotalRss,
+			cache:      memory.Stats.TotalCache,
+			workingSet: workingSet(memory.Usage, memory.Stats.TotalInactiveFile),
+			failcnt:    memory.Failcnt,
+		},
+		throttling: throttlingCounters{
+			periods:          stats.CPUStats.ThrottlingData.Periods,
+			throttledPeriods: stats.CPUStats.ThrottlingData.ThrottledPeriods,
+			throttledTime:    stats.CPUStats.ThrottlingData.ThrottledTime,
+		},
+		blockIOStats: blockIO,
+		timestamp:    stats.Read,
+	}
+	network := stats.Network
+	// Docker 1.9 and later report each interface under "networks" instead,
+	// which isn't decoded by this version of the client. Leave network usage
+	// unknown rather than report none at all.
+	if network.RxBytes != 0 || network.RxPackets != 0 || network.TxBytes != 0 || network.TxPackets != 0 {
+		containerStats.networkStats = &networkCounters{
+			rxBytes:   network.RxBytes,
+			rxPackets: network.RxPackets,
+			rxErrors:  network.RxErrors,
+			txBytes:   network.TxBytes,
+			txPackets: network.TxPackets,
+			txErrors:  network.TxErrors,
+		}
+	}
+	return containerStats
+}
+
+// addBlkioEntry adds the value of a Read or Write entry. Docker capitalizes
+// the operation with cgroup v1 and doesn't with cgroup v2.
+func addBlkioEntry(entry docker.BlkioStatsEntry, read *uint64, write *uint64) {
+	switch strings.ToLower(entry.Op) {
+	case "read":
+		*read += entry.Value
+	case "write":
+		*write += entry.Value
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	mock_dockeriface "github.com/aws/amazon-ecs-agent/agent/engine/dockeriface/mocks"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/mock/gomock"
+)
+
+func testDockerStats(timestamp time.Time) *docker.Stats {
+	stats := &docker.Stats{Read: timestamp}
+	stats.CPUStats.CPUUsage.TotalUsage = 400
+	stats.CPUStats.CPUUsage.PercpuUsage = []uint64{100, 300}
+	stats.MemoryStats.Usage = 1024
+	stats.MemoryStats.Stats.TotalRss = 512
+	stats.MemoryStats.Stats.TotalCache = 256
+	stats.MemoryStats.Stats.TotalInactiveFile = 128
+	stats.MemoryStats.Failcnt = 2
+	stats.CPUStats.ThrottlingData.Periods = 10
+	stats.CPUStats.ThrottlingData.ThrottledPeriods = 2
+	stats.CPUStats.ThrottlingData.ThrottledTime = 3000
+	stats.BlkioStats.IOServiceBytesRecursive = []docker.BlkioStatsEntry{
+		{Major: 202, Op: "Read", Value: 10},
+		{Major: 202, Op: "Write", Value: 20},
+		{Major: 202, Op: "Total", Value: 30},
+		{Major: 203, Op: "read", Value: 5},
+	}
+	stats.BlkioStats.IOServicedRecursive = []docker.BlkioStatsEntry{
+		{Major: 202, Op: "Read", Value: 1},
+		{Major: 202, Op: "Write", Value: 2},
+	}
+	return stats
+}
+
+// waitForDockerStats reads from the collector until something other than
+// errNoNewStats is returned.
+func waitForDockerStats(t *testing.T, collector ContainerStatsCollector, container *CronContainer) (*ContainerStats, error) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		stats, err := collector.getContainerStats(container)
+		if err != errNoNewStats {
+			return stats, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for docker stats")
+	return nil, nil
+}
+
+func TestDockerStatsCollector(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	client := mock_dockeriface.NewMockClient(mockCtrl)
+
+	timestamp := time.Now()
+	streamClosed := make(chan bool)
+	client.EXPECT().Stats(gomock.Any()).Do(func(opts docker.StatsOptions) {
+		if opts.ID != "c1" || !opts.Stream {
+			t.Errorf("Unexpected stats options: %+v", opts)
+		}
+		opts.Stats <- testDockerStats(timestamp)
+		<-opts.Done
+		close(opts.Stats)
+		close(streamClosed)
+	}).Return(nil)
+
+	collector := newDockerStatsCollector(client)
+	container := newCronContainer("c1", collector)
+	stats, err := waitForDockerStats(t, collector, container)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.cpuUsage != 200 || stats.memoryUsage != 1024 || !stats.timestamp.Equal(timestamp) {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// The same sample isn't returned twice
+	_, err = collector.getContainerStats(container)
+	if err != errNoNewStats {
+		t.Errorf("Expected no new stats, got: %v", err)
+	}
+
+	collector.stop()
+	select {
+	case <-streamClosed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the stream to be closed")
+	}
+}
+
+func TestDockerStatsCollectorReopensStream(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	client := mock_dockeriface.NewMockClient(mockCtrl)
+
+	streamErr := errors.New("connection reset")
+	reopened := make(chan bool)
+	gomock.InOrder(
+		client.EXPECT().Stats(gomock.Any()).Do(func(opts docker.StatsOptions) {
+			close(opts.Stats)
+		}).Return(streamErr),
+		client.EXPECT().Stats(gomock.Any()).Do(func(opts docker.StatsOptions) {
+			close(reopened)
+			<-opts.Done
+			close(opts.Stats)
+		}).Return(nil),
+	)
+
+	collector := newDockerStatsCollector(client)
+	container := newCronContainer("c1", collector)
+	_, err := waitForDockerStats(t, collector, container)
+	if err != streamErr {
+		t.Errorf("Expected the stream error, got: %v", err)
+	}
+
+	_, err = collector.getContainerStats(container)
+	if err != errNoNewStats {
+		t.Errorf("Expected the stream to be reopened, got: %v", err)
+	}
+	select {
+	case <-reopened:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the stream to be reopened")
+	}
+	collector.stop()
+}
+
+func TestDockerStatsToContainerStats(t *testing.T) {
+	timestamp := time.Now()
+	stats := dockerStatsToContainerStats(testDockerStats(timestamp), 4)
+	if stats.cpuUsage != 200 {
+		t.Errorf("Expected cpu usage to be divided by the number of per cpu values, got: %d", stats.cpuUsage)
+	}
+	expectedBlockIO := blockIOCounters{readBytes: 15, writeBytes: 20, readOps: 1, writeOps: 2}
+	if stats.blockIOStats != expectedBlockIO {
+		t.Errorf("Expected %+v, got %+v", expectedBlockIO, stats.blockIOStats)
+	}
+	expectedMemory := memoryCounters{rss: 512, cache: 256, workingSet: 896, failcnt: 2}
+	if stats.memoryStats != expectedMemory {
+		t.Errorf("Expected %+v, got %+v", expectedMemory, stats.memoryStats)
+	}
+	expectedThrottling := throttlingCounters{periods: 10, throttledPeriods: 2, throttledTime: 3000}
+	if stats.throttling != expectedThrottling {
+		t.Errorf("Expected %+v, got %+v", expectedThrottling, stats.throttling)
+	}
+	if stats.networkStats != nil {
+		t.Errorf("Expected no network stats, got %+v", stats.networkStats)
+	}
+
+	dockerStats := testDockerStats(timestamp)
+	dockerStats.CPUStats.CPUUsage.PercpuUsage = nil
+	dockerStats.Network.RxBytes = 100
+	dockerStats.Network.TxPackets = 2
+	stats = dockerStatsToContainerStats(dockerStats, 4)
+	if stats.cpuUsage != 100 {
+		t.Errorf("Expected cpu usage to be divided by the number of cpus, got: %d", stats.cpuUsage)
+	}
+	if stats.networkStats == nil || stats.networkStats.rxBytes != 100 || stats.networkStats.txPackets != 2 {
+		t.Errorf("Unexpected network stats: %+v", stats.networkStats)
+	}
+}
+
+// scriptedStatsCollector returns err from every call if set, or a sample
+// otherwise.
+type scriptedStatsCollector struct {
+	err     error
+	calls   int
+	stopped bool
+}
+
+func (collector *scriptedStatsCollector) getContainerStats(container *CronContainer) (*ContainerStats, error) {
+	collector.calls++
+	if collector.err != nil {
+		return nil, collector.err
+	}
+	return createContainerStats(1, 1, time.Now()), nil
+}
+
+func (collector *scriptedStatsCollector) stop() {
+	collector.stopped = true
+}
+
+func TestFallbackStatsCollector(t *testing.T) {
+	preferred := &scriptedStatsCollector{err: errors.New("no cgroup")}
+	fallback := &scriptedStatsCollector{}
+	collector := &fallbackStatsCollector{preferred: preferred, fallback: fallback}
+	container := newCronContainer("c1", collector)
+
+	for i := 0; i < maxCollectorErrors-1; i++ {
+		collector.getContainerStats(container)
+	}
+	// Having nothing new isn't a failure, and resets the count
+	preferred.err = errNoNewStats
+	collector.getContainerStats(container)
+	preferred.err = errors.New("no cgroup")
+	for i := 0; i < maxCollectorErrors-1; i++ {
+		collector.getContainerStats(container)
+	}
+	if fallback.calls != 0 || preferred.stopped {
+		t.Fatal("Expected the preferred collector to still be used")
+	}
+
+	collector.getContainerStats(container)
+	if !preferred.stopped {
+		t.Error("Expected the preferred collector to be stopped")
+	}
+	stats, err := collector.getContainerStats(container)
+	if err != nil || stats == nil {
+		t.Errorf("Expected stats from the fallback collector, got: %v", err)
+	}
+	if fallback.calls != 1 || preferred.calls != 2*maxCollectorErrors {
+		t.Errorf("Unexpected calls; preferred: %d, fallback: %d", preferred.calls, fallback.calls)
+	}
+
+	collector.stop()
+	if !fallback.stopped {
+		t.Error("Expected the fallback collector to be stopped")
+	}
+}
@@ -17,16 +17,22 @@ package stats
 
 import (
 	"fmt"
+	"math"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/pborman/uuid"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	ecsengine "github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerclient"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockeriface"
 	"github.com/aws/amazon-ecs-agent/agent/logger"
 	"github.com/aws/amazon-ecs-agent/agent/stats/resolver"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
+	"github.com/aws/amazon-ecs-agent/agent/utils"
 	"github.com/aws/aws-sdk-go/aws"
 	"golang.org/x/net/context"
 )
@@ -43,23 +49,51 @@ type DockerContainerMetadataResolver struct {
 // defined to make testing easier.
 type Engine interface {
 	GetInstanceMetrics() (*ecstcs.MetricsMetadata, []*ecstcs.TaskMetric, error)
+	GetContainerUsage() []ContainerUsage
+	GetTaskUsage() []TaskUsage
+	TaskUsageEvents(ctx context.Context) <-chan TaskUsageEvent
+	GetAlerts() []Alert
 }
 
 // DockerStatsEngine is used to monitor docker container events and to report
 // utlization metrics of the same.
 type DockerStatsEngine struct {
+	// alerts evaluates the alert rules from the config. It's nil if there
+	// are none.
+	alerts               *alertManager
 	client               ecsengine.DockerClient
 	cluster              string
 	containerInstanceArn string
 	containersLock       sync.RWMutex
 	ctx                  context.Context
-	dockerGraphPath      string
 	events               <-chan ecsengine.DockerContainerChangeEvent
-	resolver             resolver.ContainerMetadataResolver
+	hostProcPath         string
+	// preferredCollector is the config.StatsCollector* value naming where
+	// container stats are read from first.
+	preferredCollector string
+	resolver           resolver.ContainerMetadataResolver
+	// sinks receive container utilization samples every sinkInterval,
+	// independently of publishing to the backend.
+	sinks        []Sink
+	sinksLock    sync.Mutex
+	sinkInterval time.Duration
+	// statsClient streams stats from the Docker remote API. It's nil if it
+	// couldn't be created, in which case only cgroup stats are collected.
+	statsClient dockeriface.Client
+	// unsunkUsage holds the samples which were dropped from the stats queues
+	// before the sinks saw them, until the next flush. It's guarded by
+	// containersLock.
+	unsunkUsage []ContainerUsage
 	// tasksToContainers maps task arns to a map of container ids to CronContainer objects.
 	tasksToContainers map[string]map[string]*CronContainer
 	// tasksToDefinitions maps task arns to task definiton name and family metadata objects.
-	tasksToDefinitions         map[string]*taskDefinition
+	tasksToDefinitions map[string]*taskDefinition
+	// taskUsageLock guards flaggedTasks and taskUsageListeners.
+	taskUsageLock sync.Mutex
+	// flaggedTasks maps task arns to the conditions they met at the last
+	// check, so that events are only raised when a condition starts.
+	flaggedTasks               map[string]map[TaskUsageCondition]bool
+	taskUsageListeners         []chan TaskUsageEvent
 	unsubscribeContainerEvents context.CancelFunc
 }
 
@@ -79,14 +113,31 @@ func (resolver *DockerContainerMetadataResolver) ResolveTask(dockerID string) (*
 	return task, nil
 }
 
+// ResolveContainer resolves the api container object, given container id.
+func (resolver *DockerContainerMetadataResolver) ResolveContainer(dockerID string) (*api.DockerContainer, error) {
+	if resolver.dockerTaskEngine == nil {
+		return nil, fmt.Errorf("Docker task engine uninitialized")
+	}
+	container, found := resolver.dockerTaskEngine.State().ContainerById(dockerID)
+	if !found {
+		return nil, fmt.Errorf("Could not map docker id to container")
+	}
+
+	return container, nil
+}
+
 // NewDockerStatsEngine creates a new instance of the DockerStatsEngine object.
 // MustInit() must be called to initialize the fields of the new event listener.
 func NewDockerStatsEngine(cfg *config.Config) *DockerStatsEngine {
 	if dockerStatsEngine == nil {
 		dockerStatsEngine = &DockerStatsEngine{
+			alerts:             newAlertManager(cfg),
 			client:             nil,
-			dockerGraphPath:    cfg.DockerGraphPath,
+			hostProcPath:       cfg.HostProcPath,
+			preferredCollector: cfg.StatsCollector,
 			resolver:           nil,
+			sinks:              newSinks(cfg),
+			sinkInterval:       cfg.StatsSinkInterval,
 			tasksToContainers:  make(map[string]map[string]*CronContainer),
 			tasksToDefinitions: make(map[string]*taskDefinition),
 		}
@@ -111,6 +162,7 @@ func (engine *DockerStatsEngine) MustInit(taskEngine ecsengine.TaskEngine, clust
 		return err
 	}
 
+	engine.registerContainerMetrics()
 	return engine.Init()
 }
 
@@ -124,6 +176,13 @@ func (engine *DockerStatsEngine) Init() error {
 	}
 
 	go engine.listContainersAndStartEventHandler()
+	go engine.taskUsageLoop(taskUsageCheckInterval)
+	if engine.alerts != nil {
+		go engine.alertLoop(alertCheckInterval)
+	}
+	if len(engine.sinks) > 0 {
+		go engine.sinkLoop(engine.sinkInterval)
+	}
 	return nil
 }
 
@@ -213,6 +272,29 @@ func (engine *DockerStatsEngine) GetInstanceMetrics() (*ecstcs.MetricsMetadata,
 	return metricsMetadata, taskMetrics, nil
 }
 
+// GetContainerUsage returns the most recent usage sample of every watched
+// container. Containers without a CPU utilization yet are left out.
+func (engine *DockerStatsEngine) GetContainerUsage() []ContainerUsage {
+	engine.containersLock.Lock()
+	defer engine.containersLock.Unlock()
+
+	usage := []ContainerUsage{}
+	for taskArn, containerMap := range engine.tasksToContainers {
+		for dockerID, container := range containerMap {
+			if container.statsQueue == nil {
+				continue
+			}
+			usageStats, err := container.statsQueue.GetRawUsageStats(1)
+			if err != nil || math.IsNaN(float64(usageStats[0].CPUUsagePerc)) {
+				// No data collected yet
+				continue
+			}
+			usage = append(usage, engine.newContainerUsage(taskArn, dockerID, container, usageStats[0]))
+		}
+	}
+	return usage
+}
+
 func (engine *DockerStatsEngine) isIdle() bool {
 	return len(engine.tasksToContainers) == 0
 }
@@ -227,9 +309,34 @@ func (engine *DockerStatsEngine) initDockerClient() error {
 		engine.client = client
 	}
 
+	if engine.statsClient == nil {
+		endpoint := utils.DefaultIfBlank(os.Getenv(ecsengine.DOCKER_ENDPOINT_ENV_VARIABLE), ecsengine.DOCKER_DEFAULT_ENDPOINT)
+		client, err := dockerclient.NewFactory(endpoint).GetDefaultClient()
+		if err != nil {
+			// Not fatal; stats can still be read from cgroups
+			log.Warn("Error creating docker client for stats, only cgroup stats will be collected", "err", err)
+		} else {
+			engine.statsClient = client
+		}
+	}
+
 	return nil
 }
 
+// newStatsCollector creates the stats collector of a container. Stats are read
+// from the preferred source, falling back to the other if it keeps failing.
+func (engine *DockerStatsEngine) newStatsCollector() ContainerStatsCollector {
+	cgroupCollector := newCgroupStatsCollector(DefaultCgroupRoot, engine.hostProcPath)
+	if engine.statsClient == nil {
+		return cgroupCollector
+	}
+	dockerCollector := newDockerStatsCollector(engine.statsClient)
+	if engine.preferredCollector == config.StatsCollectorDocker {
+		return &fallbackStatsCollector{preferred: dockerCollector, fallback: cgroupCollector}
+	}
+	return &fallbackStatsCollector{preferred: cgroupCollector, fallback: dockerCollector}
+}
+
 // openEventStream initializes the channel to receive events from docker client's
 // event stream.
 func (engine *DockerStatsEngine) openEventStream() error {
@@ -311,7 +418,7 @@ func (engine *DockerStatsEngine) addContainer(dockerID string) {
 	}
 
 	log.Debug("Adding container to stats watch list", "id", dockerID, "task", task.Arn)
-	container := newCronContainer(dockerID, engine.dockerGraphPath)
+	container := newCronContainer(dockerID, engine.newStatsCollector())
 	engine.tasksToContainers[task.Arn][dockerID] = container
 	engine.tasksToDefinitions[task.Arn] = &taskDefinition{family: task.Family, version: task.Version}
 	container.StartStatsCron()
@@ -409,10 +516,14 @@ func (engine *DockerStatsEngine) getContainerMetricsForTask(taskArn string) ([]*
 	return containerMetrics, nil
 }
 
-// resetStats resets stats for all watched containers.
+// resetStats resets stats for all watched containers. Samples the sinks
+// haven't seen yet are kept for their next flush.
 func (engine *DockerStatsEngine) resetStats() {
 	engine.containersLock.Lock()
 	defer engine.containersLock.Unlock()
+	if len(engine.sinks) > 0 {
+		engine.unsunkUsage = append(engine.unsunkUsage, engine.newSamples()...)
+	}
 	for _, containerMap := range engine.tasksToContainers {
 		for _, container := range containerMap {
 			container.statsQueue.Reset()
@@ -48,11 +48,6 @@ var client, _ = docker.NewClient(endpoint)
 
 var cfg = config.DefaultConfig()
 
-func init() {
-	// Set DockerGraphPath as per changes in 1.6
-	cfg.DockerGraphPath = "/var/run/docker"
-}
-
 // createGremlin creates the gremlin container using the docker client.
 // It is used only in the test code.
 func createGremlin(client *docker.Client) (*docker.Container, error) {
@@ -97,6 +92,15 @@ func (resolver *IntegContainerMetadataResolver) ResolveName(dockerID string) (st
 	return name, nil
 }
 
+func (resolver *IntegContainerMetadataResolver) ResolveContainer(dockerID string) (*api.DockerContainer, error) {
+	name, err := resolver.ResolveName(dockerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.DockerContainer{DockerId: dockerID, Container: &api.Container{Name: name}}, nil
+}
+
 func (resolver *IntegContainerMetadataResolver) addToMap(containerID string) {
 	resolver.containerIDToTask[containerID] = &api.Task{Arn: taskArn, Family: taskDefinitionFamily, Version: taskDefinitionVersion}
 	resolver.containerIDToName[containerID] = containerName
@@ -19,7 +19,9 @@ import (
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
 	ecsengine "github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/recorder"
 	"github.com/aws/amazon-ecs-agent/agent/statemanager"
 	mock_resolver "github.com/aws/amazon-ecs-agent/agent/stats/resolver/mock"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
@@ -46,6 +48,9 @@ func (engine *MockTaskEngine) TaskEvents() (<-chan api.TaskStateChange, <-chan a
 func (engine *MockTaskEngine) SetSaver(statemanager.Saver) {
 }
 
+func (engine *MockTaskEngine) SetRecorder(*recorder.Recorder) {
+}
+
 func (engine *MockTaskEngine) AddTask(*api.Task) error {
 	return nil
 }
@@ -70,9 +75,16 @@ func (engine *MockTaskEngine) Capabilities() []string {
 	return []string{}
 }
 
+func (engine *MockTaskEngine) HostAttributes() map[string]string {
+	return map[string]string{}
+}
+
 func (engine *MockTaskEngine) Disable() {
 }
 
+func (engine *MockTaskEngine) UpdateConfig(*config.Config) {
+}
+
 func validateContainerMetrics(containerMetrics []*ecstcs.ContainerMetric, expected int) error {
 	if len(containerMetrics) != expected {
 		return fmt.Errorf("Mismatch in number of ContainerStatsSet elements. Expected: %d, Got: %d", expected, len(containerMetrics))
@@ -364,3 +376,39 @@ func TestStatsEngineClientErrorListingContainers(t *testing.T) {
 		t.Error("Engine context hasn't been canceled")
 	}
 }
+
+func TestStatsEngineGetContainerUsage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	resolver := mock_resolver.NewMockContainerMetadataResolver(mockCtrl)
+	resolver.EXPECT().ResolveContainer("c1").Return(&api.DockerContainer{DockerId: "c1", Container: &api.Container{Name: "web"}}, nil)
+
+	queue := NewQueue(ContainerStatsBufferLength)
+	engine := &DockerStatsEngine{
+		resolver: resolver,
+		tasksToContainers: map[string]map[string]*CronContainer{
+			"t1": {
+				"c1": &CronContainer{containerMetadata: &ContainerMetadata{DockerID: "c1"}, statsQueue: queue},
+				"c2": &CronContainer{containerMetadata: &ContainerMetadata{DockerID: "c2"}, statsQueue: NewQueue(ContainerStatsBufferLength)},
+			},
+		},
+		tasksToDefinitions: map[string]*taskDefinition{"t1": {family: "family", version: "1"}},
+	}
+
+	queue.Add(createContainerStats(22400432, 1839104, parseNanoTime("2015-02-12T21:22:05.131117533Z")))
+	if usage := engine.GetContainerUsage(); len(usage) != 0 {
+		t.Errorf("Expected no usage from a single sample, got %+v", usage)
+	}
+
+	queue.Add(createContainerStats(116499979, 3649536, parseNanoTime("2015-02-12T21:22:05.232291187Z")))
+	usage := engine.GetContainerUsage()
+	if len(usage) != 1 {
+		t.Fatalf("Expected usage of one container, got %+v", usage)
+	}
+	if usage[0].DockerID != "c1" || usage[0].ContainerName != "web" || usage[0].TaskFamily != "family" {
+		t.Errorf("Usage not tagged correctly: %+v", usage[0])
+	}
+	if !usage[0].Timestamp.Equal(parseNanoTime("2015-02-12T21:22:05.232291187Z")) || usage[0].BlockIO == nil {
+		t.Errorf("Expected the most recent sample, got %+v", usage[0])
+	}
+}
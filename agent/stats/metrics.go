@@ -0,0 +1,127 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"math"
+
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+)
+
+// containerMetricLabels are the labels of the per-container gauges.
+var containerMetricLabels = []string{"task_arn", "docker_id"}
+
+// registerContainerMetrics exposes the most recent utilization of each
+// watched container as gauges in the agent's metrics registry.
+func (engine *DockerStatsEngine) registerContainerMetrics() {
+	metrics.DefaultRegistry.RegisterGaugeFunc(metrics.Namespace+"container_cpu_usage_percent",
+		"Most recent CPU utilization of a container, as a percentage of one CPU.", containerMetricLabels,
+		func(emit func(float64, ...string)) {
+			engine.forEachLatestUsage(func(taskArn, dockerID string, usage UsageStats) {
+				cpu := float64(usage.CPUUsagePerc)
+				if math.IsNaN(cpu) {
+					// A single sample isn't enough to calculate utilization
+					return
+				}
+				emit(cpu, taskArn, dockerID)
+			})
+		})
+	metrics.DefaultRegistry.RegisterGaugeFunc(metrics.Namespace+"container_memory_usage_bytes",
+		"Most recent memory usage of a container.", containerMetricLabels,
+		func(emit func(float64, ...string)) {
+			engine.forEachLatestUsage(func(taskArn, dockerID string, usage UsageStats) {
+				emit(float64(usage.MemoryUsageInMegs)*BytesInMiB, taskArn, dockerID)
+			})
+		})
+	metrics.DefaultRegistry.RegisterGaugeFunc(metrics.Namespace+"container_memory_working_set_bytes",
+		"Most recent memory usage of a container, less inactive page cache.", containerMetricLabels,
+		func(emit func(float64, ...string)) {
+			engine.forEachLatestUsage(func(taskArn, dockerID string, usage UsageStats) {
+				emit(float64(usage.Memory.WorkingSetBytes), taskArn, dockerID)
+			})
+		})
+	metrics.DefaultRegistry.RegisterCounterFunc(metrics.Namespace+"container_cpu_throttled_periods",
+		"Number of enforcement periods in which a container was throttled, as of its most recent sample.", containerMetricLabels,
+		func(emit func(float64, ...string)) {
+			engine.forEachLatestUsage(func(taskArn, dockerID string, usage UsageStats) {
+				// The cgroup's own cumulative count, rather than the
+				// increase since the previous sample
+				emit(float64(usage.throttling.throttledPeriods), taskArn, dockerID)
+			})
+		})
+	engine.registerRateMetric("container_network_receive_bytes_per_second",
+		"Most recent rate at which a container received bytes over the network.",
+		func(usage UsageStats) (float64, bool) {
+			if usage.Network == nil {
+				return 0, false
+			}
+			return usage.Network.RxBytesPerSec, true
+		})
+	engine.registerRateMetric("container_network_transmit_bytes_per_second",
+		"Most recent rate at which a container transmitted bytes over the network.",
+		func(usage UsageStats) (float64, bool) {
+			if usage.Network == nil {
+				return 0, false
+			}
+			return usage.Network.TxBytesPerSec, true
+		})
+	engine.registerRateMetric("container_block_io_read_bytes_per_second",
+		"Most recent rate at which a container read bytes from block devices.",
+		func(usage UsageStats) (float64, bool) {
+			if usage.BlockIO == nil {
+				return 0, false
+			}
+			return usage.BlockIO.ReadBytesPerSec, true
+		})
+	engine.registerRateMetric("container_block_io_write_bytes_per_second",
+		"Most recent rate at which a container wrote bytes to block devices.",
+		func(usage UsageStats) (float64, bool) {
+			if usage.BlockIO == nil {
+				return 0, false
+			}
+			return usage.BlockIO.WriteBytesPerSec, true
+		})
+}
+
+// registerRateMetric registers a per-container gauge of a rate in the most
+// recent sample. Containers whose sample doesn't have the rate are left out.
+func (engine *DockerStatsEngine) registerRateMetric(name string, help string, rate func(UsageStats) (float64, bool)) {
+	metrics.DefaultRegistry.RegisterGaugeFunc(metrics.Namespace+name, help, containerMetricLabels,
+		func(emit func(float64, ...string)) {
+			engine.forEachLatestUsage(func(taskArn, dockerID string, usage UsageStats) {
+				value, ok := rate(usage)
+				if ok {
+					emit(value, taskArn, dockerID)
+				}
+			})
+		})
+}
+
+// forEachLatestUsage calls fn with the most recent usage sample of every
+// watched container which has one.
+func (engine *DockerStatsEngine) forEachLatestUsage(fn func(taskArn, dockerID string, usage UsageStats)) {
+	engine.containersLock.RLock()
+	defer engine.containersLock.RUnlock()
+
+	for taskArn, containerMap := range engine.tasksToContainers {
+		for dockerID, container := range containerMap {
+			usageStats, err := container.statsQueue.GetRawUsageStats(1)
+			if err != nil {
+				// No data collected yet
+				continue
+			}
+			fn(taskArn, dockerID, usageStats[0])
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+)
+
+func TestContainerMetrics(t *testing.T) {
+	queue := NewQueue(10)
+	engine := &DockerStatsEngine{
+		tasksToContainers: map[string]map[string]*CronContainer{
+			"t1": {
+				"c1": &CronContainer{
+					containerMetadata: &ContainerMetadata{DockerID: "c1"},
+					statsQueue:        queue,
+				},
+				// No samples yet; should be left out
+				"c2": &CronContainer{
+					containerMetadata: &ContainerMetadata{DockerID: "c2"},
+					statsQueue:        NewQueue(10),
+				},
+			},
+		},
+	}
+	engine.registerContainerMetrics()
+
+	stats := createContainerStats(22400432, 1839104, parseNanoTime("2015-02-12T21:22:05.131117533Z"))
+	stats.throttling.throttledPeriods = 5
+	queue.Add(stats)
+	text := writeMetrics(t)
+	if strings.Contains(text, `container_cpu_usage_percent{`) {
+		t.Errorf("Expected no cpu usage from a single sample, got:\n%s", text)
+	}
+	if !strings.Contains(text, `container_memory_usage_bytes{task_arn="t1",docker_id="c1"} 1.048576e+06`) {
+		t.Errorf("Expected memory usage of c1, got:\n%s", text)
+	}
+	// Counters are cumulative, so they don't need a previous sample
+	if !strings.Contains(text, `container_cpu_throttled_periods{task_arn="t1",docker_id="c1"} 5`) {
+		t.Errorf("Expected cpu throttling of c1, got:\n%s", text)
+	}
+
+	stats = createContainerStats(116499979, 3649536, parseNanoTime("2015-02-12T21:22:05.232291187Z"))
+	stats.throttling.throttledPeriods = 7
+	queue.Add(stats)
+	text = writeMetrics(t)
+	if !strings.Contains(text, `container_cpu_usage_percent{task_arn="t1",docker_id="c1"} `) {
+		t.Errorf("Expected cpu usage of c1, got:\n%s", text)
+	}
+	if !strings.Contains(text, `container_block_io_read_bytes_per_second{task_arn="t1",docker_id="c1"} 0`) {
+		t.Errorf("Expected block io usage of c1, got:\n%s", text)
+	}
+	if !strings.Contains(text, "# TYPE "+metrics.Namespace+"container_cpu_throttled_periods counter\n") ||
+		!strings.Contains(text, `container_cpu_throttled_periods{task_arn="t1",docker_id="c1"} 7`) {
+		t.Errorf("Expected the cumulative cpu throttling of c1 as a counter, got:\n%s", text)
+	}
+	if strings.Contains(text, `container_network_receive_bytes_per_second{`) {
+		t.Errorf("Expected no network usage without network stats, got:\n%s", text)
+	}
+	if strings.Contains(text, `docker_id="c2"`) {
+		t.Errorf("Expected no metrics for a container without samples, got:\n%s", text)
+	}
+}
+
+func writeMetrics(t *testing.T) string {
+	var buf bytes.Buffer
+	err := metrics.DefaultRegistry.WriteText(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
@@ -17,8 +17,10 @@
 package mock_stats
 
 import (
+	stats "github.com/aws/amazon-ecs-agent/agent/stats"
 	ecstcs "github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
 	gomock "github.com/golang/mock/gomock"
+	context "golang.org/x/net/context"
 )
 
 // Mock of Engine interface
@@ -42,6 +44,26 @@ func (_m *MockEngine) EXPECT() *_MockEngineRecorder {
 	return _m.recorder
 }
 
+func (_m *MockEngine) GetAlerts() []stats.Alert {
+	ret := _m.ctrl.Call(_m, "GetAlerts")
+	ret0, _ := ret[0].([]stats.Alert)
+	return ret0
+}
+
+func (_mr *_MockEngineRecorder) GetAlerts() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetAlerts")
+}
+
+func (_m *MockEngine) GetContainerUsage() []stats.ContainerUsage {
+	ret := _m.ctrl.Call(_m, "GetContainerUsage")
+	ret0, _ := ret[0].([]stats.ContainerUsage)
+	return ret0
+}
+
+func (_mr *_MockEngineRecorder) GetContainerUsage() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetContainerUsage")
+}
+
 func (_m *MockEngine) GetInstanceMetrics() (*ecstcs.MetricsMetadata, []*ecstcs.TaskMetric, error) {
 	ret := _m.ctrl.Call(_m, "GetInstanceMetrics")
 	ret0, _ := ret[0].(*ecstcs.MetricsMetadata)
@@ -53,3 +75,23 @@ func (_m *MockEngine) GetInstanceMetrics() (*ecstcs.MetricsMetadata, []*ecstcs.T
 func (_mr *_MockEngineRecorder) GetInstanceMetrics() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetInstanceMetrics")
 }
+
+func (_m *MockEngine) GetTaskUsage() []stats.TaskUsage {
+	ret := _m.ctrl.Call(_m, "GetTaskUsage")
+	ret0, _ := ret[0].([]stats.TaskUsage)
+	return ret0
+}
+
+func (_mr *_MockEngineRecorder) GetTaskUsage() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTaskUsage")
+}
+
+func (_m *MockEngine) TaskUsageEvents(_param0 context.Context) <-chan stats.TaskUsageEvent {
+	ret := _m.ctrl.Call(_m, "TaskUsageEvents", _param0)
+	ret0, _ := ret[0].(<-chan stats.TaskUsageEvent)
+	return ret0
+}
+
+func (_mr *_MockEngineRecorder) TaskUsageEvents(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TaskUsageEvents", arg0)
+}
@@ -0,0 +1,85 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// netDevFields is the number of counters listed for each interface in
+// /proc/<pid>/net/dev; eight for receive followed by eight for transmit.
+const netDevFields = 16
+
+// readNetworkStats reads the network counters of a container from the
+// net/dev file of one of its processes. The file lists the interfaces of the
+// process' network namespace, so unlike the host side veth interfaces in
+// /sys/class/net, it can be read from within the agent's container as long as
+// the host's procfs is mounted at procPath.
+func readNetworkStats(procPath string, pid int) (*networkCounters, error) {
+	file, err := os.Open(filepath.Join(procPath, strconv.Itoa(pid), "net", "dev"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseNetDev(file.Name(), bufio.NewScanner(file))
+}
+
+// parseNetDev sums the counters of every interface other than loopback.
+//
+// Expected format, after two header lines:
+//
+//	  lo:       0       0    0    0    0     0          0         0        0       0    0    0    0     0       0          0
+//	eth0:    1296      16    0    0    0     0          0         0      648       8    0    0    0     0       0          0
+func parseNetDev(path string, scanner *bufio.Scanner) (*networkCounters, error) {
+	stats := &networkCounters{}
+	for line := 0; scanner.Scan(); line++ {
+		if line < 2 {
+			continue
+		}
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid line found while parsing %s: %s", path, scanner.Text())
+		}
+		if strings.TrimSpace(parts[0]) == "lo" {
+			continue
+		}
+		fields := strings.Fields(parts[1])
+		if len(fields) != netDevFields {
+			return nil, fmt.Errorf("Invalid line found while parsing %s: %s", path, scanner.Text())
+		}
+		counters := make([]uint64, netDevFields)
+		for i, field := range fields {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			counters[i] = value
+		}
+		stats.rxBytes += counters[0]
+		stats.rxPackets += counters[1]
+		stats.rxErrors += counters[2]
+		stats.txBytes += counters[8]
+		stats.txPackets += counters[9]
+		stats.txErrors += counters[10]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestReadNetworkStats(t *testing.T) {
+	stats, err := readNetworkStats("testdata/proc", 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Loopback is left out
+	expected := networkCounters{
+		rxBytes:   2000,
+		rxPackets: 20,
+		rxErrors:  1,
+		txBytes:   1000,
+		txPackets: 10,
+		txErrors:  3,
+	}
+	if *stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *stats)
+	}
+}
+
+func TestReadNetworkStatsMissingProcess(t *testing.T) {
+	_, err := readNetworkStats("testdata/proc", 4321)
+	if err == nil {
+		t.Error("Expected an error reading stats of a process which doesn't exist")
+	}
+}
+
+func TestParseNetDevInvalid(t *testing.T) {
+	netDev := "header\nheader\n  eth0: 1 2 3\n"
+	_, err := parseNetDev("dev", bufio.NewScanner(strings.NewReader(netDev)))
+	if err == nil {
+		t.Error("Expected an error parsing a line with missing counters")
+	}
+}
@@ -16,7 +16,9 @@ package stats
 import (
 	"fmt"
 	"math"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
 )
@@ -56,12 +58,30 @@ func (queue *Queue) Add(rawStat *ContainerStats) {
 		CPUUsagePerc:      (float32)(nan32()),
 		MemoryUsageInMegs: (uint32)(rawStat.memoryUsage) / BytesInMiB,
 		Timestamp:         rawStat.timestamp,
-		cpuUsage:          rawStat.cpuUsage,
+		Pids:              rawStat.pids,
+		Memory: MemoryUsage{
+			RSSBytes:        rawStat.memoryStats.rss,
+			CacheBytes:      rawStat.memoryStats.cache,
+			SwapBytes:       rawStat.memoryStats.swap,
+			WorkingSetBytes: rawStat.memoryStats.workingSet,
+		},
+		cpuUsage:      rawStat.cpuUsage,
+		memoryFailcnt: rawStat.memoryStats.failcnt,
+		throttling:    rawStat.throttling,
+		network:       rawStat.networkStats,
+		blockIO:       rawStat.blockIOStats,
 	}
 	if queueLength != 0 {
-		// % utilization can be calculated only when queue is non-empty.
+		// % utilization and rates can be calculated only when queue is non-empty.
 		lastStat := queue.buffer[queueLength-1]
-		stat.CPUUsagePerc = 100 * (float32)(rawStat.cpuUsage-lastStat.cpuUsage) / (float32)(rawStat.timestamp.Sub(lastStat.Timestamp).Nanoseconds())
+		elapsed := rawStat.timestamp.Sub(lastStat.Timestamp)
+		stat.CPUUsagePerc = 100 * (float32)(rawStat.cpuUsage-lastStat.cpuUsage) / (float32)(elapsed.Nanoseconds())
+		stat.CPUThrottling = getCPUThrottling(&lastStat.throttling, &rawStat.throttling)
+		stat.Memory.LimitHits = increase(lastStat.memoryFailcnt, rawStat.memoryStats.failcnt)
+		stat.BlockIO = getBlockIOUsage(&lastStat.blockIO, &rawStat.blockIOStats, elapsed)
+		if lastStat.network != nil && rawStat.networkStats != nil {
+			stat.Network = getNetworkUsage(lastStat.network, rawStat.networkStats, elapsed)
+		}
 		if queue.maxSize == queueLength {
 			// Remove first element if queue is full.
 			queue.buffer = queue.buffer[1:queueLength]
@@ -104,12 +124,66 @@ func (queue *Queue) GetRawUsageStats(numStats int) ([]UsageStats, error) {
 			CPUUsagePerc:      rawUsageStat.CPUUsagePerc,
 			MemoryUsageInMegs: rawUsageStat.MemoryUsageInMegs,
 			Timestamp:         rawUsageStat.Timestamp,
+			Pids:              rawUsageStat.Pids,
+			Memory:            rawUsageStat.Memory,
+			CPUThrottling:     rawUsageStat.CPUThrottling,
+			Network:           rawUsageStat.Network,
+			BlockIO:           rawUsageStat.BlockIO,
+			memoryFailcnt:     rawUsageStat.memoryFailcnt,
+			throttling:        rawUsageStat.throttling,
 		}
 	}
 
 	return usageStats, nil
 }
 
+func getNetworkUsage(last, current *networkCounters, elapsed time.Duration) *NetworkUsage {
+	return &NetworkUsage{
+		RxBytesPerSec:   perSecond(last.rxBytes, current.rxBytes, elapsed),
+		RxPacketsPerSec: perSecond(last.rxPackets, current.rxPackets, elapsed),
+		RxErrorsPerSec:  perSecond(last.rxErrors, current.rxErrors, elapsed),
+		TxBytesPerSec:   perSecond(last.txBytes, current.txBytes, elapsed),
+		TxPacketsPerSec: perSecond(last.txPackets, current.txPackets, elapsed),
+		TxErrorsPerSec:  perSecond(last.txErrors, current.txErrors, elapsed),
+	}
+}
+
+func getBlockIOUsage(last, current *blockIOCounters, elapsed time.Duration) *BlockIOUsage {
+	return &BlockIOUsage{
+		ReadBytesPerSec:  perSecond(last.readBytes, current.readBytes, elapsed),
+		WriteBytesPerSec: perSecond(last.writeBytes, current.writeBytes, elapsed),
+		ReadOpsPerSec:    perSecond(last.readOps, current.readOps, elapsed),
+		WriteOpsPerSec:   perSecond(last.writeOps, current.writeOps, elapsed),
+	}
+}
+
+func getCPUThrottling(last, current *throttlingCounters) *CPUThrottling {
+	return &CPUThrottling{
+		Periods:          increase(last.periods, current.periods),
+		ThrottledPeriods: increase(last.throttledPeriods, current.throttledPeriods),
+		ThrottledTimeNs:  increase(last.throttledTime, current.throttledTime),
+	}
+}
+
+// increase returns how much a cumulative counter increased, treating one which
+// went backwards as not having increased.
+func increase(last, current uint64) uint64 {
+	if current < last {
+		return 0
+	}
+	return current - last
+}
+
+// perSecond returns the rate at which a cumulative counter increased. A
+// counter which went backwards, as when an interface is recreated, is treated
+// as not having increased.
+func perSecond(last, current uint64, elapsed time.Duration) float64 {
+	if current < last || elapsed <= 0 {
+		return 0
+	}
+	return float64(current-last) / elapsed.Seconds()
+}
+
 func getCPUUsagePerc(s *UsageStats) float64 {
 	return float64(s.CPUUsagePerc)
 }
@@ -158,3 +232,148 @@ func (queue *Queue) getCWStatsSet(f getUsageFunc) (*ecstcs.CWStatsSet, error) {
 		Sum:         &sum,
 	}, nil
 }
+
+// DefaultPercentiles are the percentiles summarized by a StatsQuery which
+// doesn't list any.
+var DefaultPercentiles = []float64{50, 90, 99}
+
+// Metric names a per sample value of UsageStats which can be summarized by a
+// StatsQuery.
+type Metric string
+
+const (
+	MetricCPUUsagePerc          Metric = "cpuUsagePerc"
+	MetricMemoryUsageInMegs     Metric = "memoryUsageInMegs"
+	MetricMemoryRSSBytes        Metric = "memoryRSSBytes"
+	MetricMemoryCacheBytes      Metric = "memoryCacheBytes"
+	MetricMemorySwapBytes       Metric = "memorySwapBytes"
+	MetricMemoryWorkingSetBytes Metric = "memoryWorkingSetBytes"
+	MetricCPUThrottledPeriods   Metric = "cpuThrottledPeriods"
+	MetricCPUThrottledTimeNs    Metric = "cpuThrottledTimeNs"
+	MetricMemoryLimitHits       Metric = "memoryLimitHits"
+)
+
+// metricGetters return the value of each metric in a sample, or NaN when the
+// sample doesn't have it.
+var metricGetters = map[Metric]getUsageFunc{
+	MetricCPUUsagePerc:      getCPUUsagePerc,
+	MetricMemoryUsageInMegs: getMemoryUsagePerc,
+	MetricMemoryRSSBytes: func(s *UsageStats) float64 {
+		return float64(s.Memory.RSSBytes)
+	},
+	MetricMemoryCacheBytes: func(s *UsageStats) float64 {
+		return float64(s.Memory.CacheBytes)
+	},
+	MetricMemorySwapBytes: func(s *UsageStats) float64 {
+		return float64(s.Memory.SwapBytes)
+	},
+	MetricMemoryWorkingSetBytes: func(s *UsageStats) float64 {
+		return float64(s.Memory.WorkingSetBytes)
+	},
+	MetricCPUThrottledPeriods: func(s *UsageStats) float64 {
+		if s.CPUThrottling == nil {
+			return math.NaN()
+		}
+		return float64(s.CPUThrottling.ThrottledPeriods)
+	},
+	MetricCPUThrottledTimeNs: func(s *UsageStats) float64 {
+		if s.CPUThrottling == nil {
+			return math.NaN()
+		}
+		return float64(s.CPUThrottling.ThrottledTimeNs)
+	},
+	MetricMemoryLimitHits: func(s *UsageStats) float64 {
+		return float64(s.Memory.LimitHits)
+	},
+}
+
+// StatsQuery selects the samples in a Queue to summarize.
+type StatsQuery struct {
+	Metric Metric
+	// Since leaves out samples taken before it, if set.
+	Since time.Time
+	// Percentiles are between 0 and 100. DefaultPercentiles are used if
+	// there are none.
+	Percentiles []float64
+}
+
+// StatsSummary summarizes a metric over the samples selected by a StatsQuery.
+type StatsSummary struct {
+	Metric      Metric            `json:"metric"`
+	Min         float64           `json:"min"`
+	Max         float64           `json:"max"`
+	Sum         float64           `json:"sum"`
+	Mean        float64           `json:"mean"`
+	SampleCount int64             `json:"sampleCount"`
+	Percentiles []PercentileValue `json:"percentiles"`
+}
+
+// PercentileValue is the value of a metric at a percentile.
+type PercentileValue struct {
+	Percentile float64 `json:"percentile"`
+	Value      float64 `json:"value"`
+}
+
+// Query summarizes a metric over the samples in the queue. Percentiles are
+// interpolated linearly between the closest samples.
+func (queue *Queue) Query(query StatsQuery) (*StatsSummary, error) {
+	f, ok := metricGetters[query.Metric]
+	if !ok {
+		return nil, fmt.Errorf("Unknown metric: %s", query.Metric)
+	}
+	percentiles := query.Percentiles
+	if len(percentiles) == 0 {
+		percentiles = DefaultPercentiles
+	}
+	for _, percentile := range percentiles {
+		if percentile < 0 || percentile > 100 || math.IsNaN(percentile) {
+			return nil, fmt.Errorf("Invalid percentile: %v", percentile)
+		}
+	}
+
+	queue.bufferLock.RLock()
+	values := make([]float64, 0, len(queue.buffer))
+	for _, stat := range queue.buffer {
+		if stat.Timestamp.Before(query.Since) {
+			continue
+		}
+		value := f(&stat)
+		if math.IsNaN(value) {
+			continue
+		}
+		values = append(values, value)
+	}
+	queue.bufferLock.RUnlock()
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("No data in the queue")
+	}
+	sort.Float64s(values)
+
+	summary := &StatsSummary{
+		Metric:      query.Metric,
+		Min:         values[0],
+		Max:         values[len(values)-1],
+		SampleCount: int64(len(values)),
+		Percentiles: make([]PercentileValue, len(percentiles)),
+	}
+	for _, value := range values {
+		summary.Sum += value
+	}
+	summary.Mean = summary.Sum / float64(len(values))
+	for i, percentile := range percentiles {
+		summary.Percentiles[i] = PercentileValue{
+			Percentile: percentile,
+			Value:      percentileOf(values, percentile),
+		}
+	}
+	return summary, nil
+}
+
+// percentileOf returns the percentile of sorted, non-empty values.
+func percentileOf(sorted []float64, percentile float64) float64 {
+	rank := percentile / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
@@ -187,3 +187,151 @@ func TestQueueAddRemove(t *testing.T) {
 	}
 
 }
+
+func TestQueueNetworkAndBlockIORates(t *testing.T) {
+	start := parseNanoTime("2015-02-12T21:22:05.131117533Z")
+	queue := NewQueue(10)
+	queue.Add(&ContainerStats{
+		timestamp:    start,
+		networkStats: &networkCounters{rxBytes: 1000, txBytes: 500, rxPackets: 10},
+		blockIOStats: blockIOCounters{readBytes: 4096, writeOps: 1},
+	})
+	queue.Add(&ContainerStats{
+		timestamp:    start.Add(500 * time.Millisecond),
+		networkStats: &networkCounters{rxBytes: 3000, txBytes: 1500, rxPackets: 20, rxErrors: 1},
+		blockIOStats: blockIOCounters{readBytes: 8192, writeOps: 3},
+	})
+	// The interface was recreated, so the counters went backwards
+	queue.Add(&ContainerStats{
+		timestamp:    start.Add(time.Second),
+		networkStats: &networkCounters{rxBytes: 100},
+		blockIOStats: blockIOCounters{readBytes: 8192, writeOps: 3},
+	})
+	// Network stats couldn't be read
+	queue.Add(&ContainerStats{
+		timestamp:    start.Add(1500 * time.Millisecond),
+		blockIOStats: blockIOCounters{readBytes: 8192, writeOps: 3},
+	})
+
+	usageStats, err := queue.GetRawUsageStats(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// usageStats is ordered newest first
+	if usageStats[3].Network != nil || usageStats[3].BlockIO != nil {
+		t.Error("Expected no rates for the first sample")
+	}
+	expectedNetwork := NetworkUsage{RxBytesPerSec: 4000, RxPacketsPerSec: 20, RxErrorsPerSec: 2, TxBytesPerSec: 2000}
+	if usageStats[2].Network == nil || *usageStats[2].Network != expectedNetwork {
+		t.Errorf("Expected network usage %+v, got %+v", expectedNetwork, usageStats[2].Network)
+	}
+	expectedBlockIO := BlockIOUsage{ReadBytesPerSec: 8192, WriteOpsPerSec: 4}
+	if usageStats[2].BlockIO == nil || *usageStats[2].BlockIO != expectedBlockIO {
+		t.Errorf("Expected block io usage %+v, got %+v", expectedBlockIO, usageStats[2].BlockIO)
+	}
+	if usageStats[1].Network == nil || *usageStats[1].Network != (NetworkUsage{}) {
+		t.Errorf("Expected a counter reset to be reported as no usage, got %+v", usageStats[1].Network)
+	}
+	if usageStats[0].Network != nil {
+		t.Errorf("Expected no network usage without network stats, got %+v", usageStats[0].Network)
+	}
+	if usageStats[0].BlockIO == nil || *usageStats[0].BlockIO != (BlockIOUsage{}) {
+		t.Errorf("Expected idle block io usage, got %+v", usageStats[0].BlockIO)
+	}
+}
+
+func TestQueueMemoryAndThrottling(t *testing.T) {
+	start := parseNanoTime("2015-02-12T21:22:05.131117533Z")
+	queue := NewQueue(10)
+	queue.Add(&ContainerStats{
+		timestamp:   start,
+		memoryStats: memoryCounters{rss: 1, cache: 2, swap: 3, workingSet: 4, failcnt: 5},
+		throttling:  throttlingCounters{periods: 10, throttledPeriods: 1, throttledTime: 1000},
+	})
+	queue.Add(&ContainerStats{
+		timestamp:   start.Add(500 * time.Millisecond),
+		memoryStats: memoryCounters{failcnt: 7},
+		throttling:  throttlingCounters{periods: 15, throttledPeriods: 3, throttledTime: 5000},
+	})
+
+	usageStats, err := queue.GetRawUsageStats(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedMemory := MemoryUsage{RSSBytes: 1, CacheBytes: 2, SwapBytes: 3, WorkingSetBytes: 4}
+	if usageStats[1].Memory != expectedMemory {
+		t.Errorf("Expected memory usage %+v, got %+v", expectedMemory, usageStats[1].Memory)
+	}
+	if usageStats[0].Memory.LimitHits != 2 {
+		t.Errorf("Expected the memory limit to be hit twice since the first sample, got %d", usageStats[0].Memory.LimitHits)
+	}
+	if usageStats[1].CPUThrottling != nil {
+		t.Error("Expected no throttling for the first sample")
+	}
+	expectedThrottling := CPUThrottling{Periods: 5, ThrottledPeriods: 2, ThrottledTimeNs: 4000}
+	if usageStats[0].CPUThrottling == nil || *usageStats[0].CPUThrottling != expectedThrottling {
+		t.Errorf("Expected throttling %+v, got %+v", expectedThrottling, usageStats[0].CPUThrottling)
+	}
+}
+
+func TestQueueQuery(t *testing.T) {
+	start := parseNanoTime("2015-02-12T21:22:05.131117533Z")
+	queue := NewQueue(10)
+	for i := 1; i <= 10; i++ {
+		queue.Add(&ContainerStats{
+			timestamp:   start.Add(time.Duration(i) * time.Second),
+			memoryStats: memoryCounters{workingSet: uint64(i * 10)},
+		})
+	}
+
+	summary, err := queue.Query(StatsQuery{Metric: MetricMemoryWorkingSetBytes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Min != 10 || summary.Max != 100 || summary.Sum != 550 || summary.Mean != 55 || summary.SampleCount != 10 {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+	expectedPercentiles := []PercentileValue{{50, 55}, {90, 91}, {99, 99.1}}
+	if len(summary.Percentiles) != len(expectedPercentiles) {
+		t.Fatalf("Expected the default percentiles, got %+v", summary.Percentiles)
+	}
+	for i, expected := range expectedPercentiles {
+		if math.Abs(summary.Percentiles[i].Value-expected.Value) > 1e-9 || summary.Percentiles[i].Percentile != expected.Percentile {
+			t.Errorf("Expected %+v, got %+v", expected, summary.Percentiles[i])
+		}
+	}
+
+	summary, err = queue.Query(StatsQuery{
+		Metric:      MetricMemoryWorkingSetBytes,
+		Since:       start.Add(8 * time.Second),
+		Percentiles: []float64{0, 100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.SampleCount != 3 || summary.Percentiles[0].Value != 80 || summary.Percentiles[1].Value != 100 {
+		t.Errorf("Unexpected summary of recent samples: %+v", summary)
+	}
+
+	// The first sample has no cpu utilization or throttling, and is skipped
+	summary, err = queue.Query(StatsQuery{Metric: MetricCPUThrottledPeriods})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.SampleCount != 9 {
+		t.Errorf("Expected 9 samples, got %d", summary.SampleCount)
+	}
+
+	_, err = queue.Query(StatsQuery{Metric: "unknown"})
+	if err == nil {
+		t.Error("Expected an error querying an unknown metric")
+	}
+	_, err = queue.Query(StatsQuery{Metric: MetricCPUUsagePerc, Percentiles: []float64{101}})
+	if err == nil {
+		t.Error("Expected an error querying an invalid percentile")
+	}
+	_, err = NewQueue(10).Query(StatsQuery{Metric: MetricCPUUsagePerc})
+	if err == nil {
+		t.Error("Expected an error querying an empty queue")
+	}
+}
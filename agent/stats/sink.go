@@ -0,0 +1,266 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+)
+
+// sinkMetricPrefix prefixes the name of every metric written to a StatsD or
+// Graphite sink.
+const sinkMetricPrefix = "ecs.container."
+
+// ContainerUsage is a single utilization sample of a container, along with
+// the task and container it was collected from.
+type ContainerUsage struct {
+	TaskArn       string `json:"taskArn"`
+	TaskFamily    string `json:"taskFamily"`
+	TaskVersion   string `json:"taskVersion"`
+	ContainerName string `json:"containerName"`
+	DockerID      string `json:"dockerId"`
+	UsageStats
+}
+
+// sinkTag is a single tag attached to every metric of a sample.
+type sinkTag struct {
+	key   string
+	value string
+}
+
+// tags returns the tags which identify where the sample came from.
+func (usage *ContainerUsage) tags() []sinkTag {
+	return []sinkTag{
+		{"task_arn", usage.TaskArn},
+		{"task_family", usage.TaskFamily},
+		{"task_version", usage.TaskVersion},
+		{"container_name", usage.ContainerName},
+	}
+}
+
+// sinkValue is a single named value of a sample.
+type sinkValue struct {
+	name  string
+	value float64
+}
+
+// values returns the metrics in the sample. The process count and network
+// and block I/O rates are left out when the sample doesn't have them.
+func (usage *ContainerUsage) values() []sinkValue {
+	values := []sinkValue{
+		{"cpu_usage_percent", float64(usage.CPUUsagePerc)},
+		{"memory_usage_bytes", float64(usage.MemoryUsageInMegs) * BytesInMiB},
+	}
+	if usage.Pids > 0 {
+		values = append(values, sinkValue{"pids", float64(usage.Pids)})
+	}
+	if usage.Network != nil {
+		values = append(values,
+			sinkValue{"network_rx_bytes_per_second", usage.Network.RxBytesPerSec},
+			sinkValue{"network_rx_packets_per_second", usage.Network.RxPacketsPerSec},
+			sinkValue{"network_rx_errors_per_second", usage.Network.RxErrorsPerSec},
+			sinkValue{"network_tx_bytes_per_second", usage.Network.TxBytesPerSec},
+			sinkValue{"network_tx_packets_per_second", usage.Network.TxPacketsPerSec},
+			sinkValue{"network_tx_errors_per_second", usage.Network.TxErrorsPerSec},
+		)
+	}
+	if usage.BlockIO != nil {
+		values = append(values,
+			sinkValue{"block_io_read_bytes_per_second", usage.BlockIO.ReadBytesPerSec},
+			sinkValue{"block_io_write_bytes_per_second", usage.BlockIO.WriteBytesPerSec},
+			sinkValue{"block_io_read_ops_per_second", usage.BlockIO.ReadOpsPerSec},
+			sinkValue{"block_io_write_ops_per_second", usage.BlockIO.WriteOpsPerSec},
+		)
+	}
+	return values
+}
+
+// Sink receives container utilization samples from the stats engine, for
+// delivery to a local monitoring system.
+type Sink interface {
+	// Write delivers a batch of samples, oldest first.
+	Write([]ContainerUsage) error
+	// Close releases any resources held by the sink.
+	Close() error
+}
+
+// newSinks creates a sink for each destination set in the config. Sinks
+// which can't be created are logged and left out.
+func newSinks(cfg *config.Config) []Sink {
+	var sinks []Sink
+	if cfg.StatsDEndpoint != "" {
+		sink, err := NewStatsDSink(cfg.StatsDEndpoint)
+		if err != nil {
+			log.Warn("Error creating statsd sink", "err", err, "endpoint", cfg.StatsDEndpoint)
+		} else {
+			sinks = append(sinks, sink)
+		}
+	}
+	if cfg.GraphiteEndpoint != "" {
+		sinks = append(sinks, NewGraphiteSink(cfg.GraphiteEndpoint))
+	}
+	if cfg.StatsFile != "" {
+		sink, err := NewJSONLinesSink(cfg.StatsFile)
+		if err != nil {
+			log.Warn("Error creating stats file sink", "err", err, "file", cfg.StatsFile)
+		} else {
+			sinks = append(sinks, sink)
+		}
+	}
+	return sinks
+}
+
+// sinkLoop writes new samples to the sinks every interval until the engine's
+// context is cancelled, after which the sinks are closed.
+func (engine *DockerStatsEngine) sinkLoop(interval time.Duration) {
+	if interval <= 0 {
+		interval = config.DefaultStatsSinkInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-engine.ctx.Done():
+			engine.closeSinks()
+			return
+		case <-ticker.C:
+			engine.flushSinks()
+		}
+	}
+}
+
+// flushSinks writes every sample collected since the last flush to each of
+// the sinks.
+func (engine *DockerStatsEngine) flushSinks() {
+	if len(engine.sinks) == 0 {
+		return
+	}
+	engine.sinksLock.Lock()
+	defer engine.sinksLock.Unlock()
+
+	usage := engine.collectNewUsage()
+	if len(usage) == 0 {
+		return
+	}
+	for _, sink := range engine.sinks {
+		err := sink.Write(usage)
+		if err != nil {
+			log.Warn("Error writing stats to sink", "err", err)
+		}
+	}
+}
+
+func (engine *DockerStatsEngine) closeSinks() {
+	engine.sinksLock.Lock()
+	defer engine.sinksLock.Unlock()
+	for _, sink := range engine.sinks {
+		err := sink.Close()
+		if err != nil {
+			log.Warn("Error closing stats sink", "err", err)
+		}
+	}
+}
+
+// collectNewUsage returns the samples of every watched container which are
+// newer than the last flush, oldest first, after those kept when the stats
+// were last reset.
+func (engine *DockerStatsEngine) collectNewUsage() []ContainerUsage {
+	engine.containersLock.Lock()
+	defer engine.containersLock.Unlock()
+
+	usage := append(engine.unsunkUsage, engine.newSamples()...)
+	engine.unsunkUsage = nil
+	return usage
+}
+
+// newSamples returns the samples of every watched container which are
+// newer than the last ones the sinks were given, oldest first, and marks them
+// as given. Samples without a CPU utilization, which is only the case for the
+// first sample of a container, are skipped. The containers lock must be held
+// by the caller.
+func (engine *DockerStatsEngine) newSamples() []ContainerUsage {
+	var usage []ContainerUsage
+	for taskArn, containerMap := range engine.tasksToContainers {
+		for dockerID, container := range containerMap {
+			if container.statsQueue == nil {
+				continue
+			}
+			usageStats, err := container.statsQueue.GetRawUsageStats(ContainerStatsBufferLength)
+			if err != nil {
+				// No data collected yet
+				continue
+			}
+			// usageStats is ordered newest first
+			for i := len(usageStats) - 1; i >= 0; i-- {
+				stat := usageStats[i]
+				if !stat.Timestamp.After(container.lastSunk) || math.IsNaN(float64(stat.CPUUsagePerc)) {
+					continue
+				}
+				usage = append(usage, engine.newContainerUsage(taskArn, dockerID, container, stat))
+			}
+			container.lastSunk = usageStats[0].Timestamp
+		}
+	}
+	return usage
+}
+
+// newContainerUsage tags a sample with the task and container it was
+// collected from. The containers lock must be held by the caller.
+func (engine *DockerStatsEngine) newContainerUsage(taskArn string, dockerID string, container *CronContainer, stat UsageStats) ContainerUsage {
+	taskDef, ok := engine.tasksToDefinitions[taskArn]
+	if !ok {
+		taskDef = &taskDefinition{}
+	}
+	return ContainerUsage{
+		TaskArn:       taskArn,
+		TaskFamily:    taskDef.family,
+		TaskVersion:   taskDef.version,
+		ContainerName: engine.containerName(container),
+		DockerID:      dockerID,
+		UsageStats:    stat,
+	}
+}
+
+// containerName returns the name of the container in its task definition.
+// The containers lock must be held by the caller.
+func (engine *DockerStatsEngine) containerName(container *CronContainer) string {
+	return engine.resolveMetadata(container).Name
+}
+
+// resolveMetadata resolves the name and limits of the container in its task
+// definition, caching them the first time they are needed. The containers
+// lock must be held by the caller.
+func (engine *DockerStatsEngine) resolveMetadata(container *CronContainer) *ContainerMetadata {
+	metadata := container.containerMetadata
+	if metadata.resolved || engine.resolver == nil {
+		return metadata
+	}
+	dockerContainer, err := engine.resolver.ResolveContainer(metadata.DockerID)
+	if err != nil || dockerContainer.Container == nil {
+		log.Debug("Could not resolve container", "err", err, "id", metadata.DockerID)
+		return metadata
+	}
+	metadata.Name = dockerContainer.Container.Name
+	metadata.CPUShares = uint64(dockerContainer.Container.Cpu)
+	metadata.MemoryLimitInMegs = uint64(dockerContainer.Container.Memory)
+	metadata.resolved = true
+	return metadata
+}
+
+func formatSinkValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,90 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// graphiteTimeout bounds connecting to and writing to the Graphite server.
+const graphiteTimeout = 5 * time.Second
+
+var graphiteTagEscaper = strings.NewReplacer(";", "_", " ", "_", "~", "_", "\n", "_")
+
+// GraphiteSink sends samples to a Graphite server using the plaintext
+// protocol over TCP. Tags use the Graphite 1.1 "name;tag=value" syntax.
+type GraphiteSink struct {
+	endpoint string
+	// conn is established on the first write and after a write fails.
+	conn net.Conn
+}
+
+// NewGraphiteSink creates a GraphiteSink which sends to the given host:port.
+func NewGraphiteSink(endpoint string) *GraphiteSink {
+	return &GraphiteSink{endpoint: endpoint}
+}
+
+// Write sends every sample. On error the connection is dropped, to be
+// re-established on the next write.
+func (sink *GraphiteSink) Write(usage []ContainerUsage) error {
+	var lines bytes.Buffer
+	for _, sample := range usage {
+		tags := formatGraphiteTags(sample.tags())
+		timestamp := strconv.FormatInt(sample.Timestamp.Unix(), 10)
+		for _, value := range sample.values() {
+			lines.WriteString(sinkMetricPrefix + value.name + tags + " " + formatSinkValue(value.value) + " " + timestamp + "\n")
+		}
+	}
+
+	if sink.conn == nil {
+		conn, err := net.DialTimeout("tcp", sink.endpoint, graphiteTimeout)
+		if err != nil {
+			return err
+		}
+		sink.conn = conn
+	}
+	sink.conn.SetWriteDeadline(time.Now().Add(graphiteTimeout))
+	_, err := sink.conn.Write(lines.Bytes())
+	if err != nil {
+		sink.conn.Close()
+		sink.conn = nil
+	}
+	return err
+}
+
+// Close closes the connection, if there is one.
+func (sink *GraphiteSink) Close() error {
+	if sink.conn == nil {
+		return nil
+	}
+	err := sink.conn.Close()
+	sink.conn = nil
+	return err
+}
+
+func formatGraphiteTags(tags []sinkTag) string {
+	var formatted string
+	for _, tag := range tags {
+		// Graphite doesn't accept empty tag values
+		if tag.value == "" {
+			continue
+		}
+		formatted += ";" + tag.key + "=" + graphiteTagEscaper.Replace(tag.value)
+	}
+	return formatted
+}
@@ -0,0 +1,53 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+// JSONLinesSink appends each sample to a file as a single line of json.
+type JSONLinesSink struct {
+	file *os.File
+}
+
+// NewJSONLinesSink opens, creating if needed, the file at path for appending.
+func NewJSONLinesSink(path string) (*JSONLinesSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesSink{file: file}, nil
+}
+
+// Write appends every sample to the file.
+func (sink *JSONLinesSink) Write(usage []ContainerUsage) error {
+	writer := bufio.NewWriter(sink.file)
+	// Encode terminates each value with a newline
+	encoder := json.NewEncoder(writer)
+	for _, sample := range usage {
+		err := encoder.Encode(&sample)
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// Close closes the file.
+func (sink *JSONLinesSink) Close() error {
+	return sink.file.Close()
+}
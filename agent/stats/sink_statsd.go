@@ -0,0 +1,102 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"bytes"
+	"net"
+	"strings"
+)
+
+// statsDMaxPacketSize keeps each datagram within a typical ethernet MTU so it
+// isn't fragmented.
+const statsDMaxPacketSize = 1432
+
+var statsDTagEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// StatsDSink sends samples to a StatsD server over UDP as gauges. Tags are
+// appended using the widely supported DogStatsD extension.
+type StatsDSink struct {
+	conn net.Conn
+}
+
+// NewStatsDSink creates a StatsDSink which sends to the given host:port.
+func NewStatsDSink(endpoint string) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsDSink{conn: conn}, nil
+}
+
+// Write sends the newest sample of each container. Gauges only keep their
+// last value, so sending older samples would be wasted.
+func (sink *StatsDSink) Write(usage []ContainerUsage) error {
+	newest := make(map[string]int)
+	var order []string
+	for i, sample := range usage {
+		if _, ok := newest[sample.DockerID]; !ok {
+			order = append(order, sample.DockerID)
+		}
+		newest[sample.DockerID] = i
+	}
+
+	var packet bytes.Buffer
+	for _, dockerID := range order {
+		sample := usage[newest[dockerID]]
+		tags := formatStatsDTags(sample.tags())
+		for _, value := range sample.values() {
+			line := sinkMetricPrefix + value.name + ":" + formatSinkValue(value.value) + "|g" + tags
+			if packet.Len() > 0 && packet.Len()+1+len(line) > statsDMaxPacketSize {
+				err := sink.send(&packet)
+				if err != nil {
+					return err
+				}
+			}
+			if packet.Len() > 0 {
+				packet.WriteByte('\n')
+			}
+			packet.WriteString(line)
+		}
+	}
+	if packet.Len() > 0 {
+		return sink.send(&packet)
+	}
+	return nil
+}
+
+func (sink *StatsDSink) send(packet *bytes.Buffer) error {
+	_, err := sink.conn.Write(packet.Bytes())
+	packet.Reset()
+	return err
+}
+
+// Close closes the connection.
+func (sink *StatsDSink) Close() error {
+	return sink.conn.Close()
+}
+
+func formatStatsDTags(tags []sinkTag) string {
+	formatted := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag.value == "" {
+			continue
+		}
+		formatted = append(formatted, tag.key+":"+statsDTagEscaper.Replace(tag.value))
+	}
+	if len(formatted) == 0 {
+		return ""
+	}
+	return "|#" + strings.Join(formatted, ",")
+}
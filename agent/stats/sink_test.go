@@ -0,0 +1,324 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	mock_resolver "github.com/aws/amazon-ecs-agent/agent/stats/resolver/mock"
+	"github.com/golang/mock/gomock"
+)
+
+// recordingSink keeps every batch written to it.
+type recordingSink struct {
+	batches [][]ContainerUsage
+	closed  bool
+}
+
+func (sink *recordingSink) Write(usage []ContainerUsage) error {
+	sink.batches = append(sink.batches, usage)
+	return nil
+}
+
+func (sink *recordingSink) Close() error {
+	sink.closed = true
+	return nil
+}
+
+func testUsage(dockerID string, cpu float32, timestamp time.Time) ContainerUsage {
+	return ContainerUsage{
+		TaskArn:       "arn:aws:ecs:us-west-2:123456789012:task/t1",
+		TaskFamily:    "family",
+		TaskVersion:   "1",
+		ContainerName: "web",
+		DockerID:      dockerID,
+		UsageStats: UsageStats{
+			CPUUsagePerc:      cpu,
+			MemoryUsageInMegs: 2,
+			Timestamp:         timestamp,
+		},
+	}
+}
+
+func TestFlushSinksOnlyWritesNewSamples(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	resolver := mock_resolver.NewMockContainerMetadataResolver(mockCtrl)
+	// The name is only resolved once and then cached
+	resolver.EXPECT().ResolveContainer("c1").Return(&api.DockerContainer{DockerId: "c1", Container: &api.Container{Name: "web"}}, nil)
+
+	queue := NewQueue(ContainerStatsBufferLength)
+	sink := &recordingSink{}
+	engine := &DockerStatsEngine{
+		resolver: resolver,
+		sinks:    []Sink{sink},
+		tasksToContainers: map[string]map[string]*CronContainer{
+			"t1": {"c1": &CronContainer{containerMetadata: &ContainerMetadata{DockerID: "c1"}, statsQueue: queue}},
+		},
+		tasksToDefinitions: map[string]*taskDefinition{"t1": {family: "family", version: "1"}},
+	}
+
+	queue.Add(createContainerStats(22400432, 1839104, parseNanoTime("2015-02-12T21:22:05.131117533Z")))
+	queue.Add(createContainerStats(116499979, 3649536, parseNanoTime("2015-02-12T21:22:05.232291187Z")))
+	engine.flushSinks()
+	if len(sink.batches) != 1 || len(sink.batches[0]) != 1 {
+		// The first sample has no cpu utilization and is skipped
+		t.Fatalf("Expected one batch with one sample, got %+v", sink.batches)
+	}
+	sample := sink.batches[0][0]
+	if sample.TaskArn != "t1" || sample.TaskFamily != "family" || sample.TaskVersion != "1" || sample.ContainerName != "web" || sample.DockerID != "c1" {
+		t.Errorf("Sample not tagged correctly: %+v", sample)
+	}
+
+	// Nothing new; nothing written
+	engine.flushSinks()
+	if len(sink.batches) != 1 {
+		t.Fatalf("Expected no new batch, got %+v", sink.batches)
+	}
+
+	queue.Add(createContainerStats(199279360, 1839104, parseNanoTime("2015-02-12T21:22:05.333776335Z")))
+	queue.Add(createContainerStats(288669457, 1839104, parseNanoTime("2015-02-12T21:22:05.434753595Z")))
+	engine.flushSinks()
+	if len(sink.batches) != 2 || len(sink.batches[1]) != 2 {
+		t.Fatalf("Expected a second batch with two samples, got %+v", sink.batches)
+	}
+	if !sink.batches[1][0].Timestamp.Before(sink.batches[1][1].Timestamp) {
+		t.Error("Expected samples to be written oldest first")
+	}
+}
+
+func TestResetStatsKeepsUnsunkSamples(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	resolver := mock_resolver.NewMockContainerMetadataResolver(mockCtrl)
+	resolver.EXPECT().ResolveContainer("c1").Return(&api.DockerContainer{DockerId: "c1", Container: &api.Container{Name: "web"}}, nil)
+
+	queue := NewQueue(ContainerStatsBufferLength)
+	sink := &recordingSink{}
+	engine := &DockerStatsEngine{
+		resolver: resolver,
+		sinks:    []Sink{sink},
+		tasksToContainers: map[string]map[string]*CronContainer{
+			"t1": {"c1": &CronContainer{containerMetadata: &ContainerMetadata{DockerID: "c1"}, statsQueue: queue}},
+		},
+		tasksToDefinitions: map[string]*taskDefinition{"t1": {family: "family", version: "1"}},
+	}
+
+	queue.Add(createContainerStats(22400432, 1839104, parseNanoTime("2015-02-12T21:22:05.131117533Z")))
+	queue.Add(createContainerStats(116499979, 3649536, parseNanoTime("2015-02-12T21:22:05.232291187Z")))
+	queue.Add(createContainerStats(199279360, 1839104, parseNanoTime("2015-02-12T21:22:05.333776335Z")))
+	// Publishing resets the stats before the sinks are flushed
+	engine.resetStats()
+	if len(sink.batches) != 0 {
+		t.Fatalf("Expected the sinks not to be written to when the stats are reset, got %+v", sink.batches)
+	}
+
+	queue.Add(createContainerStats(288669457, 1839104, parseNanoTime("2015-02-12T21:22:05.434753595Z")))
+	queue.Add(createContainerStats(391482304, 1839104, parseNanoTime("2015-02-12T21:22:05.535987002Z")))
+	engine.flushSinks()
+	if len(sink.batches) != 1 || len(sink.batches[0]) != 3 {
+		t.Fatalf("Expected one batch with the two samples from before the reset and one after, got %+v", sink.batches)
+	}
+	for i := 1; i < len(sink.batches[0]); i++ {
+		if !sink.batches[0][i-1].Timestamp.Before(sink.batches[0][i].Timestamp) {
+			t.Error("Expected samples to be written oldest first")
+		}
+	}
+
+	engine.flushSinks()
+	if len(sink.batches) != 1 {
+		t.Fatalf("Expected no new batch, got %+v", sink.batches)
+	}
+}
+
+func TestStatsDSink(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sink, err := NewStatsDSink(listener.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	now := time.Now()
+	err = sink.Write([]ContainerUsage{
+		testUsage("c1", 10, now),
+		testUsage("c1", 12.5, now.Add(time.Second)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, statsDMaxPacketSize)
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := listener.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := "|#task_arn:arn:aws:ecs:us-west-2:123456789012:task/t1,task_family:family,task_version:1,container_name:web"
+	expected := "ecs.container.cpu_usage_percent:12.5|g" + tags + "\n" +
+		"ecs.container.memory_usage_bytes:2097152|g" + tags
+	if string(buf[:n]) != expected {
+		t.Errorf("Expected only the newest sample:\n%s\nGot:\n%s", expected, string(buf[:n]))
+	}
+}
+
+func TestGraphiteSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		scanner := bufio.NewScanner(conn)
+		for len(lines) < 2 && scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}()
+
+	sink := NewGraphiteSink(listener.Addr().String())
+	defer sink.Close()
+	timestamp := time.Unix(1423776125, 0)
+	usage := testUsage("c1", 12.5, timestamp)
+	usage.ContainerName = "has space;semicolon"
+	err = sink.Write([]ContainerUsage{usage})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags := ";task_arn=arn:aws:ecs:us-west-2:123456789012:task/t1;task_family=family;task_version=1;container_name=has_space_semicolon"
+	expected := []string{
+		"ecs.container.cpu_usage_percent" + tags + " 12.5 1423776125",
+		"ecs.container.memory_usage_bytes" + tags + " 2097152 1423776125",
+	}
+	select {
+	case lines := <-received:
+		if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("Expected:\n%s\nGot:\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for graphite lines")
+	}
+}
+
+func TestGraphiteSinkUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := listener.Addr().String()
+	listener.Close()
+
+	sink := NewGraphiteSink(endpoint)
+	err = sink.Write([]ContainerUsage{testUsage("c1", 1, time.Now())})
+	if err == nil {
+		t.Error("Expected an error writing to a closed port")
+	}
+	if sink.conn != nil {
+		t.Error("Expected no connection to be kept after an error")
+	}
+}
+
+func TestSinkValuesIncludeNetworkAndBlockIO(t *testing.T) {
+	usage := testUsage("c1", 10, time.Now())
+	if len(usage.values()) != 2 {
+		t.Errorf("Expected only cpu and memory without network and block io usage, got %+v", usage.values())
+	}
+
+	usage.Network = &NetworkUsage{RxBytesPerSec: 1, TxBytesPerSec: 2}
+	usage.BlockIO = &BlockIOUsage{WriteBytesPerSec: 3}
+	usage.Pids = 4
+	values := make(map[string]float64)
+	for _, value := range usage.values() {
+		values[value.name] = value.value
+	}
+	if len(values) != 13 {
+		t.Errorf("Expected 13 values, got %+v", values)
+	}
+	if values["network_rx_bytes_per_second"] != 1 || values["network_tx_bytes_per_second"] != 2 ||
+		values["block_io_write_bytes_per_second"] != 3 || values["pids"] != 4 {
+		t.Errorf("Unexpected values: %+v", values)
+	}
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecs_stats_sink_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stats.json")
+
+	sink, err := NewJSONLinesSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	err = sink.Write([]ContainerUsage{testUsage("c1", 10, now), testUsage("c2", 20, now)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	// Reopening appends
+	sink, err = NewJSONLinesSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sink.Write([]ContainerUsage{testUsage("c1", 30, now)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d: %s", len(lines), string(data))
+	}
+	var decoded map[string]interface{}
+	err = json.Unmarshal([]byte(lines[2]), &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded["taskArn"] != "arn:aws:ecs:us-west-2:123456789012:task/t1" || decoded["containerName"] != "web" ||
+		decoded["dockerId"] != "c1" || decoded["cpuUsagePerc"] != 30.0 || decoded["memoryUsageInMegs"] != 2.0 {
+		t.Errorf("Unexpected json line: %s", lines[2])
+	}
+}
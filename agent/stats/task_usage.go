@@ -0,0 +1,299 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// cpuSharesPerCPU is the number of cpu shares which reserve a whole cpu.
+	cpuSharesPerCPU = 1024
+
+	// NearOOMThresholdPerc is the memory utilization of a task, as a
+	// percentage of its limit, at which it is flagged as near OOM.
+	NearOOMThresholdPerc = 90
+
+	// taskUsageCheckInterval is how often task utilization is checked for
+	// conditions to raise events for.
+	taskUsageCheckInterval = 10 * time.Second
+
+	// taskUsageEventBufferSize is the number of events buffered for each
+	// subscriber. Events are dropped for subscribers which fall behind.
+	taskUsageEventBufferSize = 100
+)
+
+// TaskUsage is the utilization of a task, aggregated over its containers.
+// Peaks are the sum of the highest utilization of each container over the
+// samples in its queue, so they are an upper bound of the task's peak.
+type TaskUsage struct {
+	TaskArn     string `json:"taskArn"`
+	TaskFamily  string `json:"taskFamily"`
+	TaskVersion string `json:"taskVersion"`
+	// CPUUsagePerc is a percentage of one cpu.
+	CPUUsagePerc     float64 `json:"cpuUsagePerc"`
+	PeakCPUUsagePerc float64 `json:"peakCPUUsagePerc"`
+	// CPUShares is the sum of the shares declared by the containers, or 0 if
+	// any container doesn't declare any.
+	CPUShares uint64 `json:"cpuShares"`
+	// CPUUtilizationPerc is the cpu usage as a percentage of the declared
+	// shares, where 1024 shares reserve a whole cpu. It's nil without shares.
+	CPUUtilizationPerc *float64 `json:"cpuUtilizationPerc,omitempty"`
+	MemoryUsageInMegs  uint64   `json:"memoryUsageInMegs"`
+	// MemoryWorkingSetInMegs leaves out inactive page cache, which is
+	// reclaimed before the OOM killer is invoked.
+	MemoryWorkingSetInMegs uint64 `json:"memoryWorkingSetInMegs"`
+	PeakMemoryUsageInMegs  uint64 `json:"peakMemoryUsageInMegs"`
+	// MemoryLimitInMegs is the sum of the limits of the containers, or 0 if
+	// any container isn't limited.
+	MemoryLimitInMegs uint64 `json:"memoryLimitInMegs"`
+	// MemoryUtilizationPerc is the working set as a percentage of the limit.
+	// It's nil without a limit.
+	MemoryUtilizationPerc *float64 `json:"memoryUtilizationPerc,omitempty"`
+	// MemoryLimitHits is the number of times the memory usage of the
+	// containers hit their limits over the samples in their queues. The
+	// kernel reclaims memory, or invokes the OOM killer, when it does.
+	MemoryLimitHits uint64 `json:"memoryLimitHits"`
+	// OverLimit is set when a container hit its memory limit. CPU shares are
+	// only a relative weight, which tasks may go over while the cpus aren't
+	// contended, so they don't count.
+	OverLimit bool `json:"overLimit"`
+	// NearOOM is set when the working set is at least NearOOMThresholdPerc
+	// of the limit.
+	NearOOM bool `json:"nearOOM"`
+	// Timestamp is that of the newest sample of any of the containers.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TaskUsageCondition is a condition of the utilization of a task which
+// raises a TaskUsageEvent.
+type TaskUsageCondition string
+
+const (
+	// TaskOverLimit is raised when TaskUsage.OverLimit becomes set.
+	TaskOverLimit TaskUsageCondition = "OverLimit"
+	// TaskNearOOM is raised when TaskUsage.NearOOM becomes set.
+	TaskNearOOM TaskUsageCondition = "NearOOM"
+)
+
+// TaskUsageEvent is raised when a task starts meeting a condition. It isn't
+// raised again until the condition clears and then recurs.
+type TaskUsageEvent struct {
+	Condition TaskUsageCondition `json:"condition"`
+	Usage     TaskUsage          `json:"usage"`
+}
+
+// GetTaskUsage returns the utilization of every watched task with samples.
+func (engine *DockerStatsEngine) GetTaskUsage() []TaskUsage {
+	engine.containersLock.Lock()
+	defer engine.containersLock.Unlock()
+
+	usage := []TaskUsage{}
+	for taskArn, containerMap := range engine.tasksToContainers {
+		taskUsage, ok := engine.getTaskUsage(taskArn, containerMap)
+		if ok {
+			usage = append(usage, taskUsage)
+		}
+	}
+	return usage
+}
+
+// getTaskUsage aggregates the utilization of the containers of a task. It
+// returns false if none of the containers has samples. The containers lock
+// must be held by the caller.
+func (engine *DockerStatsEngine) getTaskUsage(taskArn string, containerMap map[string]*CronContainer) (TaskUsage, bool) {
+	taskDef, ok := engine.tasksToDefinitions[taskArn]
+	if !ok {
+		taskDef = &taskDefinition{}
+	}
+	usage := TaskUsage{
+		TaskArn:     taskArn,
+		TaskFamily:  taskDef.family,
+		TaskVersion: taskDef.version,
+	}
+
+	var workingSet uint64
+	sampled := false
+	allShares, allLimited := true, true
+	for _, container := range containerMap {
+		metadata := engine.resolveMetadata(container)
+		usage.CPUShares += metadata.CPUShares
+		usage.MemoryLimitInMegs += metadata.MemoryLimitInMegs
+		allShares = allShares && metadata.CPUShares > 0
+		allLimited = allLimited && metadata.MemoryLimitInMegs > 0
+
+		if container.statsQueue == nil {
+			continue
+		}
+		usageStats, err := container.statsQueue.GetRawUsageStats(1)
+		if err != nil {
+			// No data collected yet
+			continue
+		}
+		sampled = true
+		latest := usageStats[0]
+		if cpu := float64(latest.CPUUsagePerc); !math.IsNaN(cpu) {
+			usage.CPUUsagePerc += cpu
+		}
+		usage.MemoryUsageInMegs += uint64(latest.MemoryUsageInMegs)
+		workingSet += latest.Memory.WorkingSetBytes
+		if latest.Timestamp.After(usage.Timestamp) {
+			usage.Timestamp = latest.Timestamp
+		}
+
+		cpuSummary, err := container.statsQueue.Query(StatsQuery{Metric: MetricCPUUsagePerc})
+		if err == nil {
+			usage.PeakCPUUsagePerc += cpuSummary.Max
+		}
+		memorySummary, err := container.statsQueue.Query(StatsQuery{Metric: MetricMemoryUsageInMegs})
+		if err == nil {
+			usage.PeakMemoryUsageInMegs += uint64(memorySummary.Max)
+		}
+		limitHitsSummary, err := container.statsQueue.Query(StatsQuery{Metric: MetricMemoryLimitHits})
+		if err == nil {
+			usage.MemoryLimitHits += uint64(limitHitsSummary.Sum)
+		}
+	}
+	if !sampled {
+		return usage, false
+	}
+	usage.MemoryWorkingSetInMegs = workingSet / BytesInMiB
+	usage.OverLimit = usage.MemoryLimitHits > 0
+
+	if !allShares {
+		usage.CPUShares = 0
+	}
+	if !allLimited {
+		usage.MemoryLimitInMegs = 0
+	}
+	if usage.CPUShares > 0 {
+		utilization := usage.CPUUsagePerc * cpuSharesPerCPU / float64(usage.CPUShares)
+		usage.CPUUtilizationPerc = &utilization
+	}
+	if usage.MemoryLimitInMegs > 0 {
+		utilization := 100 * float64(workingSet) / float64(usage.MemoryLimitInMegs*BytesInMiB)
+		usage.MemoryUtilizationPerc = &utilization
+		usage.NearOOM = utilization >= NearOOMThresholdPerc
+	}
+	return usage, true
+}
+
+// TaskUsageEvents returns a channel of events raised when tasks hit their
+// memory limits or get close to running out of memory. The channel is closed
+// when ctx is cancelled.
+func (engine *DockerStatsEngine) TaskUsageEvents(ctx context.Context) <-chan TaskUsageEvent {
+	events := make(chan TaskUsageEvent, taskUsageEventBufferSize)
+	engine.taskUsageLock.Lock()
+	engine.taskUsageListeners = append(engine.taskUsageListeners, events)
+	engine.taskUsageLock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		engine.taskUsageLock.Lock()
+		defer engine.taskUsageLock.Unlock()
+		for i, listener := range engine.taskUsageListeners {
+			if listener == events {
+				engine.taskUsageListeners = append(engine.taskUsageListeners[:i], engine.taskUsageListeners[i+1:]...)
+				break
+			}
+		}
+		close(events)
+	}()
+	return events
+}
+
+// taskUsageLoop checks task utilization every interval until the engine's
+// context is cancelled.
+func (engine *DockerStatsEngine) taskUsageLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-engine.ctx.Done():
+			return
+		case <-ticker.C:
+			engine.checkTaskUsage()
+		}
+	}
+}
+
+// checkTaskUsage raises an event for every condition which tasks started
+// meeting since the last check.
+func (engine *DockerStatsEngine) checkTaskUsage() {
+	engine.containersLock.Lock()
+	watched := make(map[string]bool, len(engine.tasksToContainers))
+	usage := []TaskUsage{}
+	for taskArn, containerMap := range engine.tasksToContainers {
+		watched[taskArn] = true
+		taskUsage, ok := engine.getTaskUsage(taskArn, containerMap)
+		if ok {
+			usage = append(usage, taskUsage)
+		}
+	}
+	engine.containersLock.Unlock()
+
+	engine.taskUsageLock.Lock()
+	defer engine.taskUsageLock.Unlock()
+
+	flagged := make(map[string]map[TaskUsageCondition]bool)
+	// Tasks without samples since their queues were reset keep their
+	// conditions, and tasks which are no longer watched are forgotten
+	for taskArn, conditions := range engine.flaggedTasks {
+		if watched[taskArn] {
+			flagged[taskArn] = conditions
+		}
+	}
+	for _, taskUsage := range usage {
+		conditions := make(map[TaskUsageCondition]bool)
+		if taskUsage.OverLimit {
+			conditions[TaskOverLimit] = true
+		}
+		if taskUsage.NearOOM {
+			conditions[TaskNearOOM] = true
+		}
+		for condition := range conditions {
+			if !engine.flaggedTasks[taskUsage.TaskArn][condition] {
+				engine.raiseTaskUsageEvent(TaskUsageEvent{Condition: condition, Usage: taskUsage})
+			}
+		}
+		flagged[taskUsage.TaskArn] = conditions
+	}
+	engine.flaggedTasks = flagged
+}
+
+// raiseTaskUsageEvent logs the event and sends it to every subscriber. The
+// task usage lock must be held by the caller.
+func (engine *DockerStatsEngine) raiseTaskUsageEvent(event TaskUsageEvent) {
+	log.Warn("Task utilization condition raised", "condition", event.Condition, "task", event.Usage.TaskArn,
+		"cpu", formatUtilization(event.Usage.CPUUtilizationPerc), "memory", formatUtilization(event.Usage.MemoryUtilizationPerc),
+		"memoryLimitHits", event.Usage.MemoryLimitHits)
+	for _, listener := range engine.taskUsageListeners {
+		select {
+		case listener <- event:
+		default:
+			log.Warn("Task utilization event subscriber is falling behind, dropping event", "task", event.Usage.TaskArn)
+		}
+	}
+}
+
+func formatUtilization(utilization *float64) string {
+	if utilization == nil {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%.1f%%", *utilization)
+}
@@ -0,0 +1,244 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	mock_resolver "github.com/aws/amazon-ecs-agent/agent/stats/resolver/mock"
+	"github.com/golang/mock/gomock"
+	"golang.org/x/net/context"
+)
+
+func addMemorySample(queue *Queue, cpuUsage uint64, memoryInMegs uint64, workingSetInMegs uint64, timestamp time.Time) {
+	stats := createContainerStats(cpuUsage, memoryInMegs*BytesInMiB, timestamp)
+	stats.memoryStats.workingSet = workingSetInMegs * BytesInMiB
+	queue.Add(stats)
+}
+
+// addLimitHitSample adds a sample with the cumulative number of times the
+// memory usage of the container hit its limit.
+func addLimitHitSample(queue *Queue, memoryInMegs uint64, failcnt uint64, timestamp time.Time) {
+	stats := createContainerStats(0, memoryInMegs*BytesInMiB, timestamp)
+	stats.memoryStats.workingSet = memoryInMegs * BytesInMiB
+	stats.memoryStats.failcnt = failcnt
+	queue.Add(stats)
+}
+
+func newTaskUsageTestEngine(mockCtrl *gomock.Controller) (*DockerStatsEngine, *Queue, *Queue) {
+	resolver := mock_resolver.NewMockContainerMetadataResolver(mockCtrl)
+	resolver.EXPECT().ResolveContainer("c1").Return(&api.DockerContainer{DockerId: "c1", Container: &api.Container{Name: "web", Cpu: 512, Memory: 100}}, nil)
+	resolver.EXPECT().ResolveContainer("c2").Return(&api.DockerContainer{DockerId: "c2", Container: &api.Container{Name: "worker", Cpu: 512, Memory: 100}}, nil)
+
+	queue1 := NewQueue(ContainerStatsBufferLength)
+	queue2 := NewQueue(ContainerStatsBufferLength)
+	engine := &DockerStatsEngine{
+		resolver: resolver,
+		tasksToContainers: map[string]map[string]*CronContainer{
+			"t1": {
+				"c1": &CronContainer{containerMetadata: &ContainerMetadata{DockerID: "c1"}, statsQueue: queue1},
+				"c2": &CronContainer{containerMetadata: &ContainerMetadata{DockerID: "c2"}, statsQueue: queue2},
+			},
+		},
+		tasksToDefinitions: map[string]*taskDefinition{"t1": {family: "family", version: "1"}},
+	}
+	return engine, queue1, queue2
+}
+
+func TestGetTaskUsage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	engine, queue1, queue2 := newTaskUsageTestEngine(mockCtrl)
+
+	start := time.Now()
+	addMemorySample(queue1, 0, 100, 95, start)
+	addMemorySample(queue1, 600000000, 95, 90, start.Add(time.Second))
+	// A single sample; memory but no cpu utilization
+	addMemorySample(queue2, 0, 95, 90, start.Add(time.Second))
+
+	usage := engine.GetTaskUsage()
+	if len(usage) != 1 {
+		t.Fatalf("Expected usage of one task, got %+v", usage)
+	}
+	task := usage[0]
+	if task.TaskArn != "t1" || task.TaskFamily != "family" || task.TaskVersion != "1" {
+		t.Errorf("Task usage not tagged correctly: %+v", task)
+	}
+	// CPU utilization of a container is a float32
+	if math.Abs(task.CPUUsagePerc-60) > 1e-3 || task.PeakCPUUsagePerc != task.CPUUsagePerc || task.CPUShares != 1024 {
+		t.Errorf("Unexpected cpu usage: %+v", task)
+	}
+	if task.CPUUtilizationPerc == nil || math.Abs(*task.CPUUtilizationPerc-60) > 1e-3 {
+		t.Errorf("Expected 60%% of the reserved cpu to be used, got %v", task.CPUUtilizationPerc)
+	}
+	if task.MemoryUsageInMegs != 190 || task.PeakMemoryUsageInMegs != 195 || task.MemoryWorkingSetInMegs != 180 || task.MemoryLimitInMegs != 200 {
+		t.Errorf("Unexpected memory usage: %+v", task)
+	}
+	if task.MemoryUtilizationPerc == nil || *task.MemoryUtilizationPerc != 90 {
+		t.Errorf("Expected 90%% of the memory limit to be used, got %v", task.MemoryUtilizationPerc)
+	}
+	if task.MemoryLimitHits != 0 || task.OverLimit || !task.NearOOM {
+		t.Errorf("Expected the task to only be near OOM: %+v", task)
+	}
+	if !task.Timestamp.Equal(start.Add(time.Second)) {
+		t.Errorf("Expected the timestamp of the newest sample, got %v", task.Timestamp)
+	}
+}
+
+func TestGetTaskUsageUnlimited(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	resolver := mock_resolver.NewMockContainerMetadataResolver(mockCtrl)
+	resolver.EXPECT().ResolveContainer("c1").Return(&api.DockerContainer{DockerId: "c1", Container: &api.Container{Name: "web", Cpu: 512, Memory: 100}}, nil)
+	resolver.EXPECT().ResolveContainer("c2").Return(&api.DockerContainer{DockerId: "c2", Container: &api.Container{Name: "sidecar"}}, nil)
+	queue := NewQueue(ContainerStatsBufferLength)
+	engine := &DockerStatsEngine{
+		resolver: resolver,
+		tasksToContainers: map[string]map[string]*CronContainer{
+			"t1": {
+				"c1": &CronContainer{containerMetadata: &ContainerMetadata{DockerID: "c1"}, statsQueue: queue},
+				// Not sampled yet
+				"c2": &CronContainer{containerMetadata: &ContainerMetadata{DockerID: "c2"}, statsQueue: NewQueue(ContainerStatsBufferLength)},
+			},
+		},
+	}
+	addMemorySample(queue, 0, 100, 100, time.Now())
+
+	usage := engine.GetTaskUsage()
+	if len(usage) != 1 {
+		t.Fatalf("Expected usage of one task, got %+v", usage)
+	}
+	// A container without limits leaves the whole task without them
+	task := usage[0]
+	if task.CPUShares != 0 || task.CPUUtilizationPerc != nil || task.MemoryLimitInMegs != 0 || task.MemoryUtilizationPerc != nil {
+		t.Errorf("Expected no limits, got %+v", task)
+	}
+	if task.OverLimit || task.NearOOM {
+		t.Errorf("Expected a task without limits not to be flagged: %+v", task)
+	}
+}
+
+// receiveTaskUsageEvent returns the next buffered event, if there's one.
+func receiveTaskUsageEvent(events <-chan TaskUsageEvent) (TaskUsageEvent, bool) {
+	select {
+	case event := <-events:
+		return event, true
+	default:
+		return TaskUsageEvent{}, false
+	}
+}
+
+func TestCheckTaskUsage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	engine, queue1, queue2 := newTaskUsageTestEngine(mockCtrl)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := engine.TaskUsageEvents(ctx)
+
+	start := time.Now()
+	addMemorySample(queue1, 0, 95, 90, start)
+	addMemorySample(queue1, 600000000, 95, 90, start.Add(time.Second))
+	addLimitHitSample(queue2, 90, 0, start.Add(time.Second))
+	engine.checkTaskUsage()
+	event, ok := receiveTaskUsageEvent(events)
+	if !ok || event.Condition != TaskNearOOM || event.Usage.TaskArn != "t1" {
+		t.Errorf("Expected a near OOM event, got %+v", event)
+	}
+
+	// 1.5 cpus used against the one reserved; shares aren't a limit
+	addMemorySample(queue1, 2100000000, 95, 90, start.Add(2*time.Second))
+	engine.checkTaskUsage()
+	if event, ok := receiveTaskUsageEvent(events); ok {
+		t.Errorf("Expected cpu usage over the reserved shares not to raise events, got %+v", event)
+	}
+
+	// The second container hit its 100MB limit 3 times
+	addLimitHitSample(queue2, 100, 3, start.Add(2*time.Second))
+	engine.checkTaskUsage()
+	event, ok = receiveTaskUsageEvent(events)
+	if !ok || event.Condition != TaskOverLimit || event.Usage.MemoryLimitHits != 3 {
+		t.Errorf("Expected an over limit event, got %+v", event)
+	}
+	if event, ok := receiveTaskUsageEvent(events); ok {
+		t.Errorf("Expected the near OOM condition not to be raised again, got %+v", event)
+	}
+
+	// Once the conditions clear, they're raised again when they recur
+	queue1.Reset()
+	addMemorySample(queue1, 0, 50, 40, start.Add(4*time.Second))
+	queue2.Reset()
+	addLimitHitSample(queue2, 50, 3, start.Add(4*time.Second))
+	engine.checkTaskUsage()
+	if flagged := engine.flaggedTasks["t1"]; len(flagged) != 0 {
+		t.Errorf("Expected the conditions to clear, got %v", flagged)
+	}
+	addLimitHitSample(queue2, 100, 4, start.Add(5*time.Second))
+	engine.checkTaskUsage()
+	event, ok = receiveTaskUsageEvent(events)
+	if !ok || event.Condition != TaskOverLimit || event.Usage.MemoryLimitHits != 1 {
+		t.Errorf("Expected an over limit event, got %+v", event)
+	}
+
+	// Tasks which are no longer watched are forgotten
+	delete(engine.tasksToContainers, "t1")
+	engine.checkTaskUsage()
+	if len(engine.flaggedTasks) != 0 {
+		t.Errorf("Expected no flagged tasks, got %v", engine.flaggedTasks)
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestCheckTaskUsageAfterReset(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	engine, queue1, queue2 := newTaskUsageTestEngine(mockCtrl)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := engine.TaskUsageEvents(ctx)
+
+	start := time.Now()
+	addMemorySample(queue1, 0, 95, 90, start)
+	addLimitHitSample(queue2, 90, 0, start)
+	addLimitHitSample(queue2, 100, 2, start.Add(time.Second))
+	engine.checkTaskUsage()
+	for i := 0; i < 2; i++ {
+		if _, ok := receiveTaskUsageEvent(events); !ok {
+			t.Fatal("Expected over limit and near OOM events")
+		}
+	}
+
+	// The queues are reset after every publish to the backend. The task keeps
+	// its conditions until there are new samples, so they aren't raised again
+	engine.resetStats()
+	engine.checkTaskUsage()
+	if flagged := engine.flaggedTasks["t1"]; !flagged[TaskOverLimit] || !flagged[TaskNearOOM] {
+		t.Errorf("Expected the task to stay flagged, got %v", flagged)
+	}
+	addMemorySample(queue1, 0, 95, 90, start.Add(2*time.Second))
+	addLimitHitSample(queue2, 100, 2, start.Add(2*time.Second))
+	engine.checkTaskUsage()
+	if event, ok := receiveTaskUsageEvent(events); ok {
+		t.Errorf("Expected no events after the reset, got %+v", event)
+	}
+	if flagged := engine.flaggedTasks["t1"]; flagged[TaskOverLimit] || !flagged[TaskNearOOM] {
+		t.Errorf("Expected the task to only be near OOM, got %v", flagged)
+	}
+}
@@ -19,11 +19,62 @@ import (
 	"golang.org/x/net/context"
 )
 
-// ContainerStats encapsulates the raw CPU and memory utilization from cgroup fs.
+// ContainerStats encapsulates the raw CPU, memory, block I/O and process
+// utilization from cgroup fs and the raw network utilization from procfs.
 type ContainerStats struct {
-	cpuUsage    uint64
-	memoryUsage uint64
-	timestamp   time.Time
+	cpuUsage     uint64
+	memoryUsage  uint64
+	memoryStats  memoryCounters
+	throttling   throttlingCounters
+	blockIOStats blockIOCounters
+	// pids is 0 when the pids controller isn't available.
+	pids uint64
+	// networkStats is nil when network stats couldn't be read.
+	networkStats *networkCounters
+	timestamp    time.Time
+}
+
+// networkCounters are the cumulative counters of every network interface of
+// a container, other than loopback.
+type networkCounters struct {
+	rxBytes   uint64
+	rxPackets uint64
+	rxErrors  uint64
+	txBytes   uint64
+	txPackets uint64
+	txErrors  uint64
+}
+
+// memoryCounters break down the memory used by a container.
+type memoryCounters struct {
+	rss   uint64
+	cache uint64
+	// swap is 0 when swap accounting isn't enabled.
+	swap uint64
+	// workingSet is the usage less inactive file pages, which are the first
+	// to be reclaimed under memory pressure.
+	workingSet uint64
+	// failcnt is the cumulative number of times the usage hit the limit. It's
+	// 0 when the container isn't limited.
+	failcnt uint64
+}
+
+// throttlingCounters are the cumulative cpu throttling counters of a
+// container.
+type throttlingCounters struct {
+	periods          uint64
+	throttledPeriods uint64
+	// throttledTime is in nanoseconds.
+	throttledTime uint64
+}
+
+// blockIOCounters are the cumulative counters of I/O to every block device
+// by a container.
+type blockIOCounters struct {
+	readBytes  uint64
+	writeBytes uint64
+	readOps    uint64
+	writeOps   uint64
 }
 
 // UsageStats abstracts the format in which the queue stores data.
@@ -31,12 +82,75 @@ type UsageStats struct {
 	CPUUsagePerc      float32   `json:"cpuUsagePerc"`
 	MemoryUsageInMegs uint32    `json:"memoryUsageInMegs"`
 	Timestamp         time.Time `json:"timestamp"`
-	cpuUsage          uint64
+	// Pids is the number of processes in the container, or 0 when it isn't
+	// known.
+	Pids uint64 `json:"pids"`
+	// Memory breaks down the memory usage. MemoryUsageInMegs includes the
+	// page cache, so the working set better reflects memory pressure.
+	Memory MemoryUsage `json:"memory"`
+	// CPUThrottling, Network and BlockIO are nil for the first sample of a
+	// container, and Network also when network stats couldn't be read.
+	CPUThrottling *CPUThrottling `json:"cpuThrottling,omitempty"`
+	Network       *NetworkUsage  `json:"network,omitempty"`
+	BlockIO       *BlockIOUsage  `json:"blockIO,omitempty"`
+	cpuUsage      uint64
+	memoryFailcnt uint64
+	throttling    throttlingCounters
+	network       *networkCounters
+	blockIO       blockIOCounters
+}
+
+// MemoryUsage is the memory used by a container, by kind.
+type MemoryUsage struct {
+	RSSBytes        uint64 `json:"rssBytes"`
+	CacheBytes      uint64 `json:"cacheBytes"`
+	SwapBytes       uint64 `json:"swapBytes"`
+	WorkingSetBytes uint64 `json:"workingSetBytes"`
+	// LimitHits is the number of times the usage hit the container's memory
+	// limit since the previous sample, and 0 for its first sample.
+	LimitHits uint64 `json:"limitHits"`
+}
+
+// CPUThrottling is how much a container was throttled by its cpu quota since
+// the previous sample.
+type CPUThrottling struct {
+	Periods          uint64 `json:"periods"`
+	ThrottledPeriods uint64 `json:"throttledPeriods"`
+	ThrottledTimeNs  uint64 `json:"throttledTimeNs"`
+}
+
+// NetworkUsage is the network utilization of a container since the previous
+// sample.
+type NetworkUsage struct {
+	RxBytesPerSec   float64 `json:"rxBytesPerSec"`
+	RxPacketsPerSec float64 `json:"rxPacketsPerSec"`
+	RxErrorsPerSec  float64 `json:"rxErrorsPerSec"`
+	TxBytesPerSec   float64 `json:"txBytesPerSec"`
+	TxPacketsPerSec float64 `json:"txPacketsPerSec"`
+	TxErrorsPerSec  float64 `json:"txErrorsPerSec"`
+}
+
+// BlockIOUsage is the block I/O utilization of a container since the
+// previous sample.
+type BlockIOUsage struct {
+	ReadBytesPerSec  float64 `json:"readBytesPerSec"`
+	WriteBytesPerSec float64 `json:"writeBytesPerSec"`
+	ReadOpsPerSec    float64 `json:"readOpsPerSec"`
+	WriteOpsPerSec   float64 `json:"writeOpsPerSec"`
 }
 
 // ContainerMetadata contains meta-data information for a container.
 type ContainerMetadata struct {
 	DockerID string `json:"-"`
+	// Name is the name of the container in its task definition. It is
+	// resolved, along with the limits, when first needed.
+	Name string `json:"-"`
+	// CPUShares and MemoryLimitInMegs are declared in the task definition,
+	// and are 0 when not set.
+	CPUShares         uint64 `json:"-"`
+	MemoryLimitInMegs uint64 `json:"-"`
+	// resolved is set once the above are resolved.
+	resolved bool
 }
 
 // CronContainer abstracts methods to gather and aggregate utilization data for a container.
@@ -44,9 +158,11 @@ type CronContainer struct {
 	containerMetadata *ContainerMetadata
 	ctx               context.Context
 	cancel            context.CancelFunc
-	statePath         string
 	statsQueue        *Queue
 	statsCollector    ContainerStatsCollector
+	// lastSunk is the timestamp of the newest sample written to the stats
+	// sinks.
+	lastSunk time.Time
 }
 
 // taskDefinition encapsulates family and version strings for a task definition
@@ -28,7 +28,6 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/wsclient"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/gorilla/websocket"
 )
 
 // tasksInMessage is the maximum number of tasks that can be sent in a message to the backend
@@ -40,6 +39,7 @@ var log = logger.ForModule("tcs client")
 // clientServer implements wsclient.ClientServer interface for metrics backend.
 type clientServer struct {
 	statsEngine            stats.Engine
+	publishBuffer          *PublishBuffer
 	publishTicker          *time.Ticker
 	endPublish             chan struct{}
 	publishMetricsInterval time.Duration
@@ -48,10 +48,13 @@ type clientServer struct {
 
 // New returns a client/server to bidirectionally communicate with the backend.
 // The returned struct should have both 'Connect' and 'Serve' called upon it
-// before being used.
-func New(url string, region string, credentialProvider *credentials.Credentials, acceptInvalidCert bool, statsEngine stats.Engine, publishMetricsInterval time.Duration) wsclient.ClientServer {
+// before being used. Metrics are published through publishBuffer, which should
+// be shared by the clients of successive connections so that metrics which
+// weren't acknowledged are sent again.
+func New(url string, region string, credentialProvider *credentials.Credentials, acceptInvalidCert bool, statsEngine stats.Engine, publishBuffer *PublishBuffer, publishMetricsInterval time.Duration) wsclient.ClientServer {
 	cs := &clientServer{
 		statsEngine:            statsEngine,
+		publishBuffer:          publishBuffer,
 		publishTicker:          nil,
 		publishMetricsInterval: publishMetricsInterval,
 	}
@@ -78,6 +81,9 @@ func (cs *clientServer) Serve() error {
 		return fmt.Errorf("uninitialized stats engine")
 	}
 
+	// Requests which weren't acked on the previous connection are sent first.
+	cs.publishBuffer.reconnected()
+
 	// Start the timer function to publish metrics to the backend.
 	cs.publishTicker = time.NewTicker(cs.publishMetricsInterval)
 	cs.endPublish = make(chan struct{})
@@ -99,7 +105,7 @@ func (cs *clientServer) MakeRequest(input interface{}) error {
 
 	// Over the wire we send something like
 	// {"type":"AckRequest","message":{"messageId":"xyz"}}
-	return cs.Conn.WriteMessage(websocket.TextMessage, data)
+	return cs.WriteMessage(data)
 }
 
 func (cs *clientServer) signRequest(payload []byte) []byte {
@@ -155,16 +161,22 @@ func (cs *clientServer) publishMetrics() {
 }
 
 // publishMetricsOnce is invoked by the ticker to periodically publish metrics to backend.
+// Requests are buffered until they're acked, and any which couldn't be sent are
+// sent again, before newer ones, on the next call.
 func (cs *clientServer) publishMetricsOnce() {
 	// Get the list of objects to send to backend.
 	requests, err := cs.metricsToPublishMetricRequests()
 	if err != nil {
 		log.Warn("Error getting instance metrics", "err", err)
 	}
+	cs.publishBuffer.add(requests)
 
 	// Make the publish metrics request to the backend.
-	for _, request := range requests {
-		cs.MakeRequest(request)
+	err = cs.publishBuffer.flush(func(request *ecstcs.PublishMetricsRequest) error {
+		return cs.MakeRequest(request)
+	})
+	if err != nil {
+		log.Warn("Error publishing metrics; they will be sent again", "err", err)
 	}
 }
 
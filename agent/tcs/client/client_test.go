@@ -26,11 +26,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/amazon-ecs-agent/agent/stats"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
 	"github.com/aws/amazon-ecs-agent/agent/wsclient"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/gorilla/websocket"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -77,6 +79,22 @@ func (engine *mockStatsEngine) GetInstanceMetrics() (*ecstcs.MetricsMetadata, []
 	return nil, nil, fmt.Errorf("uninitialized")
 }
 
+func (engine *mockStatsEngine) GetContainerUsage() []stats.ContainerUsage {
+	return nil
+}
+
+func (engine *mockStatsEngine) GetTaskUsage() []stats.TaskUsage {
+	return nil
+}
+
+func (engine *mockStatsEngine) TaskUsageEvents(ctx context.Context) <-chan stats.TaskUsageEvent {
+	return nil
+}
+
+func (engine *mockStatsEngine) GetAlerts() []stats.Alert {
+	return nil
+}
+
 type idleStatsEngine struct{}
 
 func (engine *idleStatsEngine) GetInstanceMetrics() (*ecstcs.MetricsMetadata, []*ecstcs.TaskMetric, error) {
@@ -89,6 +107,22 @@ func (engine *idleStatsEngine) GetInstanceMetrics() (*ecstcs.MetricsMetadata, []
 	return metadata, []*ecstcs.TaskMetric{}, nil
 }
 
+func (engine *idleStatsEngine) GetContainerUsage() []stats.ContainerUsage {
+	return nil
+}
+
+func (engine *idleStatsEngine) GetTaskUsage() []stats.TaskUsage {
+	return nil
+}
+
+func (engine *idleStatsEngine) TaskUsageEvents(ctx context.Context) <-chan stats.TaskUsageEvent {
+	return nil
+}
+
+func (engine *idleStatsEngine) GetAlerts() []stats.Alert {
+	return nil
+}
+
 type nonIdleStatsEngine struct {
 	numTasks int
 }
@@ -109,6 +143,22 @@ func (engine *nonIdleStatsEngine) GetInstanceMetrics() (*ecstcs.MetricsMetadata,
 	return metadata, taskMetrics, nil
 }
 
+func (engine *nonIdleStatsEngine) GetContainerUsage() []stats.ContainerUsage {
+	return nil
+}
+
+func (engine *nonIdleStatsEngine) GetTaskUsage() []stats.TaskUsage {
+	return nil
+}
+
+func (engine *nonIdleStatsEngine) TaskUsageEvents(ctx context.Context) <-chan stats.TaskUsageEvent {
+	return nil
+}
+
+func (engine *nonIdleStatsEngine) GetAlerts() []stats.Alert {
+	return nil
+}
+
 func newNonIdleStatsEngine(numTasks int) *nonIdleStatsEngine {
 	return &nonIdleStatsEngine{numTasks: numTasks}
 }
@@ -151,6 +201,25 @@ func TestPublishMetricsRequest(t *testing.T) {
 	cs.Close()
 }
 
+func TestPublishMetricsOnceBuffersUnsent(t *testing.T) {
+	cs, ml := testCS()
+	cs.(*clientServer).statsEngine = &idleStatsEngine{}
+	ml.closed = true
+	cs.(*clientServer).publishMetricsOnce()
+	if len(ml.writes) != 0 {
+		t.Fatalf("Expected nothing to be written to a closed websocket, got %d writes", len(ml.writes))
+	}
+
+	ml.closed = false
+	cs.(*clientServer).publishMetricsOnce()
+	if len(ml.writes) != 2 {
+		t.Errorf("Expected the unsent request to be sent with the new one, got %d writes", len(ml.writes))
+	}
+	if cs.(*clientServer).publishBuffer.Len() != 2 {
+		t.Errorf("Expected both requests to be kept until acked, got %d", cs.(*clientServer).publishBuffer.Len())
+	}
+}
+
 func TestPublishOnceIdleStatsEngine(t *testing.T) {
 	cs := clientServer{
 		statsEngine: &idleStatsEngine{},
@@ -207,7 +276,7 @@ func TestPublishOnceNonIdleStatsEngine(t *testing.T) {
 
 func testCS() (wsclient.ClientServer, *messageLogger) {
 	testCreds := credentials.AnonymousCredentials
-	cs := New("localhost:443", "us-east-1", testCreds, true, &mockStatsEngine{}, testPublishMetricsInterval).(*clientServer)
+	cs := New("localhost:443", "us-east-1", testCreds, true, &mockStatsEngine{}, NewPublishBuffer(time.Minute), testPublishMetricsInterval).(*clientServer)
 	ml := &messageLogger{make([][]byte, 0), make([][]byte, 0), false}
 	cs.Conn = ml
 	return cs, ml
@@ -0,0 +1,168 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tcsclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+)
+
+// maxBufferedPublishRequests bounds the number of requests kept in a
+// PublishBuffer; the oldest are dropped first. With a request for every 10
+// tasks published every 20 seconds, it covers several minutes of an instance
+// running hundreds of tasks.
+const maxBufferedPublishRequests = 1000
+
+const (
+	dropReasonExpired  = "expired"
+	dropReasonOverflow = "overflow"
+)
+
+// PublishBuffer keeps PublishMetricsRequests until they're acknowledged by the
+// backend, so that metrics aren't lost when publishing them fails or the
+// connection is reset. It outlives the connections made by the client.
+//
+// The AckPublishMetric sent by TCS for every message it processes doesn't
+// identify the message, so acks are matched with sent requests in order.
+// Requests sent on a connection which is closed before they're acked are sent
+// again on the next one, so the backend may see them twice.
+type PublishBuffer struct {
+	retention  time.Duration
+	maxEntries int
+
+	lock sync.Mutex
+	// entries are the requests not yet acked, oldest first.
+	entries []*bufferedRequest
+	// sent is the number of entries, from the front, sent on the current
+	// connection.
+	sent int
+}
+
+type bufferedRequest struct {
+	request    *ecstcs.PublishMetricsRequest
+	bufferedAt time.Time
+}
+
+// NewPublishBuffer creates a PublishBuffer which drops requests once they
+// have been kept for longer than retention. A zero retention keeps requests
+// until the buffer is full.
+func NewPublishBuffer(retention time.Duration) *PublishBuffer {
+	return &PublishBuffer{
+		retention:  retention,
+		maxEntries: maxBufferedPublishRequests,
+	}
+}
+
+// Len returns the number of requests which haven't been acked.
+func (buffer *PublishBuffer) Len() int {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	return len(buffer.entries)
+}
+
+// Ack drops the oldest request sent on the current connection.
+func (buffer *PublishBuffer) Ack() {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	if buffer.sent == 0 {
+		log.Debug("Received an ack without an outstanding metrics request")
+		return
+	}
+	buffer.entries = buffer.entries[1:]
+	buffer.sent--
+}
+
+// add appends requests to the buffer, dropping the oldest ones if it's full
+// and any which have expired.
+func (buffer *PublishBuffer) add(requests []*ecstcs.PublishMetricsRequest) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	now := ttime.Now()
+	for _, request := range requests {
+		buffer.entries = append(buffer.entries, &bufferedRequest{request: request, bufferedAt: now})
+	}
+	if buffer.retention > 0 {
+		expired := 0
+		for expired < len(buffer.entries) && now.Sub(buffer.entries[expired].bufferedAt) > buffer.retention {
+			expired++
+		}
+		buffer.drop(expired, dropReasonExpired)
+	}
+	if len(buffer.entries) > buffer.maxEntries {
+		buffer.drop(len(buffer.entries)-buffer.maxEntries, dropReasonOverflow)
+	}
+}
+
+// drop drops the oldest n requests. The lock must be held by the caller.
+func (buffer *PublishBuffer) drop(n int, reason string) {
+	if n == 0 {
+		return
+	}
+	log.Warn("Dropping metrics which weren't acknowledged by the backend", "requests", n, "reason", reason)
+	metrics.TelemetryRequestsDropped.Add(float64(n), reason)
+	buffer.entries = buffer.entries[n:]
+	buffer.sent -= n
+	if buffer.sent < 0 {
+		buffer.sent = 0
+	}
+}
+
+// flush sends the requests not yet sent on the current connection, in order,
+// until send fails. Requests which couldn't be sent are tried again on the
+// next flush. The buffer isn't locked while sending, so that acks and new
+// requests aren't held up by a slow connection; the requests are marked as
+// sent beforehand, so that their acks may arrive before send returns.
+func (buffer *PublishBuffer) flush(send func(*ecstcs.PublishMetricsRequest) error) error {
+	buffer.lock.Lock()
+	pending := make([]*bufferedRequest, len(buffer.entries)-buffer.sent)
+	copy(pending, buffer.entries[buffer.sent:])
+	buffer.sent = len(buffer.entries)
+	buffer.lock.Unlock()
+
+	for i, entry := range pending {
+		err := send(entry.request)
+		if err != nil {
+			buffer.unsent(pending[i:])
+			return err
+		}
+	}
+	return nil
+}
+
+// unsent marks requests which couldn't be sent as unsent again. They're the
+// last ones marked as sent on the current connection, unless it was replaced
+// or they were dropped in the meantime.
+func (buffer *PublishBuffer) unsent(entries []*bufferedRequest) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	for i := len(entries) - 1; i >= 0 && buffer.sent > 0 && buffer.entries[buffer.sent-1] == entries[i]; i-- {
+		buffer.sent--
+	}
+}
+
+// reconnected marks every request as unsent, so that the ones which weren't
+// acked on the previous connection are sent again.
+func (buffer *PublishBuffer) reconnected() {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	if len(buffer.entries) > 0 {
+		log.Info("Replaying metrics which weren't acknowledged by the backend", "requests", len(buffer.entries))
+	}
+	buffer.sent = 0
+}
@@ -0,0 +1,141 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tcsclient
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
+	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func testPublishRequests(messageIds ...string) []*ecstcs.PublishMetricsRequest {
+	var requests []*ecstcs.PublishMetricsRequest
+	for _, messageId := range messageIds {
+		requests = append(requests, ecstcs.NewPublishMetricsRequest(&ecstcs.MetricsMetadata{MessageId: aws.String(messageId)}, nil))
+	}
+	return requests
+}
+
+// flushMessageIds flushes the buffer and returns the message ids sent.
+func flushMessageIds(t *testing.T, buffer *PublishBuffer) string {
+	var sent []string
+	err := buffer.flush(func(request *ecstcs.PublishMetricsRequest) error {
+		sent = append(sent, *request.Metadata.MessageId)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(sent, ",")
+}
+
+func TestPublishBufferAckAndReplay(t *testing.T) {
+	buffer := NewPublishBuffer(time.Minute)
+	buffer.add(testPublishRequests("m1", "m2", "m3"))
+	if sent := flushMessageIds(t, buffer); sent != "m1,m2,m3" {
+		t.Errorf("Unexpected requests sent: %s", sent)
+	}
+	if sent := flushMessageIds(t, buffer); sent != "" {
+		t.Errorf("Expected nothing to be sent twice on a connection, got: %s", sent)
+	}
+
+	buffer.Ack()
+	if buffer.Len() != 2 {
+		t.Errorf("Expected the acked request to be dropped, %d left", buffer.Len())
+	}
+
+	// Requests which weren't acked are sent again, in order, after reconnecting
+	buffer.reconnected()
+	buffer.add(testPublishRequests("m4"))
+	if sent := flushMessageIds(t, buffer); sent != "m2,m3,m4" {
+		t.Errorf("Unexpected requests sent after reconnecting: %s", sent)
+	}
+	buffer.Ack()
+	buffer.Ack()
+	buffer.Ack()
+	buffer.Ack()
+	if buffer.Len() != 0 {
+		t.Errorf("Expected every request to be acked, %d left", buffer.Len())
+	}
+}
+
+func TestPublishBufferSendFailure(t *testing.T) {
+	buffer := NewPublishBuffer(time.Minute)
+	buffer.add(testPublishRequests("m1", "m2"))
+	sendErr := errors.New("connection reset")
+	err := buffer.flush(func(request *ecstcs.PublishMetricsRequest) error {
+		if *request.Metadata.MessageId == "m2" {
+			return sendErr
+		}
+		return nil
+	})
+	if err != sendErr {
+		t.Errorf("Expected the send error, got: %v", err)
+	}
+	if sent := flushMessageIds(t, buffer); sent != "m2" {
+		t.Errorf("Expected the request which failed to be sent again, got: %s", sent)
+	}
+}
+
+func TestPublishBufferDrops(t *testing.T) {
+	testTime := ttime.NewTestTime()
+	ttime.SetTime(testTime)
+	defer ttime.SetTime(&ttime.DefaultTime{})
+
+	buffer := NewPublishBuffer(time.Minute)
+	buffer.add(testPublishRequests("m1"))
+	flushMessageIds(t, buffer)
+	testTime.Warp(2 * time.Minute)
+	buffer.add(testPublishRequests("m2"))
+	// The ack of the expired request is ignored
+	buffer.Ack()
+	if buffer.Len() != 1 {
+		t.Errorf("Expected only the unexpired request to be kept, %d left", buffer.Len())
+	}
+	if sent := flushMessageIds(t, buffer); sent != "m2" {
+		t.Errorf("Unexpected requests sent: %s", sent)
+	}
+
+	buffer = NewPublishBuffer(time.Minute)
+	buffer.maxEntries = 2
+	buffer.add(testPublishRequests("m1", "m2", "m3"))
+	if sent := flushMessageIds(t, buffer); sent != "m2,m3" {
+		t.Errorf("Expected the oldest request to be dropped, got: %s", sent)
+	}
+}
+
+func TestPublishBufferSendsUnlocked(t *testing.T) {
+	buffer := NewPublishBuffer(time.Minute)
+	buffer.add(testPublishRequests("m1", "m2"))
+	err := buffer.flush(func(request *ecstcs.PublishMetricsRequest) error {
+		// Acks and new requests may come in while sending
+		buffer.add(testPublishRequests("n" + *request.Metadata.MessageId))
+		buffer.Ack()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buffer.Len() != 2 {
+		t.Errorf("Expected both sent requests to be acked, %d left", buffer.Len())
+	}
+	if sent := flushMessageIds(t, buffer); sent != "nm1,nm2" {
+		t.Errorf("Expected the requests added while sending to be sent next, got: %s", sent)
+	}
+}
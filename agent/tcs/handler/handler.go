@@ -19,7 +19,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/aws/amazon-ecs-agent/agent/health"
 	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
 	"github.com/aws/amazon-ecs-agent/agent/stats"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/client"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
@@ -40,29 +42,27 @@ const (
 
 var log = logger.ForModule("tcs handler")
 
-// StartMetricsSession starts a metric session. It initializes the stats engine
-// and invokes StartSession.
-func StartMetricsSession(params TelemetrySessionParams) {
+// ConnectionStatus tracks the state of the connection to TCS for health
+// reporting.
+var ConnectionStatus = health.NewConnectionTracker()
+
+// StartMetricsSession starts a metric session publishing the metrics of the
+// given stats engine, which must be initialized, unless telemetry is disabled.
+func StartMetricsSession(params TelemetrySessionParams, statsEngine stats.Engine) {
 	disabled, err := params.isTelemetryDisabled()
 	if err != nil {
 		log.Warn("Error getting telemetry config", "err", err)
 		return
 	}
 
-	if !disabled {
-		statsEngine := stats.NewDockerStatsEngine(params.Cfg)
-		err := statsEngine.MustInit(params.TaskEngine, params.Cfg.Cluster, params.ContainerInstanceArn)
-		if err != nil {
-			log.Warn("Error initializing metrics engine", "err", err)
-			return
-		}
-		err = StartSession(params, statsEngine)
-		if err != nil {
-			log.Warn("Error starting metrics session with backend", "err", err)
-			return
-		}
-	} else {
-		log.Info("Metric collection disabled")
+	if disabled {
+		log.Info("Metric publishing disabled")
+		return
+	}
+	err = StartSession(params, statsEngine)
+	if err != nil {
+		log.Warn("Error starting metrics session with backend", "err", err)
+		return
 	}
 }
 
@@ -72,8 +72,10 @@ func StartMetricsSession(params TelemetrySessionParams) {
 // the time the websocket client starts using it.
 func StartSession(params TelemetrySessionParams, statsEngine stats.Engine) error {
 	backoff := utils.NewSimpleBackoff(time.Second, 1*time.Minute, 0.2, 2)
+	// Metrics which weren't acked are kept across connections
+	publishBuffer := tcsclient.NewPublishBuffer(params.Cfg.TelemetryBufferRetention)
 	for {
-		tcsError := startTelemetrySession(params, statsEngine)
+		tcsError := startTelemetrySession(params, statsEngine, publishBuffer)
 		if tcsError == nil || tcsError == io.EOF {
 			backoff.Reset()
 		} else {
@@ -83,7 +85,7 @@ func StartSession(params TelemetrySessionParams, statsEngine stats.Engine) error
 	}
 }
 
-func startTelemetrySession(params TelemetrySessionParams, statsEngine stats.Engine) error {
+func startTelemetrySession(params TelemetrySessionParams, statsEngine stats.Engine, publishBuffer *tcsclient.PublishBuffer) error {
 	tcsEndpoint, err := params.EcsClient.DiscoverTelemetryEndpoint(params.ContainerInstanceArn)
 	if err != nil {
 		log.Error("Unable to discover poll endpoint", "err", err)
@@ -91,11 +93,11 @@ func startTelemetrySession(params TelemetrySessionParams, statsEngine stats.Engi
 	}
 	log.Debug("Connecting to TCS endpoint " + tcsEndpoint)
 	url := formatURL(tcsEndpoint, params.Cfg.Cluster, params.ContainerInstanceArn)
-	return startSession(url, params.Cfg.AWSRegion, params.CredentialProvider, params.AcceptInvalidCert, statsEngine, defaultPublishMetricsInterval)
+	return startSession(url, params.Cfg.AWSRegion, params.CredentialProvider, params.AcceptInvalidCert, statsEngine, publishBuffer, defaultPublishMetricsInterval)
 }
 
-func startSession(url string, region string, credentialProvider *credentials.Credentials, acceptInvalidCert bool, statsEngine stats.Engine, publishMetricsInterval time.Duration) error {
-	client := tcsclient.New(url, region, credentialProvider, acceptInvalidCert, statsEngine, publishMetricsInterval)
+func startSession(url string, region string, credentialProvider *credentials.Credentials, acceptInvalidCert bool, statsEngine stats.Engine, publishBuffer *tcsclient.PublishBuffer, publishMetricsInterval time.Duration) error {
+	client := tcsclient.New(url, region, credentialProvider, acceptInvalidCert, statsEngine, publishBuffer, publishMetricsInterval)
 
 	defer client.Close()
 
@@ -110,12 +112,15 @@ func startSession(url string, region string, credentialProvider *credentials.Cre
 	})
 	defer timer.Stop()
 	client.AddRequestHandler(heartbeatHandler(timer))
-	client.AddRequestHandler(ackPublishMetricHandler(timer))
+	client.AddRequestHandler(ackPublishMetricHandler(timer, publishBuffer))
 	err := client.Connect()
 	if err != nil {
 		log.Error("Error connecting to TCS: " + err.Error())
 		return err
 	}
+	ConnectionStatus.Connected()
+	metrics.BackendConnections.Inc("tcs")
+	defer ConnectionStatus.Disconnected()
 	return client.Serve()
 }
 
@@ -123,15 +128,19 @@ func startSession(url string, region string, credentialProvider *credentials.Cre
 func heartbeatHandler(timer *time.Timer) func(*ecstcs.HeartbeatMessage) {
 	return func(*ecstcs.HeartbeatMessage) {
 		log.Debug("Received HeartbeatMessage from tcs")
+		ConnectionStatus.MessageReceived()
 		timer.Reset(utils.AddJitter(heartbeatTimeout, heartbeatJitter))
 	}
 }
 
 // ackPublishMetricHandler consumes the ack message from the backend. THe backend sends
-// the ack each time it processes a metric message.
-func ackPublishMetricHandler(timer *time.Timer) func(*ecstcs.AckPublishMetric) {
+// the ack each time it processes a metric message, which can then be dropped from
+// the publish buffer.
+func ackPublishMetricHandler(timer *time.Timer, publishBuffer *tcsclient.PublishBuffer) func(*ecstcs.AckPublishMetric) {
 	return func(*ecstcs.AckPublishMetric) {
 		log.Debug("Received AckPublishMetric from tcs")
+		ConnectionStatus.MessageReceived()
+		publishBuffer.Ack()
 		timer.Reset(utils.AddJitter(heartbeatTimeout, heartbeatJitter))
 	}
 }
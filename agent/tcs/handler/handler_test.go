@@ -23,12 +23,14 @@ import (
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/api/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/stats"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/client"
 	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
 	"github.com/aws/amazon-ecs-agent/agent/wsclient"
 	"github.com/aws/amazon-ecs-agent/agent/wsclient/mock/utils"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/golang/mock/gomock"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -47,6 +49,22 @@ func (engine *mockStatsEngine) GetInstanceMetrics() (*ecstcs.MetricsMetadata, []
 	return req.Metadata, req.TaskMetrics, nil
 }
 
+func (engine *mockStatsEngine) GetContainerUsage() []stats.ContainerUsage {
+	return nil
+}
+
+func (engine *mockStatsEngine) GetTaskUsage() []stats.TaskUsage {
+	return nil
+}
+
+func (engine *mockStatsEngine) TaskUsageEvents(ctx context.Context) <-chan stats.TaskUsageEvent {
+	return nil
+}
+
+func (engine *mockStatsEngine) GetAlerts() []stats.Alert {
+	return nil
+}
+
 func TestFormatURL(t *testing.T) {
 	endpoint := "http://127.0.0.0.1/"
 	wsurl := formatURL(endpoint, testClusterArn, testInstanceArn)
@@ -85,7 +103,7 @@ func TestStartSession(t *testing.T) {
 	}()
 
 	// Start a session with the test server.
-	go startSession(server.URL, "us-east-1", credentials.AnonymousCredentials, true, &mockStatsEngine{}, testPublishMetricsInterval)
+	go startSession(server.URL, "us-east-1", credentials.AnonymousCredentials, true, &mockStatsEngine{}, tcsclient.NewPublishBuffer(time.Minute), testPublishMetricsInterval)
 
 	// startSession internally starts publishing metrics from the mockStatsEngine object.
 	time.Sleep(testPublishMetricsInterval)
@@ -128,7 +146,7 @@ func TestSessionConenctionClosedByRemote(t *testing.T) {
 	}()
 
 	// Start a session with the test server.
-	err = startSession(server.URL, "us-east-1", credentials.AnonymousCredentials, true, &mockStatsEngine{}, testPublishMetricsInterval)
+	err = startSession(server.URL, "us-east-1", credentials.AnonymousCredentials, true, &mockStatsEngine{}, tcsclient.NewPublishBuffer(time.Minute), testPublishMetricsInterval)
 
 	if err == nil {
 		t.Error("Expected io.EOF on closed connection")
@@ -145,7 +163,7 @@ func TestDiscoverEndpointAndStartSession(t *testing.T) {
 	mockEcs := mock_api.NewMockECSClient(ctrl)
 	mockEcs.EXPECT().DiscoverTelemetryEndpoint(gomock.Any()).Return("", errors.New("error"))
 
-	err := startTelemetrySession(TelemetrySessionParams{EcsClient: mockEcs}, nil)
+	err := startTelemetrySession(TelemetrySessionParams{EcsClient: mockEcs}, nil, nil)
 	if err == nil {
 		t.Error("Expected error from startTelemetrySession when DiscoverTelemetryEndpoint returns error")
 	}
@@ -18,7 +18,6 @@ import (
 
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/config"
-	"github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 )
 
@@ -28,7 +27,6 @@ type TelemetrySessionParams struct {
 	Cfg                  *config.Config
 	AcceptInvalidCert    bool
 	EcsClient            api.ECSClient
-	TaskEngine           engine.TaskEngine
 }
 
 func (params *TelemetrySessionParams) isTelemetryDisabled() (bool, error) {
@@ -0,0 +1,36 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package atomic
+
+import "sync/atomic"
+
+// String is a string which can be set and read from different goroutines
+type String struct {
+	value atomic.Value
+}
+
+func NewString(initial string) *String {
+	s := &String{}
+	s.Set(initial)
+	return s
+}
+
+func (s *String) Get() string {
+	val, _ := s.value.Load().(string)
+	return val
+}
+
+func (s *String) Set(val string) {
+	s.value.Store(val)
+}
@@ -0,0 +1,48 @@
+// Copyright 2014-2015 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package atomic
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStringSetGet(t *testing.T) {
+	var zero String
+	if zero.Get() != "" {
+		t.Fatal("Zero value")
+	}
+
+	s := NewString("initial")
+	if s.Get() != "initial" {
+		t.Fatal("Initial value")
+	}
+
+	waitAllSet := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		waitAllSet.Add(2)
+		go func() {
+			s.Set("set")
+			waitAllSet.Done()
+		}()
+		go func() {
+			s.Get()
+			waitAllSet.Done()
+		}()
+	}
+	waitAllSet.Wait()
+	if s.Get() != "set" {
+		t.Fatal("Set", s.Get())
+	}
+}
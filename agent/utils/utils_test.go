@@ -77,6 +77,13 @@ func TestZeroOrNil(t *testing.T) {
 		t.Error("[] is Zero")
 	}
 
+	if !ZeroOrNil(map[string]string{}) {
+		t.Error("{} is Zero")
+	}
+	if ZeroOrNil(map[string]string{"a": "b"}) {
+		t.Error("{\"a\":\"b\"} is not zero")
+	}
+
 	if ZeroOrNil(struct{ uncomparable []uint16 }{uncomparable: []uint16{1, 2, 3}}) {
 		t.Error("Uncomparable structs are never zero")
 	}
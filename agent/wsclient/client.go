@@ -31,6 +31,7 @@ import (
 	"net/url"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/logger"
@@ -114,6 +115,10 @@ type ClientServerImpl struct {
 	AnyRequestHandler RequestHandler
 	// URL is the full url to the backend, including path, querystring, and so on.
 	URL string
+	// writeLock serializes writes to Conn, which doesn't support concurrent
+	// writers; acks and handler responses may be sent from different
+	// goroutines.
+	writeLock sync.Mutex
 	ClientServer
 	ServiceError
 	TypeDecoder
@@ -201,7 +206,15 @@ func (cs *ClientServerImpl) MakeRequest(input interface{}) error {
 
 	// Over the wire we send something like
 	// {"type":"AckRequest","message":{"messageId":"xyz"}}
-	return cs.Conn.WriteMessage(websocket.TextMessage, send)
+	return cs.WriteMessage(send)
+}
+
+// WriteMessage writes a text message to the connection. It's safe to call
+// from multiple goroutines.
+func (cs *ClientServerImpl) WriteMessage(data []byte) error {
+	cs.writeLock.Lock()
+	defer cs.writeLock.Unlock()
+	return cs.Conn.WriteMessage(websocket.TextMessage, data)
 }
 
 // ConsumeMessages reads messages from the websocket connection and handles read